@@ -18,6 +18,7 @@ The Library Management System provides backend functionality for:
 - User registration & authentication  
 - Managing books (CRUD, search, favorites)  
 - Loan operations (reserve, borrow, return, cancel)  
+- Book sales (cart, orders)  
 - Real-time & async workflows (RabbitMQ)
 - Redis caching and login rate limiting  
 - Clean architecture for maintainability  
@@ -32,6 +33,7 @@ The Library Management System provides backend functionality for:
 - ✔ Redis caching for book performance  
 - ✔ Redis-backed Token Bucket rate limiting  
 - ✔ RabbitMQ asynchronous reservation queue  
+- ✔ Domain events through a transactional outbox  
 - ✔ Dockerized deployment  
 - ✔ Configurable environment using Viper  
 
@@ -50,8 +52,14 @@ Handles:
 - Login  
 - Password hashing (bcrypt)  
 - Email uniqueness  
-- Role management (`member`, `student`)  
-- JWT generation  
+- Role management (`admin`, `librarian`, `member`, `student`; self sign-up only as member/student)  
+- Permission checks from the JWT `role` claim (`pkg/middleware/rbac.go`)  
+- First admin bootstrapped from `admin.*` config  
+- JWT generation (with `jti`)  
+- Refresh tokens stored as SHA-256 hashes, rotated on use; reuse of a rotated token revokes the whole family  
+- Logout (access token `jti` denylisted in Redis, in-memory fallback) and logout everywhere  
+- Changing a user's role or blocking them ends their sessions (access tokens denylisted, refresh tokens revoked)  
+- Password recovery with hashed, expiring, single-use tokens sent by mail (`pkg/mail`: SMTP or in-memory); rate limited; ends all sessions on reset  
 
 Repository:
 
@@ -75,15 +83,24 @@ Handler:
 Features:
 
 - CRUD for books  
-- Search (title/author)  
+- Per-copy inventory (`book_copies`: barcode, shelf, condition, status)  
+- Full-text search with relevance ranking (`internal/search`: MySQL FULLTEXT or in-memory index)
+  - fields: title, author, ISBN, tags, description
+  - field-scoped (`author:hedayat`, `isbn:978...`) and prefix (`shah*`) queries
+  - Persian/Arabic character and digit normalization  
+- Create a book from its ISBN (`internal/metadata`: file, Open Library and Google Books providers with fallback and Redis caching; ISBN-10/13 validation in `pkg/isbn`)
+- Bulk CSV/NDJSON import (upsert by ISBN, batched transactions, per-row error report; a failed batch is retried row by row so only the bad lines fail; `stock`, `sale_stock` and `selling_status` of existing books are ignored with a warning) and streaming export
+- MARC21/MARCXML import and export (`pkg/marc`, field mapping in `books.BookFromMARC`/`BookToMARC`, CLI in `cmd/marc`)
 - Favorite system  
+- Paginated listing with filters (genre, language, tags, year range, status, price range) and sorting; tags are stored as a comma-separated list trimmed on write, and a tag filter (e.g. `tags=science fiction,classic`) ignores spaces
+- Optimistic locking of edits: every book carries a `version`; `PUT /books/:id` with the version it was based on fails with 409 `VERSION_CONFLICT` if someone changed the book meanwhile; a request without `version` gets 428 `VERSION_REQUIRED`
 - Redis caching:
   - Cache for single book: `book:<id>`
-  - Cache for full list: `books:all`
+  - Cache per list query: `books:list:v<version>:<hash>`
 
 Cache invalidation:
 
-- On create/update/delete
+- On create/update/delete (`books:list:version` is bumped, old pages expire)
 
 Service:
 
@@ -99,7 +116,7 @@ Service:
 
 Implements the complete loan lifecycle:
 
-- Reserve book (async)
+- Reserve book (async); with no free copy the user joins a hold queue
 - Confirm borrow
 - Return book
 - Cancel reservation
@@ -107,10 +124,136 @@ Implements the complete loan lifecycle:
 All operations:
 
 - Are transactional (GORM transactions)
-- Update book stock  
+- Allocate and release a specific copy (`loans.copy_id`)  
+- Keep book stock in sync with available copies  
 - Update reservation status  
 - Track timestamps (`reserved_at`, `borrowed_at`, `due_date`, etc.)
 
+Reservation queue (`pkg/rabbitmq`):
+
+- `POST /api/loans/reserve` publishes to `reserve_requests`; a consumer calls `ReserveBook`
+- The client watches the connection and its channels; on loss it reconnects with exponential backoff (0.5s doubling to 30s, with jitter), declares the queue again and restarts the consumer
+- Failed requests are classified: `transient` (database errors, timeouts) are retried through TTL queues `reserve_requests.retry.<delay>` with exponential backoff (`rabbitmq.retry_delays`, attempt count in the `x-attempts` header); `rejected` (no stock, over limit, blocked, already reserved) and `permanent` (malformed, unknown book or user) are not retried
+- Requests out of attempts or not retryable go to `reserve_requests.dead` with the error and its class in headers; staff list, replay or discard them under `/api/loans/dead-letters`
+- The consumer records each message ID in `processed_messages` in the transaction of the reservation, so a redelivered message (e.g. after a crash before the ack) is acknowledged without reserving twice; a failed attempt rolls the record back and stays retryable
+- Each request is recorded in `reservation_requests` under a correlation ID, returned in the 202 (`request_id`, `status_url`, `events_url`) and carried as the message's `correlation_id`; its status goes `pending` → `retrying` → `succeeded` (with the loan or hold) or `failed` (with the error and its class). A redelivered message of a succeeded request is not reserved twice
+- `GET /api/loans/requests/:id/events` is a Server-Sent Events stream of `status` events: the current state, then each change until the request succeeds or fails (`timeout` after 5 minutes, keep-alive comments every 15s). `EventSource` cannot send headers, so the token may be passed as `?access_token=`. Updates go through Redis pub/sub, so any instance can serve the stream; without Redis only the local one
+- While disconnected, reserve requests get 503 instead of failing silently, and `GET /healthz` reports `rabbitmq.state` (`connected`, `reconnecting`), the last error and the reconnect count, with status 503
+
+Hold queue (`holds` table):
+
+- FIFO per book, optionally ranked by role (`loans.hold_priorities`)
+- A returned/cancelled copy, or a new copy added by staff, goes to the head of the queue as a loan ready for pickup
+- Users see their position via `GET /api/loans/holds`
+
+Renewals (`POST /api/loans/:id/renew`):
+
+- Extends `due_date` by the policy's `renew_days`, at most `max_renewals` times
+- Refused when the loan is overdue, other users hold the book, or the user is blocked (`PUT /users/:id/block`)
+- Each renewal is recorded in `loan_renewals`
+
+Circulation policy (`internal/policy`):
+
+- Rules per role (`member`, `student`, `staff`, ...) and genre, from `circulation.rules` in the config or the `circulation_policies` table (`circulation.source: database`)
+- Defines loan period, max concurrent loans, max reservations (pickup-ready + queued holds), renewal period and limit, fine rate and cap
+- The most specific rule wins field by field; `circulation.default` fills the rest
+- Consulted by reserve, confirm and renew; errors `OVER_LIMIT` (422), `ALREADY_RESERVED` (409), `USER_BLOCKED` (403)
+
+Overdue and fines (`internal/fines`):
+
+- A job (every `fines.overdue_interval`, under a distributed lock) marks loans past `due_date` as `overdue` and accrues one fine per overdue day at the policy's `fine_per_day`, up to `fine_cap`
+- Returning an overdue loan accrues the remaining days
+- Ledger `fine_entries`: accruals, adjustments, waivers and payments; the balance is their sum
+- Users owing more than `fines.block_threshold` get `USER_BLOCKED` on reserve and renew
+
+Library calendar (`internal/calendar`):
+
+- Weekly opening hours and closures (`calendar.hours`) plus holidays stored in `holidays`, importable from iCalendar (.ics) files
+- Due dates and renewals roll forward to the next open day (due at closing time)
+- Closed days extend the pickup window and accrue no fines
+
+Pickup expiry:
+
+- A background worker expires reservations not confirmed within `loans.pickup_window` (status `expired`)
+- The copy goes back to stock or to the next hold
+- Runs every `loans.expiry_interval` under a distributed lock (`pkg/lock`, Redis `SET NX` or an in-process lock without Redis), so several server instances can run it
+
+---
+
+##  Idempotency Keys
+
+Mutating endpoints accept an `Idempotency-Key` header (up to 255 characters, e.g. a UUID per logical operation) so clients can retry after a timeout safely:
+
+- Keys are scoped to the authenticated user; the first response is stored and retries within `idempotency.window` (default 24h) get it again with `Idempotent-Replayed: true`, without running the operation
+- A retry while the first request is still running gets 409 `IDEMPOTENCY_IN_FLIGHT`; the same key with a different method, path or body gets 422 `IDEMPOTENCY_KEY_REUSED`
+- 5xx responses are not stored, so the operation can be retried with the same key; a request that never finishes frees its key after 2 minutes
+- Stored in Redis when enabled, otherwise in `idempotency_keys` (`pkg/idempotency`). Requests that meet a Redis error use `idempotency_keys` instead, and keys claimed in Redis are checked there too, so a retry after Redis recovers is still replayed; only when the database fails as well does the request get 503 rather than risk running twice
+- Applies to `POST /api/loans/reserve`, `POST /books`, `/books/import`, `/books/import/isbn`, `/books/:id/copies`, `POST /sales/orders`, `/sales/orders/:id/pay`, `/refund`, `/payments`, `POST /sales/promotions` and the fines payments, adjustments and waivers; requests without the header behave as before
+
+---
+
+##  Concurrency
+
+Stock is derived from copy rows, and every change to it happens inside one database transaction that locks what it reads:
+
+- Reservations, returns, cancellations, expiry and hold promotion lock the book row (`SELECT ... FOR UPDATE`) before they look at its copies, so requests for one book take turns and two readers can never both see the last copy
+- Copies change status with a conditional update (`available` → `reserved`, `for_sale` → `sold`); a copy that is no longer in the expected status is not taken and the request fails with no stock instead of overselling
+- Staff copy edits (add, update, delete) lock the book as well and only write a copy still in the status they read; otherwise they get 409 `COPY_CHANGED`
+- Checkout locks the user's cart and then all books of the cart in ID order; a second checkout of the same cart waits and then fails with "cart is empty". Sales orders are locked before they are paid, cancelled or refunded
+- Locks are always taken in the order loan → book → copies → holds, cart → books → promotions for checkout, and order → payments → books for sales, which keeps concurrent transactions from deadlocking
+- The tests in `tests/` (`make stock-check DB_DSN=...`, skipped unless `TEST_DB_DSN` is set) race many users reserving, buying and editing one book, and staff editing its copies, against a scratch database; they fail if a copy is handed out twice, stock goes negative or more than one edit of a version wins
+
+---
+
+##  Domain Events (Outbox)
+
+`internal/outbox` publishes state changes for other systems without writing to the broker inside a database transaction:
+
+- `loan.reserved` (also when a hold is promoted), `loan.borrowed`, `loan.returned`, `loan.cancelled`, `book.created`, `book.updated` (also from bulk import), `book.deleted`
+- The event is inserted into `outbox_events` in the same transaction as the change; a rolled-back change leaves no event, a committed one always has one
+- A relay (every `outbox.relay_interval`, one instance at a time under a distributed lock) publishes pending events in order to the durable topic exchange `library.events`, routed by event type (bind e.g. `loan.*`), on a channel in confirm mode, and marks them published only once the broker acks them
+- Unconfirmed events stay pending and go out again (`attempts`, `last_error` record failures): delivery is at least once, so consumers deduplicate on the message ID (`event_id`)
+- Message body: `{id, type, aggregate_type, aggregate_id, payload, occurred_at}`, the payload being the loan or book after the change
+- Published events are purged after `outbox.retention`
+
+---
+
+##  Sales Module
+
+Sells copies marked `for_sale` (set by staff on `/books/:id/copies`):
+
+- One cart per user, priced with current book prices
+- Checkout creates a `pending` order whose lines keep the price at purchase time and marks the copies `sold`
+- `Book.sale_stock` mirrors the copies for sale; `selling_status` flips to `sold_out` when the last one is sold
+- Status transitions: `pending` → `paid` | `cancelled`, `paid` → `refunded`; cancel and refund put the copies back on sale
+
+Promotions (`internal/promotions`):
+
+- Percentage or fixed discounts, automatic (no code) or behind a coupon code entered on the cart
+- Scoped by genre, tag, user role (e.g. a student price) and a minimum subtotal; validity dates; total and per-user usage limits
+- Stacking: of the exclusive promotions only the one taking off the most applies; stackable ones are then applied in priority order (percentages first) on what is left; a fixed amount is spread over the lines it covers
+- The cart shows the discounts (and `coupon_error` when its coupon stopped applying); checkout refuses an invalid coupon with `COUPON_INVALID`, `COUPON_EXPIRED`, `COUPON_USED_UP` or `COUPON_NOT_APPLICABLE` (422)
+- Orders keep `subtotal`, `discount` and the applied promotions (`order_discounts`); uses are counted atomically in `promotion_redemptions`, with the promotion row locked while the per-user limit is checked, and given back when the order is cancelled
+
+Payments:
+
+- `sales.Gateway` interface: create intent, capture, refund, lookup, webhook verification
+- `POST /sales/payments/webhook/:provider` is idempotent: each provider event id is applied once (`payment_events`)
+- Authorized payments are captured, then the order is marked paid; money arriving for a cancelled or already paid order is refunded
+- A reconciler (every `payments.reconcile_interval`) asks the provider about payments still pending after `payments.reconcile_after`, e.g. when a webhook was lost
+- Webhooks and the reconciler lock the order and the payment and re-check its status before capturing or refunding, so the same payment is never acted on twice; a staff refund marks the order refunded under the same locks before calling the provider, and is rolled back if the provider fails
+- `payments.provider: fake` is a local gateway with HMAC-signed webhooks; `/sales/payments/fake/:ref/simulate` plays success, failure, delayed, duplicated or dropped webhooks
+
+Invoices and receipts (`internal/invoices`):
+
+- Issued on first download for a paid order (`INV-<year>-000001`) or a fine payment (`RCT-<year>-000001`); numbers come from a locked per-series, per-year counter (`invoice_sequences`) so they have no gaps
+- Lines, prices and taxes are copied into `invoices` once issued and never change
+- Ownership is checked before an invoice is issued: members asking for someone else's order or fine payment get 404, and no number is used up
+- Sale prices include the taxes in `invoices.taxes` (e.g. VAT 10%); the invoice splits each line into net amount and tax lines, fines are not taxed
+- `?format=pdf` (default), `html` or `json`; `?lang=fa|en` (default `invoices.language`)
+- Persian (`fa`): Persian digits and separators, amounts in ریال, Jalali dates, right-to-left HTML
+- PDFs are written by `pkg/pdf` in DejaVu Sans (embedded, subset per document, licence in `pkg/pdf/fonts/LICENSE`); Arabic script is shaped and right-to-left text reordered, and Persian invoices are laid out right to left like the HTML version
+
 ---
 
 ---
@@ -123,23 +266,101 @@ All operations:
 
 POST /users/signup
 POST /users/login
+POST /users/refresh
+POST /users/password/forgot
+POST /users/password/reset
+POST /users/logout       (JWT)
+POST /users/logout/all   (JWT)
+POST /users              (admin)
+PUT  /users/:id/role     (admin)
+PUT  /users/:id/block    (admin)
+DELETE /users/:id/block  (admin)
 
 ## Books
 
+Catalogue writes (create/update/delete, copies, import/export) require a staff token (admin or librarian).
+
 POST   /books
+POST   /books/import            (?format=csv|ndjson|marc21|marcxml, raw body or multipart "file")
+POST   /books/import/isbn
+GET    /books/export            (?format=csv|ndjson|marc21|marcxml)
 GET    /books
 GET    /books/:id
-PUT    /books/:id
+PUT    /books/:id               (body must carry "version": 428 if missing, 409 if stale)
 DELETE /books/:id
 GET    /books/search
+GET    /books/:id/copies
+POST   /books/:id/copies
+GET    /books/:id/copies/:copy_id
+PUT    /books/:id/copies/:copy_id
+DELETE /books/:id/copies/:copy_id
 POST   /books/:id/favorite/:user_id
 GET    /books/favorites/:user_id
 
+## Calendar
+
+GET    /api/calendar
+POST   /api/calendar/holidays              (staff) {date, name}
+DELETE /api/calendar/holidays/:date        (staff)
+POST   /api/calendar/holidays/import       (staff) .ics body or multipart "file"
+
+## Fines (JWT Required)
+
+GET  /api/fines/me
+GET  /api/fines/user/:userID                (self or staff)
+POST /api/fines/user/:userID/payments       (staff)
+POST /api/fines/user/:userID/adjustments    (staff, note required)
+POST /api/fines/user/:userID/waivers        (staff, note required)
+GET  /api/fines/payments/:id/receipt        (owner or staff) ?format=pdf|html|json&lang=fa|en
+
 ## Loans (JWT Required)
 
-POST /api/loans/reserve
+Confirm and return are staff only; members may cancel only their own reservations.
+
+POST /api/loans/reserve                  → 202 {request_id, status, status_url, events_url}
+GET  /api/loans/requests                 (caller's latest requests)
+GET  /api/loans/requests/:id             (owner or staff)
+GET  /api/loans/requests/:id/events      (SSE; owner or staff; ?access_token= accepted)
 POST /api/loans/:id/confirm
 POST /api/loans/:id/return
 POST /api/loans/:id/cancel
+POST /api/loans/:id/renew
+GET  /api/loans/:id/renewals
 GET  /api/loans/user/:userID
-
+GET  /api/loans/policy?genre=            (caller's effective limits)
+GET  /api/loans/policies                 (staff)
+POST /api/loans/policies/reload          (staff, database source)
+GET  /api/loans/holds
+POST /api/loans/holds/:id/cancel
+GET  /api/loans/holds/book/:bookID      (staff)
+GET  /api/loans/dead-letters?limit=      (staff)
+POST /api/loans/dead-letters/replay      (staff) {message_ids}; empty replays all
+POST /api/loans/dead-letters/discard     (staff) {message_ids}
+
+## Sales (JWT Required)
+
+GET    /sales/cart
+PUT    /sales/cart/items              {book_id, quantity}
+DELETE /sales/cart/items/:bookID
+DELETE /sales/cart
+PUT    /sales/cart/coupon             {code}
+DELETE /sales/cart/coupon
+POST   /sales/orders                  (checkout)
+GET    /sales/orders?status=
+GET    /sales/orders/all              (staff)
+GET    /sales/orders/:id              (owner or staff)
+POST   /sales/orders/:id/cancel       (owner or staff, pending only)
+POST   /sales/orders/:id/pay          (staff)
+POST   /sales/orders/:id/refund       (staff)
+POST   /sales/orders/:id/payments     (owner or staff)
+GET    /sales/orders/:id/payments     (owner or staff)
+GET    /sales/orders/:id/invoice      (owner or staff, paid orders) ?format=pdf|html|json&lang=fa|en
+POST   /sales/payments/reconcile      (staff) ?older_than=
+POST   /sales/payments/fake/:ref/simulate   {outcome, delay, drop_webhook, duplicate}
+POST   /sales/payments/webhook/:provider    (no JWT, signed by the provider)
+GET    /sales/promotions              (staff)
+POST   /sales/promotions              (staff)
+GET    /sales/promotions/:id          (staff)
+PUT    /sales/promotions/:id          (staff)
+DELETE /sales/promotions/:id          (staff, never redeemed only)
+GET    /sales/promotions/:id/redemptions   (staff)
@@ -0,0 +1,132 @@
+// Command marc converts between MARC21, MARCXML and the NDJSON accepted by
+// POST /books/import.
+//
+//	marc convert -from marc21 -to marcxml records.mrc > records.xml
+//	marc dump -from marcxml records.xml
+//	marc books -from marc21 records.mrc > books.ndjson
+//	marc marc -to marc21 books.ndjson > records.mrc
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	books "github.com/erfnzmn/Library_Management_System/internal/books"
+	"github.com/erfnzmn/Library_Management_System/pkg/marc"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage: marc <command> [flags] [file]
+
+commands:
+  convert  -from marc21|marcxml -to marc21|marcxml   convert between MARC encodings
+  dump     -from marc21|marcxml                      print records in a readable form
+  books    -from marc21|marcxml                      map records to book NDJSON
+  marc     -to marc21|marcxml                        map book NDJSON to MARC records
+
+with no file, input is read from stdin`)
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd := os.Args[1]
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	from := fs.String("from", marc.FormatMARC21, "input format")
+	to := fs.String("to", marc.FormatMARCXML, "output format")
+	_ = fs.Parse(os.Args[2:])
+
+	in := io.Reader(os.Stdin)
+	if fs.NArg() > 0 {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	var err error
+	switch cmd {
+	case "convert":
+		err = convert(in, out, *from, *to)
+	case "dump":
+		err = eachRecord(in, *from, func(rec *marc.Record) error {
+			_, err := fmt.Fprintln(out, rec.String())
+			return err
+		})
+	case "books":
+		enc := json.NewEncoder(out)
+		err = eachRecord(in, *from, func(rec *marc.Record) error {
+			return enc.Encode(books.BookFromMARC(rec))
+		})
+	case "marc":
+		err = toMARC(in, out, *to)
+	default:
+		usage()
+	}
+	if err != nil {
+		out.Flush()
+		log.Fatal(err)
+	}
+}
+
+func eachRecord(in io.Reader, format string, fn func(*marc.Record) error) error {
+	rd, err := marc.NewFormatReader(format, in)
+	if err != nil {
+		return err
+	}
+	for {
+		rec, err := rd.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+}
+
+func convert(in io.Reader, out io.Writer, from, to string) error {
+	w, err := marc.NewFormatWriter(to, out)
+	if err != nil {
+		return err
+	}
+	if err := eachRecord(in, from, w.Write); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func toMARC(in io.Reader, out io.Writer, to string) error {
+	w, err := marc.NewFormatWriter(to, out)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(in)
+	for {
+		var b books.Book
+		if err := dec.Decode(&b); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if err := w.Write(books.BookToMARC(&b)); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
@@ -15,8 +17,22 @@ import (
 	"gorm.io/gorm"
 
 	books "github.com/erfnzmn/Library_Management_System/internal/books"
+	"github.com/erfnzmn/Library_Management_System/internal/calendar"
+	"github.com/erfnzmn/Library_Management_System/internal/fines"
+	"github.com/erfnzmn/Library_Management_System/internal/invoices"
 	loans "github.com/erfnzmn/Library_Management_System/internal/loans"
+	"github.com/erfnzmn/Library_Management_System/internal/metadata"
+	"github.com/erfnzmn/Library_Management_System/internal/outbox"
+	"github.com/erfnzmn/Library_Management_System/internal/policy"
+	"github.com/erfnzmn/Library_Management_System/internal/promotions"
+	"github.com/erfnzmn/Library_Management_System/internal/sales"
+	"github.com/erfnzmn/Library_Management_System/internal/search"
 	users "github.com/erfnzmn/Library_Management_System/internal/users"
+	"github.com/erfnzmn/Library_Management_System/pkg/events"
+	"github.com/erfnzmn/Library_Management_System/pkg/idempotency"
+	"github.com/erfnzmn/Library_Management_System/pkg/lock"
+	"github.com/erfnzmn/Library_Management_System/pkg/mail"
+	authmw "github.com/erfnzmn/Library_Management_System/pkg/middleware"
 	rabbitmq "github.com/erfnzmn/Library_Management_System/pkg/rabbitmq"
 	"github.com/erfnzmn/Library_Management_System/pkg/rate"
 	"github.com/erfnzmn/Library_Management_System/pkg/redisclient"
@@ -48,12 +64,104 @@ type Config struct {
 		Host     string `mapstructure:"host"`
 		Port     int    `mapstructure:"port"`
 		VHost    string `mapstructure:"vhost"`
+		// failed reservation requests are retried after each delay in turn
+		// (the last one repeating) until max_attempts, then dead-lettered
+		RetryDelays []string `mapstructure:"retry_delays"`
+		MaxAttempts int      `mapstructure:"max_attempts"`
 	} `mapstructure:"rabbitmq"`
 
 	JWT struct {
-		Secret    string `mapstructure:"secret"`
-		ExpiresIn string `mapstructure:"expires_in"`
+		Secret           string `mapstructure:"secret"`
+		ExpiresIn        string `mapstructure:"expires_in"`
+		RefreshExpiresIn string `mapstructure:"refresh_expires_in"`
 	} `mapstructure:"jwt"`
+
+	Mail struct {
+		Driver   string `mapstructure:"driver"` // smtp | memory
+		Host     string `mapstructure:"host"`
+		Port     int    `mapstructure:"port"`
+		Username string `mapstructure:"username"`
+		Password string `mapstructure:"password"`
+		From     string `mapstructure:"from"`
+	} `mapstructure:"mail"`
+
+	PasswordReset struct {
+		TTL string `mapstructure:"ttl"`
+		URL string `mapstructure:"url"`
+	} `mapstructure:"password_reset"`
+
+	// first admin, created on start-up when no admin exists yet
+	Admin struct {
+		Name     string `mapstructure:"name"`
+		Email    string `mapstructure:"email"`
+		Password string `mapstructure:"password"`
+	} `mapstructure:"admin"`
+
+	Search struct {
+		Engine         string `mapstructure:"engine"` // mysql | memory
+		ReindexOnStart bool   `mapstructure:"reindex_on_start"`
+	} `mapstructure:"search"`
+
+	Metadata struct {
+		Providers    []string `mapstructure:"providers"` // file | openlibrary | googlebooks, in fallback order
+		File         string   `mapstructure:"file"`
+		GoogleAPIKey string   `mapstructure:"google_api_key"`
+		CacheTTL     string   `mapstructure:"cache_ttl"`
+	} `mapstructure:"metadata"`
+
+	Loans struct {
+		// hold queue priority per role, higher is served first
+		HoldPriorities map[string]int `mapstructure:"hold_priorities"`
+		// reservations not confirmed within PickupWindow are expired
+		PickupWindow   string `mapstructure:"pickup_window"`
+		ExpiryInterval string `mapstructure:"expiry_interval"`
+	} `mapstructure:"loans"`
+
+	Idempotency struct {
+		// how long responses are replayed for a repeated Idempotency-Key
+		Window string `mapstructure:"window"`
+	} `mapstructure:"idempotency"`
+
+	// domain events are written to the outbox with each change and relayed
+	// to the library.events exchange
+	Outbox struct {
+		RelayInterval string `mapstructure:"relay_interval"`
+		BatchSize     int    `mapstructure:"batch_size"`
+		Retention     string `mapstructure:"retention"` // how long published events are kept
+	} `mapstructure:"outbox"`
+
+	Payments struct {
+		Provider          string `mapstructure:"provider"` // fake | "" (desk payments only)
+		WebhookSecret     string `mapstructure:"webhook_secret"`
+		RedirectURL       string `mapstructure:"redirect_url"`
+		CallbackURL       string `mapstructure:"callback_url"` // fake: POST webhooks here instead of in-process
+		ReconcileInterval string `mapstructure:"reconcile_interval"`
+		ReconcileAfter    string `mapstructure:"reconcile_after"` // age of a pending payment before asking the provider
+	} `mapstructure:"payments"`
+
+	Calendar struct {
+		Timezone     string            `mapstructure:"timezone"`
+		Hours        map[string]string `mapstructure:"hours"`         // weekday -> "08:00-18:00" | "closed"
+		HolidaysFile string            `mapstructure:"holidays_file"` // .ics imported on start
+	} `mapstructure:"calendar"`
+
+	Fines struct {
+		// unpaid balance above which reservations and renewals are refused; 0 = never
+		BlockThreshold  float64 `mapstructure:"block_threshold"`
+		OverdueInterval string  `mapstructure:"overdue_interval"`
+	} `mapstructure:"fines"`
+
+	Invoices struct {
+		Language string          `mapstructure:"language"` // fa | en, default of ?lang=
+		Seller   invoices.Seller `mapstructure:"seller"`
+		Taxes    []invoices.Tax  `mapstructure:"taxes"` // included in sale prices
+	} `mapstructure:"invoices"`
+
+	Circulation struct {
+		Source  string        `mapstructure:"source"` // config | database
+		Default policy.Rule   `mapstructure:"default"`
+		Rules   []policy.Rule `mapstructure:"rules"`
+	} `mapstructure:"circulation"`
 	
 }
 func verifyConfigLoad() {
@@ -78,6 +186,9 @@ func loadConfig() (*Config, error) {
 	viper.AutomaticEnv()
 	_ = viper.BindEnv("jwt.secret")
 	_ = viper.BindEnv("jwt.expires_in")
+	_ = viper.BindEnv("admin.email")
+	_ = viper.BindEnv("admin.password")
+	_ = viper.BindEnv("mail.password")
 
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, err
@@ -121,6 +232,171 @@ func openDB(cfg *Config) (*gorm.DB, error) {
 	return db, nil
 }
 
+func newMailer(cfg *Config) mail.Sender {
+	switch cfg.Mail.Driver {
+	case "smtp":
+		return mail.NewSMTPSender(mail.SMTPConfig{
+			Host:     cfg.Mail.Host,
+			Port:     cfg.Mail.Port,
+			Username: cfg.Mail.Username,
+			Password: cfg.Mail.Password,
+			From:     cfg.Mail.From,
+		})
+	case "memory":
+		return mail.NewMemorySender()
+	}
+	return nil
+}
+
+func newMetadataProvider(cfg *Config, rdb *redis.Client) (metadata.Provider, error) {
+	var chain metadata.Chain
+	for _, name := range cfg.Metadata.Providers {
+		switch name {
+		case "file":
+			p, err := metadata.NewFileProvider(cfg.Metadata.File)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, p)
+		case "openlibrary":
+			chain = append(chain, metadata.NewOpenLibrary())
+		case "googlebooks":
+			chain = append(chain, metadata.NewGoogleBooks(cfg.Metadata.GoogleAPIKey))
+		default:
+			return nil, fmt.Errorf("unknown metadata provider %q", name)
+		}
+	}
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	ttl, err := time.ParseDuration(cfg.Metadata.CacheTTL)
+	if err != nil || ttl <= 0 {
+		ttl = 7 * 24 * time.Hour
+	}
+	return metadata.NewCached(chain, rdb, ttl), nil
+}
+
+// retryPolicy reads the retry delays of reservation requests; the
+// defaults back off exponentially.
+func retryPolicy(cfg *Config) (rabbitmq.RetryPolicy, error) {
+	p := rabbitmq.DefaultRetryPolicy
+	if len(cfg.RabbitMQ.RetryDelays) > 0 {
+		p.Delays = nil
+		for _, s := range cfg.RabbitMQ.RetryDelays {
+			d, err := time.ParseDuration(s)
+			if err != nil || d <= 0 {
+				return p, fmt.Errorf("invalid retry delay %q", s)
+			}
+			p.Delays = append(p.Delays, d)
+		}
+	}
+	if cfg.RabbitMQ.MaxAttempts > 0 {
+		p.MaxAttempts = cfg.RabbitMQ.MaxAttempts
+	}
+	return p, nil
+}
+
+// setupPayments picks the payment gateway of the sales module.
+func setupPayments(cfg *Config, db *gorm.DB, svc *sales.Service) error {
+	if err := db.AutoMigrate(&sales.Payment{}, &sales.PaymentEvent{}); err != nil {
+		return err
+	}
+	switch cfg.Payments.Provider {
+	case "":
+		return nil
+	case "fake":
+		fake := sales.NewFakeGateway(cfg.Payments.WebhookSecret, cfg.Payments.RedirectURL)
+		if cfg.Payments.CallbackURL != "" {
+			fake.SetWebhookSink(sales.HTTPSink(cfg.Payments.CallbackURL))
+		} else {
+			fake.SetWebhookSink(func(ctx context.Context, header http.Header, body []byte) error {
+				return svc.HandleWebhook(ctx, fake.Name(), header, body)
+			})
+		}
+		svc.SetGateway(fake)
+		return nil
+	}
+	return fmt.Errorf("unknown payment provider %q", cfg.Payments.Provider)
+}
+
+// setupCalendar builds the library calendar from the weekly hours in the
+// config and the holidays table, importing calendar.holidays_file first.
+func setupCalendar(ctx context.Context, cfg *Config, db *gorm.DB) (*calendar.Service, error) {
+	loc := time.UTC
+	if cfg.Calendar.Timezone != "" {
+		l, err := time.LoadLocation(cfg.Calendar.Timezone)
+		if err != nil {
+			return nil, err
+		}
+		loc = l
+	}
+	cal := calendar.New(loc)
+	if err := calendar.ParseWeekly(cal, cfg.Calendar.Hours); err != nil {
+		return nil, err
+	}
+	if err := db.AutoMigrate(&calendar.Holiday{}); err != nil {
+		return nil, err
+	}
+	svc := calendar.NewService(calendar.NewRepository(db), cal)
+	if cfg.Calendar.HolidaysFile != "" {
+		f, err := os.Open(cfg.Calendar.HolidaysFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		report, err := svc.ImportICS(ctx, f)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("calendar: %d holiday(s) imported from %s", report.Holidays, cfg.Calendar.HolidaysFile)
+	}
+	return svc, svc.Reload(ctx)
+}
+
+// setupPolicies loads circulation rules from the config file or from the
+// circulation_policies table; circulation.default overrides the built-in
+// fallback in both cases.
+func setupPolicies(ctx context.Context, cfg *Config, db *gorm.DB, svc *loans.Service) error {
+	base := policy.Default
+	d := cfg.Circulation.Default
+	if d.LoanDays > 0 {
+		base.LoanDays = d.LoanDays
+	}
+	if d.MaxLoans > 0 {
+		base.MaxLoans = d.MaxLoans
+	}
+	if d.MaxReservations > 0 {
+		base.MaxReservations = d.MaxReservations
+	}
+	if d.RenewDays > 0 {
+		base.RenewDays = d.RenewDays
+	}
+	if d.MaxRenewals != 0 {
+		base.MaxRenewals = d.MaxRenewals
+	}
+	if d.FinePerDay > 0 {
+		base.FinePerDay = d.FinePerDay
+	}
+	if d.FineCap > 0 {
+		base.FineCap = d.FineCap
+	}
+
+	engine := policy.NewEngine(base, cfg.Circulation.Rules)
+	svc.SetPolicyEngine(engine)
+
+	switch cfg.Circulation.Source {
+	case "", "config":
+		return nil
+	case "database":
+		if err := db.AutoMigrate(&policy.Rule{}); err != nil {
+			return err
+		}
+		store := policy.NewStore(db)
+		svc.SetPolicyStore(store)
+		return store.Reload(ctx, engine)
+	}
+	return fmt.Errorf("unknown circulation source %q", cfg.Circulation.Source)
+}
 
 func main() {
     cfg, err := loadConfig()
@@ -140,14 +416,6 @@ func main() {
     e.Use(middleware.CORS())
     e.Use(middleware.Secure())
 
-    // Health check
-    e.GET("/healthz", func(c echo.Context) error {
-        return c.JSON(http.StatusOK, map[string]any{
-            "ok":   true,
-            "time": time.Now().UTC(),
-        })
-    })
-
     // Database
     var db *gorm.DB
     if cfg.Database.Enabled {
@@ -156,7 +424,7 @@ func main() {
         if err != nil {
             log.Fatalf("db error: %v", err)
         }
-		if err := db.AutoMigrate(&books.Book{}, &books.Favorite{}, &loans.Loan{}); err != nil {
+		if err := db.AutoMigrate(&books.Book{}, &books.BookCopy{}, &books.Favorite{}, &loans.Loan{}, &loans.LoanRenewal{}, &loans.Hold{}, &loans.ReservationRequest{}, &loans.ProcessedMessage{}); err != nil {
     log.Fatalf("failed to migrate database: %v", err)
 }
         log.Printf("DB connected ✔")
@@ -200,13 +468,28 @@ if err!= nil {
 }
 defer rb.Close()
 
+// Health check; 503 while the broker connection is being recovered
+e.GET("/healthz", func(c echo.Context) error {
+	status := http.StatusOK
+	if !rb.Connected() {
+		status = http.StatusServiceUnavailable
+	}
+	return c.JSON(status, map[string]any{
+		"ok":       status == http.StatusOK,
+		"time":     time.Now().UTC(),
+		"rabbitmq": rb.Status(),
+	})
+})
+
 
 // login limiter setup
 if rdb != nil {
 	loginLimiter = rate.NewTokenBucket(rdb, 5, 1, 2*time.Minute, 20*time.Minute)
+	resetLimiter := rate.NewTokenBucket(rdb, 3, 1, 15*time.Minute, time.Hour)
 	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			c.Set("loginLimiter", loginLimiter)
+			c.Set("passwordResetLimiter", resetLimiter)
 			return next(c)
 		}
 	})
@@ -224,27 +507,209 @@ if rdb != nil {
     if err != nil || jwtTTL <= 0 {
         jwtTTL = time.Hour
     }
+    refreshTTL, err := time.ParseDuration(cfg.JWT.RefreshExpiresIn)
+    if err != nil || refreshTTL <= 0 {
+        refreshTTL = 30 * 24 * time.Hour
+    }
+
+    // revoked access tokens (logout) — Redis if enabled, memory otherwise
+    e.Use(authmw.WithDenylist(authmw.NewDenylist(rdb)))
+
+    // background workers stop with the process
+    workersCtx, stopWorkers := context.WithCancel(context.Background())
+    defer stopWorkers()
 
     // Register routes
 if db != nil {
-	users.RegisterUserRoutes(e, db, jwtSecret, jwtTTL)
+	// Idempotency-Key replay — Redis if enabled, falling back to idempotency_keys
+	if err := db.AutoMigrate(&idempotency.Record{}); err != nil {
+		log.Fatalf("failed to migrate idempotency keys: %v", err)
+	}
+	idemWindow, err := time.ParseDuration(cfg.Idempotency.Window)
+	if err != nil || idemWindow <= 0 {
+		idemWindow = 24 * time.Hour
+	}
+	e.Use(authmw.WithIdempotency(idempotency.New(rdb, db), idemWindow))
+
+	resetTTL, err := time.ParseDuration(cfg.PasswordReset.TTL)
+	if err != nil || resetTTL <= 0 {
+		resetTTL = 30 * time.Minute
+	}
+	users.RegisterUserRoutes(e, db, users.RouteConfig{
+		JWTSecret:  jwtSecret,
+		JWTTTL:     jwtTTL,
+		RefreshTTL: refreshTTL,
+		ResetTTL:   resetTTL,
+		ResetURL:   cfg.PasswordReset.URL,
+		Mailer:     newMailer(cfg),
+	})
+	if cfg.Admin.Email != "" {
+		admin, created, err := users.NewService(users.NewRepository(db)).
+			EnsureAdmin(cfg.Admin.Name, cfg.Admin.Email, cfg.Admin.Password)
+		if err != nil {
+			log.Fatalf("admin bootstrap error: %v", err)
+		}
+		if created {
+			log.Printf("bootstrap admin ready: %s", admin.Email)
+		}
+	}
+
+	// Outbox
+	if err := db.AutoMigrate(&outbox.Event{}); err != nil {
+		log.Fatalf("failed to migrate outbox: %v", err)
+	}
+	outboxRepo := outbox.NewRepository(db)
 
 	// Books
 	booksRepo := books.NewRepository(db)
 	booksService := books.NewService(booksRepo, rdb)
-	booksHandler := books.NewHandler(booksService)
+	booksService.SetOutbox(outboxRepo)
+	switch cfg.Search.Engine {
+	case "memory":
+		booksService.SetSearchIndex(search.NewMemoryIndex())
+	case "mysql":
+		if err := db.AutoMigrate(&search.SearchDocument{}); err != nil {
+			log.Fatalf("failed to migrate search index: %v", err)
+		}
+		booksService.SetSearchIndex(search.NewMySQLIndex(db))
+	}
+	if provider, err := newMetadataProvider(cfg, rdb); err != nil {
+		log.Fatalf("metadata provider error: %v", err)
+	} else if provider != nil {
+		booksService.SetMetadataProvider(provider)
+	}
+	if cfg.Search.Engine == "memory" || cfg.Search.ReindexOnStart {
+		if err := booksService.RebuildSearchIndex(context.Background()); err != nil {
+			log.Fatalf("search index error: %v", err)
+		}
+	}
+	booksHandler := books.NewHandler(booksService, jwtSecret)
 	booksHandler.RegisterRoutes(e)
 
+	usersService := users.NewService(users.NewRepository(db))
+
+	// Sales
+	if err := db.AutoMigrate(&sales.Cart{}, &sales.CartItem{}, &sales.Order{}, &sales.OrderItem{}, &sales.OrderCopy{}, &sales.OrderDiscount{},
+		&promotions.Promotion{}, &promotions.Redemption{}); err != nil {
+		log.Fatalf("failed to migrate sales: %v", err)
+	}
+	promotionsService := promotions.NewService(promotions.NewRepository(db))
+	promotions.NewHandler(promotionsService, jwtSecret).RegisterRoutes(e)
+	salesService := sales.NewService(db, sales.NewRepository(db), booksRepo)
+	salesService.SetPromotions(promotionsService)
+	salesService.SetUserDirectory(usersService)
+	if err := setupPayments(cfg, db, salesService); err != nil {
+		log.Fatalf("payments error: %v", err)
+	}
+	sales.NewHandler(salesService, jwtSecret).RegisterRoutes(e)
+
+	// Calendar
+	cal, err := setupCalendar(context.Background(), cfg, db)
+	if err != nil {
+		log.Fatalf("calendar error: %v", err)
+	}
+	calendar.NewHandler(cal, jwtSecret).RegisterRoutes(e)
+
 	// Loans
 	loansRepo := loans.NewRepository(db)
 	loansService := loans.NewService(db, loansRepo, booksRepo)
+	loansService.SetCalendar(cal.Calendar())
+	loansService.SetUserDirectory(usersService)
+	loansService.AddBlocker(usersService)
+	if err := setupPolicies(context.Background(), cfg, db, loansService); err != nil {
+		log.Fatalf("circulation policy error: %v", err)
+	}
+	loansService.SetHoldPriorities(cfg.Loans.HoldPriorities)
+	loansService.SetEventBus(events.New(rdb))
+	loansService.SetOutbox(outboxRepo)
+	booksService.SetAvailabilityHook(func(ctx context.Context, bookID uint) {
+		if err := loansService.PromoteHolds(ctx, bookID); err != nil {
+			log.Printf("promote holds for book %d: %v", bookID, err)
+		}
+	})
 
-	loansHandler := loans.NewHandler(loansService, rb.Channel, jwtSecret)
+	loansHandler := loans.NewHandler(loansService, rb, jwtSecret)
 	loansHandler.RegisterRoutes(e)
 
-	if err := rabbitmq.ConsumeReservations(rb.Channel, loansService); err != nil {
+	retry, err := retryPolicy(cfg)
+	if err != nil {
+		log.Fatalf("rabbitmq retry config: %v", err)
+	}
+	if err := rabbitmq.ConsumeReservations(rb, loansService, retry); err != nil {
 		log.Fatalf("consume error: %v", err)
 	}
+	rabbitmq.NewAdminHandler(rb, jwtSecret).RegisterRoutes(e)
+
+	pickupWindow, err := time.ParseDuration(cfg.Loans.PickupWindow)
+	if err != nil || pickupWindow <= 0 {
+		pickupWindow = 48 * time.Hour
+	}
+	expiryInterval, err := time.ParseDuration(cfg.Loans.ExpiryInterval)
+	if err != nil || expiryInterval <= 0 {
+		expiryInterval = 5 * time.Minute
+	}
+	// one instance per tick does the work; Redis lock when available
+	locker := lock.New(rdb)
+	expiry := loans.NewExpiryWorker(loansService, locker, pickupWindow, expiryInterval)
+	go expiry.Run(workersCtx)
+
+	eventPublisher, err := rabbitmq.NewEventPublisher(rb)
+	if err != nil {
+		log.Fatalf("rabbitmq events exchange: %v", err)
+	}
+	relayInterval, err := time.ParseDuration(cfg.Outbox.RelayInterval)
+	if err != nil || relayInterval <= 0 {
+		relayInterval = time.Second
+	}
+	relayBatch := cfg.Outbox.BatchSize
+	if relayBatch <= 0 {
+		relayBatch = 100
+	}
+	retention, err := time.ParseDuration(cfg.Outbox.Retention)
+	if err != nil || retention < 0 {
+		retention = 7 * 24 * time.Hour
+	}
+	go outbox.NewRelay(outboxRepo, eventPublisher, locker, relayInterval, relayBatch, retention).Run(workersCtx)
+
+	// Fines
+	if err := db.AutoMigrate(&fines.Entry{}); err != nil {
+		log.Fatalf("failed to migrate fines: %v", err)
+	}
+	finesService := fines.NewService(fines.NewRepository(db), loansService)
+	finesService.SetBlockThreshold(cfg.Fines.BlockThreshold)
+	finesService.SetCalendar(cal.Calendar())
+	loansService.SetFineAccruer(finesService)
+	loansService.AddBlocker(finesService)
+	fines.NewHandler(finesService, jwtSecret).RegisterRoutes(e)
+
+	overdueInterval, err := time.ParseDuration(cfg.Fines.OverdueInterval)
+	if err != nil || overdueInterval <= 0 {
+		overdueInterval = time.Hour
+	}
+	go fines.NewOverdueWorker(loansService, finesService, locker, overdueInterval).Run(workersCtx)
+
+	// Invoices and receipts
+	if err := db.AutoMigrate(&invoices.Invoice{}, &invoices.InvoiceLine{}, &invoices.TaxLine{}, &invoices.Sequence{}); err != nil {
+		log.Fatalf("failed to migrate invoices: %v", err)
+	}
+	invoicesService := invoices.NewService(invoices.NewRepository(db), salesService, finesService)
+	invoicesService.SetCustomers(usersService)
+	invoicesService.SetSeller(cfg.Invoices.Seller)
+	invoicesService.SetTaxes(cfg.Invoices.Taxes)
+	invoicesService.SetLocale(cfg.Invoices.Language, cal.Calendar().Location())
+	invoices.NewHandler(invoicesService, jwtSecret).RegisterRoutes(e)
+
+	if salesService.Gateway() != nil {
+		interval, err := time.ParseDuration(cfg.Payments.ReconcileInterval)
+		if err != nil || interval <= 0 {
+			interval = 10 * time.Minute
+		}
+		after, err := time.ParseDuration(cfg.Payments.ReconcileAfter)
+		if err != nil || after < 0 {
+			after = 15 * time.Minute
+		}
+		go sales.NewReconciler(salesService, locker, interval, after).Run(workersCtx)
+	}
 }
 	
 
@@ -0,0 +1,422 @@
+package books
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/erfnzmn/Library_Management_System/internal/outbox"
+	"github.com/erfnzmn/Library_Management_System/pkg/isbn"
+	"github.com/erfnzmn/Library_Management_System/pkg/marc"
+)
+
+const (
+	FormatCSV     = "csv"
+	FormatNDJSON  = "ndjson"
+	FormatMARC21  = marc.FormatMARC21
+	FormatMARCXML = marc.FormatMARCXML
+
+	importBatchSize = 200
+)
+
+var ErrUnknownFormat = errors.New("unknown format, expected csv, ndjson, marc21 or marcxml")
+
+// bulkColumns is the CSV header used for export and the columns understood
+// on import, in order.
+var bulkColumns = []string{
+	"isbn", "title", "author", "publisher", "year_of_publication", "edition",
+	"genre", "language", "description", "stock", "selling_status",
+	"cover_image", "tags", "price",
+}
+
+var columnAliases = map[string]string{
+	"year":      "year_of_publication",
+	"published": "year_of_publication",
+	"auther":    "author",
+	"cover":     "cover_image",
+	"category":  "genre",
+	"keywords":  "tags",
+}
+
+type RowError struct {
+	Line  int    `json:"line"`
+	ISBN  string `json:"isbn,omitempty"`
+	Error string `json:"error"`
+}
+
+type ImportReport struct {
+	Total   int        `json:"total"`
+	Created int        `json:"created"`
+	Updated int        `json:"updated"`
+	Failed  int        `json:"failed"`
+	Errors  []RowError `json:"errors"`
+	// Warnings lists rows that were imported with some columns ignored.
+	Warnings []RowError `json:"warnings,omitempty"`
+}
+
+type importRow struct {
+	line int
+	book Book
+}
+
+// ImportBooks upserts books by ISBN from CSV or NDJSON. Rows are validated
+// first; valid rows are written in batches, each batch in one transaction.
+func (s *Service) ImportBooks(ctx context.Context, format string, r io.Reader) (*ImportReport, error) {
+	report := &ImportReport{Errors: []RowError{}}
+	seen := make(map[string]int)
+	var batch []importRow
+	var touched []uint
+
+	write := func(rows []importRow) error {
+		res, err := s.importBatch(ctx, rows)
+		if err != nil {
+			return err
+		}
+		report.Created += res.created
+		report.Updated += res.updated
+		report.Warnings = append(report.Warnings, res.warnings...)
+		touched = append(touched, res.ids...)
+		return nil
+	}
+	fail := func(row importRow, err error) {
+		report.Failed++
+		report.Errors = append(report.Errors, RowError{Line: row.line, ISBN: row.book.ISBN, Error: err.Error()})
+	}
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		defer func() { batch = batch[:0] }()
+		err := write(batch)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if len(batch) == 1 {
+			fail(batch[0], err)
+			return nil
+		}
+		// one bad row rolls back its whole batch; write the rows one by one
+		// so that only the offending lines are reported
+		for _, row := range batch {
+			if err := write([]importRow{row}); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				fail(row, err)
+			}
+		}
+		return nil
+	}
+
+	err := readRows(format, r, func(line int, book Book, rowErr error) error {
+		report.Total++
+		if rowErr == nil {
+			rowErr = validateImportRow(&book)
+		}
+		if rowErr == nil && book.ISBN != "" {
+			if first, dup := seen[book.ISBN]; dup {
+				rowErr = fmt.Errorf("duplicate ISBN, first seen on line %d", first)
+			} else {
+				seen[book.ISBN] = line
+			}
+		}
+		if rowErr != nil {
+			fail(importRow{line: line, book: book}, rowErr)
+			return nil
+		}
+		batch = append(batch, importRow{line: line, book: book})
+		if len(batch) >= importBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range touched {
+		if b, err := s.repo.GetBookByID(ctx, id); err == nil {
+			s.indexBook(ctx, b)
+		}
+	}
+	s.invalidate(ctx)
+	return report, nil
+}
+
+// batchResult is what importBatch wrote.
+type batchResult struct {
+	ids              []uint
+	created, updated int
+	warnings         []RowError
+}
+
+func (s *Service) importBatch(ctx context.Context, rows []importRow) (*batchResult, error) {
+	var res *batchResult
+	err := s.transaction(ctx, func(repo *Repository, events *outbox.Repository) error {
+		res = &batchResult{}
+		for _, row := range rows {
+			book := row.book
+			var existing *Book
+			if book.ISBN != "" {
+				var err error
+				if existing, err = repo.FindByISBN(ctx, book.ISBN); err != nil {
+					return err
+				}
+			}
+			if existing == nil {
+				if err := createWithCopies(ctx, repo, &book); err != nil {
+					return fmt.Errorf("line %d: %w", row.line, err)
+				}
+				if err := record(ctx, events, outbox.BookCreated, book.ID, &book); err != nil {
+					return err
+				}
+				res.created++
+			} else {
+				// only the columns present in the row are overwritten;
+				// stock and selling status of an existing book come from
+				// its copies
+				if book.Stock > 0 {
+					res.warnings = append(res.warnings, RowError{
+						Line:  row.line,
+						ISBN:  book.ISBN,
+						Error: "stock is ignored for existing books; add copies with POST /books/:id/copies",
+					})
+				}
+				if book.SellingStatus != "" || book.SaleStock > 0 {
+					res.warnings = append(res.warnings, RowError{
+						Line:  row.line,
+						ISBN:  book.ISBN,
+						Error: "selling_status and sale_stock are ignored for existing books; they follow the copies for sale",
+					})
+				}
+				book.ID = existing.ID
+				if err := repo.MergeBook(ctx, &book); err != nil {
+					return fmt.Errorf("line %d: %w", row.line, err)
+				}
+				if events != nil {
+					// the event carries the whole book, not just the row
+					merged, err := repo.GetBookByID(ctx, book.ID)
+					if err != nil {
+						return err
+					}
+					if err := record(ctx, events, outbox.BookUpdated, book.ID, merged); err != nil {
+						return err
+					}
+				}
+				res.updated++
+			}
+			res.ids = append(res.ids, book.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func validateImportRow(b *Book) error {
+	b.Title = strings.TrimSpace(b.Title)
+	b.Author = strings.TrimSpace(b.Author)
+	if b.Title == "" {
+		return errors.New("title is required")
+	}
+	if b.Author == "" {
+		return errors.New("author is required")
+	}
+	if b.ISBN != "" {
+		code, err := isbn.Normalize(b.ISBN)
+		if err != nil {
+			return err
+		}
+		b.ISBN = code
+	}
+	if b.Stock < 0 {
+		return errors.New("stock must not be negative")
+	}
+	if b.SellingStatus != "" && b.SellingStatus != "available" && b.SellingStatus != "sold_out" {
+		return fmt.Errorf("invalid selling_status %q", b.SellingStatus)
+	}
+	return nil
+}
+
+// readRows decodes rows one at a time; fn receives a per-row decode error
+// instead of aborting the whole import.
+func readRows(format string, r io.Reader, fn func(line int, b Book, err error) error) error {
+	switch format {
+	case FormatCSV:
+		return readCSV(r, fn)
+	case FormatNDJSON:
+		return readNDJSON(r, fn)
+	case FormatMARC21, FormatMARCXML:
+		return readMARC(format, r, fn)
+	}
+	return ErrUnknownFormat
+}
+
+func readCSV(r io.Reader, fn func(int, Book, error) error) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("read csv header: %w", err)
+	}
+	columns := make([]string, len(header))
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		if alias, ok := columnAliases[h]; ok {
+			h = alias
+		}
+		columns[i] = h
+	}
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			var perr *csv.ParseError
+			if errors.As(err, &perr) {
+				if err := fn(perr.Line, Book{}, err); err != nil {
+					return err
+				}
+				continue
+			}
+			return err
+		}
+		line, _ := cr.FieldPos(0)
+		book, rowErr := bookFromRecord(columns, record)
+		if err := fn(line, book, rowErr); err != nil {
+			return err
+		}
+	}
+}
+
+func bookFromRecord(columns, record []string) (Book, error) {
+	var b Book
+	for i, col := range columns {
+		if i >= len(record) {
+			break
+		}
+		v := strings.TrimSpace(record[i])
+		if v == "" {
+			continue
+		}
+		var err error
+		switch col {
+		case "isbn":
+			b.ISBN = v
+		case "title":
+			b.Title = v
+		case "author":
+			b.Author = v
+		case "publisher":
+			b.Publisher = v
+		case "year_of_publication":
+			b.YearOfPublication, err = strconv.Atoi(v)
+		case "edition":
+			b.Edition = v
+		case "genre":
+			b.Genre = v
+		case "language":
+			b.Language = v
+		case "description":
+			b.Description = v
+		case "stock":
+			b.Stock, err = strconv.Atoi(v)
+		case "selling_status":
+			b.SellingStatus = v
+		case "cover_image":
+			b.CoverImage = v
+		case "tags":
+			b.Tags = v
+		case "price":
+			b.Price, err = strconv.ParseFloat(v, 64)
+		}
+		if err != nil {
+			return b, fmt.Errorf("invalid %s %q", col, v)
+		}
+	}
+	return b, nil
+}
+
+func readNDJSON(r io.Reader, fn func(int, Book, error) error) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		var b Book
+		err := json.Unmarshal([]byte(text), &b)
+		b.ID = 0
+		if err := fn(line, b, err); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// ExportBooks streams the catalogue to w in batches.
+func (s *Service) ExportBooks(ctx context.Context, format string, w io.Writer) error {
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(bulkColumns); err != nil {
+			return err
+		}
+		err := s.repo.EachBook(ctx, 500, func(b *Book) error {
+			return cw.Write(bookRecord(b))
+		})
+		cw.Flush()
+		if err != nil {
+			return err
+		}
+		return cw.Error()
+	case FormatNDJSON:
+		enc := json.NewEncoder(w)
+		return s.repo.EachBook(ctx, 500, func(b *Book) error {
+			return enc.Encode(b)
+		})
+	case FormatMARC21, FormatMARCXML:
+		return s.exportMARC(ctx, format, w)
+	}
+	return ErrUnknownFormat
+}
+
+func bookRecord(b *Book) []string {
+	return []string{
+		b.ISBN,
+		b.Title,
+		b.Author,
+		b.Publisher,
+		strconv.Itoa(b.YearOfPublication),
+		b.Edition,
+		b.Genre,
+		b.Language,
+		b.Description,
+		strconv.Itoa(b.Stock),
+		b.SellingStatus,
+		b.CoverImage,
+		b.Tags,
+		strconv.FormatFloat(b.Price, 'f', -1, 64),
+	}
+}
@@ -2,30 +2,54 @@ package books
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"github.com/erfnzmn/Library_Management_System/internal/metadata"
+	"github.com/erfnzmn/Library_Management_System/pkg/isbn"
+	"github.com/erfnzmn/Library_Management_System/pkg/middleware"
 )
 
 type Handler struct {
-	service *Service
+	service   *Service
+	jwtSecret string
 }
 
-func NewHandler(service *Service) *Handler {
-	return &Handler{service: service}
+func NewHandler(service *Service, jwtSecret string) *Handler {
+	return &Handler{service: service, jwtSecret: jwtSecret}
 }
 
 func (h *Handler) RegisterRoutes(e *echo.Echo) {
-	e.POST("/books", h.CreateBook)
+	auth := middleware.JWT(h.jwtSecret)
+	staff := middleware.RequirePermission(middleware.PermBooksWrite)
+	once := middleware.Idempotent
+
+	e.POST("/books", h.CreateBook, auth, staff, once)
+	e.POST("/books/import", h.ImportBooks, auth, staff, once)
+	e.POST("/books/import/isbn", h.ImportByISBN, auth, staff, once)
+	e.GET("/books/export", h.ExportBooks, auth, staff)
 	e.GET("/books", h.ListBooks)
 	e.GET("/books/:id", h.GetBookByID)
-	e.PUT("/books/:id", h.UpdateBook)
-	e.DELETE("/books/:id", h.DeleteBook)
+	e.PUT("/books/:id", h.UpdateBook, auth, staff)
+	e.DELETE("/books/:id", h.DeleteBook, auth, staff)
 	e.GET("/books/search", h.SearchBooks)
 
-	e.POST("/books/:id/favorite/:user_id", h.AddToFavorites)
-	e.GET("/books/favorites/:user_id", h.GetFavoritesByUser)
+	e.GET("/books/:id/copies", h.ListCopies)
+	e.POST("/books/:id/copies", h.AddCopy, auth, staff, once)
+	e.GET("/books/:id/copies/:copy_id", h.GetCopy)
+	e.PUT("/books/:id/copies/:copy_id", h.UpdateCopy, auth, staff)
+	e.DELETE("/books/:id/copies/:copy_id", h.DeleteCopy, auth, staff)
+
+	self := middleware.SelfOr("user_id", middleware.PermUsersManage)
+	e.POST("/books/:id/favorite/:user_id", h.AddToFavorites, auth, self)
+	e.GET("/books/favorites/:user_id", h.GetFavoritesByUser, auth, self)
 }
 
 func (h *Handler) CreateBook(c echo.Context) error {
@@ -39,6 +63,134 @@ func (h *Handler) CreateBook(c echo.Context) error {
 	return c.JSON(http.StatusCreated, book)
 }
 
+// ImportBooks accepts a raw CSV/NDJSON/MARC21/MARCXML body or a multipart
+// "file" field.
+// The format comes from ?format= or the Content-Type.
+func (h *Handler) ImportBooks(c echo.Context) error {
+	format := c.QueryParam("format")
+	var body io.Reader = c.Request().Body
+	if fh, err := c.FormFile("file"); err == nil {
+		f, err := fh.Open()
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, err.Error())
+		}
+		defer f.Close()
+		body = f
+		if format == "" {
+			format = formatFromName(fh.Filename)
+		}
+	}
+	if format == "" {
+		format = formatFromContentType(c.Request().Header.Get(echo.HeaderContentType))
+	}
+
+	report, err := h.service.ImportBooks(c.Request().Context(), format, body)
+	if err != nil {
+		if errors.Is(err, ErrUnknownFormat) {
+			return c.JSON(http.StatusUnsupportedMediaType, err.Error())
+		}
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	status := http.StatusOK
+	if report.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	return c.JSON(status, report)
+}
+
+func (h *Handler) ExportBooks(c echo.Context) error {
+	format := c.QueryParam("format")
+	if format == "" {
+		format = FormatCSV
+	}
+	var contentType string
+	switch format {
+	case FormatCSV:
+		contentType = "text/csv; charset=utf-8"
+	case FormatNDJSON:
+		contentType = "application/x-ndjson"
+	case FormatMARC21:
+		contentType = "application/marc"
+	case FormatMARCXML:
+		contentType = "application/marcxml+xml"
+	default:
+		return c.JSON(http.StatusBadRequest, ErrUnknownFormat.Error())
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, contentType)
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="books.%s"`, exportExtensions[format]))
+	res.WriteHeader(http.StatusOK)
+	// headers are already sent; a failure can only cut the stream short
+	if err := h.service.ExportBooks(c.Request().Context(), format, res); err != nil {
+		c.Logger().Errorf("export books: %v", err)
+	}
+	return nil
+}
+
+var exportExtensions = map[string]string{
+	FormatCSV:     "csv",
+	FormatNDJSON:  "ndjson",
+	FormatMARC21:  "mrc",
+	FormatMARCXML: "xml",
+}
+
+func formatFromContentType(ct string) string {
+	switch {
+	case strings.HasPrefix(ct, "application/marc"):
+		if strings.Contains(ct, "xml") {
+			return FormatMARCXML
+		}
+		return FormatMARC21
+	case strings.HasPrefix(ct, "application/xml"), strings.HasPrefix(ct, "text/xml"):
+		return FormatMARCXML
+	case strings.HasPrefix(ct, "text/csv"):
+		return FormatCSV
+	case strings.HasPrefix(ct, "application/x-ndjson"), strings.HasPrefix(ct, "application/ndjson"):
+		return FormatNDJSON
+	}
+	return ""
+}
+
+func formatFromName(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".csv"):
+		return FormatCSV
+	case strings.HasSuffix(name, ".ndjson"), strings.HasSuffix(name, ".jsonl"):
+		return FormatNDJSON
+	case strings.HasSuffix(name, ".mrc"), strings.HasSuffix(name, ".marc"):
+		return FormatMARC21
+	case strings.HasSuffix(name, ".xml"):
+		return FormatMARCXML
+	}
+	return ""
+}
+
+func (h *Handler) ImportByISBN(c echo.Context) error {
+	var req struct {
+		ISBN string `json:"isbn"`
+		Book
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	book := req.Book
+	if err := h.service.ImportByISBN(c.Request().Context(), req.ISBN, &book); err != nil {
+		switch {
+		case errors.Is(err, isbn.ErrInvalid):
+			return c.JSON(http.StatusBadRequest, err.Error())
+		case errors.Is(err, ErrDuplicateISBN):
+			return c.JSON(http.StatusConflict, err.Error())
+		case errors.Is(err, metadata.ErrNotFound):
+			return c.JSON(http.StatusNotFound, err.Error())
+		case errors.Is(err, ErrNoMetadata):
+			return c.JSON(http.StatusNotImplemented, err.Error())
+		}
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusCreated, book)
+}
+
 func (h *Handler) UpdateBook(c echo.Context) error {
 	var book Book
 	if err := c.Bind(&book); err != nil {
@@ -47,6 +199,14 @@ func (h *Handler) UpdateBook(c echo.Context) error {
 	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
 	book.ID = uint(id)
 	if err := h.service.UpdateBook(context.Background(), &book); err != nil {
+		switch {
+		case errors.Is(err, ErrVersionConflict):
+			return c.JSON(http.StatusConflict, err.Error())
+		case errors.Is(err, ErrVersionRequired):
+			return c.JSON(http.StatusPreconditionRequired, err.Error())
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return c.JSON(http.StatusNotFound, err.Error())
+		}
 		return c.JSON(http.StatusInternalServerError, err.Error())
 	}
 	return c.JSON(http.StatusOK, book)
@@ -61,11 +221,77 @@ func (h *Handler) DeleteBook(c echo.Context) error {
 }
 
 func (h *Handler) ListBooks(c echo.Context) error {
-	books, err := h.service.ListBooks(context.Background())
+	q, err := parseListQuery(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	res, err := h.service.ListBooks(context.Background(), q)
 	if err != nil {
+		if errors.Is(err, ErrInvalidListQuery) {
+			return c.JSON(http.StatusBadRequest, err.Error())
+		}
 		return c.JSON(http.StatusInternalServerError, err.Error())
 	}
-	return c.JSON(http.StatusOK, books)
+	if res.Page < res.TotalPages {
+		res.Next = pageLink(c, res.Page+1)
+	}
+	if res.Page > 1 {
+		res.Prev = pageLink(c, res.Page-1)
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// parseListQuery reads filters, sorting and paging from the query string,
+// e.g. /books?genre=novel&tags=classic,persian&year_from=1950&sort=price&order=desc&page=2
+func parseListQuery(c echo.Context) (ListQuery, error) {
+	q := ListQuery{
+		Genre:             c.QueryParam("genre"),
+		Language:          c.QueryParam("language"),
+		ReservationStatus: c.QueryParam("reservation_status"),
+		SellingStatus:     c.QueryParam("selling_status"),
+		Sort:              c.QueryParam("sort"),
+		Order:             c.QueryParam("order"),
+	}
+	if tags := c.QueryParam("tags"); tags != "" {
+		q.Tags = strings.Split(tags, ",")
+	}
+	ints := map[string]*int{
+		"year_from": &q.YearFrom,
+		"year_to":   &q.YearTo,
+		"page":      &q.Page,
+		"page_size": &q.PageSize,
+	}
+	for name, dst := range ints {
+		if v := c.QueryParam(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return q, fmt.Errorf("invalid %s", name)
+			}
+			*dst = n
+		}
+	}
+	floats := map[string]**float64{
+		"price_min": &q.PriceMin,
+		"price_max": &q.PriceMax,
+	}
+	for name, dst := range floats {
+		if v := c.QueryParam(name); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return q, fmt.Errorf("invalid %s", name)
+			}
+			*dst = &f
+		}
+	}
+	return q, nil
+}
+
+func pageLink(c echo.Context, page int) string {
+	u := *c.Request().URL
+	values := u.Query()
+	values.Set("page", strconv.Itoa(page))
+	u.RawQuery = values.Encode()
+	return u.RequestURI()
 }
 
 func (h *Handler) GetBookByID(c echo.Context) error {
@@ -104,3 +330,69 @@ func (h *Handler) GetFavoritesByUser(c echo.Context) error {
 	}
 	return c.JSON(http.StatusOK, books)
 }
+
+func (h *Handler) ListCopies(c echo.Context) error {
+	bookID, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	copies, err := h.service.ListCopies(context.Background(), uint(bookID))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, err.Error())
+	}
+	return c.JSON(http.StatusOK, copies)
+}
+
+func (h *Handler) GetCopy(c echo.Context) error {
+	bookID, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	copyID, _ := strconv.ParseUint(c.Param("copy_id"), 10, 64)
+	bc, err := h.service.GetCopy(context.Background(), uint(bookID), uint(copyID))
+	if err != nil {
+		return c.JSON(copyErrorStatus(err), err.Error())
+	}
+	return c.JSON(http.StatusOK, bc)
+}
+
+func (h *Handler) AddCopy(c echo.Context) error {
+	var bc BookCopy
+	if err := c.Bind(&bc); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	bookID, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err := h.service.AddCopy(context.Background(), uint(bookID), &bc); err != nil {
+		return c.JSON(copyErrorStatus(err), err.Error())
+	}
+	return c.JSON(http.StatusCreated, bc)
+}
+
+func (h *Handler) UpdateCopy(c echo.Context) error {
+	var bc BookCopy
+	if err := c.Bind(&bc); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	bookID, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	copyID, _ := strconv.ParseUint(c.Param("copy_id"), 10, 64)
+	bc.ID = uint(copyID)
+	if err := h.service.UpdateCopy(context.Background(), uint(bookID), &bc); err != nil {
+		return c.JSON(copyErrorStatus(err), err.Error())
+	}
+	return c.JSON(http.StatusOK, bc)
+}
+
+func (h *Handler) DeleteCopy(c echo.Context) error {
+	bookID, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	copyID, _ := strconv.ParseUint(c.Param("copy_id"), 10, 64)
+	if err := h.service.DeleteCopy(context.Background(), uint(bookID), uint(copyID)); err != nil {
+		return c.JSON(copyErrorStatus(err), err.Error())
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func copyErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrCopyNotFound), errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrInvalidCopyStatus), errors.Is(err, ErrInvalidCondition), errors.Is(err, ErrBarcodeRequired):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrCopyInUse), errors.Is(err, ErrCopyChanged):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
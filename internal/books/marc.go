@@ -0,0 +1,180 @@
+package books
+
+import (
+	"context"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erfnzmn/Library_Management_System/pkg/marc"
+)
+
+// marcLanguages maps MARC language codes to the codes stored on Book.
+var marcLanguages = map[string]string{
+	"per": "fa",
+	"ara": "ar",
+	"eng": "en",
+	"fre": "fr",
+	"ger": "de",
+	"tur": "tr",
+	"rus": "ru",
+	"spa": "es",
+}
+
+var (
+	marcYear      = regexp.MustCompile(`\d{4}`)
+	marcISBN      = regexp.MustCompile(`[0-9Xx\-]{10,17}`)
+	trailingPunct = " /:;,.="
+)
+
+func cleanMARC(s string) string {
+	return strings.TrimSpace(strings.TrimRight(strings.TrimSpace(s), trailingPunct))
+}
+
+// BookFromMARC maps the standard bibliographic fields of a record:
+//
+//	020$a ISBN, 100$a author, 245$a$b title, 250$a edition,
+//	260/264$b publisher and $c year, 650$a subjects (tags, first one as
+//	genre unless 655$a is present), 520$a description, 041$a/008 language.
+func BookFromMARC(rec *marc.Record) Book {
+	var b Book
+
+	if raw := rec.Value("020", 'a'); raw != "" {
+		b.ISBN = marcISBN.FindString(raw)
+	}
+	b.Author = cleanMARC(rec.Value("100", 'a'))
+	if b.Author == "" {
+		b.Author = cleanMARC(rec.Value("110", 'a'))
+	}
+
+	if fields := rec.DataFields("245"); len(fields) > 0 {
+		title := cleanMARC(fields[0].Subfield('a'))
+		if sub := cleanMARC(fields[0].Subfield('b')); sub != "" {
+			title += ": " + sub
+		}
+		b.Title = title
+	}
+	b.Edition = cleanMARC(rec.Value("250", 'a'))
+
+	for _, tag := range []string{"264", "260"} {
+		if b.Publisher == "" {
+			b.Publisher = cleanMARC(rec.Value(tag, 'b'))
+		}
+		if b.YearOfPublication == 0 {
+			b.YearOfPublication, _ = strconv.Atoi(marcYear.FindString(rec.Value(tag, 'c')))
+		}
+	}
+
+	var subjects []string
+	for _, f := range rec.DataFields("650") {
+		if v := cleanMARC(f.Subfield('a')); v != "" {
+			subjects = append(subjects, v)
+		}
+	}
+	b.Tags = strings.Join(subjects, ",")
+	b.Genre = cleanMARC(rec.Value("655", 'a'))
+	if b.Genre == "" && len(subjects) > 0 {
+		b.Genre = subjects[0]
+	}
+
+	b.Description = strings.TrimSpace(rec.Value("520", 'a'))
+
+	lang := rec.Value("041", 'a')
+	if lang == "" {
+		if f008 := rec.ControlField("008"); len(f008) >= 38 {
+			lang = f008[35:38]
+		}
+	}
+	if code, ok := marcLanguages[strings.ToLower(strings.TrimSpace(lang))]; ok {
+		b.Language = code
+	}
+	return b
+}
+
+// BookToMARC builds a MARC21 record carrying the same fields BookFromMARC reads.
+func BookToMARC(b *Book) *marc.Record {
+	rec := marc.NewRecord()
+	rec.AddControlField("001", strconv.FormatUint(uint64(b.ID), 10))
+	if !b.UpdatedAt.IsZero() {
+		rec.AddControlField("005", b.UpdatedAt.UTC().Format("20060102150405")+".0")
+	}
+
+	lang := "und"
+	for code, short := range marcLanguages {
+		if short == b.Language {
+			lang = code
+			break
+		}
+	}
+	year := "    "
+	if b.YearOfPublication > 0 {
+		year = strconv.Itoa(b.YearOfPublication)
+	}
+	created := b.CreatedAt
+	if created.IsZero() {
+		created = time.Now()
+	}
+	// 008: date entered, type of date, date1, ..., language at 35-37
+	f008 := created.UTC().Format("060102") + "s" + year + "    " + "xx " +
+		strings.Repeat(" ", 17) + lang + " d"
+	rec.AddControlField("008", f008)
+
+	rec.AddDataField("020", ' ', ' ', "a", b.ISBN)
+	rec.AddDataField("041", '0', ' ', "a", lang)
+	rec.AddDataField("100", '1', ' ', "a", b.Author)
+
+	title, subtitle := b.Title, ""
+	if i := strings.Index(title, ": "); i > 0 {
+		title, subtitle = title[:i], title[i+2:]
+	}
+	rec.AddDataField("245", '1', '0', "a", title, "b", subtitle)
+	rec.AddDataField("250", ' ', ' ', "a", b.Edition)
+
+	yearValue := ""
+	if b.YearOfPublication > 0 {
+		yearValue = strconv.Itoa(b.YearOfPublication)
+	}
+	rec.AddDataField("264", ' ', '1', "b", b.Publisher, "c", yearValue)
+	rec.AddDataField("520", ' ', ' ', "a", b.Description)
+
+	for _, tag := range strings.Split(b.Tags, ",") {
+		rec.AddDataField("650", ' ', '4', "a", strings.TrimSpace(tag))
+	}
+	rec.AddDataField("655", ' ', '4', "a", b.Genre)
+	return rec
+}
+
+func readMARC(format string, r io.Reader, fn func(int, Book, error) error) error {
+	rd, err := marc.NewFormatReader(format, r)
+	if err != nil {
+		return err
+	}
+	for n := 1; ; n++ {
+		rec, err := rd.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			// a broken record leaves the stream position unknown; report and stop
+			return fn(n, Book{}, err)
+		}
+		if err := fn(n, BookFromMARC(rec), nil); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Service) exportMARC(ctx context.Context, format string, w io.Writer) error {
+	mw, err := marc.NewFormatWriter(format, w)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.EachBook(ctx, 500, func(b *Book) error {
+		return mw.Write(BookToMARC(b))
+	}); err != nil {
+		return err
+	}
+	return mw.Close()
+}
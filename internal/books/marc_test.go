@@ -0,0 +1,101 @@
+package books
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/erfnzmn/Library_Management_System/pkg/marc"
+)
+
+func TestBookMARCRoundTrip(t *testing.T) {
+	books := []Book{
+		{
+			ID:                7,
+			ISBN:              "9780451524935",
+			Title:             "Nineteen Eighty-Four: A Novel",
+			Author:            "George Orwell",
+			Publisher:         "Secker & Warburg",
+			YearOfPublication: 1949,
+			Edition:           "Centennial edition",
+			Genre:             "Fiction",
+			Language:          "en",
+			Description:       "A dystopian novel about surveillance.",
+			Tags:              "Totalitarianism,Dystopias",
+			CreatedAt:         time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			ID:                8,
+			ISBN:              "9789643510172",
+			Title:             "بوف کور",
+			Author:            "صادق هدایت",
+			Publisher:         "امیرکبیر",
+			YearOfPublication: 1937,
+			Genre:             "رمان",
+			Language:          "fa",
+		},
+	}
+
+	for _, format := range []string{FormatMARC21, FormatMARCXML} {
+		var buf bytes.Buffer
+		w, err := marc.NewFormatWriter(format, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range books {
+			if err := w.Write(BookToMARC(&books[i])); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		var got []Book
+		err = readMARC(format, &buf, func(_ int, b Book, err error) error {
+			if err != nil {
+				t.Fatalf("%s: %v", format, err)
+			}
+			got = append(got, b)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(books) {
+			t.Fatalf("%s: read %d books, want %d", format, len(got), len(books))
+		}
+		for i, want := range books {
+			// only the catalogue fields travel through MARC
+			want.ID, want.CreatedAt = 0, time.Time{}
+			if got[i] != want {
+				t.Errorf("%s: got %+v\nwant %+v", format, got[i], want)
+			}
+		}
+	}
+}
+
+func TestBookFromMARCPunctuation(t *testing.T) {
+	rec := marc.NewRecord()
+	rec.AddControlField("008", "240101s1937    ir            000 1 per d")
+	rec.AddDataField("020", ' ', ' ', "a", "978-964-351-017-2 (pbk.)")
+	rec.AddDataField("100", '1', ' ', "a", "Hedayat, Sadegh,")
+	rec.AddDataField("245", '1', '0', "a", "The blind owl /", "c", "Sadegh Hedayat.")
+	rec.AddDataField("260", ' ', ' ', "b", "Grove Press,", "c", "c1957.")
+	rec.AddDataField("650", ' ', '0', "a", "Persian fiction.")
+
+	b := BookFromMARC(rec)
+	want := Book{
+		ISBN:              "978-964-351-017-2",
+		Title:             "The blind owl",
+		Author:            "Hedayat, Sadegh",
+		Publisher:         "Grove Press",
+		YearOfPublication: 1957,
+		Genre:             "Persian fiction",
+		Tags:              "Persian fiction",
+		Language:          "fa",
+	}
+	if b != want {
+		t.Errorf("got %+v\nwant %+v", b, want)
+	}
+}
@@ -20,11 +20,16 @@ type Book struct {
 
 	ReservationStatus string `gorm:"type:enum('available','reserved');default:'available'" json:"reservation_status"`
 	SellingStatus     string `gorm:"type:enum('available','sold_out');default:'available'" json:"selling_status"`
+	SaleStock         int    `gorm:"not null;default:0" json:"sale_stock"` // copies for sale
 
 	CoverImage string  `gorm:"type:varchar(255)" json:"cover_image"`
 	Tags       string  `gorm:"type:varchar(255)" json:"tags"`
 	Price      float64 `gorm:"default:0" json:"price"`
 
+	// Version guards catalogue edits (optimistic locking): an update must
+	// carry the version it was based on. Stock changes do not bump it.
+	Version uint `gorm:"not null;default:1" json:"version"`
+
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
 	DeletedAt *time.Time `gorm:"index" json:"deleted_at"`
@@ -39,3 +44,90 @@ type Favorite struct {
 func (Book) TableName() string {
 	return "books"
 }
+
+const (
+	CopyStatusAvailable = "available"
+	CopyStatusOnLoan    = "on_loan"
+	CopyStatusReserved  = "reserved"
+	CopyStatusLost      = "lost"
+	CopyStatusWithdrawn = "withdrawn"
+	CopyStatusForSale   = "for_sale" // sales inventory, not lent
+	CopyStatusSold      = "sold"
+)
+
+const (
+	ConditionNew     = "new"
+	ConditionGood    = "good"
+	ConditionWorn    = "worn"
+	ConditionDamaged = "damaged"
+)
+
+// BookCopy is a single physical item of a Book. Availability of a title is
+// derived from the status of its copies; Book.Stock mirrors the number of
+// available copies and Book.SaleStock the number of copies for sale.
+type BookCopy struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	BookID        uint       `gorm:"not null;index;index:idx_book_copies_book_status,priority:1" json:"book_id"`
+	Barcode       string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"barcode"`
+	ShelfLocation string     `gorm:"type:varchar(100)" json:"shelf_location"`
+	Condition     string     `gorm:"type:enum('new','good','worn','damaged');default:'good'" json:"condition"`
+	AcquiredAt    *time.Time `json:"acquired_at,omitempty"`
+	Status        string     `gorm:"type:enum('available','on_loan','reserved','lost','withdrawn','for_sale','sold');not null;default:'available';index;index:idx_book_copies_book_status,priority:2" json:"status"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (BookCopy) TableName() string {
+	return "book_copies"
+}
+
+func IsValidCopyStatus(status string) bool {
+	switch status {
+	case CopyStatusAvailable, CopyStatusOnLoan, CopyStatusReserved, CopyStatusLost, CopyStatusWithdrawn,
+		CopyStatusForSale, CopyStatusSold:
+		return true
+	}
+	return false
+}
+
+func IsValidCondition(condition string) bool {
+	switch condition {
+	case ConditionNew, ConditionGood, ConditionWorn, ConditionDamaged:
+		return true
+	}
+	return false
+}
+
+// ListQuery describes one page of the catalogue listing.
+type ListQuery struct {
+	Genre             string   `json:"genre,omitempty"`
+	Language          string   `json:"language,omitempty"`
+	Tags              []string `json:"tags,omitempty"`
+	YearFrom          int      `json:"year_from,omitempty"`
+	YearTo            int      `json:"year_to,omitempty"`
+	ReservationStatus string   `json:"reservation_status,omitempty"`
+	SellingStatus     string   `json:"selling_status,omitempty"`
+	PriceMin          *float64 `json:"price_min,omitempty"`
+	PriceMax          *float64 `json:"price_max,omitempty"`
+	Sort              string   `json:"sort,omitempty"`
+	Order             string   `json:"order,omitempty"`
+	Page              int      `json:"page"`
+	PageSize          int      `json:"page_size"`
+}
+
+type ListResult struct {
+	Items      []Book `json:"items"`
+	Total      int64  `json:"total"`
+	Page       int    `json:"page"`
+	PageSize   int    `json:"page_size"`
+	TotalPages int    `json:"total_pages"`
+	Next       string `json:"next,omitempty"`
+	Prev       string `json:"prev,omitempty"`
+}
+
+// SearchResult is a book with its relevance score for the search query.
+type SearchResult struct {
+	Book
+	Score float64 `json:"score"`
+}
@@ -2,8 +2,11 @@ package books
 
 import (
 	"context"
+	"errors"
+	"strings"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Repository struct {
@@ -13,22 +16,130 @@ type Repository struct {
 func NewRepository(db *gorm.DB) *Repository {
 	return &Repository{db: db}
 }
+// WithTx returns a repository bound to the given transaction.
+func (r *Repository) WithTx(tx *gorm.DB) *Repository {
+	return &Repository{db: tx}
+}
+
+// normalizeTags trims the tags of a comma-separated list and drops empty
+// ones, so that stored lists have no spaces around their commas.
+func normalizeTags(tags string) string {
+	var out []string
+	for _, t := range strings.Split(tags, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			out = append(out, t)
+		}
+	}
+	return strings.Join(out, ",")
+}
+
 func (r *Repository) CreateBook(ctx context.Context, book *Book) error {
+	book.Tags = normalizeTags(book.Tags)
 	return r.db.WithContext(ctx).Create(book).Error
 }
+// UpdateBook writes book if the stored row is still at book.Version, and
+// bumps the version; otherwise it returns ErrVersionConflict. Stock and
+// availability are derived from copies and never written here.
 func (r *Repository) UpdateBook(ctx context.Context, book *Book) error {
-	return r.db.WithContext(ctx).Save(book).Error
+	expected := book.Version
+	book.Version = expected + 1
+	book.Tags = normalizeTags(book.Tags)
+	res := r.db.WithContext(ctx).Model(book).
+		Where("version = ?", expected).
+		Select("*").
+		Omit("id", "stock", "sale_stock", "reservation_status", "selling_status", "created_at", "deleted_at").
+		Updates(book)
+	if res.Error == nil && res.RowsAffected == 0 {
+		res.Error = ErrVersionConflict
+	}
+	if res.Error != nil {
+		book.Version = expected
+	}
+	return res.Error
 }
+// MergeBook updates the non-zero fields of book; stock, sale stock and
+// availability are derived from copies and never written here.
+func (r *Repository) MergeBook(ctx context.Context, book *Book) error {
+	book.Tags = normalizeTags(book.Tags)
+	if err := r.db.WithContext(ctx).Model(&Book{ID: book.ID}).
+		Omit("stock", "sale_stock", "reservation_status", "selling_status", "created_at", "version").
+		Updates(book).Error; err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Model(&Book{ID: book.ID}).
+		UpdateColumn("version", gorm.Expr("version + 1")).Error
+}
+
 func (r *Repository) DeleteBook(ctx context.Context, id uint) error {
 	return r.db.WithContext(ctx).Delete(&Book{}, id).Error
 }
 
-func (r *Repository) ListBooks(ctx context.Context) ([]Book, error) {
+// sortColumns whitelists the sort keys accepted by ListBooks
+var sortColumns = map[string]string{
+	"id":         "id",
+	"title":      "title",
+	"author":     "author",
+	"year":       "year_of_publication",
+	"price":      "price",
+	"created_at": "created_at",
+}
+
+func (r *Repository) ListBooks(ctx context.Context, q ListQuery) ([]Book, int64, error) {
+	db := r.db.WithContext(ctx).Model(&Book{})
+	if q.Genre != "" {
+		db = db.Where("genre = ?", q.Genre)
+	}
+	if q.Language != "" {
+		db = db.Where("language = ?", q.Language)
+	}
+	// spaces are stripped on both sides, which also covers lists stored
+	// before tags were normalized
+	for _, tag := range q.Tags {
+		db = db.Where("FIND_IN_SET(?, REPLACE(tags, ' ', '')) > 0", strings.ReplaceAll(tag, " ", ""))
+	}
+	if q.YearFrom > 0 {
+		db = db.Where("year_of_publication >= ?", q.YearFrom)
+	}
+	if q.YearTo > 0 {
+		db = db.Where("year_of_publication <= ?", q.YearTo)
+	}
+	if q.ReservationStatus != "" {
+		db = db.Where("reservation_status = ?", q.ReservationStatus)
+	}
+	if q.SellingStatus != "" {
+		db = db.Where("selling_status = ?", q.SellingStatus)
+	}
+	if q.PriceMin != nil {
+		db = db.Where("price >= ?", *q.PriceMin)
+	}
+	if q.PriceMax != nil {
+		db = db.Where("price <= ?", *q.PriceMax)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	column, ok := sortColumns[q.Sort]
+	if !ok {
+		column = "id"
+	}
+	order := "ASC"
+	if q.Order == "desc" {
+		order = "DESC"
+	}
+
 	var books []Book
-	if err := r.db.WithContext(ctx).Find(&books).Error; err != nil {
-		return nil, err
+	if err := db.
+		Order(column + " " + order).
+		Order("id " + order).
+		Offset((q.Page - 1) * q.PageSize).
+		Limit(q.PageSize).
+		Find(&books).Error; err != nil {
+		return nil, 0, err
 	}
-	return books, nil
+	return books, total, nil
 }
 
 func (r *Repository) FindBookByID(ctx context.Context, id uint) (*Book, error) {
@@ -43,6 +154,37 @@ func (r *Repository) SaveBook(ctx context.Context, book *Book) error {
 	return r.db.WithContext(ctx).Create(book).Error
 }
 
+// LockBook reads a book and locks its row until the transaction ends.
+// Whatever changes the copies of a book in a transaction locks the book
+// first, so reservations, checkouts and returns of one book take turns
+// instead of deadlocking.
+func (r *Repository) LockBook(ctx context.Context, id uint) (*Book, error) {
+	var book Book
+	if err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&book, id).Error; err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+// LockBooks locks several books, in ID order so that two transactions
+// locking overlapping sets cannot deadlock.
+func (r *Repository) LockBooks(ctx context.Context, ids []uint) ([]Book, error) {
+	var books []Book
+	if len(ids) == 0 {
+		return books, nil
+	}
+	if err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", ids).
+		Order("id ASC").
+		Find(&books).Error; err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
 func (r *Repository) GetBookByID(ctx context.Context, id uint) (*Book, error) {
 	var book Book
 	if err := r.db.WithContext(ctx).First(&book, id).Error; err != nil {
@@ -60,6 +202,42 @@ func (r *Repository) SearchBooks(ctx context.Context, q string) ([]Book, error)
 	}
 	return books, nil
 }
+func (r *Repository) FindByISBN(ctx context.Context, isbn string) (*Book, error) {
+	var book Book
+	err := r.db.WithContext(ctx).Where("isbn = ?", isbn).First(&book).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+func (r *Repository) GetBooksByIDs(ctx context.Context, ids []uint) ([]Book, error) {
+	var books []Book
+	if len(ids) == 0 {
+		return books, nil
+	}
+	if err := r.db.WithContext(ctx).Where("id IN ?", ids).Find(&books).Error; err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+// EachBook walks the whole catalogue in batches without loading it at once.
+func (r *Repository) EachBook(ctx context.Context, batchSize int, fn func(*Book) error) error {
+	var batch []Book
+	return r.db.WithContext(ctx).Order("id ASC").FindInBatches(&batch, batchSize, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			if err := fn(&batch[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
 func (r *Repository) Exists(ctx context.Context, id uint) (bool, error) {
 	var count int64
 	if err := r.db.WithContext(ctx).Model(&Book{}).Where("id = ?", id).Count(&count).Error; err != nil {
@@ -86,3 +264,160 @@ func (r *Repository) GetFavoritesByUser(ctx context.Context, userID int) ([]Book
 	}
 	return books, nil
 }
+
+func (r *Repository) CreateCopy(ctx context.Context, bc *BookCopy) error {
+	return r.db.WithContext(ctx).Create(bc).Error
+}
+
+// UpdateCopy writes bc if the stored copy is still in status; it reports
+// false, writing nothing, when the copy changed status meanwhile.
+func (r *Repository) UpdateCopy(ctx context.Context, bc *BookCopy, status string) (bool, error) {
+	res := r.db.WithContext(ctx).Model(bc).
+		Where("status = ?", status).
+		Select("*").
+		Omit("id", "created_at").
+		Updates(bc)
+	if res.Error != nil || res.RowsAffected > 0 {
+		return res.RowsAffected > 0, res.Error
+	}
+	// MySQL counts a row written with the values it already had as not
+	// affected; that is not a conflict
+	var n int64
+	err := r.db.WithContext(ctx).Model(&BookCopy{}).
+		Where("id = ? AND status = ?", bc.ID, status).
+		Count(&n).Error
+	return n > 0, err
+}
+
+// DeleteCopy deletes a copy if it is still in status.
+func (r *Repository) DeleteCopy(ctx context.Context, id uint, status string) (bool, error) {
+	res := r.db.WithContext(ctx).
+		Where("id = ? AND status = ?", id, status).
+		Delete(&BookCopy{})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *Repository) GetCopyByID(ctx context.Context, id uint) (*BookCopy, error) {
+	var bc BookCopy
+	if err := r.db.WithContext(ctx).First(&bc, id).Error; err != nil {
+		return nil, err
+	}
+	return &bc, nil
+}
+
+func (r *Repository) ListCopiesByBook(ctx context.Context, bookID uint) ([]BookCopy, error) {
+	var copies []BookCopy
+	if err := r.db.WithContext(ctx).
+		Where("book_id = ?", bookID).
+		Order("id ASC").
+		Find(&copies).Error; err != nil {
+		return nil, err
+	}
+	return copies, nil
+}
+
+// FindAvailableCopy returns the oldest available copy of a book, or nil when
+// every copy is reserved, on loan or out of circulation.
+// Inside a transaction the copy stays locked until it ends.
+func (r *Repository) FindAvailableCopy(ctx context.Context, bookID uint) (*BookCopy, error) {
+	var bc BookCopy
+	err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("book_id = ? AND status = ?", bookID, CopyStatusAvailable).
+		Order("id ASC").
+		First(&bc).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &bc, nil
+}
+
+func (r *Repository) CountCopiesByStatus(ctx context.Context, bookID uint, status string) (int64, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&BookCopy{}).
+		Where("book_id = ? AND status = ?", bookID, status).
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// SyncAvailability recomputes Stock, SaleStock, ReservationStatus and
+// SellingStatus of a book from the status of its copies. SellingStatus
+// only flips to sold_out once copies have actually been sold.
+func (r *Repository) SyncAvailability(ctx context.Context, bookID uint) error {
+	available, err := r.CountCopiesByStatus(ctx, bookID, CopyStatusAvailable)
+	if err != nil {
+		return err
+	}
+	forSale, err := r.CountCopiesByStatus(ctx, bookID, CopyStatusForSale)
+	if err != nil {
+		return err
+	}
+	status := "available"
+	if available == 0 {
+		status = "reserved"
+	}
+	updates := map[string]any{"stock": available, "sale_stock": forSale, "reservation_status": status}
+	if forSale > 0 {
+		updates["selling_status"] = "available"
+	} else {
+		sold, err := r.CountCopiesByStatus(ctx, bookID, CopyStatusSold)
+		if err != nil {
+			return err
+		}
+		if sold > 0 {
+			updates["selling_status"] = "sold_out"
+		}
+	}
+	return r.db.WithContext(ctx).Model(&Book{}).
+		Where("id = ?", bookID).
+		Updates(updates).Error
+}
+
+// FindCopiesForSale returns up to n copies of a book that are for sale,
+// locked until the transaction ends.
+func (r *Repository) FindCopiesForSale(ctx context.Context, bookID uint, n int) ([]BookCopy, error) {
+	var copies []BookCopy
+	if err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("book_id = ? AND status = ?", bookID, CopyStatusForSale).
+		Order("id ASC").
+		Limit(n).
+		Find(&copies).Error; err != nil {
+		return nil, err
+	}
+	return copies, nil
+}
+
+// SetCopiesStatus changes the status of several copies at once.
+func (r *Repository) SetCopiesStatus(ctx context.Context, ids []uint, status string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Model(&BookCopy{}).
+		Where("id IN ?", ids).
+		Update("status", status).Error
+}
+
+// TransitionCopies moves copies from one status to another and returns how
+// many were still in the from status; the others are left alone. Callers
+// compare the count to claim copies atomically.
+func (r *Repository) TransitionCopies(ctx context.Context, ids []uint, from, to string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	res := r.db.WithContext(ctx).Model(&BookCopy{}).
+		Where("id IN ? AND status = ?", ids, from).
+		Update("status", to)
+	return res.RowsAffected, res.Error
+}
+
+func (r *Repository) SetCopyStatus(ctx context.Context, id uint, status string) error {
+	return r.db.WithContext(ctx).Model(&BookCopy{}).
+		Where("id = ?", id).
+		Update("status", status).Error
+}
@@ -2,65 +2,235 @@ package books
 
 import (
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+
+	"github.com/erfnzmn/Library_Management_System/internal/metadata"
+	"github.com/erfnzmn/Library_Management_System/internal/outbox"
+	"github.com/erfnzmn/Library_Management_System/internal/search"
+	"github.com/erfnzmn/Library_Management_System/pkg/isbn"
+)
+
+var (
+	ErrCopyNotFound      = errors.New("copy not found")
+	ErrInvalidCopyStatus = errors.New("invalid copy status")
+	ErrInvalidCondition  = errors.New("invalid copy condition")
+	ErrCopyInUse         = errors.New("copy is reserved or on loan")
+	ErrCopyChanged       = errors.New("COPY_CHANGED: the copy changed meanwhile; reload it and try again")
+	ErrBarcodeRequired   = errors.New("barcode is required")
+	ErrInvalidListQuery  = errors.New("invalid list query")
+	ErrDuplicateISBN     = errors.New("a book with this ISBN already exists")
+	ErrNoMetadata        = errors.New("ISBN metadata lookup is not configured")
+	ErrVersionConflict   = errors.New("VERSION_CONFLICT: the book was changed meanwhile; reload it and try again")
+	ErrVersionRequired   = errors.New("VERSION_REQUIRED: send the version of the book being edited")
 )
 
 type Service struct {
-	repo  *Repository
-	cache *redis.Client
+	repo     *Repository
+	cache    *redis.Client
+	index    search.Index
+	metadata metadata.Provider
+	outbox   *outbox.Repository
+
+	// onAvailable runs after copies of a book change, e.g. so the loans
+	// module can hand a new copy to a waiting hold
+	onAvailable func(ctx context.Context, bookID uint)
 }
 
 func NewService(repo *Repository, cache *redis.Client) *Service {
 	return &Service{repo: repo, cache: cache}
 }
 
+// SetSearchIndex plugs a full-text index into the service. Without one,
+// SearchBooks falls back to LIKE matching on title and author.
+func (s *Service) SetSearchIndex(index search.Index) {
+	s.index = index
+}
+
 func (s *Service) cacheKey(id uint) string {
 	return fmt.Sprintf("book:%d", id)
 }
 
-func (s *Service) cacheListKey() string {
-	return "books:all"
+// cacheListVersionKey is bumped on every write so that cached list pages of
+// older versions are never served again and simply expire.
+func (s *Service) cacheListVersionKey() string {
+	return "books:list:version"
+}
+
+func (s *Service) cacheListKey(ctx context.Context, q ListQuery) string {
+	version := "0"
+	if s.cache != nil {
+		if v, err := s.cache.Get(ctx, s.cacheListVersionKey()).Result(); err == nil {
+			version = v
+		}
+	}
+	raw, _ := json.Marshal(q)
+	sum := sha1.Sum(raw)
+	return fmt.Sprintf("books:list:v%s:%s", version, hex.EncodeToString(sum[:]))
+}
+
+// SetOutbox records BookCreated, BookUpdated and BookDeleted events with
+// the changes they describe.
+func (s *Service) SetOutbox(o *outbox.Repository) {
+	s.outbox = o
+}
+
+// transaction runs fn with the repository and the outbox bound to one
+// transaction; events is nil when no outbox is set.
+func (s *Service) transaction(ctx context.Context, fn func(repo *Repository, events *outbox.Repository) error) error {
+	return s.repo.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var events *outbox.Repository
+		if s.outbox != nil {
+			events = s.outbox.WithTx(tx)
+		}
+		return fn(s.repo.WithTx(tx), events)
+	})
+}
+
+func record(ctx context.Context, events *outbox.Repository, typ string, bookID uint, payload any) error {
+	if events == nil {
+		return nil
+	}
+	ev, err := outbox.NewEvent(typ, "book", bookID, payload)
+	if err != nil {
+		return err
+	}
+	return events.Add(ctx, ev)
+}
+
+// SetMetadataProvider enables ImportByISBN.
+func (s *Service) SetMetadataProvider(p metadata.Provider) {
+	s.metadata = p
+}
+
+// SetAvailabilityHook registers fn to run after copies are added or change
+// status through the catalogue.
+func (s *Service) SetAvailabilityHook(fn func(ctx context.Context, bookID uint)) {
+	s.onAvailable = fn
+}
+
+func (s *Service) invalidate(ctx context.Context, keys ...string) {
+	if s.cache == nil {
+		return
+	}
+	if len(keys) > 0 {
+		s.cache.Del(ctx, keys...)
+	}
+	s.cache.Incr(ctx, s.cacheListVersionKey())
 }
 
 // CreateBook — هم دیتا ذخیره میشه، هم کش پاک میشه
+// Stock اولیه به تعداد نسخه‌های فیزیکی تبدیل می‌شود
 func (s *Service) CreateBook(ctx context.Context, book *Book) error {
-	if err := s.repo.CreateBook(ctx, book); err != nil {
+	err := s.transaction(ctx, func(repo *Repository, events *outbox.Repository) error {
+		if err := createWithCopies(ctx, repo, book); err != nil {
+			return err
+		}
+		return record(ctx, events, outbox.BookCreated, book.ID, book)
+	})
+	if err != nil {
 		return err
 	}
+	s.indexBook(ctx, book)
 	// پاک‌سازی کش
-	s.cache.Del(ctx, s.cacheListKey())
+	s.invalidate(ctx)
 	return nil
 }
 
+func createWithCopies(ctx context.Context, repo *Repository, book *Book) error {
+	book.Version = 1
+	if err := repo.CreateBook(ctx, book); err != nil {
+		return err
+	}
+	for i := 0; i < book.Stock; i++ {
+		bc := &BookCopy{
+			BookID:  book.ID,
+			Barcode: fmt.Sprintf("BK%06d-%03d", book.ID, i+1),
+			Status:  CopyStatusAvailable,
+		}
+		if err := repo.CreateCopy(ctx, bc); err != nil {
+			return err
+		}
+	}
+	// the column default must not leave a phantom unit of stock behind
+	if err := repo.SyncAvailability(ctx, book.ID); err != nil {
+		return err
+	}
+	book.ReservationStatus = "available"
+	if book.Stock <= 0 {
+		book.Stock = 0
+		book.ReservationStatus = "reserved"
+	}
+	return nil
+}
+
+// UpdateBook — Stock و ReservationStatus از روی نسخه‌ها محاسبه می‌شوند
 func (s *Service) UpdateBook(ctx context.Context, book *Book) error {
-	if err := s.repo.UpdateBook(ctx, book); err != nil {
+	// every edit must say which version it was based on
+	if book.Version == 0 {
+		return ErrVersionRequired
+	}
+	err := s.transaction(ctx, func(repo *Repository, events *outbox.Repository) error {
+		if _, err := repo.LockBook(ctx, book.ID); err != nil {
+			return err
+		}
+		if err := repo.UpdateBook(ctx, book); err != nil {
+			return err
+		}
+		if err := repo.SyncAvailability(ctx, book.ID); err != nil {
+			return err
+		}
+		if fresh, err := repo.GetBookByID(ctx, book.ID); err == nil {
+			*book = *fresh
+		}
+		return record(ctx, events, outbox.BookUpdated, book.ID, book)
+	})
+	if err != nil {
 		return err
 	}
-	s.cache.Del(ctx, s.cacheKey(book.ID))
-	s.cache.Del(ctx, s.cacheListKey())
+	s.indexBook(ctx, book)
+	s.invalidate(ctx, s.cacheKey(book.ID))
 	return nil
 }
 
 func (s *Service) DeleteBook(ctx context.Context, id uint) error {
-	if err := s.repo.DeleteBook(ctx, id); err != nil {
+	err := s.transaction(ctx, func(repo *Repository, events *outbox.Repository) error {
+		if err := repo.DeleteBook(ctx, id); err != nil {
+			return err
+		}
+		return record(ctx, events, outbox.BookDeleted, id, map[string]uint{"id": id})
+	})
+	if err != nil {
 		return err
 	}
-	s.cache.Del(ctx, s.cacheKey(id))
-	s.cache.Del(ctx, s.cacheListKey())
+	if s.index != nil {
+		if err := s.index.Remove(ctx, id); err != nil {
+			log.Printf("search: remove book %d: %v", id, err)
+		}
+	}
+	s.invalidate(ctx, s.cacheKey(id))
 	return nil
 }
 
 func (s *Service) GetBookByID(ctx context.Context, id uint) (*Book, error) {
 	key := s.cacheKey(id)
-	val, err := s.cache.Get(ctx, key).Result()
-	if err == nil {
-		var b Book
-		if json.Unmarshal([]byte(val), &b) == nil {
-			return &b, nil
+	if s.cache != nil {
+		val, err := s.cache.Get(ctx, key).Result()
+		if err == nil {
+			var b Book
+			if json.Unmarshal([]byte(val), &b) == nil {
+				return &b, nil
+			}
 		}
 	}
 
@@ -68,32 +238,160 @@ func (s *Service) GetBookByID(ctx context.Context, id uint) (*Book, error) {
 	if err != nil {
 		return nil, err
 	}
-	data, _ := json.Marshal(book)
-	s.cache.Set(ctx, key, data, 10*time.Minute)
+	if s.cache != nil {
+		data, _ := json.Marshal(book)
+		s.cache.Set(ctx, key, data, 10*time.Minute)
+	}
 	return book, nil
 }
 
-func (s *Service) ListBooks(ctx context.Context) ([]Book, error) {
-	key := s.cacheListKey()
-	val, err := s.cache.Get(ctx, key).Result()
-	if err == nil {
-		var books []Book
-		if json.Unmarshal([]byte(val), &books) == nil {
-			return books, nil
+func (s *Service) ListBooks(ctx context.Context, q ListQuery) (*ListResult, error) {
+	if err := q.normalize(); err != nil {
+		return nil, err
+	}
+
+	key := s.cacheListKey(ctx, q)
+	if s.cache != nil {
+		val, err := s.cache.Get(ctx, key).Result()
+		if err == nil {
+			var res ListResult
+			if json.Unmarshal([]byte(val), &res) == nil {
+				return &res, nil
+			}
+		}
+	}
+
+	items, total, err := s.repo.ListBooks(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []Book{}
+	}
+	res := &ListResult{
+		Items:      items,
+		Total:      total,
+		Page:       q.Page,
+		PageSize:   q.PageSize,
+		TotalPages: int((total + int64(q.PageSize) - 1) / int64(q.PageSize)),
+	}
+	if s.cache != nil {
+		data, _ := json.Marshal(res)
+		s.cache.Set(ctx, key, data, 5*time.Minute)
+	}
+	return res, nil
+}
+
+const searchLimit = 50
+
+// SearchBooks ranks books by relevance. See search.ParseQuery for the syntax.
+func (s *Service) SearchBooks(ctx context.Context, q string) ([]SearchResult, error) {
+	if s.index == nil {
+		books, err := s.repo.SearchBooks(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		results := make([]SearchResult, len(books))
+		for i, b := range books {
+			results[i] = SearchResult{Book: b}
 		}
+		return results, nil
 	}
 
-	books, err := s.repo.ListBooks(ctx)
+	hits, err := s.index.Search(ctx, search.ParseQuery(q), searchLimit)
 	if err != nil {
 		return nil, err
 	}
-	data, _ := json.Marshal(books)
-	s.cache.Set(ctx, key, data, 5*time.Minute)
-	return books, nil
+	ids := make([]uint, len(hits))
+	for i, h := range hits {
+		ids[i] = h.ID
+	}
+	books, err := s.repo.GetBooksByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]Book, len(books))
+	for _, b := range books {
+		byID[b.ID] = b
+	}
+
+	results := make([]SearchResult, 0, len(hits))
+	for _, h := range hits {
+		if b, ok := byID[h.ID]; ok {
+			results = append(results, SearchResult{Book: b, Score: h.Score})
+		}
+	}
+	return results, nil
+}
+
+// RebuildSearchIndex feeds every book into the search index, e.g. on start-up
+// for the in-memory index.
+func (s *Service) RebuildSearchIndex(ctx context.Context) error {
+	if s.index == nil {
+		return nil
+	}
+	return s.repo.EachBook(ctx, 500, func(b *Book) error {
+		return s.index.Index(ctx, searchDocument(b))
+	})
+}
+
+func (s *Service) indexBook(ctx context.Context, b *Book) {
+	if s.index == nil {
+		return
+	}
+	if err := s.index.Index(ctx, searchDocument(b)); err != nil {
+		log.Printf("search: index book %d: %v", b.ID, err)
+	}
+}
+
+func searchDocument(b *Book) search.Document {
+	return search.Document{
+		ID:          b.ID,
+		Title:       b.Title,
+		Author:      b.Author,
+		ISBN:        b.ISBN,
+		Tags:        b.Tags,
+		Description: b.Description,
+	}
 }
 
-func (s *Service) SearchBooks(ctx context.Context, q string) ([]Book, error) {
-	return s.repo.SearchBooks(ctx, q)
+// ImportByISBN creates a book from provider metadata. Fields already set on
+// base (genre, price, stock, ...) are kept; provider values fill the rest.
+func (s *Service) ImportByISBN(ctx context.Context, rawISBN string, base *Book) error {
+	if s.metadata == nil {
+		return ErrNoMetadata
+	}
+	code, err := isbn.Normalize(rawISBN)
+	if err != nil {
+		return err
+	}
+	if existing, err := s.repo.FindByISBN(ctx, code); err != nil {
+		return err
+	} else if existing != nil {
+		return ErrDuplicateISBN
+	}
+
+	rec, err := s.metadata.Lookup(ctx, code)
+	if err != nil {
+		return err
+	}
+
+	base.ISBN = code
+	fill := func(dst *string, v string) {
+		if *dst == "" {
+			*dst = v
+		}
+	}
+	fill(&base.Title, rec.Title)
+	fill(&base.Author, rec.Author)
+	fill(&base.Publisher, rec.Publisher)
+	fill(&base.Edition, rec.Edition)
+	fill(&base.Language, rec.Language)
+	fill(&base.CoverImage, rec.CoverImage)
+	if base.YearOfPublication == 0 {
+		base.YearOfPublication = rec.YearOfPublication
+	}
+	return s.CreateBook(ctx, base)
 }
 
 func (s *Service) AddToFavorites(ctx context.Context, userID, bookID uint) error {
@@ -103,3 +401,192 @@ func (s *Service) AddToFavorites(ctx context.Context, userID, bookID uint) error
 func (s *Service) GetFavoritesByUser(ctx context.Context, userID int) ([]Book, error) {
 	return s.repo.GetFavoritesByUser(ctx, userID)
 }
+
+func (s *Service) ListCopies(ctx context.Context, bookID uint) ([]BookCopy, error) {
+	if _, err := s.repo.GetBookByID(ctx, bookID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListCopiesByBook(ctx, bookID)
+}
+
+func (s *Service) GetCopy(ctx context.Context, bookID, copyID uint) (*BookCopy, error) {
+	return getCopy(ctx, s.repo, bookID, copyID)
+}
+
+func getCopy(ctx context.Context, repo *Repository, bookID, copyID uint) (*BookCopy, error) {
+	bc, err := repo.GetCopyByID(ctx, copyID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCopyNotFound
+		}
+		return nil, err
+	}
+	if bc.BookID != bookID {
+		return nil, ErrCopyNotFound
+	}
+	return bc, nil
+}
+
+// copyTransaction runs a copy edit with the book locked, the way the loans
+// and sales modules change copies, so staff edits and reservations of one
+// book take turns. The book is re-synced in the same transaction.
+func (s *Service) copyTransaction(ctx context.Context, bookID uint, fn func(repo *Repository) error) error {
+	err := s.transaction(ctx, func(repo *Repository, _ *outbox.Repository) error {
+		if _, err := repo.LockBook(ctx, bookID); err != nil {
+			return err
+		}
+		if err := fn(repo); err != nil {
+			return err
+		}
+		return repo.SyncAvailability(ctx, bookID)
+	})
+	if err != nil {
+		return err
+	}
+	s.invalidate(ctx, s.cacheKey(bookID))
+	if s.onAvailable != nil {
+		s.onAvailable(ctx, bookID)
+	}
+	return nil
+}
+
+func (s *Service) AddCopy(ctx context.Context, bookID uint, bc *BookCopy) error {
+	bc.ID = 0
+	bc.BookID = bookID
+	if bc.Status == "" {
+		bc.Status = CopyStatusAvailable
+	}
+	if bc.Condition == "" {
+		bc.Condition = ConditionGood
+	}
+	if err := validateCopy(bc); err != nil {
+		return err
+	}
+	// نسخه‌های رزرو/امانت/فروخته‌شده فقط از طریق ماژول امانت و فروش ساخته می‌شوند
+	if isManagedStatus(bc.Status) {
+		return ErrInvalidCopyStatus
+	}
+	return s.copyTransaction(ctx, bookID, func(repo *Repository) error {
+		return repo.CreateCopy(ctx, bc)
+	})
+}
+
+// UpdateCopy — وضعیت reserved/on_loan/sold فقط توسط ماژول‌های امانت و فروش تغییر می‌کند
+func (s *Service) UpdateCopy(ctx context.Context, bookID uint, bc *BookCopy) error {
+	return s.copyTransaction(ctx, bookID, func(repo *Repository) error {
+		current, err := getCopy(ctx, repo, bookID, bc.ID)
+		if err != nil {
+			return err
+		}
+		if bc.Status == "" {
+			bc.Status = current.Status
+		}
+		if bc.Condition == "" {
+			bc.Condition = current.Condition
+		}
+		if err := validateCopy(bc); err != nil {
+			return err
+		}
+		inUse := isManagedStatus(current.Status)
+		if inUse && bc.Status != current.Status {
+			return ErrCopyInUse
+		}
+		if !inUse && isManagedStatus(bc.Status) {
+			return ErrInvalidCopyStatus
+		}
+		bc.BookID = bookID
+		bc.CreatedAt = current.CreatedAt
+		ok, err := repo.UpdateCopy(ctx, bc, current.Status)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrCopyChanged
+		}
+		return nil
+	})
+}
+
+func (s *Service) DeleteCopy(ctx context.Context, bookID, copyID uint) error {
+	return s.copyTransaction(ctx, bookID, func(repo *Repository) error {
+		current, err := getCopy(ctx, repo, bookID, copyID)
+		if err != nil {
+			return err
+		}
+		if isManagedStatus(current.Status) {
+			return ErrCopyInUse
+		}
+		ok, err := repo.DeleteCopy(ctx, copyID, current.Status)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrCopyChanged
+		}
+		return nil
+	})
+}
+
+// isManagedStatus reports statuses owned by the loans and sales modules.
+func isManagedStatus(status string) bool {
+	return status == CopyStatusReserved || status == CopyStatusOnLoan || status == CopyStatusSold
+}
+
+func validateCopy(bc *BookCopy) error {
+	if bc.Barcode == "" {
+		return ErrBarcodeRequired
+	}
+	if !IsValidCopyStatus(bc.Status) {
+		return ErrInvalidCopyStatus
+	}
+	if !IsValidCondition(bc.Condition) {
+		return ErrInvalidCondition
+	}
+	return nil
+}
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// normalize applies defaults and rejects values the repository cannot handle
+func (q *ListQuery) normalize() error {
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PageSize < 1 {
+		q.PageSize = defaultPageSize
+	}
+	if q.PageSize > maxPageSize {
+		q.PageSize = maxPageSize
+	}
+	if q.Sort == "" {
+		q.Sort = "id"
+	}
+	if _, ok := sortColumns[q.Sort]; !ok {
+		return fmt.Errorf("%w: unknown sort %q", ErrInvalidListQuery, q.Sort)
+	}
+	q.Order = strings.ToLower(q.Order)
+	if q.Order == "" {
+		q.Order = "asc"
+	}
+	if q.Order != "asc" && q.Order != "desc" {
+		return fmt.Errorf("%w: order must be asc or desc", ErrInvalidListQuery)
+	}
+	if q.YearFrom > 0 && q.YearTo > 0 && q.YearFrom > q.YearTo {
+		return fmt.Errorf("%w: year_from is after year_to", ErrInvalidListQuery)
+	}
+	if q.PriceMin != nil && q.PriceMax != nil && *q.PriceMin > *q.PriceMax {
+		return fmt.Errorf("%w: price_min is greater than price_max", ErrInvalidListQuery)
+	}
+	tags := q.Tags[:0]
+	for _, t := range q.Tags {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	sort.Strings(tags)
+	q.Tags = tags
+	return nil
+}
@@ -0,0 +1,183 @@
+package calendar
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dateKey is the layout used for holiday dates.
+const dateKey = "2006-01-02"
+
+// Hours are the opening hours of one weekday as minutes after midnight.
+// A closed day has Closed set.
+type Hours struct {
+	Closed bool `json:"closed"`
+	Open   int  `json:"open"`  // minutes after midnight
+	Close  int  `json:"close"` // minutes after midnight
+}
+
+// ParseHours reads "08:00-18:00" or "closed".
+func ParseHours(s string) (Hours, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" || s == "closed" {
+		return Hours{Closed: true}, nil
+	}
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return Hours{}, fmt.Errorf("calendar: invalid hours %q", s)
+	}
+	open, err := parseClock(from)
+	if err != nil {
+		return Hours{}, err
+	}
+	closing, err := parseClock(to)
+	if err != nil {
+		return Hours{}, err
+	}
+	if closing <= open {
+		return Hours{}, fmt.Errorf("calendar: closing time before opening time in %q", s)
+	}
+	return Hours{Open: open, Close: closing}, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("calendar: invalid time %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (h Hours) String() string {
+	if h.Closed {
+		return "closed"
+	}
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", h.Open/60, h.Open%60, h.Close/60, h.Close%60)
+}
+
+// Calendar knows when the library is open: weekly opening hours plus
+// holiday exceptions. Dates are civil dates in the library's time zone,
+// represented as midnight UTC (see DateOf). The zero weekly schedule is
+// open every day, so an unconfigured Calendar never changes a date.
+type Calendar struct {
+	loc *time.Location
+
+	mu       sync.RWMutex
+	weekly   [7]Hours          // indexed by time.Weekday; zero value = open, no hours
+	holidays map[string]string // dateKey -> name
+}
+
+func New(loc *time.Location) *Calendar {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return &Calendar{loc: loc, holidays: make(map[string]string)}
+}
+
+func (c *Calendar) Location() *time.Location { return c.loc }
+
+func (c *Calendar) SetWeekly(day time.Weekday, h Hours) {
+	c.mu.Lock()
+	c.weekly[day] = h
+	c.mu.Unlock()
+}
+
+func (c *Calendar) Weekly() [7]Hours {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.weekly
+}
+
+// SetHolidays replaces the holiday exceptions.
+func (c *Calendar) SetHolidays(holidays []Holiday) {
+	m := make(map[string]string, len(holidays))
+	for _, h := range holidays {
+		m[h.Date.Format(dateKey)] = h.Name
+	}
+	c.mu.Lock()
+	c.holidays = m
+	c.mu.Unlock()
+}
+
+// DateOf returns the civil date of t in the library's zone.
+func (c *Calendar) DateOf(t time.Time) time.Time {
+	y, m, d := t.In(c.loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// IsOpenOn reports whether the library opens on date (as from DateOf).
+func (c *Calendar) IsOpenOn(date time.Time) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if _, ok := c.holidays[date.Format(dateKey)]; ok {
+		return false
+	}
+	return !c.weekly[date.Weekday()].Closed
+}
+
+// maxClosedRun bounds the search for an open day so a calendar that is
+// closed every day cannot loop forever.
+const maxClosedRun = 366
+
+// NextOpenDay returns date itself when the library opens that day, or the
+// first open date after it.
+func (c *Calendar) NextOpenDay(date time.Time) time.Time {
+	for i := 0; i < maxClosedRun; i++ {
+		if c.IsOpenOn(date) {
+			return date
+		}
+		date = date.AddDate(0, 0, 1)
+	}
+	return date
+}
+
+// DueDate adds days to from and rolls the result forward to the next open
+// day. The due time is the closing time of that day when hours are known,
+// otherwise the time of day of from.
+func (c *Calendar) DueDate(from time.Time, days int) time.Time {
+	return c.rollForward(from.AddDate(0, 0, days))
+}
+
+func (c *Calendar) rollForward(t time.Time) time.Time {
+	local := t.In(c.loc)
+	date := c.NextOpenDay(c.DateOf(local))
+	if date.Equal(c.DateOf(local)) {
+		return t
+	}
+	c.mu.RLock()
+	h := c.weekly[date.Weekday()]
+	c.mu.RUnlock()
+	hour, min := local.Hour(), local.Minute()
+	if h.Close > 0 {
+		hour, min = h.Close/60, h.Close%60
+	}
+	return time.Date(date.Year(), date.Month(), date.Day(), hour, min, 0, 0, c.loc)
+}
+
+// Extend moves due forward by days and rolls it to the next open day; used
+// for renewals.
+func (c *Calendar) Extend(due time.Time, days int) time.Time {
+	return c.rollForward(due.AddDate(0, 0, days))
+}
+
+// PickupDeadline is from + window, extended by one day for every closed day
+// the window runs over, so patrons always get window worth of open days.
+func (c *Calendar) PickupDeadline(from time.Time, window time.Duration) time.Time {
+	deadline := from.Add(window)
+	for d := c.DateOf(from).AddDate(0, 0, 1); !d.After(c.DateOf(deadline)); d = d.AddDate(0, 0, 1) {
+		if !c.IsOpenOn(d) {
+			deadline = deadline.Add(24 * time.Hour)
+		}
+	}
+	return deadline
+}
+
+// HolidayName returns the name of the holiday on date, if any.
+func (c *Calendar) HolidayName(date time.Time) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	name, ok := c.holidays[date.Format(dateKey)]
+	return name, ok
+}
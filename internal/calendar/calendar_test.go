@@ -0,0 +1,152 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+)
+
+// tehran is fixed so the tests do not depend on the zone database.
+var tehran = time.FixedZone("IRST", 3*3600+1800)
+
+func at(day, hour, min int) time.Time {
+	return time.Date(2026, time.March, day, hour, min, 0, 0, tehran)
+}
+
+// testCalendar is open 08:00-18:00, 08:00-13:00 on Thursdays, closed on
+// Fridays and over Nowruz (21-24 March 2026, Saturday to Tuesday).
+func testCalendar() *Calendar {
+	c := New(tehran)
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		c.SetWeekly(d, Hours{Open: 8 * 60, Close: 18 * 60})
+	}
+	c.SetWeekly(time.Thursday, Hours{Open: 8 * 60, Close: 13 * 60})
+	c.SetWeekly(time.Friday, Hours{Closed: true})
+	var holidays []Holiday
+	for day := 21; day <= 24; day++ {
+		holidays = append(holidays, Holiday{Date: time.Date(2026, time.March, day, 0, 0, 0, 0, time.UTC), Name: "Nowruz"})
+	}
+	c.SetHolidays(holidays)
+	return c
+}
+
+func TestDueDate(t *testing.T) {
+	c := testCalendar()
+	from := at(10, 10, 30) // Tuesday
+	for _, tt := range []struct {
+		name string
+		from time.Time
+		days int
+		want time.Time
+	}{
+		{"open day keeps the time", from, 7, at(17, 10, 30)},
+		{"same day", from, 0, from},
+		{"Thursday keeps the time", from, 9, at(19, 10, 30)},
+		{"Friday rolls to Saturday's closing", from, 3, at(14, 18, 0)},
+		{"Friday and Nowruz roll to Wednesday", from, 10, at(25, 18, 0)},
+		{"holiday", from, 11, at(25, 18, 0)},
+		{"after the holidays", from, 16, at(26, 10, 30)},
+		// 22:00 UTC on Thursday is already Friday in Tehran
+		{"date in the library's zone", time.Date(2026, time.March, 12, 22, 0, 0, 0, time.UTC), 0, at(14, 18, 0)},
+	} {
+		if got := c.DueDate(tt.from, tt.days); !got.Equal(tt.want) {
+			t.Errorf("%s: DueDate(%v, %d) = %v, want %v", tt.name, tt.from, tt.days, got, tt.want)
+		}
+	}
+}
+
+func TestExtend(t *testing.T) {
+	c := testCalendar()
+	due := at(17, 18, 0)
+	for _, tt := range []struct {
+		days int
+		want time.Time
+	}{
+		{14, at(31, 18, 0)},
+		{3, at(25, 18, 0)},
+	} {
+		if got := c.Extend(due, tt.days); !got.Equal(tt.want) {
+			t.Errorf("Extend(%v, %d) = %v, want %v", due, tt.days, got, tt.want)
+		}
+	}
+}
+
+func TestDueDateWithoutHours(t *testing.T) {
+	c := New(tehran)
+	c.SetHolidays([]Holiday{{Date: time.Date(2026, time.March, 20, 0, 0, 0, 0, time.UTC)}})
+	from := at(10, 10, 30)
+	for _, tt := range []struct {
+		days int
+		want time.Time
+	}{
+		{3, at(13, 10, 30)}, // every day is open
+		{10, at(21, 10, 30)},
+	} {
+		if got := c.DueDate(from, tt.days); !got.Equal(tt.want) {
+			t.Errorf("DueDate(%v, %d) = %v, want %v", from, tt.days, got, tt.want)
+		}
+	}
+}
+
+func TestNextOpenDay(t *testing.T) {
+	c := testCalendar()
+	for _, tt := range []struct{ date, want int }{
+		{10, 10},
+		{13, 14},
+		{20, 25},
+		{24, 25},
+	} {
+		date := time.Date(2026, time.March, tt.date, 0, 0, 0, 0, time.UTC)
+		want := time.Date(2026, time.March, tt.want, 0, 0, 0, 0, time.UTC)
+		if got := c.NextOpenDay(date); !got.Equal(want) {
+			t.Errorf("NextOpenDay(%s) = %s, want %s", date.Format(dateKey), got.Format(dateKey), want.Format(dateKey))
+		}
+	}
+
+	closed := New(nil)
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		closed.SetWeekly(d, Hours{Closed: true})
+	}
+	start := time.Date(2026, time.March, 10, 0, 0, 0, 0, time.UTC)
+	if got := closed.NextOpenDay(start); got.Sub(start) != maxClosedRun*24*time.Hour {
+		t.Errorf("always closed: NextOpenDay = %s", got.Format(dateKey))
+	}
+}
+
+func TestPickupDeadline(t *testing.T) {
+	c := testCalendar()
+	for _, tt := range []struct {
+		name   string
+		from   time.Time
+		window time.Duration
+		want   time.Time
+	}{
+		{"open days", at(9, 12, 0), 24 * time.Hour, at(10, 12, 0)},
+		{"over a Friday", at(12, 12, 0), 48 * time.Hour, at(15, 12, 0)},
+		{"starting before a Friday", at(12, 12, 0), 12 * time.Hour, at(14, 0, 0)},
+	} {
+		if got := c.PickupDeadline(tt.from, tt.window); !got.Equal(tt.want) {
+			t.Errorf("%s: PickupDeadline(%v, %v) = %v, want %v", tt.name, tt.from, tt.window, got, tt.want)
+		}
+	}
+}
+
+func TestParseHours(t *testing.T) {
+	for _, tt := range []struct {
+		in      string
+		want    Hours
+		wantErr bool
+	}{
+		{"08:00-18:00", Hours{Open: 480, Close: 1080}, false},
+		{" 09:30 - 13:00 ", Hours{Open: 570, Close: 780}, false},
+		{"closed", Hours{Closed: true}, false},
+		{"", Hours{Closed: true}, false},
+		{"18:00-08:00", Hours{}, true},
+		{"8am-6pm", Hours{}, true},
+		{"08:00", Hours{}, true},
+	} {
+		got, err := ParseHours(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseHours(%q) = %+v, %v, want %+v (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package calendar
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/erfnzmn/Library_Management_System/pkg/middleware"
+	"github.com/labstack/echo/v4"
+)
+
+type Handler struct {
+	service   *Service
+	jwtSecret string
+}
+
+func NewHandler(service *Service, jwtSecret string) *Handler {
+	return &Handler{service: service, jwtSecret: jwtSecret}
+}
+
+// RegisterRoutes
+func (h *Handler) RegisterRoutes(e *echo.Echo) {
+	e.GET("/api/calendar", h.GetCalendar)
+
+	staff := []echo.MiddlewareFunc{
+		middleware.JWT(h.jwtSecret),
+		middleware.RequirePermission(middleware.PermCalendarManage),
+	}
+	e.POST("/api/calendar/holidays", h.AddHoliday, staff...)
+	e.DELETE("/api/calendar/holidays/:date", h.DeleteHoliday, staff...)
+	e.POST("/api/calendar/holidays/import", h.ImportICS, staff...)
+}
+
+// GetCalendar
+func (h *Handler) GetCalendar(c echo.Context) error {
+	view, err := h.service.View(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, view)
+}
+
+// AddHoliday
+func (h *Handler) AddHoliday(c echo.Context) error {
+	var req HolidayRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid input"})
+	}
+	holiday, err := h.service.AddHoliday(c.Request().Context(), req)
+	if err != nil {
+		return c.JSON(calendarErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, holiday)
+}
+
+// DeleteHoliday
+func (h *Handler) DeleteHoliday(c echo.Context) error {
+	if err := h.service.DeleteHoliday(c.Request().Context(), c.Param("date")); err != nil {
+		return c.JSON(calendarErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ImportICS accepts a text/calendar body or a multipart "file".
+func (h *Handler) ImportICS(c echo.Context) error {
+	var body io.Reader = c.Request().Body
+	if fh, err := c.FormFile("file"); err == nil {
+		f, err := fh.Open()
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+		defer f.Close()
+		body = f
+	}
+	report, err := h.service.ImportICS(c.Request().Context(), body)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+func calendarErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidDate):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrHolidayNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,149 @@
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Event is the part of an iCalendar VEVENT the calendar cares about.
+type Event struct {
+	UID     string
+	Summary string
+	Start   time.Time // first day, as a civil date
+	End     time.Time // exclusive
+}
+
+// Days returns the dates covered by the event.
+func (e Event) Days() []time.Time {
+	var days []time.Time
+	for d := e.Start; d.Before(e.End); d = d.AddDate(0, 0, 1) {
+		days = append(days, d)
+	}
+	return days
+}
+
+// ParseICS reads the VEVENTs of an iCalendar (RFC 5545) stream. Events are
+// treated as whole days closed; timed events close the days they touch in
+// loc. Recurrence rules are not expanded.
+func ParseICS(r io.Reader, loc *time.Location) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		events []Event
+		cur    *Event
+		hasEnd bool
+	)
+	for n, line := range lines {
+		name, params, value, ok := splitProperty(line)
+		if !ok {
+			continue
+		}
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			cur, hasEnd = &Event{}, false
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			if cur == nil {
+				continue
+			}
+			if cur.Start.IsZero() {
+				return nil, fmt.Errorf("calendar: event %q without DTSTART", cur.UID)
+			}
+			if !hasEnd || !cur.End.After(cur.Start) {
+				cur.End = cur.Start.AddDate(0, 0, 1)
+			}
+			events = append(events, *cur)
+			cur = nil
+		case cur == nil:
+			continue
+		case name == "UID":
+			cur.UID = value
+		case name == "SUMMARY":
+			cur.Summary = unescape(value)
+		case name == "DTSTART":
+			t, _, err := parseICSTime(value, params, loc)
+			if err != nil {
+				return nil, fmt.Errorf("calendar: line %d: %w", n+1, err)
+			}
+			cur.Start = t
+		case name == "DTEND":
+			t, allDay, err := parseICSTime(value, params, loc)
+			if err != nil {
+				return nil, fmt.Errorf("calendar: line %d: %w", n+1, err)
+			}
+			// DTEND of a timed event is inside its last day
+			if !allDay {
+				t = t.AddDate(0, 0, 1)
+			}
+			cur.End, hasEnd = t, true
+		}
+	}
+	return events, nil
+}
+
+// unfold joins continuation lines (RFC 5545 3.1).
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, sc.Err()
+}
+
+// splitProperty splits "DTSTART;VALUE=DATE:20250321" into its parts.
+func splitProperty(line string) (name string, params map[string]string, value string, ok bool) {
+	head, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return "", nil, "", false
+	}
+	parts := strings.Split(head, ";")
+	params = make(map[string]string, len(parts)-1)
+	for _, p := range parts[1:] {
+		if k, v, ok := strings.Cut(p, "="); ok {
+			params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return strings.ToUpper(parts[0]), params, strings.TrimSpace(value), true
+}
+
+// parseICSTime returns the civil date of an iCalendar DATE or DATE-TIME.
+func parseICSTime(value string, params map[string]string, loc *time.Location) (time.Time, bool, error) {
+	if params["VALUE"] == "DATE" || len(value) == len("20060102") {
+		t, err := time.Parse("20060102", value)
+		return t, true, err
+	}
+	zone := loc
+	if tzid := params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			zone = l
+		}
+	}
+	var t time.Time
+	var err error
+	if strings.HasSuffix(value, "Z") {
+		t, err = time.Parse("20060102T150405Z", value)
+	} else {
+		t, err = time.ParseInLocation("20060102T150405", value, zone)
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	y, m, d := t.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC), false, nil
+}
+
+func unescape(s string) string {
+	return strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
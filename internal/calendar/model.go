@@ -0,0 +1,31 @@
+package calendar
+
+import "time"
+
+// Holiday is a date the library is closed outside the weekly schedule.
+type Holiday struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Date      time.Time `gorm:"type:date;not null;uniqueIndex" json:"date"`
+	Name      string    `gorm:"size:255" json:"name"`
+	UID       string    `gorm:"size:255;index" json:"uid,omitempty"` // UID of the imported iCalendar event
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (Holiday) TableName() string { return "holidays" }
+
+type HolidayRequest struct {
+	Date string `json:"date"` // 2006-01-02
+	Name string `json:"name"`
+}
+
+// View is the public description of the calendar.
+type View struct {
+	Timezone string            `json:"timezone"`
+	Weekly   map[string]string `json:"weekly"`
+	Holidays []Holiday         `json:"holidays"`
+}
+
+type ImportReport struct {
+	Events   int `json:"events"`
+	Holidays int `json:"holidays"`
+}
@@ -0,0 +1,54 @@
+package calendar
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) ListHolidays(ctx context.Context) ([]Holiday, error) {
+	var holidays []Holiday
+	if err := r.db.WithContext(ctx).Order("date ASC").Find(&holidays).Error; err != nil {
+		return nil, err
+	}
+	return holidays, nil
+}
+
+// UpsertHolidays inserts holidays, renaming existing ones on the same date.
+func (r *Repository) UpsertHolidays(ctx context.Context, holidays []Holiday) error {
+	if len(holidays) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "uid"}),
+	}).Create(&holidays).Error
+}
+
+func (r *Repository) DeleteHoliday(ctx context.Context, date time.Time) (bool, error) {
+	res := r.db.WithContext(ctx).Where("date = ?", date.Format(dateKey)).Delete(&Holiday{})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *Repository) GetHoliday(ctx context.Context, date time.Time) (*Holiday, error) {
+	var h Holiday
+	err := r.db.WithContext(ctx).Where("date = ?", date.Format(dateKey)).First(&h).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
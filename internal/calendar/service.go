@@ -0,0 +1,135 @@
+package calendar
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidDate     = errors.New("invalid date, expected YYYY-MM-DD")
+	ErrHolidayNotFound = errors.New("holiday not found")
+)
+
+// weekdays maps config keys to time.Weekday.
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday,
+	"wednesday": time.Wednesday, "thursday": time.Thursday, "friday": time.Friday,
+	"saturday": time.Saturday,
+}
+
+// ParseWeekly builds the weekly schedule of cal from a weekday -> hours map
+// such as {"friday": "closed", "saturday": "08:00-18:00"}. Days left out
+// stay open.
+func ParseWeekly(cal *Calendar, hours map[string]string) error {
+	for name, spec := range hours {
+		day, ok := weekdays[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return errors.New("calendar: unknown weekday " + name)
+		}
+		h, err := ParseHours(spec)
+		if err != nil {
+			return err
+		}
+		cal.SetWeekly(day, h)
+	}
+	return nil
+}
+
+// Service keeps holiday exceptions in the database and mirrors them into a
+// Calendar that the loans and fines modules consult.
+type Service struct {
+	repo *Repository
+	cal  *Calendar
+}
+
+func NewService(repo *Repository, cal *Calendar) *Service {
+	return &Service{repo: repo, cal: cal}
+}
+
+func (s *Service) Calendar() *Calendar { return s.cal }
+
+// Reload copies the stored holidays into the calendar.
+func (s *Service) Reload(ctx context.Context) error {
+	holidays, err := s.repo.ListHolidays(ctx)
+	if err != nil {
+		return err
+	}
+	s.cal.SetHolidays(holidays)
+	return nil
+}
+
+func (s *Service) View(ctx context.Context) (*View, error) {
+	holidays, err := s.repo.ListHolidays(ctx)
+	if err != nil {
+		return nil, err
+	}
+	weekly := make(map[string]string, len(weekdays))
+	w := s.cal.Weekly()
+	for name, day := range weekdays {
+		if w[day] == (Hours{}) {
+			weekly[name] = "open"
+			continue
+		}
+		weekly[name] = w[day].String()
+	}
+	return &View{Timezone: s.cal.Location().String(), Weekly: weekly, Holidays: holidays}, nil
+}
+
+func (s *Service) AddHoliday(ctx context.Context, req HolidayRequest) (*Holiday, error) {
+	date, err := time.Parse(dateKey, strings.TrimSpace(req.Date))
+	if err != nil {
+		return nil, ErrInvalidDate
+	}
+	h := Holiday{Date: date, Name: strings.TrimSpace(req.Name)}
+	if err := s.repo.UpsertHolidays(ctx, []Holiday{h}); err != nil {
+		return nil, err
+	}
+	if err := s.Reload(ctx); err != nil {
+		return nil, err
+	}
+	return s.repo.GetHoliday(ctx, date)
+}
+
+func (s *Service) DeleteHoliday(ctx context.Context, rawDate string) error {
+	date, err := time.Parse(dateKey, strings.TrimSpace(rawDate))
+	if err != nil {
+		return ErrInvalidDate
+	}
+	found, err := s.repo.DeleteHoliday(ctx, date)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrHolidayNotFound
+	}
+	return s.Reload(ctx)
+}
+
+// ImportICS stores every day covered by the events of an iCalendar file as
+// a holiday.
+func (s *Service) ImportICS(ctx context.Context, r io.Reader) (*ImportReport, error) {
+	events, err := ParseICS(r, s.cal.Location())
+	if err != nil {
+		return nil, err
+	}
+	byDate := make(map[string]Holiday)
+	for _, ev := range events {
+		for _, d := range ev.Days() {
+			byDate[d.Format(dateKey)] = Holiday{Date: d, Name: ev.Summary, UID: ev.UID}
+		}
+	}
+	holidays := make([]Holiday, 0, len(byDate))
+	for _, h := range byDate {
+		holidays = append(holidays, h)
+	}
+	if err := s.repo.UpsertHolidays(ctx, holidays); err != nil {
+		return nil, err
+	}
+	if err := s.Reload(ctx); err != nil {
+		return nil, err
+	}
+	return &ImportReport{Events: len(events), Holidays: len(holidays)}, nil
+}
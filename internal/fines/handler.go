@@ -0,0 +1,105 @@
+package fines
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/erfnzmn/Library_Management_System/pkg/middleware"
+	"github.com/labstack/echo/v4"
+)
+
+type Handler struct {
+	service   *Service
+	jwtSecret string
+}
+
+func NewHandler(service *Service, jwtSecret string) *Handler {
+	return &Handler{service: service, jwtSecret: jwtSecret}
+}
+
+// RegisterRoutes
+func (h *Handler) RegisterRoutes(e *echo.Echo) {
+	g := e.Group("/api/fines")
+	g.Use(middleware.JWT(h.jwtSecret))
+
+	staff := middleware.RequirePermission(middleware.PermFinesManage)
+	once := middleware.Idempotent
+
+	g.GET("/me", h.GetMyStatement)
+	g.GET("/user/:userID", h.GetStatement, middleware.SelfOr("userID", middleware.PermFinesManage))
+	g.POST("/user/:userID/payments", h.RecordPayment, staff, once)
+	g.POST("/user/:userID/adjustments", h.Adjust, staff, once)
+	g.POST("/user/:userID/waivers", h.Waive, staff, once)
+}
+
+// GetMyStatement
+func (h *Handler) GetMyStatement(c echo.Context) error {
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid or missing token"})
+	}
+	return h.statement(c, userID)
+}
+
+// GetStatement
+func (h *Handler) GetStatement(c echo.Context) error {
+	userID, err := strconv.ParseUint(c.Param("userID"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid user id"})
+	}
+	return h.statement(c, uint(userID))
+}
+
+func (h *Handler) statement(c echo.Context, userID uint) error {
+	st, err := h.service.Statement(c.Request().Context(), userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, st)
+}
+
+type entryFunc func(ctx context.Context, userID, staffID uint, req EntryRequest) (*Entry, error)
+
+// RecordPayment
+func (h *Handler) RecordPayment(c echo.Context) error {
+	return h.record(c, h.service.RecordPayment)
+}
+
+// Adjust
+func (h *Handler) Adjust(c echo.Context) error {
+	return h.record(c, h.service.Adjust)
+}
+
+// Waive
+func (h *Handler) Waive(c echo.Context) error {
+	return h.record(c, h.service.Waive)
+}
+
+func (h *Handler) record(c echo.Context, fn entryFunc) error {
+	userID, err := strconv.ParseUint(c.Param("userID"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid user id"})
+	}
+	staffID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid or missing token"})
+	}
+	var req EntryRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid input"})
+	}
+	entry, err := fn(c.Request().Context(), uint(userID), staffID, req)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, ErrInvalidAmount), errors.Is(err, ErrNoteRequired):
+			status = http.StatusBadRequest
+		case errors.Is(err, ErrOverpayment):
+			status = http.StatusConflict
+		}
+		return c.JSON(status, echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, entry)
+}
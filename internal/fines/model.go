@@ -0,0 +1,45 @@
+package fines
+
+import "time"
+
+const (
+	KindAccrual    = "accrual"    // daily overdue charge
+	KindAdjustment = "adjustment" // manual correction by staff, either sign
+	KindWaiver     = "waiver"     // debt forgiven by staff
+	KindPayment    = "payment"
+)
+
+// Entry is one line of the fines ledger. Positive amounts add to what the
+// user owes, negative amounts (payments, waivers) reduce it; the balance is
+// the sum of all entries of a user.
+type Entry struct {
+	ID     uint    `gorm:"primaryKey" json:"id"`
+	UserID uint    `gorm:"not null;index" json:"user_id"`
+	LoanID *uint   `gorm:"uniqueIndex:uq_fine_accrual_day" json:"loan_id,omitempty"`
+	Kind   string  `gorm:"type:enum('accrual','adjustment','waiver','payment');not null" json:"kind"`
+	Amount float64 `gorm:"type:decimal(12,2);not null" json:"amount"`
+	// AccrualDate is the overdue day charged by an accrual entry; unique per
+	// loan so running the job twice never double-charges
+	AccrualDate *time.Time `gorm:"type:date;uniqueIndex:uq_fine_accrual_day" json:"accrual_date,omitempty"`
+	Note        string     `gorm:"size:255" json:"note,omitempty"`
+	CreatedBy   *uint      `json:"created_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func (Entry) TableName() string { return "fine_entries" }
+
+// Statement is the balance of a user with the ledger lines behind it.
+type Statement struct {
+	UserID  uint    `json:"user_id"`
+	Balance float64 `json:"balance"`
+	Blocked bool    `json:"blocked"`
+	Entries []Entry `json:"entries"`
+}
+
+// EntryRequest is the body of the staff payment, adjustment and waiver
+// endpoints.
+type EntryRequest struct {
+	Amount float64 `json:"amount"`
+	LoanID *uint   `json:"loan_id,omitempty"`
+	Note   string  `json:"note"`
+}
@@ -0,0 +1,69 @@
+package fines
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) CreateEntries(ctx context.Context, entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Create(&entries).Error
+}
+
+func (r *Repository) Balance(ctx context.Context, userID uint) (float64, error) {
+	var sum float64
+	err := r.db.WithContext(ctx).Model(&Entry{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("user_id = ?", userID).
+		Scan(&sum).Error
+	return sum, err
+}
+
+func (r *Repository) EntriesByUser(ctx context.Context, userID uint) ([]Entry, error) {
+	var entries []Entry
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at DESC, id DESC").
+		Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Accrued returns the total charged for a loan by accrual entries and the
+// last day charged (nil when none).
+func (r *Repository) Accrued(ctx context.Context, loanID uint) (float64, *time.Time, error) {
+	var row struct {
+		Total float64
+		Last  *time.Time
+	}
+	err := r.db.WithContext(ctx).Model(&Entry{}).
+		Select("COALESCE(SUM(amount), 0) AS total, MAX(accrual_date) AS last").
+		Where("loan_id = ? AND kind = ?", loanID, KindAccrual).
+		Scan(&row).Error
+	return row.Total, row.Last, err
+}
+
+func (r *Repository) GetEntry(ctx context.Context, id uint) (*Entry, error) {
+	var e Entry
+	if err := r.db.WithContext(ctx).First(&e, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &e, nil
+}
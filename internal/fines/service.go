@@ -0,0 +1,213 @@
+package fines
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/erfnzmn/Library_Management_System/internal/calendar"
+	"github.com/erfnzmn/Library_Management_System/internal/loans"
+)
+
+var (
+	ErrInvalidAmount = errors.New("amount must be a positive number")
+	ErrNoteRequired  = errors.New("a note is required")
+	ErrOverpayment   = errors.New("amount exceeds the outstanding balance")
+	ErrEntryNotFound = errors.New("fine entry not found")
+)
+
+type Service struct {
+	repo  *Repository
+	loans *loans.Service
+
+	// users owing more than blockThreshold cannot reserve or renew; 0 disables
+	blockThreshold float64
+	cal            *calendar.Calendar
+}
+
+func NewService(repo *Repository, loanService *loans.Service) *Service {
+	return &Service{repo: repo, loans: loanService, cal: calendar.New(time.UTC)}
+}
+
+// SetCalendar stops fines from accruing on days the library is closed.
+func (s *Service) SetCalendar(cal *calendar.Calendar) {
+	s.cal = cal
+}
+
+func (s *Service) SetBlockThreshold(amount float64) {
+	s.blockThreshold = amount
+}
+
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// AccrueLoan charges one fine per overdue open day of the loan from the last
+// day already charged up to until, using the fine rate and cap of the loan's
+// circulation policy. Days are charged at most once; closed days are free.
+func (s *Service) AccrueLoan(ctx context.Context, loan *loans.Loan, until time.Time) error {
+	if loan.DueDate == nil {
+		return nil
+	}
+	pol, err := s.loans.LoanPolicy(ctx, loan)
+	if err != nil {
+		return err
+	}
+	if pol.FinePerDay <= 0 {
+		return nil
+	}
+	total, last, err := s.repo.Accrued(ctx, loan.ID)
+	if err != nil {
+		return err
+	}
+
+	from := s.cal.DateOf(*loan.DueDate)
+	if last != nil && last.After(from) {
+		from = *last
+	}
+	var entries []Entry
+	for d := from.AddDate(0, 0, 1); !d.After(s.cal.DateOf(until)); d = d.AddDate(0, 0, 1) {
+		if !s.cal.IsOpenOn(d) {
+			continue
+		}
+		amount := pol.FinePerDay
+		if pol.FineCap > 0 {
+			if total >= pol.FineCap {
+				break
+			}
+			amount = math.Min(amount, pol.FineCap-total)
+		}
+		accrued := d
+		entries = append(entries, Entry{
+			UserID:      loan.UserID,
+			LoanID:      &loan.ID,
+			Kind:        KindAccrual,
+			Amount:      round(amount),
+			AccrualDate: &accrued,
+		})
+		total += amount
+	}
+	return s.repo.CreateEntries(ctx, entries)
+}
+
+// AccrueOverdue charges all overdue loans up to now.
+func (s *Service) AccrueOverdue(ctx context.Context, now time.Time) error {
+	overdue, err := s.loans.GetOverdueLoans(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range overdue {
+		if err := s.AccrueLoan(ctx, &overdue[i], now); err != nil {
+			log.Printf("fines: loan %d: %v", overdue[i].ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *Service) Balance(ctx context.Context, userID uint) (float64, error) {
+	b, err := s.repo.Balance(ctx, userID)
+	return round(b), err
+}
+
+func (s *Service) Statement(ctx context.Context, userID uint) (*Statement, error) {
+	balance, err := s.Balance(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.repo.EntriesByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &Statement{
+		UserID:  userID,
+		Balance: balance,
+		Blocked: s.overThreshold(balance),
+		Entries: entries,
+	}, nil
+}
+
+func (s *Service) GetEntry(ctx context.Context, id uint) (*Entry, error) {
+	e, err := s.repo.GetEntry(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if e == nil {
+		return nil, ErrEntryNotFound
+	}
+	return e, nil
+}
+
+func (s *Service) overThreshold(balance float64) bool {
+	return s.blockThreshold > 0 && balance > s.blockThreshold
+}
+
+// IsBlocked implements loans.Blocker.
+func (s *Service) IsBlocked(ctx context.Context, userID uint) (bool, error) {
+	if s.blockThreshold <= 0 {
+		return false, nil
+	}
+	balance, err := s.Balance(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return s.overThreshold(balance), nil
+}
+
+// RecordPayment books a payment; paying more than is owed is refused.
+func (s *Service) RecordPayment(ctx context.Context, userID, staffID uint, req EntryRequest) (*Entry, error) {
+	return s.credit(ctx, KindPayment, userID, staffID, req)
+}
+
+// Waive forgives part or all of the outstanding balance.
+func (s *Service) Waive(ctx context.Context, userID, staffID uint, req EntryRequest) (*Entry, error) {
+	if strings.TrimSpace(req.Note) == "" {
+		return nil, ErrNoteRequired
+	}
+	return s.credit(ctx, KindWaiver, userID, staffID, req)
+}
+
+func (s *Service) credit(ctx context.Context, kind string, userID, staffID uint, req EntryRequest) (*Entry, error) {
+	amount := round(req.Amount)
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	balance, err := s.Balance(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if amount > balance {
+		return nil, ErrOverpayment
+	}
+	return s.record(ctx, kind, userID, staffID, -amount, req)
+}
+
+// Adjust adds a signed manual correction, e.g. a damaged-book charge or a
+// refund of a wrongly charged day.
+func (s *Service) Adjust(ctx context.Context, userID, staffID uint, req EntryRequest) (*Entry, error) {
+	amount := round(req.Amount)
+	if amount == 0 {
+		return nil, ErrInvalidAmount
+	}
+	if strings.TrimSpace(req.Note) == "" {
+		return nil, ErrNoteRequired
+	}
+	return s.record(ctx, KindAdjustment, userID, staffID, amount, req)
+}
+
+func (s *Service) record(ctx context.Context, kind string, userID, staffID uint, amount float64, req EntryRequest) (*Entry, error) {
+	entries := []Entry{{
+		UserID:    userID,
+		LoanID:    req.LoanID,
+		Kind:      kind,
+		Amount:    amount,
+		Note:      strings.TrimSpace(req.Note),
+		CreatedBy: &staffID,
+	}}
+	if err := s.repo.CreateEntries(ctx, entries); err != nil {
+		return nil, err
+	}
+	return &entries[0], nil
+}
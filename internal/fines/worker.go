@@ -0,0 +1,64 @@
+package fines
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/erfnzmn/Library_Management_System/internal/loans"
+	"github.com/erfnzmn/Library_Management_System/pkg/lock"
+)
+
+const overdueLockKey = "fines:overdue"
+
+// OverdueWorker periodically marks loans overdue and accrues their fines.
+// Like the pickup expiry worker it runs on one instance at a time.
+type OverdueWorker struct {
+	loans    *loans.Service
+	fines    *Service
+	locker   lock.Locker
+	interval time.Duration
+}
+
+func NewOverdueWorker(loanService *loans.Service, fines *Service, locker lock.Locker, interval time.Duration) *OverdueWorker {
+	return &OverdueWorker{loans: loanService, fines: fines, locker: locker, interval: interval}
+}
+
+// Run blocks until ctx is cancelled.
+func (w *OverdueWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		w.tick(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *OverdueWorker) tick(ctx context.Context) {
+	release, ok, err := w.locker.TryAcquire(ctx, overdueLockKey, w.interval)
+	if err != nil {
+		log.Printf("overdue worker: lock: %v", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	defer release()
+
+	now := time.Now()
+	n, err := w.loans.MarkOverdue(ctx, now)
+	if err != nil {
+		log.Printf("overdue worker: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("overdue worker: %d loan(s) now overdue", n)
+	}
+	if err := w.fines.AccrueOverdue(ctx, now); err != nil {
+		log.Printf("overdue worker: accrue: %v", err)
+	}
+}
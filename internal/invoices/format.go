@@ -0,0 +1,203 @@
+package invoices
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Formatter renders amounts, dates and labels for one language. "fa" uses
+// Persian digits and separators, the Solar Hijri (Jalali) calendar and
+// right-to-left layout; anything else falls back to English.
+type Formatter struct {
+	lang string
+	loc  *time.Location
+}
+
+func NewFormatter(lang string, loc *time.Location) Formatter {
+	if lang != "fa" {
+		lang = "en"
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	return Formatter{lang: lang, loc: loc}
+}
+
+func (f Formatter) Lang() string { return f.lang }
+
+func (f Formatter) Dir() string {
+	if f.lang == "fa" {
+		return "rtl"
+	}
+	return "ltr"
+}
+
+// Money formats an amount in its currency. Rials have no minor unit in
+// practice, so IRR amounts are rounded to whole rials.
+func (f Formatter) Money(amount float64, currency string) string {
+	decimals := 2
+	if currency == "IRR" {
+		decimals = 0
+	}
+	s := f.grouped(amount, decimals)
+	if f.lang == "fa" {
+		if name, ok := currencyNames[currency]; ok {
+			return s + " " + name
+		}
+	}
+	return s + " " + currency
+}
+
+var currencyNames = map[string]string{
+	"IRR": "ریال",
+	"IRT": "تومان",
+}
+
+// grouped writes amount with thousands separators.
+func (f Formatter) grouped(amount float64, decimals int) string {
+	neg := amount < 0
+	scale := math.Pow(10, float64(decimals))
+	v := int64(math.Round(math.Abs(amount) * scale))
+	whole, frac := v/int64(scale), v%int64(scale)
+
+	digits := fmt.Sprint(whole)
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteString(f.thousandsSep())
+		}
+		b.WriteRune(d)
+	}
+	if decimals > 0 {
+		b.WriteString(f.decimalSep())
+		fmt.Fprintf(&b, "%0*d", decimals, frac)
+	}
+	s := b.String()
+	if neg {
+		s = "-" + s
+	}
+	return f.digits(s)
+}
+
+func (f Formatter) thousandsSep() string {
+	if f.lang == "fa" {
+		return "٬"
+	}
+	return ","
+}
+
+func (f Formatter) decimalSep() string {
+	if f.lang == "fa" {
+		return "٫"
+	}
+	return "."
+}
+
+// digits replaces ASCII digits with Persian ones for "fa".
+func (f Formatter) digits(s string) string {
+	if f.lang != "fa" {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			r = '۰' + (r - '0')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (f Formatter) Number(n int) string {
+	return f.digits(fmt.Sprint(n))
+}
+
+func (f Formatter) Percent(rate float64) string {
+	s := f.digits(strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.2f", rate*100), "0"), "."))
+	if f.lang == "fa" {
+		return s + "٪"
+	}
+	return s + "%"
+}
+
+// Date prints the local date of t; Jalali for "fa".
+func (f Formatter) Date(t time.Time) string {
+	t = t.In(f.loc)
+	if f.lang == "fa" {
+		y, m, d := Jalali(t)
+		return f.digits(fmt.Sprintf("%04d/%02d/%02d", y, m, d))
+	}
+	return t.Format("2006-01-02")
+}
+
+// Jalali converts the date of t to the Solar Hijri calendar.
+func Jalali(t time.Time) (year, month, day int) {
+	gy, gm, gd := t.Date()
+	monthDays := [...]int{0, 31, 59, 90, 120, 151, 181, 212, 243, 273, 304, 334}
+	gy2 := gy
+	if gm > 2 {
+		gy2 = gy + 1
+	}
+	days := 355666 + 365*gy + (gy2+3)/4 - (gy2+99)/100 + (gy2+399)/400 + gd + monthDays[gm-1]
+	year = -1595 + 33*(days/12053)
+	days %= 12053
+	year += 4 * (days / 1461)
+	days %= 1461
+	if days > 365 {
+		year += (days - 1) / 365
+		days = (days - 1) % 365
+	}
+	if days < 186 {
+		return year, 1 + days/31, 1 + days%31
+	}
+	return year, 7 + (days-186)/30, 1 + (days-186)%30
+}
+
+// Label translates the fixed words printed on invoices.
+func (f Formatter) Label(key string) string {
+	if f.lang == "fa" {
+		if s, ok := labelsFA[key]; ok {
+			return s
+		}
+	}
+	if s, ok := labelsEN[key]; ok {
+		return s
+	}
+	return key
+}
+
+var labelsEN = map[string]string{
+	"title_" + KindOrder:       "Invoice",
+	"title_" + KindFinePayment: "Fine payment receipt",
+	"number":                   "Number",
+	"date":                     "Date",
+	"customer":                 "Customer",
+	"seller":                   "Seller",
+	"tax_id":                   "Tax ID",
+	"description":              "Description",
+	"quantity":                 "Qty",
+	"unit_price":               "Unit price",
+	"amount":                   "Amount",
+	"subtotal":                 "Subtotal",
+	"total":                    "Total",
+	"order":                    "Order",
+}
+
+var labelsFA = map[string]string{
+	"title_" + KindOrder:       "صورتحساب فروش",
+	"title_" + KindFinePayment: "رسید پرداخت جریمه",
+	"number":                   "شماره",
+	"date":                     "تاریخ",
+	"customer":                 "خریدار",
+	"seller":                   "فروشنده",
+	"tax_id":                   "شناسه مالیاتی",
+	"description":              "شرح",
+	"quantity":                 "تعداد",
+	"unit_price":               "قیمت واحد",
+	"amount":                   "مبلغ",
+	"subtotal":                 "جمع",
+	"total":                    "مبلغ کل",
+	"order":                    "سفارش",
+}
@@ -0,0 +1,97 @@
+package invoices
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/erfnzmn/Library_Management_System/internal/fines"
+	"github.com/erfnzmn/Library_Management_System/internal/sales"
+	"github.com/erfnzmn/Library_Management_System/pkg/middleware"
+	"github.com/labstack/echo/v4"
+)
+
+type Handler struct {
+	service   *Service
+	jwtSecret string
+}
+
+func NewHandler(service *Service, jwtSecret string) *Handler {
+	return &Handler{service: service, jwtSecret: jwtSecret}
+}
+
+// RegisterRoutes adds the download routes next to the sales and fines
+// routes they belong to.
+func (h *Handler) RegisterRoutes(e *echo.Echo) {
+	jwt := middleware.JWT(h.jwtSecret)
+	e.GET("/sales/orders/:id/invoice", h.OrderInvoice, jwt)
+	e.GET("/api/fines/payments/:id/receipt", h.FineReceipt, jwt)
+}
+
+// OrderInvoice — owner or staff; ?format=pdf|html|json&lang=fa|en
+func (h *Handler) OrderInvoice(c echo.Context) error {
+	return h.download(c, middleware.PermSalesManage, h.service.ForOrder)
+}
+
+// FineReceipt — owner or staff
+func (h *Handler) FineReceipt(c echo.Context) error {
+	return h.download(c, middleware.PermFinesManage, h.service.ForFinePayment)
+}
+
+func (h *Handler) download(c echo.Context, staff middleware.Permission, issue func(ctx context.Context, id, owner uint) (*Invoice, error)) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid id"})
+	}
+	format := c.QueryParam("format")
+	if format == "" {
+		format = "pdf"
+	}
+	if format != "pdf" && format != "html" && format != "json" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "format must be pdf, html or json"})
+	}
+
+	// members only see their own documents; the service checks this before
+	// issuing, so others' orders neither use up a number nor show they exist
+	var owner uint
+	if !middleware.Can(c, staff) {
+		if owner, err = middleware.CurrentUserID(c); err != nil {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid or missing token"})
+		}
+	}
+	inv, err := issue(c.Request().Context(), uint(id), owner)
+	if err != nil {
+		return c.JSON(invoiceErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+
+	f := h.service.Formatter(c.QueryParam("lang"))
+	var buf bytes.Buffer
+	switch format {
+	case "json":
+		return c.JSON(http.StatusOK, inv)
+	case "html":
+		if err := RenderHTML(&buf, inv, h.service.Seller(), f); err != nil {
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+		return c.Blob(http.StatusOK, echo.MIMETextHTMLCharsetUTF8, buf.Bytes())
+	}
+	if err := RenderPDF(&buf, inv, h.service.Seller(), f); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.pdf"`, inv.Number))
+	return c.Blob(http.StatusOK, "application/pdf", buf.Bytes())
+}
+
+func invoiceErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, sales.ErrOrderNotFound), errors.Is(err, fines.ErrEntryNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrNotInvoiceable), errors.Is(err, ErrNotAPayment):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
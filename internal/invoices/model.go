@@ -0,0 +1,77 @@
+package invoices
+
+import "time"
+
+const (
+	KindOrder       = "order"        // sale of books
+	KindFinePayment = "fine_payment" // receipt for a fine paid at the desk
+)
+
+// Invoice is issued once per paid order or fine payment and never changes
+// afterwards: lines, prices and tax are copied so that later price or rate
+// changes do not alter a document the customer already holds.
+type Invoice struct {
+	ID          uint          `gorm:"primaryKey" json:"id"`
+	Number      string        `gorm:"size:32;not null;uniqueIndex" json:"number"`
+	Kind        string        `gorm:"type:enum('order','fine_payment');not null" json:"kind"`
+	OrderID     *uint         `gorm:"uniqueIndex" json:"order_id,omitempty"`
+	FineEntryID *uint         `gorm:"uniqueIndex" json:"fine_entry_id,omitempty"`
+	UserID      uint          `gorm:"not null;index" json:"user_id"`
+	Customer    string        `gorm:"size:100" json:"customer"`
+	Currency    string        `gorm:"size:3;not null" json:"currency"`
+	Subtotal    float64       `gorm:"type:decimal(12,2);not null" json:"subtotal"`
+	Tax         float64       `gorm:"type:decimal(12,2);not null" json:"tax"`
+	Total       float64       `gorm:"type:decimal(12,2);not null" json:"total"`
+	Lines       []InvoiceLine `gorm:"foreignKey:InvoiceID;constraint:OnDelete:CASCADE" json:"lines"`
+	Taxes       []TaxLine     `gorm:"foreignKey:InvoiceID;constraint:OnDelete:CASCADE" json:"taxes"`
+	IssuedAt    time.Time     `gorm:"not null" json:"issued_at"`
+}
+
+func (Invoice) TableName() string { return "invoices" }
+
+// InvoiceLine amounts are net of tax; Amount is after Discount.
+type InvoiceLine struct {
+	ID          uint    `gorm:"primaryKey" json:"id"`
+	InvoiceID   uint    `gorm:"not null;index" json:"invoice_id"`
+	Description string  `gorm:"size:255;not null" json:"description"`
+	Quantity    int     `gorm:"not null" json:"quantity"`
+	UnitPrice   float64 `gorm:"type:decimal(12,2);not null" json:"unit_price"`
+	Discount    float64 `gorm:"type:decimal(12,2);not null;default:0" json:"discount"`
+	Amount      float64 `gorm:"type:decimal(12,2);not null" json:"amount"`
+}
+
+func (InvoiceLine) TableName() string { return "invoice_lines" }
+
+type TaxLine struct {
+	ID        uint    `gorm:"primaryKey" json:"id"`
+	InvoiceID uint    `gorm:"not null;index" json:"invoice_id"`
+	Name      string  `gorm:"size:50;not null" json:"name"`
+	Rate      float64 `gorm:"type:decimal(6,4);not null" json:"rate"`
+	Base      float64 `gorm:"type:decimal(12,2);not null" json:"base"`
+	Amount    float64 `gorm:"type:decimal(12,2);not null" json:"amount"`
+}
+
+func (TaxLine) TableName() string { return "invoice_taxes" }
+
+// Sequence hands out invoice numbers without gaps, one counter per series
+// and year (e.g. INV-2026-000042).
+type Sequence struct {
+	Series string `gorm:"primaryKey;size:20"`
+	Year   int    `gorm:"primaryKey;autoIncrement:false"`
+	Last   uint   `gorm:"not null"`
+}
+
+func (Sequence) TableName() string { return "invoice_sequences" }
+
+// Tax describes one tax applied to sales, e.g. VAT.
+type Tax struct {
+	Name string  `mapstructure:"name" json:"name"`
+	Rate float64 `mapstructure:"rate" json:"rate"` // 0.10 = 10%
+}
+
+// Seller is printed in the header of every invoice.
+type Seller struct {
+	Name    string `mapstructure:"name"`
+	Address string `mapstructure:"address"`
+	TaxID   string `mapstructure:"tax_id"`
+}
@@ -0,0 +1,222 @@
+package invoices
+
+import (
+	"html/template"
+	"io"
+
+	"github.com/erfnzmn/Library_Management_System/pkg/pdf"
+)
+
+// document is an invoice with every value already formatted for display.
+type document struct {
+	Lang, Dir, Title string
+	Number, Date     string
+	Customer         string
+	Seller           Seller
+	Labels           map[string]string
+	Lines            []documentLine
+	Taxes            []documentTax
+	Subtotal, Total  string
+	ShowSubtotal     bool
+	ShowDiscount     bool
+}
+
+type documentLine struct {
+	Description, Quantity, UnitPrice, Discount, Amount string
+}
+
+type documentTax struct {
+	Name, Amount string
+}
+
+func newDocument(inv *Invoice, seller Seller, f Formatter) document {
+	d := document{
+		Lang:         f.Lang(),
+		Dir:          f.Dir(),
+		Title:        f.Label("title_" + inv.Kind),
+		Number:       inv.Number,
+		Date:         f.Date(inv.IssuedAt),
+		Customer:     inv.Customer,
+		Seller:       seller,
+		Labels:       map[string]string{},
+		Subtotal:     f.Money(inv.Subtotal, inv.Currency),
+		Total:        f.Money(inv.Total, inv.Currency),
+		ShowSubtotal: len(inv.Taxes) > 0,
+	}
+	for _, k := range []string{"number", "date", "customer", "seller", "tax_id", "description", "quantity", "unit_price", "discount", "amount", "subtotal", "total"} {
+		d.Labels[k] = f.Label(k)
+	}
+	for _, l := range inv.Lines {
+		d.Lines = append(d.Lines, documentLine{
+			Description: l.Description,
+			Quantity:    f.Number(l.Quantity),
+			UnitPrice:   f.Money(l.UnitPrice, inv.Currency),
+			Discount:    f.Money(l.Discount, inv.Currency),
+			Amount:      f.Money(l.Amount, inv.Currency),
+		})
+		if l.Discount > 0 {
+			d.ShowDiscount = true
+		}
+	}
+	for _, t := range inv.Taxes {
+		d.Taxes = append(d.Taxes, documentTax{
+			Name:   t.Name + " " + f.Percent(t.Rate),
+			Amount: f.Money(t.Amount, inv.Currency),
+		})
+	}
+	return d
+}
+
+var htmlTemplate = template.Must(template.New("invoice").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}" dir="{{.Dir}}">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} {{.Number}}</title>
+<style>
+body { font-family: Vazirmatn, Tahoma, "DejaVu Sans", sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; margin-top: 1.5em; }
+th, td { border-bottom: 1px solid #ccc; padding: .4em .6em; text-align: start; }
+td.num, th.num { text-align: end; white-space: nowrap; }
+tfoot td { border: none; }
+tfoot tr.total td { font-weight: bold; border-top: 2px solid #222; }
+.meta { display: flex; justify-content: space-between; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="meta">
+<div>
+{{- if .Seller.Name}}<div>{{.Labels.seller}}: {{.Seller.Name}}</div>{{end}}
+{{- if .Seller.Address}}<div>{{.Seller.Address}}</div>{{end}}
+{{- if .Seller.TaxID}}<div>{{.Labels.tax_id}}: {{.Seller.TaxID}}</div>{{end}}
+</div>
+<div>
+<div>{{.Labels.number}}: {{.Number}}</div>
+<div>{{.Labels.date}}: {{.Date}}</div>
+{{- if .Customer}}<div>{{.Labels.customer}}: {{.Customer}}</div>{{end}}
+</div>
+</div>
+<table>
+{{- $span := 3}}{{if .ShowDiscount}}{{$span = 4}}{{end}}
+<thead><tr><th>{{.Labels.description}}</th><th class="num">{{.Labels.quantity}}</th><th class="num">{{.Labels.unit_price}}</th>{{if .ShowDiscount}}<th class="num">{{.Labels.discount}}</th>{{end}}<th class="num">{{.Labels.amount}}</th></tr></thead>
+<tbody>
+{{- range .Lines}}
+<tr><td>{{.Description}}</td><td class="num">{{.Quantity}}</td><td class="num">{{.UnitPrice}}</td>{{if $.ShowDiscount}}<td class="num">{{.Discount}}</td>{{end}}<td class="num">{{.Amount}}</td></tr>
+{{- end}}
+</tbody>
+<tfoot>
+{{- if .ShowSubtotal}}
+<tr><td colspan="{{$span}}">{{.Labels.subtotal}}</td><td class="num">{{.Subtotal}}</td></tr>
+{{- end}}
+{{- range .Taxes}}
+<tr><td colspan="{{$span}}">{{.Name}}</td><td class="num">{{.Amount}}</td></tr>
+{{- end}}
+<tr class="total"><td colspan="{{$span}}">{{.Labels.total}}</td><td class="num">{{.Total}}</td></tr>
+</tfoot>
+</table>
+</body>
+</html>
+`))
+
+// RenderHTML writes a standalone HTML page.
+func RenderHTML(w io.Writer, inv *Invoice, seller Seller, f Formatter) error {
+	return htmlTemplate.Execute(w, newDocument(inv, seller, f))
+}
+
+// RenderPDF writes an A4 PDF. Persian documents are laid out right to
+// left: the columns are mirrored and text starts at the right margin.
+func RenderPDF(w io.Writer, inv *Invoice, seller Seller, f Formatter) error {
+	d := newDocument(inv, seller, f)
+
+	const (
+		left   = 50.0
+		right  = pdf.A4Width - 50
+		bottom = 60.0
+	)
+	doc := pdf.New()
+	page := doc.AddPage()
+	y := pdf.A4Height - 70
+
+	// positions are given for left-to-right documents; start draws text
+	// beginning at x in reading order, end draws text ending there
+	rtl := d.Dir == "rtl"
+	start := func(x, y, size float64, bold bool, s string) {
+		if rtl {
+			page.TextRight(pdf.A4Width-x, y, size, bold, s)
+		} else {
+			page.Text(x, y, size, bold, s)
+		}
+	}
+	end := func(x, y, size float64, bold bool, s string) {
+		if rtl {
+			page.Text(pdf.A4Width-x, y, size, bold, s)
+		} else {
+			page.TextRight(x, y, size, bold, s)
+		}
+	}
+
+	start(left, y, 20, true, d.Title)
+	y -= 30
+	header := [][2]string{{d.Labels["number"], d.Number}, {d.Labels["date"], d.Date}}
+	if d.Customer != "" {
+		header = append(header, [2]string{d.Labels["customer"], d.Customer})
+	}
+	if seller.Name != "" {
+		header = append(header, [2]string{d.Labels["seller"], seller.Name})
+	}
+	if seller.Address != "" {
+		header = append(header, [2]string{"", seller.Address})
+	}
+	if seller.TaxID != "" {
+		header = append(header, [2]string{d.Labels["tax_id"], seller.TaxID})
+	}
+	for _, h := range header {
+		if h[0] != "" {
+			start(left, y, 10, true, h[0]+":")
+		}
+		start(left+90, y, 10, false, h[1])
+		y -= 15
+	}
+
+	cols := [...]float64{left, right - 280, right - 190, right - 95, right}
+	row := func(bold bool, desc, qty, unit, discount, amount string) {
+		if y < bottom {
+			page = doc.AddPage()
+			y = pdf.A4Height - 70
+		}
+		start(cols[0], y, 10, bold, desc)
+		end(cols[1], y, 10, bold, qty)
+		end(cols[2], y, 10, bold, unit)
+		if d.ShowDiscount {
+			end(cols[3], y, 10, bold, discount)
+		}
+		end(cols[4], y, 10, bold, amount)
+		y -= 16
+	}
+
+	y -= 15
+	row(true, d.Labels["description"], d.Labels["quantity"], d.Labels["unit_price"], d.Labels["discount"], d.Labels["amount"])
+	page.Line(left, y+11, right, y+11)
+	for _, l := range d.Lines {
+		row(false, truncate(l.Description, 45), l.Quantity, l.UnitPrice, l.Discount, l.Amount)
+	}
+	page.Line(left, y+11, right, y+11)
+	if d.ShowSubtotal {
+		row(false, d.Labels["subtotal"], "", "", "", d.Subtotal)
+	}
+	for _, t := range d.Taxes {
+		row(false, t.Name, "", "", "", t.Amount)
+	}
+	row(true, d.Labels["total"], "", "", "", d.Total)
+
+	_, err := doc.WriteTo(w)
+	return err
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "..."
+}
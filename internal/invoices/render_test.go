@@ -0,0 +1,128 @@
+package invoices
+
+import (
+	"bytes"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func persianInvoice() *Invoice {
+	return &Invoice{
+		Kind:     KindOrder,
+		Number:   "INV-2026-000042",
+		Customer: "صادق هدایت",
+		Currency: "IRR",
+		Subtotal: 1200000,
+		Total:    1200000,
+		Lines: []InvoiceLine{
+			{Description: "بوف کور", Quantity: 2, UnitPrice: 600000, Amount: 1200000},
+		},
+		IssuedAt: time.Date(2026, 3, 21, 10, 0, 0, 0, time.UTC),
+	}
+}
+
+var (
+	objectPattern  = regexp.MustCompile(`(?s)(\d+) 0 obj\n(.*?)\nendobj\n`)
+	fontPattern    = regexp.MustCompile(`/F(\d) (\d+) 0 R`)
+	unicodePattern = regexp.MustCompile(`/ToUnicode (\d+) 0 R`)
+	bfcharPattern  = regexp.MustCompile(`<([0-9A-F]{4})> <([0-9A-F]*)>`)
+	textPattern    = regexp.MustCompile(`/F(\d) [\d.]+ Tf [\d.]+ [\d.]+ Td <([0-9A-F]*)> Tj`)
+)
+
+// pdfText returns the strings drawn in a PDF written by pkg/pdf, decoded
+// through the fonts' ToUnicode maps, in drawing order.
+func pdfText(t *testing.T, out []byte) []string {
+	t.Helper()
+	objects := map[string]string{}
+	for _, m := range objectPattern.FindAllSubmatch(out, -1) {
+		objects[string(m[1])] = string(m[2])
+	}
+	// face number -> glyph -> text
+	faces := map[string]map[string]string{}
+	for _, obj := range objects {
+		if !strings.Contains(obj, "/Type /Page ") {
+			continue
+		}
+		for _, f := range fontPattern.FindAllStringSubmatch(obj, -1) {
+			u := unicodePattern.FindStringSubmatch(objects[f[2]])
+			if u == nil {
+				t.Fatalf("font %s has no ToUnicode", f[2])
+			}
+			glyphs := map[string]string{}
+			for _, c := range bfcharPattern.FindAllStringSubmatch(objects[u[1]], -1) {
+				glyphs[c[1]] = c[2]
+			}
+			faces[f[1]] = glyphs
+		}
+	}
+
+	var texts []string
+	for _, m := range textPattern.FindAllSubmatch(out, -1) {
+		glyphs := faces[string(m[1])]
+		var b strings.Builder
+		for i := 0; i+4 <= len(m[2]); i += 4 {
+			u, ok := glyphs[string(m[2][i:i+4])]
+			if !ok {
+				t.Fatalf("glyph %s has no ToUnicode entry", m[2][i:i+4])
+			}
+			raw, _ := hex.DecodeString(u)
+			for j := 0; j+1 < len(raw); j += 2 {
+				b.WriteRune(rune(raw[j])<<8 | rune(raw[j+1]))
+			}
+		}
+		texts = append(texts, b.String())
+	}
+	return texts
+}
+
+func reversed(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
+
+func TestRenderPDFPersian(t *testing.T) {
+	inv := persianInvoice()
+	var buf bytes.Buffer
+	if err := RenderPDF(&buf, inv, Seller{Name: "کتابخانه مرکزی"}, NewFormatter("fa", time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	texts := pdfText(t, buf.Bytes())
+	all := strings.Join(texts, "\n")
+	if strings.Contains(all, "?") {
+		t.Errorf("PDF text has '?':\n%s", all)
+	}
+
+	// right-to-left text is drawn in visual order, so it reads reversed
+	for _, want := range []string{
+		reversed("صورتحساب فروش"),
+		reversed("بوف کور"),
+		reversed("صادق هدایت"),
+		reversed("کتابخانه مرکزی"),
+		"INV-2026-000042",
+		reversed("ریال") + " ۱٬۲۰۰٬۰۰۰",
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("PDF has no %q; drawn:\n%s", want, all)
+		}
+	}
+}
+
+func TestRenderPDFEnglish(t *testing.T) {
+	inv := persianInvoice()
+	var buf bytes.Buffer
+	if err := RenderPDF(&buf, inv, Seller{}, NewFormatter("en", time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	all := strings.Join(pdfText(t, buf.Bytes()), "\n")
+	for _, want := range []string{"Invoice", "1,200,000 IRR", reversed("بوف کور")} {
+		if !strings.Contains(all, want) {
+			t.Errorf("PDF has no %q; drawn:\n%s", want, all)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package invoices
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) get(ctx context.Context, query string, args ...any) (*Invoice, error) {
+	var inv Invoice
+	err := r.db.WithContext(ctx).
+		Preload("Lines", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("Taxes", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where(query, args...).
+		First(&inv).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &inv, nil
+}
+
+func (r *Repository) GetByOrder(ctx context.Context, orderID uint) (*Invoice, error) {
+	return r.get(ctx, "order_id = ?", orderID)
+}
+
+func (r *Repository) GetByFineEntry(ctx context.Context, entryID uint) (*Invoice, error) {
+	return r.get(ctx, "fine_entry_id = ?", entryID)
+}
+
+// Issue numbers and stores the invoice in one transaction; the sequence row
+// is locked so concurrent issues get consecutive numbers.
+func (r *Repository) Issue(ctx context.Context, inv *Invoice, series string, format func(seq Sequence) string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		seq := Sequence{Series: series, Year: inv.IssuedAt.Year()}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&seq).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("series = ? AND year = ?", seq.Series, seq.Year).
+			First(&seq).Error; err != nil {
+			return err
+		}
+		seq.Last++
+		if err := tx.Model(&Sequence{}).
+			Where("series = ? AND year = ?", seq.Series, seq.Year).
+			Update("last", seq.Last).Error; err != nil {
+			return err
+		}
+		inv.Number = format(seq)
+		return tx.Create(inv).Error
+	})
+}
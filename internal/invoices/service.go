@@ -0,0 +1,235 @@
+package invoices
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/erfnzmn/Library_Management_System/internal/fines"
+	"github.com/erfnzmn/Library_Management_System/internal/sales"
+)
+
+var (
+	ErrNotInvoiceable = errors.New("order has not been paid")
+	ErrNotAPayment    = errors.New("receipts are issued for payments only")
+)
+
+// Invoice number series.
+const (
+	SeriesInvoice = "INV"
+	SeriesReceipt = "RCT"
+)
+
+// Customers resolves the name printed on an invoice; implemented by the
+// users service.
+type Customers interface {
+	DisplayName(ctx context.Context, userID uint) (string, error)
+}
+
+type Service struct {
+	repo      *Repository
+	sales     *sales.Service
+	fines     *fines.Service
+	customers Customers
+
+	// sale prices include these taxes; fines are not taxed
+	taxes    []Tax
+	seller   Seller
+	currency string
+	lang     string
+	loc      *time.Location
+}
+
+func NewService(repo *Repository, salesService *sales.Service, finesService *fines.Service) *Service {
+	return &Service{
+		repo:     repo,
+		sales:    salesService,
+		fines:    finesService,
+		currency: sales.Currency,
+		lang:     "fa",
+		loc:      time.UTC,
+	}
+}
+
+func (s *Service) SetCustomers(c Customers) {
+	s.customers = c
+}
+
+func (s *Service) SetTaxes(taxes []Tax) {
+	s.taxes = taxes
+}
+
+func (s *Service) SetSeller(seller Seller) {
+	s.seller = seller
+}
+
+// SetLocale sets the default language of rendered invoices and the time
+// zone their dates are printed in.
+func (s *Service) SetLocale(lang string, loc *time.Location) {
+	if lang != "" {
+		s.lang = lang
+	}
+	if loc != nil {
+		s.loc = loc
+	}
+}
+
+func (s *Service) Seller() Seller {
+	return s.seller
+}
+
+// Formatter returns the formatter for lang, or for the default language
+// when lang is empty.
+func (s *Service) Formatter(lang string) Formatter {
+	if lang == "" {
+		lang = s.lang
+	}
+	return NewFormatter(lang, s.loc)
+}
+
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// owns reports whether a document of userID may be shown to owner; owner 0
+// stands for staff, who see every document.
+func owns(owner, userID uint) bool {
+	return owner == 0 || owner == userID
+}
+
+// ForOrder returns the invoice of a paid (or since refunded) order, issuing
+// it on first request. A non-zero owner only gets invoices of their own
+// orders; any other order is reported as not found, and nothing is issued.
+func (s *Service) ForOrder(ctx context.Context, orderID, owner uint) (*Invoice, error) {
+	inv, err := s.repo.GetByOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if inv != nil {
+		if !owns(owner, inv.UserID) {
+			return nil, sales.ErrOrderNotFound
+		}
+		return inv, nil
+	}
+	order, err := s.sales.GetOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if !owns(owner, order.UserID) {
+		return nil, sales.ErrOrderNotFound
+	}
+	if order.PaidAt == nil {
+		return nil, ErrNotInvoiceable
+	}
+
+	inv = &Invoice{
+		Kind:     KindOrder,
+		OrderID:  &order.ID,
+		UserID:   order.UserID,
+		Currency: s.currency,
+		Total:    round(order.Total),
+	}
+	// prices are tax inclusive: split each line into net amount and tax
+	rate := 0.0
+	for _, t := range s.taxes {
+		rate += t.Rate
+	}
+	for _, item := range order.Items {
+		inv.Lines = append(inv.Lines, InvoiceLine{
+			Description: item.Title,
+			Quantity:    item.Quantity,
+			UnitPrice:   round(item.UnitPrice / (1 + rate)),
+			Discount:    round(item.Discount / (1 + rate)),
+			Amount:      round(item.LineTotal / (1 + rate)),
+		})
+		inv.Subtotal += round(item.LineTotal / (1 + rate))
+	}
+	inv.Subtotal = round(inv.Subtotal)
+	for _, t := range s.taxes {
+		line := TaxLine{Name: t.Name, Rate: t.Rate, Base: inv.Subtotal, Amount: round(inv.Subtotal * t.Rate)}
+		inv.Taxes = append(inv.Taxes, line)
+		inv.Tax += line.Amount
+	}
+	// rounding differences go to the last tax line so the total matches
+	// what was charged
+	if n := len(inv.Taxes); n > 0 {
+		diff := round(inv.Total - inv.Subtotal - inv.Tax)
+		inv.Taxes[n-1].Amount = round(inv.Taxes[n-1].Amount + diff)
+		inv.Tax += diff
+	}
+	inv.Tax = round(inv.Tax)
+	return s.issue(ctx, inv, SeriesInvoice, func() (*Invoice, error) { return s.repo.GetByOrder(ctx, orderID) })
+}
+
+// ForFinePayment returns the receipt of a fine payment, issuing it on first
+// request. owner restricts it as in ForOrder.
+func (s *Service) ForFinePayment(ctx context.Context, entryID, owner uint) (*Invoice, error) {
+	inv, err := s.repo.GetByFineEntry(ctx, entryID)
+	if err != nil {
+		return nil, err
+	}
+	if inv != nil {
+		if !owns(owner, inv.UserID) {
+			return nil, fines.ErrEntryNotFound
+		}
+		return inv, nil
+	}
+	entry, err := s.fines.GetEntry(ctx, entryID)
+	if err != nil {
+		return nil, err
+	}
+	if !owns(owner, entry.UserID) {
+		return nil, fines.ErrEntryNotFound
+	}
+	if entry.Kind != fines.KindPayment {
+		return nil, ErrNotAPayment
+	}
+
+	amount := round(-entry.Amount)
+	desc := "Fine payment"
+	if entry.Note != "" {
+		desc += " - " + entry.Note
+	}
+	if entry.LoanID != nil {
+		desc += fmt.Sprintf(" (loan #%d)", *entry.LoanID)
+	}
+	inv = &Invoice{
+		Kind:        KindFinePayment,
+		FineEntryID: &entry.ID,
+		UserID:      entry.UserID,
+		Currency:    s.currency,
+		Subtotal:    amount,
+		Total:       amount,
+		Lines: []InvoiceLine{{
+			Description: desc,
+			Quantity:    1,
+			UnitPrice:   amount,
+			Amount:      amount,
+		}},
+	}
+	return s.issue(ctx, inv, SeriesReceipt, func() (*Invoice, error) { return s.repo.GetByFineEntry(ctx, entryID) })
+}
+
+// issue numbers and stores inv. When a concurrent request issued the same
+// document first, the unique index refuses ours and theirs is returned.
+func (s *Service) issue(ctx context.Context, inv *Invoice, series string, existing func() (*Invoice, error)) (*Invoice, error) {
+	inv.IssuedAt = time.Now().UTC()
+	if s.customers != nil {
+		if name, err := s.customers.DisplayName(ctx, inv.UserID); err == nil {
+			inv.Customer = name
+		}
+	}
+	err := s.repo.Issue(ctx, inv, series, func(seq Sequence) string {
+		return fmt.Sprintf("%s-%d-%06d", strings.ToUpper(seq.Series), seq.Year, seq.Last)
+	})
+	if err != nil {
+		if other, gerr := existing(); gerr == nil && other != nil {
+			return other, nil
+		}
+		return nil, err
+	}
+	return inv, nil
+}
@@ -0,0 +1,130 @@
+package loans
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/erfnzmn/Library_Management_System/pkg/lock"
+	"gorm.io/gorm"
+)
+
+const expiryBatchSize = 100
+
+// ExpireReservation marks a reservation that was not picked up as expired
+// and hands its copy back to the shelf or to the next hold in the queue.
+// Loans that are no longer reserved are skipped, so it is safe to race with
+// a confirm or cancel.
+func (s *Service) ExpireReservation(ctx context.Context, loanID uint) (bool, error) {
+	expired := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		s := s.withTx(tx)
+		loan, err := s.repo.LockLoan(ctx, loanID)
+		if err != nil {
+			return err
+		}
+		if loan == nil || loan.Status != StatusReserved || !loan.IsActive {
+			return nil
+		}
+
+		if err := s.releaseCopy(ctx, loan); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		loan.Status = StatusExpired
+		loan.ExpiredAt = &now
+		loan.IsActive = false
+		if err := s.repo.UpdateLoan(ctx, loan); err != nil {
+			return err
+		}
+		expired = true
+		return s.promoteHolds(ctx, loan.BookID)
+	})
+	return expired, err
+}
+
+// ExpireReservations expires every reservation whose pickup window has
+// passed and returns how many were expired. Days the library is closed do
+// not count towards the window.
+func (s *Service) ExpireReservations(ctx context.Context, window time.Duration) (int, error) {
+	now := time.Now()
+	cutoff := now.Add(-window)
+	total := 0
+	for {
+		stale, err := s.repo.GetStaleReservations(ctx, cutoff, expiryBatchSize)
+		if err != nil {
+			return total, err
+		}
+		n := 0
+		for _, loan := range stale {
+			if now.Before(s.cal.PickupDeadline(loan.ReservedAt, window)) {
+				continue
+			}
+			ok, err := s.ExpireReservation(ctx, loan.ID)
+			if err != nil {
+				return total, err
+			}
+			if ok {
+				n++
+				log.Printf("reservation %d expired (user=%d book=%d)", loan.ID, loan.UserID, loan.BookID)
+			}
+		}
+		total += n
+		// a short page means we are done; n == 0 guards against spinning on
+		// rows another instance keeps from being expired
+		if len(stale) < expiryBatchSize || n == 0 {
+			return total, nil
+		}
+	}
+}
+
+// ExpiryWorker periodically runs ExpireReservations. Only one instance in
+// the cluster does the work on each tick, guarded by a distributed lock.
+type ExpiryWorker struct {
+	service  *Service
+	locker   lock.Locker
+	window   time.Duration
+	interval time.Duration
+}
+
+const expiryLockKey = "loans:expire-reservations"
+
+func NewExpiryWorker(service *Service, locker lock.Locker, window, interval time.Duration) *ExpiryWorker {
+	return &ExpiryWorker{service: service, locker: locker, window: window, interval: interval}
+}
+
+// Run blocks until ctx is cancelled.
+func (w *ExpiryWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		w.tick(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *ExpiryWorker) tick(ctx context.Context) {
+	// the lock outlives a normal run but frees itself if we crash
+	release, ok, err := w.locker.TryAcquire(ctx, expiryLockKey, w.interval)
+	if err != nil {
+		log.Printf("expiry worker: lock: %v", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	defer release()
+
+	n, err := w.service.ExpireReservations(ctx, w.window)
+	if err != nil {
+		log.Printf("expiry worker: %v", err)
+	}
+	if n > 0 {
+		log.Printf("expiry worker: %d reservation(s) expired", n)
+	}
+}
@@ -2,27 +2,35 @@ package loans
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/erfnzmn/Library_Management_System/pkg/middleware"
-	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 	"github.com/streadway/amqp"
 )
 
+// Publisher queues reservation requests; implemented by the RabbitMQ
+// client, which fails fast while the broker is unreachable.
+type Publisher interface {
+	Publish(exchange, key string, msg amqp.Publishing) error
+}
+
 type Handler struct {
 	service *Service
-	rabbitChannel *amqp.Channel
+	publisher Publisher
 	jwtSecret []byte
 }
 
-func NewHandler(service *Service, rabbitChannel *amqp.Channel, jwtSecret string) *Handler {
+func NewHandler(service *Service, publisher Publisher, jwtSecret string) *Handler {
 	return &Handler{
-		service:       service,
-		rabbitChannel: rabbitChannel,
-		jwtSecret:     []byte(jwtSecret),
+		service:   service,
+		publisher: publisher,
+		jwtSecret: []byte(jwtSecret),
 	}
 }
 // RegisterRoutes 
@@ -31,13 +39,33 @@ func (h *Handler) RegisterRoutes(e *echo.Echo) {
 
 	g := e.Group("/api/loans")
 
-	g.Use(echojwt.JWT([]byte(h.jwtSecret)))
+	g.Use(middleware.JWT(string(h.jwtSecret)))
 
-	g.POST("/reserve", h.ReserveBook)
-	g.POST("/:id/confirm", h.ConfirmBorrow)
-	g.POST("/:id/return", h.ReturnBook)
+	staff := middleware.RequirePermission(middleware.PermLoansManage)
+
+	g.POST("/reserve", h.ReserveBook, middleware.RequirePermission(middleware.PermLoansReserve), middleware.Idempotent)
+	g.POST("/:id/confirm", h.ConfirmBorrow, staff)
+	g.POST("/:id/return", h.ReturnBook, staff)
 	g.POST("/:id/cancel", h.CancelReservation)
-	g.GET("/user/:userID", h.GetUserLoans)
+	g.POST("/:id/renew", h.RenewLoan)
+	g.GET("/:id/renewals", h.GetRenewals)
+	g.GET("/user/:userID", h.GetUserLoans, middleware.SelfOr("userID", middleware.PermLoansManage))
+
+	// circulation policy
+	g.GET("/policy", h.GetMyPolicy)
+	g.GET("/policies", h.GetPolicies, staff)
+	g.POST("/policies/reload", h.ReloadPolicies, staff)
+
+	// queued reservation requests; the event stream also takes the token
+	// as ?access_token= for EventSource clients
+	g.GET("/requests", h.GetMyRequests)
+	g.GET("/requests/:id", h.GetRequest)
+	e.GET("/api/loans/requests/:id/events", h.RequestEvents, middleware.StreamJWT(string(h.jwtSecret)))
+
+	// hold queue
+	g.GET("/holds", h.GetMyHolds)
+	g.POST("/holds/:id/cancel", h.CancelHold)
+	g.GET("/holds/book/:bookID", h.GetBookQueue, staff)
 }
 
 // ReserveBook 
@@ -61,23 +89,159 @@ func (h *Handler) ReserveBook(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "encode error"})
 	}
 
-	err = h.rabbitChannel.Publish(
-		"", "reserve_requests", false, false,
+	ctx := c.Request().Context()
+	request, err := h.service.NewRequest(ctx, userID, req.BookID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+
+	err = h.publisher.Publish(
+		"", "reserve_requests",
 		amqp.Publishing{
-			ContentType:  "application/json",
-			DeliveryMode: amqp.Persistent,
-			Body:         body,
+			ContentType:   "application/json",
+			DeliveryMode:  amqp.Persistent,
+			MessageId:     request.ID,
+			CorrelationId: request.ID,
+			Timestamp:     time.Now().UTC(),
+			Body:          body,
 		},
 	)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to queue reservation"})
+		log.Printf("queue reservation (user=%d book=%d): %v", userID, req.BookID, err)
+		// "transient" as classified by the consumer
+		if err := h.service.RequestFailed(ctx, request.ID, err, "transient", true, 0); err != nil {
+			log.Printf("record request %s: %v", request.ID, err)
+		}
+		return c.JSON(http.StatusServiceUnavailable, echo.Map{"error": "failed to queue reservation, try again shortly"})
 	}
 
 	return c.JSON(http.StatusAccepted, echo.Map{
-		"message": "reservation request queued",
+		"message":    "reservation request queued",
+		"request_id": request.ID,
+		"status":     request.Status,
+		"status_url": "/api/loans/requests/" + request.ID,
+		"events_url": "/api/loans/requests/" + request.ID + "/events",
 	})
 }
 
+// GetMyRequests lists the caller's latest reservation requests
+func (h *Handler) GetMyRequests(c echo.Context) error {
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid or missing token"})
+	}
+	reqs, err := h.service.GetUserRequests(c.Request().Context(), userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, reqs)
+}
+
+// GetRequest shows where a queued reservation request stands
+func (h *Handler) GetRequest(c echo.Context) error {
+	req, ok, err := h.authorizeRequest(c)
+	if !ok {
+		return err
+	}
+	return c.JSON(http.StatusOK, req)
+}
+
+// authorizeRequest loads the :id request for its owner or staff. When ok is
+// false the response has already been written.
+func (h *Handler) authorizeRequest(c echo.Context) (req *ReservationRequest, ok bool, err error) {
+	req, err = h.service.GetRequest(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return nil, false, c.JSON(loanErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	if middleware.Can(c, middleware.PermLoansManage) {
+		return req, true, nil
+	}
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return nil, false, c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid or missing token"})
+	}
+	if req.UserID != userID {
+		return nil, false, c.JSON(http.StatusForbidden, echo.Map{"error": "FORBIDDEN"})
+	}
+	return req, true, nil
+}
+
+const (
+	streamKeepAlive = 15 * time.Second
+	streamTimeout   = 5 * time.Minute
+)
+
+// RequestEvents streams a reservation request as server-sent "status"
+// events: the current state first, then every change until the request
+// succeeds or fails. Clients reconnect after the timeout event.
+func (h *Handler) RequestEvents(c echo.Context) error {
+	if _, ok, err := h.authorizeRequest(c); !ok {
+		return err
+	}
+	ctx := c.Request().Context()
+	id := c.Param("id")
+	updates, cancel, err := h.service.WatchRequest(ctx, id)
+	if err != nil {
+		return c.JSON(http.StatusServiceUnavailable, echo.Map{"error": "event stream unavailable"})
+	}
+	defer cancel()
+	// read again now that updates are captured
+	req, err := h.service.GetRequest(ctx, id)
+	if err != nil {
+		return c.JSON(loanErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no") // nginx
+	res.WriteHeader(http.StatusOK)
+
+	payload, _ := json.Marshal(req)
+	if err := writeEvent(res, "status", payload); err != nil || req.Final() {
+		return nil
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	timeout := time.NewTimer(streamTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timeout.C:
+			_ = writeEvent(res, "timeout", []byte(`{}`))
+			return nil
+		case <-keepAlive.C:
+			if _, err := res.Write([]byte(": keep-alive\n\n")); err != nil {
+				return nil
+			}
+			res.Flush()
+		case payload, ok := <-updates:
+			if !ok {
+				return nil
+			}
+			var update ReservationRequest
+			if err := json.Unmarshal(payload, &update); err != nil {
+				continue
+			}
+			if err := writeEvent(res, "status", payload); err != nil || update.Final() {
+				return nil
+			}
+		}
+	}
+}
+
+func writeEvent(res *echo.Response, event string, data []byte) error {
+	if _, err := fmt.Fprintf(res, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	res.Flush()
+	return nil
+}
+
 // ConfirmBorrow 
 func (h *Handler) ConfirmBorrow(c echo.Context) error {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
@@ -85,7 +249,7 @@ func (h *Handler) ConfirmBorrow(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid loan id"})
 	}
 	if err := h.service.ConfirmBorrow(c.Request().Context(), uint(id)); err != nil {
-		return c.JSON(http.StatusNotFound, echo.Map{"error": err.Error()})
+		return c.JSON(loanErrorStatus(err), echo.Map{"error": err.Error()})
 	}
 	return c.JSON(http.StatusOK, echo.Map{"message": "loan confirmed"})
 }
@@ -97,7 +261,7 @@ func (h *Handler) ReturnBook(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid loan id"})
 	}
 	if err := h.service.ReturnBook(c.Request().Context(), uint(id)); err != nil {
-		return c.JSON(http.StatusNotFound, echo.Map{"error": err.Error()})
+		return c.JSON(loanErrorStatus(err), echo.Map{"error": err.Error()})
 	}
 	return c.JSON(http.StatusOK, echo.Map{"message": "book returned successfully"})
 }
@@ -108,12 +272,72 @@ func (h *Handler) CancelReservation(c echo.Context) error {
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid loan id"})
 	}
+	// members may only cancel their own reservations
+	if ok, err := h.authorizeLoan(c, uint(id)); !ok {
+		return err
+	}
 	if err := h.service.CancelReservation(c.Request().Context(), uint(id)); err != nil {
-		return c.JSON(http.StatusNotFound, echo.Map{"error": err.Error()})
+		return c.JSON(loanErrorStatus(err), echo.Map{"error": err.Error()})
 	}
 	return c.JSON(http.StatusOK, echo.Map{"message": "reservation cancelled"})
 }
 
+// authorizeLoan lets staff through and otherwise checks that the caller owns
+// the loan. When ok is false the response has already been written.
+func (h *Handler) authorizeLoan(c echo.Context, loanID uint) (ok bool, err error) {
+	if middleware.Can(c, middleware.PermLoansManage) {
+		return true, nil
+	}
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return false, c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid or missing token"})
+	}
+	loan, err := h.service.GetLoan(c.Request().Context(), loanID)
+	if err != nil {
+		return false, c.JSON(loanErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	if loan.UserID != userID {
+		return false, c.JSON(http.StatusForbidden, echo.Map{"error": "FORBIDDEN"})
+	}
+	return true, nil
+}
+
+// RenewLoan
+func (h *Handler) RenewLoan(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid loan id"})
+	}
+	if ok, err := h.authorizeLoan(c, uint(id)); !ok {
+		return err
+	}
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid or missing token"})
+	}
+	loan, err := h.service.RenewLoan(c.Request().Context(), uint(id), userID)
+	if err != nil {
+		return c.JSON(loanErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, loan)
+}
+
+// GetRenewals
+func (h *Handler) GetRenewals(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid loan id"})
+	}
+	if ok, err := h.authorizeLoan(c, uint(id)); !ok {
+		return err
+	}
+	renewals, err := h.service.GetRenewals(c.Request().Context(), uint(id))
+	if err != nil {
+		return c.JSON(loanErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, renewals)
+}
+
 // GetUserLoans 
 func (h *Handler) GetUserLoans(c echo.Context) error {
 	userID, err := strconv.ParseUint(c.Param("userID"), 10, 64)
@@ -126,3 +350,95 @@ func (h *Handler) GetUserLoans(c echo.Context) error {
 	}
 	return c.JSON(http.StatusOK, loans)
 }
+
+// GetMyHolds lists the caller's holds with their place in the queue
+func (h *Handler) GetMyHolds(c echo.Context) error {
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid or missing token"})
+	}
+	holds, err := h.service.GetUserHolds(c.Request().Context(), userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, holds)
+}
+
+// CancelHold
+func (h *Handler) CancelHold(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid hold id"})
+	}
+	hold, err := h.service.GetHold(c.Request().Context(), uint(id))
+	if err != nil {
+		return c.JSON(loanErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	if !middleware.Can(c, middleware.PermLoansManage) {
+		userID, err := middleware.CurrentUserID(c)
+		if err != nil {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid or missing token"})
+		}
+		if hold.UserID != userID {
+			return c.JSON(http.StatusForbidden, echo.Map{"error": "FORBIDDEN"})
+		}
+	}
+	if err := h.service.CancelHold(c.Request().Context(), hold.ID); err != nil {
+		return c.JSON(loanErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"message": "hold cancelled"})
+}
+
+// GetBookQueue shows the waiting list of a book to staff
+func (h *Handler) GetBookQueue(c echo.Context) error {
+	bookID, err := strconv.ParseUint(c.Param("bookID"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid book id"})
+	}
+	holds, err := h.service.GetBookQueue(c.Request().Context(), uint(bookID))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, holds)
+}
+
+// GetMyPolicy shows the caller's limits, optionally for a genre (?genre=)
+func (h *Handler) GetMyPolicy(c echo.Context) error {
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid or missing token"})
+	}
+	return c.JSON(http.StatusOK, h.service.PolicyFor(c.Request().Context(), userID, c.QueryParam("genre")))
+}
+
+func (h *Handler) GetPolicies(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.service.PolicyRules())
+}
+
+func (h *Handler) ReloadPolicies(c echo.Context) error {
+	if err := h.service.ReloadPolicies(c.Request().Context()); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrNoPolicyStore) {
+			status = http.StatusConflict
+		}
+		return c.JSON(status, echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, h.service.PolicyRules())
+}
+
+func loanErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrLoanNotFound), errors.Is(err, ErrHoldNotFound), errors.Is(err, ErrBookNotFound),
+		errors.Is(err, ErrRequestNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrInvalidLoanState), errors.Is(err, ErrAlreadyReserved),
+		errors.Is(err, ErrRenewalLimit), errors.Is(err, ErrHoldsWaiting), errors.Is(err, ErrLoanOverdue):
+		return http.StatusConflict
+	case errors.Is(err, ErrOverLimit):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ErrUserBlocked):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,117 @@
+package loans
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// promoteHolds hands free copies of a book to the head of its queue until
+// either runs out. Promoted holds become loans in StatusReserved, i.e.
+// ready for pickup.
+func (s *Service) promoteHolds(ctx context.Context, bookID uint) error {
+	if _, err := s.bookRepo.LockBook(ctx, bookID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	for {
+		hold, err := s.repo.NextHold(ctx, bookID)
+		if err != nil || hold == nil {
+			return err
+		}
+		loan, err := s.allocate(ctx, hold.UserID, bookID)
+		if errors.Is(err, ErrNoStockAvailable) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		hold.Status = HoldFulfilled
+		hold.LoanID = &loan.ID
+		hold.FulfilledAt = &now
+		if err := s.repo.UpdateHold(ctx, hold); err != nil {
+			return err
+		}
+		log.Printf("hold %d promoted: loan %d ready for pickup (user=%d book=%d)", hold.ID, loan.ID, hold.UserID, bookID)
+	}
+}
+
+// PromoteHolds is exposed for callers that add copies to circulation.
+func (s *Service) PromoteHolds(ctx context.Context, bookID uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return s.withTx(tx).promoteHolds(ctx, bookID)
+	})
+}
+
+func (s *Service) GetHold(ctx context.Context, holdID uint) (*Hold, error) {
+	hold, err := s.repo.GetHoldByID(ctx, holdID)
+	if err != nil {
+		return nil, err
+	}
+	if hold == nil {
+		return nil, ErrHoldNotFound
+	}
+	if hold.Status == HoldQueued {
+		if hold.Position, err = s.repo.QueuePosition(ctx, hold); err != nil {
+			return nil, err
+		}
+	}
+	return hold, nil
+}
+
+// GetUserHolds lists the holds of a user with queue positions.
+func (s *Service) GetUserHolds(ctx context.Context, userID uint) ([]Hold, error) {
+	holds, err := s.repo.GetHoldsByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range holds {
+		if holds[i].Status != HoldQueued {
+			continue
+		}
+		if holds[i].Position, err = s.repo.QueuePosition(ctx, &holds[i]); err != nil {
+			return nil, err
+		}
+	}
+	return holds, nil
+}
+
+// GetBookQueue returns the queued holds of a book in allocation order.
+func (s *Service) GetBookQueue(ctx context.Context, bookID uint) ([]Hold, error) {
+	holds, err := s.repo.GetQueuedHoldsByBook(ctx, bookID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range holds {
+		holds[i].Position = i + 1
+	}
+	return holds, nil
+}
+
+func (s *Service) CancelHold(ctx context.Context, holdID uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		repo := s.repo.WithTx(tx)
+		// locked so that a promotion of the same hold waits for us, or we for it
+		hold, err := repo.LockHold(ctx, holdID)
+		if err != nil {
+			return err
+		}
+		if hold == nil {
+			return ErrHoldNotFound
+		}
+		if hold.Status != HoldQueued {
+			return ErrInvalidLoanState
+		}
+		now := time.Now()
+		hold.Status = HoldCancelled
+		hold.CancelledAt = &now
+		return repo.UpdateHold(ctx, hold)
+	})
+}
@@ -9,19 +9,25 @@ const (
 	StatusBorrowed = "borrowed"
 	StatusReturned = "returned"
 	StatusCancelled = "cancelled"
+	StatusExpired = "expired" // not picked up within the pickup window
+	StatusOverdue = "overdue" // borrowed and past DueDate
 )
 
 type Loan struct {
 	ID	uint      `gorm:"primaryKey" json:"id"`
 	UserID    uint      `gorm:"not null;index" json:"user_id"`
 	BookID    uint      `gorm:"not null;index" json:"book_id"`
-	Status    string    `gorm:"type:enum('reserved','borrowed','returned','cancelled');not null;default:'reserved'" json:"status"`
+	CopyID    *uint     `gorm:"index" json:"copy_id,omitempty"`
+	Status    string    `gorm:"type:enum('reserved','borrowed','overdue','returned','cancelled','expired');not null;default:'reserved'" json:"status"`
 	IsActive bool   `gorm:"not null;default:true" json:"is_active"`
 	ReservedAt  time.Time  `gorm:"not null;autoCreateTime" json:"reserved_at"`
 	BorrowedAt  *time.Time `json:"borrowed_at,omitempty"`
 	DueDate     *time.Time `json:"due_date,omitempty"`
 	ReturnedAt  *time.Time `json:"returned_at,omitempty"`
 	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+	ExpiredAt   *time.Time `json:"expired_at,omitempty"`
+	RenewalCount int       `gorm:"not null;default:0" json:"renewal_count"`
+	OverdueAt   *time.Time `json:"overdue_at,omitempty"`
 	Notes       string     `gorm:"type:varchar(255)" json:"notes,omitempty"`
 
 	CreatedAt time.Time  `json:"created_at"`
@@ -29,3 +35,92 @@ type Loan struct {
 }
 
 func (Loan) TableName() string { return "loans" }
+
+// LoanRenewal is one extension of a loan's due date.
+type LoanRenewal struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	LoanID          uint      `gorm:"not null;index" json:"loan_id"`
+	RenewedBy       uint      `gorm:"not null" json:"renewed_by"`
+	PreviousDueDate time.Time `gorm:"not null" json:"previous_due_date"`
+	NewDueDate      time.Time `gorm:"not null" json:"new_due_date"`
+	RenewedAt       time.Time `gorm:"not null" json:"renewed_at"`
+}
+
+func (LoanRenewal) TableName() string { return "loan_renewals" }
+
+const (
+	HoldQueued    = "queued"
+	HoldFulfilled = "fulfilled" // a copy was allocated and LoanID is ready for pickup
+	HoldCancelled = "cancelled"
+)
+
+// Hold is a place in the waiting queue of a book with no free copy.
+// Queues are ordered by Priority (higher first), then by QueuedAt.
+type Hold struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      uint       `gorm:"not null;index" json:"user_id"`
+	BookID      uint       `gorm:"not null;index:idx_holds_queue,priority:1" json:"book_id"`
+	Status      string     `gorm:"type:enum('queued','fulfilled','cancelled');not null;default:'queued';index:idx_holds_queue,priority:2" json:"status"`
+	Priority    int        `gorm:"not null;default:0" json:"priority"`
+	LoanID      *uint      `json:"loan_id,omitempty"`
+	QueuedAt    time.Time  `gorm:"not null" json:"queued_at"`
+	FulfilledAt *time.Time `json:"fulfilled_at,omitempty"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Position is the 1-based place in the queue, filled for queued holds.
+	Position int `gorm:"-" json:"position,omitempty"`
+}
+
+func (Hold) TableName() string { return "holds" }
+
+// Reservation is the outcome of ReserveBook: either a loan ready for pickup
+// or a queued hold.
+type Reservation struct {
+	Loan *Loan `json:"loan,omitempty"`
+	Hold *Hold `json:"hold,omitempty"`
+}
+
+const (
+	RequestPending   = "pending"  // queued, not processed yet
+	RequestRetrying  = "retrying" // failed for a transient reason, will be tried again
+	RequestSucceeded = "succeeded"
+	RequestFailed    = "failed"
+)
+
+// ReservationRequest tracks a reservation queued through the broker. Its ID
+// is the correlation ID returned to the client and carried by the message.
+type ReservationRequest struct {
+	ID          string     `gorm:"primaryKey;type:char(32)" json:"id"`
+	UserID      uint       `gorm:"not null;index" json:"user_id"`
+	BookID      uint       `gorm:"not null" json:"book_id"`
+	Status      string     `gorm:"type:enum('pending','retrying','succeeded','failed');not null;default:'pending'" json:"status"`
+	Outcome     string     `gorm:"type:varchar(20)" json:"outcome,omitempty"` // reserved or queued, on success
+	LoanID      *uint      `json:"loan_id,omitempty"`
+	HoldID      *uint      `json:"hold_id,omitempty"`
+	Error       string     `gorm:"type:varchar(255)" json:"error,omitempty"`
+	ErrorClass  string     `gorm:"type:varchar(20)" json:"error_class,omitempty"`
+	Attempts    int        `gorm:"not null;default:0" json:"attempts"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (ReservationRequest) TableName() string { return "reservation_requests" }
+
+// Final reports whether the request will not change any more.
+func (r *ReservationRequest) Final() bool {
+	return r.Status == RequestSucceeded || r.Status == RequestFailed
+}
+
+// ProcessedMessage records a queue message that has been acted upon, so a
+// redelivered copy is recognised.
+type ProcessedMessage struct {
+	MessageID   string    `gorm:"primaryKey;type:varchar(64)"`
+	ProcessedAt time.Time `gorm:"not null"`
+}
+
+func (ProcessedMessage) TableName() string { return "processed_messages" }
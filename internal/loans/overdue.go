@@ -0,0 +1,15 @@
+package loans
+
+import (
+	"context"
+	"time"
+)
+
+// MarkOverdue moves borrowed loans past their due date to StatusOverdue.
+func (s *Service) MarkOverdue(ctx context.Context, now time.Time) (int64, error) {
+	return s.repo.MarkOverdue(ctx, now)
+}
+
+func (s *Service) GetOverdueLoans(ctx context.Context) ([]Loan, error) {
+	return s.repo.GetOverdueLoans(ctx)
+}
@@ -0,0 +1,47 @@
+package loans
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/erfnzmn/Library_Management_System/internal/policy"
+)
+
+var ErrNoPolicyStore = errors.New("circulation policies are not stored in the database")
+
+// PolicyFor resolves the circulation policy for a user and a book genre.
+// Without a user directory, or if the role lookup fails, the role-less
+// rules apply.
+func (s *Service) PolicyFor(ctx context.Context, userID uint, genre string) policy.Policy {
+	role := ""
+	if s.users != nil {
+		r, err := s.users.UserRole(ctx, userID)
+		if err != nil {
+			log.Printf("policy: role of user %d: %v", userID, err)
+		}
+		role = r
+	}
+	return s.policies.Resolve(role, genre)
+}
+
+// LoanPolicy resolves the policy of an existing loan.
+func (s *Service) LoanPolicy(ctx context.Context, loan *Loan) (policy.Policy, error) {
+	book, err := s.bookRepo.GetBookByID(ctx, loan.BookID)
+	if err != nil {
+		return policy.Policy{}, err
+	}
+	return s.PolicyFor(ctx, loan.UserID, book.Genre), nil
+}
+
+func (s *Service) PolicyRules() []policy.Rule {
+	return s.policies.Rules()
+}
+
+// ReloadPolicies re-reads the rules from the database.
+func (s *Service) ReloadPolicies(ctx context.Context) error {
+	if s.policyStore == nil {
+		return ErrNoPolicyStore
+	}
+	return s.policyStore.Reload(ctx, s.policies)
+}
@@ -0,0 +1,86 @@
+package loans
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRenewalLimit = errors.New("RENEWAL_LIMIT: loan has reached the maximum number of renewals")
+	ErrHoldsWaiting = errors.New("HOLDS_WAITING: other users are waiting for this book")
+	ErrLoanOverdue  = errors.New("OVERDUE: overdue loans cannot be renewed")
+)
+
+// RenewLoan extends the due date of a borrowed loan by one renewal period.
+// renewedBy is the user performing the renewal (the borrower or staff).
+func (s *Service) RenewLoan(ctx context.Context, loanID, renewedBy uint) (*Loan, error) {
+	var loan *Loan
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		s := s.withTx(tx)
+		var err error
+		loan, err = s.repo.LockLoan(ctx, loanID)
+		if err != nil {
+			return err
+		}
+		if loan == nil {
+			return ErrLoanNotFound
+		}
+		if loan.Status == StatusOverdue {
+			return ErrLoanOverdue
+		}
+		if loan.Status != StatusBorrowed || !loan.IsActive || loan.DueDate == nil {
+			return ErrInvalidLoanState
+		}
+
+		now := time.Now()
+		if loan.DueDate.Before(now) {
+			return ErrLoanOverdue
+		}
+		if err := s.isBlocked(ctx, loan.UserID); err != nil {
+			return err
+		}
+		pol, err := s.LoanPolicy(ctx, loan)
+		if err != nil {
+			return err
+		}
+		if loan.RenewalCount >= pol.MaxRenewals {
+			return ErrRenewalLimit
+		}
+		waiting, err := s.repo.CountQueuedHolds(ctx, loan.BookID)
+		if err != nil {
+			return err
+		}
+		if waiting > 0 {
+			return ErrHoldsWaiting
+		}
+
+		previous := *loan.DueDate
+		due := s.cal.Extend(previous, pol.RenewDays)
+		loan.DueDate = &due
+		loan.RenewalCount++
+		if err := s.repo.UpdateLoan(ctx, loan); err != nil {
+			return err
+		}
+		return s.repo.CreateRenewal(ctx, &LoanRenewal{
+			LoanID:          loan.ID,
+			RenewedBy:       renewedBy,
+			PreviousDueDate: previous,
+			NewDueDate:      due,
+			RenewedAt:       now,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return loan, nil
+}
+
+func (s *Service) GetRenewals(ctx context.Context, loanID uint) ([]LoanRenewal, error) {
+	if _, err := s.GetLoan(ctx, loanID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetRenewalsByLoan(ctx, loanID)
+}
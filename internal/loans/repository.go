@@ -3,8 +3,10 @@ package loans
 import (
 	"context"
 	"errors"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Repository struct {
@@ -15,6 +17,11 @@ func NewRepository(db *gorm.DB) *Repository {
 	return &Repository{db: db}
 }
 
+// WithTx returns a repository bound to the given transaction.
+func (r *Repository) WithTx(tx *gorm.DB) *Repository {
+	return &Repository{db: tx}
+}
+
 func (r *Repository) CreateLoan(ctx context.Context, loan *Loan) error {
 	return r.db.WithContext(ctx).Create(loan).Error
 }
@@ -30,6 +37,23 @@ func (r *Repository) GetLoanByID(ctx context.Context, id uint) (*Loan, error) {
 	return &loan, nil
 }
 
+// LockLoan is GetLoanByID locking the row until the transaction ends, so
+// that concurrent state changes of one loan (confirm, return, cancel,
+// expire, renew) take turns.
+func (r *Repository) LockLoan(ctx context.Context, id uint) (*Loan, error) {
+	var loan Loan
+	err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&loan, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &loan, nil
+}
+
 func (r *Repository) GetActiveLoansByBook(ctx context.Context, bookID uint) ([]Loan, error) {
 	var loans []Loan
 	if err := r.db.WithContext(ctx).
@@ -54,3 +78,243 @@ func (r *Repository) GetLoansByUser(ctx context.Context, userID uint) ([]Loan, e
 	}
 	return loans, nil
 }
+
+// GetStaleReservations returns reservations made before cutoff that were
+// never picked up, oldest first.
+func (r *Repository) GetStaleReservations(ctx context.Context, cutoff time.Time, limit int) ([]Loan, error) {
+	var loans []Loan
+	if err := r.db.WithContext(ctx).
+		Where("status = ? AND is_active = TRUE AND reserved_at < ?", StatusReserved, cutoff).
+		Order("reserved_at ASC").
+		Limit(limit).
+		Find(&loans).Error; err != nil {
+		return nil, err
+	}
+	return loans, nil
+}
+
+// Usage is what a user currently holds, for limit checks.
+type Usage struct {
+	Reserved int64 // copies waiting for pickup
+	Borrowed int64
+	Queued   int64 // holds
+}
+
+// Reservations counts both pickup-ready reservations and queued holds.
+func (u Usage) Reservations() int64 { return u.Reserved + u.Queued }
+
+func (r *Repository) CountUsage(ctx context.Context, userID uint) (Usage, error) {
+	var u Usage
+	var rows []struct {
+		Status string
+		N      int64
+	}
+	if err := r.db.WithContext(ctx).Model(&Loan{}).
+		Select("status, COUNT(*) AS n").
+		Where("user_id = ? AND is_active = TRUE", userID).
+		Group("status").
+		Scan(&rows).Error; err != nil {
+		return u, err
+	}
+	for _, row := range rows {
+		switch row.Status {
+		case StatusReserved:
+			u.Reserved = row.N
+		case StatusBorrowed, StatusOverdue:
+			u.Borrowed += row.N
+		}
+	}
+	err := r.db.WithContext(ctx).Model(&Hold{}).
+		Where("user_id = ? AND status = ?", userID, HoldQueued).
+		Count(&u.Queued).Error
+	return u, err
+}
+
+// MarkOverdue flags borrowed loans whose due date is before now.
+func (r *Repository) MarkOverdue(ctx context.Context, now time.Time) (int64, error) {
+	res := r.db.WithContext(ctx).Model(&Loan{}).
+		Where("status = ? AND is_active = TRUE AND due_date < ?", StatusBorrowed, now).
+		Updates(map[string]any{"status": StatusOverdue, "overdue_at": now})
+	return res.RowsAffected, res.Error
+}
+
+func (r *Repository) GetOverdueLoans(ctx context.Context) ([]Loan, error) {
+	var loans []Loan
+	if err := r.db.WithContext(ctx).
+		Where("status = ? AND is_active = TRUE", StatusOverdue).
+		Order("due_date ASC").
+		Find(&loans).Error; err != nil {
+		return nil, err
+	}
+	return loans, nil
+}
+
+func (r *Repository) CreateRenewal(ctx context.Context, renewal *LoanRenewal) error {
+	return r.db.WithContext(ctx).Create(renewal).Error
+}
+
+func (r *Repository) GetRenewalsByLoan(ctx context.Context, loanID uint) ([]LoanRenewal, error) {
+	var renewals []LoanRenewal
+	if err := r.db.WithContext(ctx).
+		Where("loan_id = ?", loanID).
+		Order("renewed_at ASC").
+		Find(&renewals).Error; err != nil {
+		return nil, err
+	}
+	return renewals, nil
+}
+
+func (r *Repository) CreateHold(ctx context.Context, hold *Hold) error {
+	return r.db.WithContext(ctx).Create(hold).Error
+}
+
+func (r *Repository) UpdateHold(ctx context.Context, hold *Hold) error {
+	return r.db.WithContext(ctx).Save(hold).Error
+}
+
+func (r *Repository) GetHoldByID(ctx context.Context, id uint) (*Hold, error) {
+	var hold Hold
+	if err := r.db.WithContext(ctx).First(&hold, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// LockHold is GetHoldByID locking the row until the transaction ends.
+func (r *Repository) LockHold(ctx context.Context, id uint) (*Hold, error) {
+	var hold Hold
+	if err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&hold, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// queueOrder is the FIFO-within-priority order of a hold queue
+const queueOrder = "priority DESC, queued_at ASC, id ASC"
+
+// NextHold returns the head of the queue of a book, or nil. Inside a
+// transaction the hold stays locked until it ends.
+func (r *Repository) NextHold(ctx context.Context, bookID uint) (*Hold, error) {
+	var hold Hold
+	err := r.db.WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("book_id = ? AND status = ?", bookID, HoldQueued).
+		Order(queueOrder).
+		First(&hold).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+func (r *Repository) CountQueuedHolds(ctx context.Context, bookID uint) (int64, error) {
+	var n int64
+	err := r.db.WithContext(ctx).Model(&Hold{}).
+		Where("book_id = ? AND status = ?", bookID, HoldQueued).
+		Count(&n).Error
+	return n, err
+}
+
+// QueuePosition counts the queued holds ahead of hold, plus one.
+func (r *Repository) QueuePosition(ctx context.Context, hold *Hold) (int, error) {
+	var ahead int64
+	err := r.db.WithContext(ctx).Model(&Hold{}).
+		Where("book_id = ? AND status = ?", hold.BookID, HoldQueued).
+		Where("priority > ? OR (priority = ? AND (queued_at < ? OR (queued_at = ? AND id < ?)))",
+			hold.Priority, hold.Priority, hold.QueuedAt, hold.QueuedAt, hold.ID).
+		Count(&ahead).Error
+	return int(ahead) + 1, err
+}
+
+func (r *Repository) GetHoldsByUser(ctx context.Context, userID uint) ([]Hold, error) {
+	var holds []Hold
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&holds).Error; err != nil {
+		return nil, err
+	}
+	return holds, nil
+}
+
+func (r *Repository) GetQueuedHoldsByBook(ctx context.Context, bookID uint) ([]Hold, error) {
+	var holds []Hold
+	if err := r.db.WithContext(ctx).
+		Where("book_id = ? AND status = ?", bookID, HoldQueued).
+		Order(queueOrder).
+		Find(&holds).Error; err != nil {
+		return nil, err
+	}
+	return holds, nil
+}
+
+// HasOpenRequest reports whether the user already has an active loan or a
+// queued hold for the book.
+func (r *Repository) HasOpenRequest(ctx context.Context, userID, bookID uint) (bool, error) {
+	var loans int64
+	if err := r.db.WithContext(ctx).Model(&Loan{}).
+		Where("user_id = ? AND book_id = ? AND is_active = TRUE", userID, bookID).
+		Count(&loans).Error; err != nil {
+		return false, err
+	}
+	if loans > 0 {
+		return true, nil
+	}
+	var holds int64
+	err := r.db.WithContext(ctx).Model(&Hold{}).
+		Where("user_id = ? AND book_id = ? AND status = ?", userID, bookID, HoldQueued).
+		Count(&holds).Error
+	return holds > 0, err
+}
+
+func (r *Repository) CreateRequest(ctx context.Context, req *ReservationRequest) error {
+	return r.db.WithContext(ctx).Create(req).Error
+}
+
+func (r *Repository) UpdateRequest(ctx context.Context, req *ReservationRequest) error {
+	return r.db.WithContext(ctx).Save(req).Error
+}
+
+func (r *Repository) GetRequest(ctx context.Context, id string) (*ReservationRequest, error) {
+	var req ReservationRequest
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&req).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func (r *Repository) GetRequestsByUser(ctx context.Context, userID uint, limit int) ([]ReservationRequest, error) {
+	var reqs []ReservationRequest
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&reqs).Error; err != nil {
+		return nil, err
+	}
+	return reqs, nil
+}
+
+// MarkMessageProcessed records a message ID; it reports false when the
+// message was already processed.
+func (r *Repository) MarkMessageProcessed(ctx context.Context, messageID string) (bool, error) {
+	res := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&ProcessedMessage{MessageID: messageID, ProcessedAt: time.Now()})
+	return res.RowsAffected > 0, res.Error
+}
@@ -0,0 +1,162 @@
+package loans
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/erfnzmn/Library_Management_System/pkg/events"
+	"gorm.io/gorm"
+)
+
+var ErrRequestNotFound = errors.New("reservation request not found")
+
+// SetEventBus shares request updates between instances; by default they
+// only reach clients connected to the instance that ran the consumer.
+func (s *Service) SetEventBus(bus events.Bus) {
+	s.events = bus
+}
+
+// RequestTopic is the event topic of a reservation request.
+func RequestTopic(id string) string {
+	return "loans:requests:" + id
+}
+
+// newRequestID is the correlation ID of a request, also used as the ID of
+// its message.
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// NewRequest records a reservation request before it is queued.
+func (s *Service) NewRequest(ctx context.Context, userID, bookID uint) (*ReservationRequest, error) {
+	req := &ReservationRequest{
+		ID:     newRequestID(),
+		UserID: userID,
+		BookID: bookID,
+		Status: RequestPending,
+	}
+	if err := s.repo.CreateRequest(ctx, req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func (s *Service) GetRequest(ctx context.Context, id string) (*ReservationRequest, error) {
+	req, err := s.repo.GetRequest(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if req == nil {
+		return nil, ErrRequestNotFound
+	}
+	return req, nil
+}
+
+func (s *Service) GetUserRequests(ctx context.Context, userID uint) ([]ReservationRequest, error) {
+	return s.repo.GetRequestsByUser(ctx, userID, 50)
+}
+
+// WatchRequest subscribes to the updates of a request. Subscribe before
+// reading the current state so that no update falls in between.
+func (s *Service) WatchRequest(ctx context.Context, id string) (<-chan []byte, func(), error) {
+	return s.events.Subscribe(ctx, RequestTopic(id))
+}
+
+// ProcessRequest reserves the book of a queued message and records the
+// outcome on its request. Each message ID is processed once: the ID is
+// stored in the transaction of the reservation, and a redelivered message
+// returns nil without reserving again. Messages queued without a request
+// record are reserved all the same.
+func (s *Service) ProcessRequest(ctx context.Context, messageID, requestID string, userID, bookID uint) (*Reservation, error) {
+	var req *ReservationRequest
+	if requestID != "" {
+		var err error
+		if req, err = s.repo.GetRequest(ctx, requestID); err != nil {
+			return nil, err
+		}
+	}
+
+	var res *Reservation
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		s := s.withTx(tx)
+		if messageID != "" {
+			fresh, err := s.repo.MarkMessageProcessed(ctx, messageID)
+			if err != nil || !fresh {
+				return err
+			}
+		}
+		var err error
+		if res, err = s.ReserveBook(ctx, userID, bookID); err != nil || req == nil {
+			return err
+		}
+
+		now := time.Now()
+		req.Status = RequestSucceeded
+		req.Error, req.ErrorClass = "", ""
+		req.CompletedAt = &now
+		if res.Loan != nil {
+			req.Outcome = StatusReserved
+			req.LoanID = &res.Loan.ID
+		} else {
+			req.Outcome = HoldQueued
+			req.HoldID = &res.Hold.ID
+		}
+		return s.repo.UpdateRequest(ctx, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if res != nil && req != nil {
+		s.publishRequest(ctx, req)
+	}
+	return res, nil
+}
+
+// RequestFailed records a failed attempt. final is false while the request
+// is still going to be retried.
+func (s *Service) RequestFailed(ctx context.Context, id string, cause error, class string, final bool, attempts int) error {
+	if id == "" {
+		return nil
+	}
+	req, err := s.repo.GetRequest(ctx, id)
+	if err != nil || req == nil {
+		return err
+	}
+	if req.Status == RequestSucceeded {
+		return nil
+	}
+	req.Error = cause.Error()
+	if len(req.Error) > 255 {
+		req.Error = req.Error[:255]
+	}
+	req.ErrorClass = class
+	req.Attempts = attempts
+	req.Status = RequestRetrying
+	if final {
+		now := time.Now()
+		req.Status = RequestFailed
+		req.CompletedAt = &now
+	}
+	if err := s.repo.UpdateRequest(ctx, req); err != nil {
+		return err
+	}
+	s.publishRequest(ctx, req)
+	return nil
+}
+
+func (s *Service) publishRequest(ctx context.Context, req *ReservationRequest) {
+	payload, err := json.Marshal(req)
+	if err == nil {
+		err = s.events.Publish(ctx, RequestTopic(req.ID), payload)
+	}
+	if err != nil {
+		log.Printf("publish request %s: %v", req.ID, err)
+	}
+}
@@ -2,10 +2,15 @@ package loans
 import (
 	"context"
 	"errors"
+	"log"
 	"time"
 
 
 	books "github.com/erfnzmn/Library_Management_System/internal/books"
+	"github.com/erfnzmn/Library_Management_System/internal/calendar"
+	"github.com/erfnzmn/Library_Management_System/internal/outbox"
+	"github.com/erfnzmn/Library_Management_System/internal/policy"
+	"github.com/erfnzmn/Library_Management_System/pkg/events"
 	"gorm.io/gorm"
 )
 
@@ -14,12 +19,45 @@ var (
 	ErrUserNotFound     = errors.New("user not found")
 	ErrNoStockAvailable = errors.New("no copies available for this book")
 	ErrLoanNotFound     = errors.New("loan not found")
+	ErrHoldNotFound     = errors.New("hold not found")
+	ErrAlreadyReserved  = errors.New("ALREADY_RESERVED: user already has an active reservation or hold for this book")
+	ErrInvalidLoanState = errors.New("loan is not in a state that allows this operation")
+	ErrUserBlocked      = errors.New("USER_BLOCKED: user is blocked from borrowing")
+	ErrOverLimit        = errors.New("OVER_LIMIT: user has reached the loan or reservation limit")
 )
 
+// UserDirectory gives the loans module what it needs to know about users
+// without depending on the users package.
+type UserDirectory interface {
+	UserRole(ctx context.Context, userID uint) (string, error)
+}
+
+// FineAccruer charges overdue fines for a loan up to a point in time. It is
+// called when an overdue loan is returned so the last days are not lost.
+type FineAccruer interface {
+	AccrueLoan(ctx context.Context, loan *Loan, until time.Time) error
+}
+
+// Blocker reports users that may not reserve, borrow or renew.
+type Blocker interface {
+	IsBlocked(ctx context.Context, userID uint) (bool, error)
+}
+
 type Service struct {
 	repo *Repository
 	bookRepo *books.Repository
 	db *gorm.DB
+
+	users UserDirectory
+	// holdPriority ranks hold queues by role; unknown roles get 0
+	holdPriority map[string]int
+	blockers     []Blocker
+	policies     *policy.Engine
+	policyStore  *policy.Store
+	fines        FineAccruer
+	cal          *calendar.Calendar
+	events       events.Bus
+	outbox       *outbox.Repository
 }
 
 func NewService(db *gorm.DB, loanRepo *Repository, bookRepo *books.Repository) *Service {
@@ -27,72 +65,283 @@ func NewService(db *gorm.DB, loanRepo *Repository, bookRepo *books.Repository) *
 		db:       db,
 		repo:     loanRepo,
 		bookRepo: bookRepo,
+		policies: policy.NewEngine(policy.Default, nil),
+		cal:      calendar.New(time.UTC),
+		events:   events.NewLocal(),
 	}
 }
 
-// ReserveBook
-func (s *Service) ReserveBook(ctx context.Context, userID, bookID uint) error {
-	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		// book inf
-		book, err := s.bookRepo.GetBookByID(ctx, bookID)
+// SetUserDirectory enables role-based features such as hold priorities.
+func (s *Service) SetUserDirectory(users UserDirectory) {
+	s.users = users
+}
+
+// SetHoldPriorities sets per-role priorities for hold queues, e.g.
+// {"student": 1}. Without it queues are plain FIFO.
+func (s *Service) SetHoldPriorities(priorities map[string]int) {
+	s.holdPriority = priorities
+}
+
+// AddBlocker adds a check consulted before reserving and renewing.
+func (s *Service) AddBlocker(b Blocker) {
+	s.blockers = append(s.blockers, b)
+}
+
+// SetCalendar makes due dates and pickup deadlines skip closed days.
+func (s *Service) SetCalendar(cal *calendar.Calendar) {
+	s.cal = cal
+}
+
+func (s *Service) SetFineAccruer(f FineAccruer) {
+	s.fines = f
+}
+
+// SetPolicyEngine replaces the built-in default circulation policy.
+func (s *Service) SetPolicyEngine(e *policy.Engine) {
+	s.policies = e
+}
+
+// SetPolicyStore makes ReloadPolicies read rules from the database.
+func (s *Service) SetPolicyStore(store *policy.Store) {
+	s.policyStore = store
+}
+
+// SetOutbox records LoanReserved, LoanBorrowed, LoanReturned and
+// LoanCancelled events with the changes they describe.
+func (s *Service) SetOutbox(o *outbox.Repository) {
+	s.outbox = o
+}
+
+// withTx returns a copy of the service whose repositories run in tx, so a
+// change and its outbox event commit or roll back together.
+func (s *Service) withTx(tx *gorm.DB) *Service {
+	txs := *s
+	txs.db = tx
+	txs.repo = s.repo.WithTx(tx)
+	txs.bookRepo = s.bookRepo.WithTx(tx)
+	if s.outbox != nil {
+		txs.outbox = s.outbox.WithTx(tx)
+	}
+	return &txs
+}
+
+// record adds an event about loan to the outbox; call it on a service
+// bound to the transaction of the change.
+func (s *Service) record(ctx context.Context, typ string, loan *Loan) error {
+	if s.outbox == nil {
+		return nil
+	}
+	ev, err := outbox.NewEvent(typ, "loan", loan.ID, loan)
+	if err != nil {
+		return err
+	}
+	return s.outbox.Add(ctx, ev)
+}
+
+func (s *Service) isBlocked(ctx context.Context, userID uint) error {
+	for _, b := range s.blockers {
+		blocked, err := b.IsBlocked(ctx, userID)
 		if err != nil {
 			return err
 		}
-		if book == nil {
-			return ErrBookNotFound
+		if blocked {
+			return ErrUserBlocked
 		}
+	}
+	return nil
+}
+
+func (s *Service) GetLoan(ctx context.Context, loanID uint) (*Loan, error) {
+	loan, err := s.repo.GetLoanByID(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	if loan == nil {
+		return nil, ErrLoanNotFound
+	}
+	return loan, nil
+}
 
-		// check stock
-		if book.Stock <= 0 {
-			return ErrNoStockAvailable
+// ReserveBook allocates a copy when one is free and nobody is waiting;
+// otherwise the user joins the hold queue of the book.
+func (s *Service) ReserveBook(ctx context.Context, userID, bookID uint) (*Reservation, error) {
+	var res *Reservation
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		s := s.withTx(tx)
+		// book inf; the lock makes reservations of one book take turns, so
+		// the queue and stock checks below stay true until commit
+		book, err := s.bookRepo.LockBook(ctx, bookID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrBookNotFound
+			}
+			return err
 		}
 
-		// status change stock --
-		book.Stock--
-		if book.Stock == 0 {
-			book.ReservationStatus = "reserved"
+		if err := s.isBlocked(ctx, userID); err != nil {
+			return err
 		}
-		if err := s.bookRepo.UpdateBook(ctx, book); err != nil {
+
+		open, err := s.repo.HasOpenRequest(ctx, userID, bookID)
+		if err != nil {
 			return err
 		}
+		if open {
+			return ErrAlreadyReserved
+		}
 
-		// new reserve recoed
-		loan := &Loan{
-			UserID:     userID,
-			BookID:     bookID,
-			Status:     StatusReserved,
-			IsActive:   true,
-			ReservedAt: time.Now(),
+		pol := s.PolicyFor(ctx, userID, book.Genre)
+		usage, err := s.repo.CountUsage(ctx, userID)
+		if err != nil {
+			return err
 		}
-		if err := s.repo.CreateLoan(ctx, loan); err != nil {
+		if usage.Reservations() >= int64(pol.MaxReservations) ||
+			usage.Borrowed+usage.Reserved >= int64(pol.MaxLoans) {
+			return ErrOverLimit
+		}
+
+		// people already waiting go first
+		waiting, err := s.repo.CountQueuedHolds(ctx, bookID)
+		if err != nil {
 			return err
 		}
+		if waiting == 0 {
+			loan, err := s.allocate(ctx, userID, bookID)
+			if err != nil && !errors.Is(err, ErrNoStockAvailable) {
+				return err
+			}
+			if loan != nil {
+				res = &Reservation{Loan: loan}
+				return nil
+			}
+		}
 
+		hold := &Hold{
+			UserID:   userID,
+			BookID:   bookID,
+			Status:   HoldQueued,
+			Priority: s.priorityOf(ctx, userID),
+			QueuedAt: time.Now(),
+		}
+		if err := s.repo.CreateHold(ctx, hold); err != nil {
+			return err
+		}
+		if hold.Position, err = s.repo.QueuePosition(ctx, hold); err != nil {
+			return err
+		}
+		res = &Reservation{Hold: hold}
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
 }
 
-// ConfirmBorrow
+// allocate reserves a free copy for the user and opens the loan.
+func (s *Service) allocate(ctx context.Context, userID, bookID uint) (*Loan, error) {
+	// pick an available copy
+	bc, err := s.bookRepo.FindAvailableCopy(ctx, bookID)
+	if err != nil {
+		return nil, err
+	}
+	if bc == nil {
+		return nil, ErrNoStockAvailable
+	}
+
+	// status change copy -> reserved, only if nobody took it meanwhile
+	n, err := s.bookRepo.TransitionCopies(ctx, []uint{bc.ID}, books.CopyStatusAvailable, books.CopyStatusReserved)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, ErrNoStockAvailable
+	}
+	if err := s.bookRepo.SyncAvailability(ctx, bookID); err != nil {
+		return nil, err
+	}
+
+	// new reserve recoed
+	loan := &Loan{
+		UserID:     userID,
+		BookID:     bookID,
+		CopyID:     &bc.ID,
+		Status:     StatusReserved,
+		IsActive:   true,
+		ReservedAt: time.Now(),
+	}
+	if err := s.repo.CreateLoan(ctx, loan); err != nil {
+		return nil, err
+	}
+	if err := s.record(ctx, outbox.LoanReserved, loan); err != nil {
+		return nil, err
+	}
+	return loan, nil
+}
+
+func (s *Service) priorityOf(ctx context.Context, userID uint) int {
+	if s.users == nil || len(s.holdPriority) == 0 {
+		return 0
+	}
+	role, err := s.users.UserRole(ctx, userID)
+	if err != nil {
+		log.Printf("hold priority: role of user %d: %v", userID, err)
+		return 0
+	}
+	return s.holdPriority[role]
+}
+
+// ConfirmBorrow hands a reserved copy to the user. The loan period comes
+// from the circulation policy of the user's role and the book's genre.
 func (s *Service) ConfirmBorrow(ctx context.Context, loanID uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return s.withTx(tx).confirmBorrow(ctx, loanID)
+	})
+}
+
+func (s *Service) confirmBorrow(ctx context.Context, loanID uint) error {
 	now := time.Now()
-	loan, err := s.repo.GetLoanByID(ctx, loanID)
+	loan, err := s.repo.LockLoan(ctx, loanID)
 	if err != nil {
 		return err
 	}
 	if loan == nil {
 		return ErrLoanNotFound
 	}
+	if loan.Status != StatusReserved || !loan.IsActive {
+		return ErrInvalidLoanState
+	}
+	pol, err := s.LoanPolicy(ctx, loan)
+	if err != nil {
+		return err
+	}
+	usage, err := s.repo.CountUsage(ctx, loan.UserID)
+	if err != nil {
+		return err
+	}
+	if usage.Borrowed >= int64(pol.MaxLoans) {
+		return ErrOverLimit
+	}
+	if loan.CopyID != nil {
+		if err := s.bookRepo.SetCopyStatus(ctx, *loan.CopyID, books.CopyStatusOnLoan); err != nil {
+			return err
+		}
+	}
 	loan.Status = StatusBorrowed
 	loan.BorrowedAt = &now
-	due := now.AddDate(0, 0, 14)
+	due := s.cal.DueDate(now, pol.LoanDays)
 	loan.DueDate = &due
-	return s.repo.UpdateLoan(ctx, loan)
+	if err := s.repo.UpdateLoan(ctx, loan); err != nil {
+		return err
+	}
+	return s.record(ctx, outbox.LoanBorrowed, loan)
 }
 
 // ReturnBook stock ++
 func (s *Service) ReturnBook(ctx context.Context, loanID uint) error {
 	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		loan, err := s.repo.GetLoanByID(ctx, loanID)
+		s := s.withTx(tx)
+		loan, err := s.repo.LockLoan(ctx, loanID)
 		if err != nil {
 			return err
 		}
@@ -100,24 +349,21 @@ func (s *Service) ReturnBook(ctx context.Context, loanID uint) error {
 			return ErrLoanNotFound
 		}
 
-		book, err := s.bookRepo.GetBookByID(ctx, loan.BookID)
-		if err != nil {
-			return err
-		}
-		if book == nil {
-			return ErrBookNotFound
+		if !loan.IsActive {
+			return ErrInvalidLoanState
 		}
 
-		//status change stock ++
-		book.Stock++
-		if book.Stock > 0 {
-			book.ReservationStatus = "available"
-		}
-		if err := s.bookRepo.UpdateBook(ctx, book); err != nil {
+		//status change copy -> available
+		if err := s.releaseCopy(ctx, loan); err != nil {
 			return err
 		}
 
 		now := time.Now()
+		if s.fines != nil && loan.DueDate != nil && loan.DueDate.Before(now) {
+			if err := s.fines.AccrueLoan(ctx, loan, now); err != nil {
+				return err
+			}
+		}
 		loan.Status = StatusReturned
 		loan.ReturnedAt = &now
 		loan.IsActive = false
@@ -125,15 +371,20 @@ func (s *Service) ReturnBook(ctx context.Context, loanID uint) error {
 		if err := s.repo.UpdateLoan(ctx, loan); err != nil {
 			return err
 		}
+		if err := s.record(ctx, outbox.LoanReturned, loan); err != nil {
+			return err
+		}
 
-		return nil
+		// next patron in the queue gets the copy
+		return s.promoteHolds(ctx, loan.BookID)
 	})
 }
 
 // CancelReservation
 func (s *Service) CancelReservation(ctx context.Context, loanID uint) error {
 	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		loan, err := s.repo.GetLoanByID(ctx, loanID)
+		s := s.withTx(tx)
+		loan, err := s.repo.LockLoan(ctx, loanID)
 		if err != nil {
 			return err
 		}
@@ -141,19 +392,11 @@ func (s *Service) CancelReservation(ctx context.Context, loanID uint) error {
 			return ErrLoanNotFound
 		}
 
-		book, err := s.bookRepo.GetBookByID(ctx, loan.BookID)
-		if err != nil {
-			return err
-		}
-		if book == nil {
-			return ErrBookNotFound
+		if loan.Status != StatusReserved || !loan.IsActive {
+			return ErrInvalidLoanState
 		}
 
-		book.Stock++
-		if book.Stock > 0 {
-			book.ReservationStatus = "available"
-		}
-		if err := s.bookRepo.UpdateBook(ctx, book); err != nil {
+		if err := s.releaseCopy(ctx, loan); err != nil {
 			return err
 		}
 
@@ -162,6 +405,26 @@ func (s *Service) CancelReservation(ctx context.Context, loanID uint) error {
 		loan.CancelledAt = &now
 		loan.IsActive = false
 
-		return s.repo.UpdateLoan(ctx, loan)
+		if err := s.repo.UpdateLoan(ctx, loan); err != nil {
+			return err
+		}
+		if err := s.record(ctx, outbox.LoanCancelled, loan); err != nil {
+			return err
+		}
+		return s.promoteHolds(ctx, loan.BookID)
 	})
 }
+
+// releaseCopy puts the copy held by a loan back on the shelf
+func (s *Service) releaseCopy(ctx context.Context, loan *Loan) error {
+	// book before copy, in the order ReserveBook locks them
+	if _, err := s.bookRepo.LockBook(ctx, loan.BookID); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if loan.CopyID != nil {
+		if err := s.bookRepo.SetCopyStatus(ctx, *loan.CopyID, books.CopyStatusAvailable); err != nil {
+			return err
+		}
+	}
+	return s.bookRepo.SyncAvailability(ctx, loan.BookID)
+}
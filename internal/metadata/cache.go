@@ -0,0 +1,57 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// notFoundMarker is cached for misses so unknown ISBNs do not hit the
+// upstream APIs on every request.
+const notFoundMarker = "-"
+
+// Cached wraps a provider with a Redis cache.
+type Cached struct {
+	next        Provider
+	rdb         *redis.Client
+	ttl         time.Duration
+	negativeTTL time.Duration
+}
+
+func NewCached(next Provider, rdb *redis.Client, ttl time.Duration) *Cached {
+	return &Cached{next: next, rdb: rdb, ttl: ttl, negativeTTL: ttl / 24}
+}
+
+func (c *Cached) Name() string { return c.next.Name() }
+
+func (c *Cached) key(isbn string) string {
+	return "isbn:meta:" + isbn
+}
+
+func (c *Cached) Lookup(ctx context.Context, isbn string) (*Record, error) {
+	if c.rdb == nil {
+		return c.next.Lookup(ctx, isbn)
+	}
+	if val, err := c.rdb.Get(ctx, c.key(isbn)).Result(); err == nil {
+		if val == notFoundMarker {
+			return nil, ErrNotFound
+		}
+		var rec Record
+		if json.Unmarshal([]byte(val), &rec) == nil {
+			return &rec, nil
+		}
+	}
+
+	rec, err := c.next.Lookup(ctx, isbn)
+	if err != nil {
+		if err == ErrNotFound {
+			c.rdb.Set(ctx, c.key(isbn), notFoundMarker, c.negativeTTL)
+		}
+		return nil, err
+	}
+	data, _ := json.Marshal(rec)
+	c.rdb.Set(ctx, c.key(isbn), data, c.ttl)
+	return rec, nil
+}
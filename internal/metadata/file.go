@@ -0,0 +1,57 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/erfnzmn/Library_Management_System/pkg/isbn"
+)
+
+// FileProvider serves records from a JSON file, either an array of records
+// or an object keyed by ISBN. It is meant for offline development and tests.
+type FileProvider struct {
+	records map[string]Record
+}
+
+func NewFileProvider(path string) (*FileProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Record
+	if err := json.Unmarshal(data, &list); err != nil {
+		var byISBN map[string]Record
+		if err := json.Unmarshal(data, &byISBN); err != nil {
+			return nil, err
+		}
+		for k, rec := range byISBN {
+			if rec.ISBN == "" {
+				rec.ISBN = k
+			}
+			list = append(list, rec)
+		}
+	}
+
+	p := &FileProvider{records: make(map[string]Record, len(list))}
+	for _, rec := range list {
+		n, err := isbn.Normalize(rec.ISBN)
+		if err != nil {
+			continue
+		}
+		rec.ISBN = n
+		p.records[n] = rec
+	}
+	return p, nil
+}
+
+func (p *FileProvider) Name() string { return "file" }
+
+func (p *FileProvider) Lookup(ctx context.Context, code string) (*Record, error) {
+	rec, ok := p.records[code]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &rec, nil
+}
@@ -0,0 +1,157 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var yearPattern = regexp.MustCompile(`\d{4}`)
+
+func parseYear(s string) int {
+	y, _ := strconv.Atoi(yearPattern.FindString(s))
+	return y
+}
+
+func getJSON(ctx context.Context, client *http.Client, rawURL string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, req.URL.Host)
+	}
+	return json.NewDecoder(resp.Body).Decode(dst)
+}
+
+func defaultClient() *http.Client {
+	return &http.Client{Timeout: 5 * time.Second}
+}
+
+// OpenLibrary uses the Open Library Books API.
+type OpenLibrary struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+func NewOpenLibrary() *OpenLibrary {
+	return &OpenLibrary{BaseURL: "https://openlibrary.org", Client: defaultClient()}
+}
+
+func (p *OpenLibrary) Name() string { return "openlibrary" }
+
+func (p *OpenLibrary) Lookup(ctx context.Context, isbn string) (*Record, error) {
+	key := "ISBN:" + isbn
+	u := fmt.Sprintf("%s/api/books?bibkeys=%s&format=json&jscmd=data", p.BaseURL, url.QueryEscape(key))
+
+	var resp map[string]struct {
+		Title       string `json:"title"`
+		PublishDate string `json:"publish_date"`
+		Authors     []struct {
+			Name string `json:"name"`
+		} `json:"authors"`
+		Publishers []struct {
+			Name string `json:"name"`
+		} `json:"publishers"`
+		Cover struct {
+			Large  string `json:"large"`
+			Medium string `json:"medium"`
+		} `json:"cover"`
+	}
+	if err := getJSON(ctx, p.Client, u, &resp); err != nil {
+		return nil, err
+	}
+	data, ok := resp[key]
+	if !ok || data.Title == "" {
+		return nil, ErrNotFound
+	}
+
+	rec := &Record{
+		ISBN:              isbn,
+		Title:             data.Title,
+		YearOfPublication: parseYear(data.PublishDate),
+		CoverImage:        data.Cover.Large,
+		Source:            p.Name(),
+	}
+	if rec.CoverImage == "" {
+		rec.CoverImage = data.Cover.Medium
+	}
+	var authors []string
+	for _, a := range data.Authors {
+		authors = append(authors, a.Name)
+	}
+	rec.Author = strings.Join(authors, ", ")
+	if len(data.Publishers) > 0 {
+		rec.Publisher = data.Publishers[0].Name
+	}
+	return rec, nil
+}
+
+// GoogleBooks uses the Google Books volumes API.
+type GoogleBooks struct {
+	BaseURL string
+	APIKey  string
+	Client  *http.Client
+}
+
+func NewGoogleBooks(apiKey string) *GoogleBooks {
+	return &GoogleBooks{BaseURL: "https://www.googleapis.com", APIKey: apiKey, Client: defaultClient()}
+}
+
+func (p *GoogleBooks) Name() string { return "googlebooks" }
+
+func (p *GoogleBooks) Lookup(ctx context.Context, isbn string) (*Record, error) {
+	q := url.Values{"q": {"isbn:" + isbn}}
+	if p.APIKey != "" {
+		q.Set("key", p.APIKey)
+	}
+	u := p.BaseURL + "/books/v1/volumes?" + q.Encode()
+
+	var resp struct {
+		Items []struct {
+			VolumeInfo struct {
+				Title         string   `json:"title"`
+				Authors       []string `json:"authors"`
+				Publisher     string   `json:"publisher"`
+				PublishedDate string   `json:"publishedDate"`
+				Language      string   `json:"language"`
+				ImageLinks    struct {
+					Thumbnail string `json:"thumbnail"`
+				} `json:"imageLinks"`
+			} `json:"volumeInfo"`
+		} `json:"items"`
+	}
+	if err := getJSON(ctx, p.Client, u, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Items) == 0 || resp.Items[0].VolumeInfo.Title == "" {
+		return nil, ErrNotFound
+	}
+
+	v := resp.Items[0].VolumeInfo
+	return &Record{
+		ISBN:              isbn,
+		Title:             v.Title,
+		Author:            strings.Join(v.Authors, ", "),
+		Publisher:         v.Publisher,
+		YearOfPublication: parseYear(v.PublishedDate),
+		Language:          v.Language,
+		CoverImage:        v.ImageLinks.Thumbnail,
+		Source:            p.Name(),
+	}, nil
+}
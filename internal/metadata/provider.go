@@ -0,0 +1,60 @@
+// Package metadata looks up bibliographic details of a book by ISBN.
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+)
+
+var ErrNotFound = errors.New("no metadata found for ISBN")
+
+// Record holds the fields a provider can fill in for a book.
+type Record struct {
+	ISBN              string `json:"isbn"`
+	Title             string `json:"title"`
+	Author            string `json:"author"`
+	Publisher         string `json:"publisher"`
+	YearOfPublication int    `json:"year_of_publication"`
+	Edition           string `json:"edition"`
+	Language          string `json:"language"`
+	CoverImage        string `json:"cover_image"`
+	Source            string `json:"source"`
+}
+
+// Provider looks up a normalized ISBN-13. It returns ErrNotFound when the
+// provider has no record for it.
+type Provider interface {
+	Name() string
+	Lookup(ctx context.Context, isbn string) (*Record, error)
+}
+
+// Chain asks each provider in turn and returns the first record found.
+type Chain []Provider
+
+func (c Chain) Name() string { return "chain" }
+
+func (c Chain) Lookup(ctx context.Context, isbn string) (*Record, error) {
+	var lastErr error
+	for _, p := range c {
+		rec, err := p.Lookup(ctx, isbn)
+		if err == nil {
+			if rec.Source == "" {
+				rec.Source = p.Name()
+			}
+			return rec, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			log.Printf("metadata: provider %s failed for %s: %v", p.Name(), isbn, err)
+			lastErr = err
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	if lastErr != nil {
+		return nil, fmt.Errorf("%w (last provider error: %v)", ErrNotFound, lastErr)
+	}
+	return nil, ErrNotFound
+}
@@ -0,0 +1,58 @@
+package outbox
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// Event types; they double as routing keys on the events exchange, so
+// consumers can bind e.g. "loan.*" or "book.#".
+const (
+	LoanReserved  = "loan.reserved"
+	LoanBorrowed  = "loan.borrowed"
+	LoanReturned  = "loan.returned"
+	LoanCancelled = "loan.cancelled"
+	BookCreated   = "book.created"
+	BookUpdated   = "book.updated"
+	BookDeleted   = "book.deleted"
+)
+
+// Event is a domain event waiting in the outbox. It is written in the
+// transaction of the state change it describes and published afterwards by
+// the Relay, so an event exists if and only if the change was committed.
+type Event struct {
+	ID            uint            `gorm:"primaryKey" json:"-"`
+	EventID       string          `gorm:"type:char(32);not null;uniqueIndex" json:"id"` // message ID; consumers deduplicate on it
+	Type          string          `gorm:"type:varchar(50);not null" json:"type"`
+	AggregateType string          `gorm:"type:varchar(50);not null" json:"aggregate_type"`
+	AggregateID   uint            `gorm:"not null" json:"aggregate_id"`
+	Payload       json.RawMessage `gorm:"type:json;not null" json:"payload"`
+	OccurredAt    time.Time       `gorm:"not null" json:"occurred_at"`
+	PublishedAt   *time.Time      `gorm:"index" json:"-"`
+	Attempts      int             `gorm:"not null;default:0" json:"-"`
+	LastError     string          `gorm:"type:varchar(255)" json:"-"`
+}
+
+func (Event) TableName() string { return "outbox_events" }
+
+// NewEvent describes a change of an aggregate; payload is stored as JSON.
+func NewEvent(typ, aggregateType string, aggregateID uint, payload any) (*Event, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return &Event{
+		EventID:       hex.EncodeToString(b),
+		Type:          typ,
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		Payload:       raw,
+		OccurredAt:    time.Now().UTC(),
+	}, nil
+}
@@ -0,0 +1,120 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/erfnzmn/Library_Management_System/pkg/lock"
+)
+
+var ErrNotConfirmed = errors.New("outbox: events not confirmed by the broker")
+
+// Publisher delivers events to the broker. It reports, per event, whether
+// the broker confirmed it; unconfirmed events are published again later.
+type Publisher interface {
+	PublishEvents(ctx context.Context, events []Event) (confirmed []bool, err error)
+}
+
+// Relay publishes the outbox in order and marks events delivered once the
+// broker has confirmed them. An event whose confirmation is lost is
+// published again, so delivery is at least once: consumers deduplicate on
+// the message ID. Only one instance relays at a time.
+type Relay struct {
+	repo      *Repository
+	publisher Publisher
+	locker    lock.Locker
+	interval  time.Duration
+	batch     int
+	retention time.Duration
+}
+
+const (
+	relayLockKey = "outbox:relay"
+	relayLockTTL = 30 * time.Second
+)
+
+func NewRelay(repo *Repository, publisher Publisher, locker lock.Locker, interval time.Duration, batch int, retention time.Duration) *Relay {
+	return &Relay{repo: repo, publisher: publisher, locker: locker, interval: interval, batch: batch, retention: retention}
+}
+
+// Run blocks until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	lastPurge := time.Time{}
+	for {
+		r.tick(ctx)
+		if r.retention > 0 && time.Since(lastPurge) > time.Hour {
+			lastPurge = time.Now()
+			if n, err := r.repo.Purge(ctx, time.Now().Add(-r.retention)); err != nil {
+				log.Printf("outbox relay: purge: %v", err)
+			} else if n > 0 {
+				log.Printf("outbox relay: %d published event(s) purged", n)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Relay) tick(ctx context.Context) {
+	release, ok, err := r.locker.TryAcquire(ctx, relayLockKey, relayLockTTL)
+	if err != nil {
+		log.Printf("outbox relay: lock: %v", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	defer release()
+
+	// drain the backlog, a batch at a time
+	for ctx.Err() == nil {
+		n, err := r.relay(ctx)
+		if err != nil {
+			log.Printf("outbox relay: %v", err)
+			return
+		}
+		if n < r.batch {
+			return
+		}
+	}
+}
+
+// relay publishes one batch and returns its size.
+func (r *Relay) relay(ctx context.Context) (int, error) {
+	events, err := r.repo.Pending(ctx, r.batch)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+	confirmed, pubErr := r.publisher.PublishEvents(ctx, events)
+
+	var done, failed []uint
+	for i, ev := range events {
+		if i < len(confirmed) && confirmed[i] {
+			done = append(done, ev.ID)
+		} else {
+			failed = append(failed, ev.ID)
+		}
+	}
+	if err := r.repo.MarkPublished(ctx, done, time.Now().UTC()); err != nil {
+		// they go out again next time; consumers drop the duplicates
+		return 0, err
+	}
+	if len(failed) > 0 {
+		if pubErr == nil {
+			pubErr = ErrNotConfirmed
+		}
+		if err := r.repo.MarkFailed(ctx, failed, pubErr.Error()); err != nil {
+			log.Printf("outbox relay: record failure: %v", err)
+		}
+		// wait for the next tick rather than hammer a failing broker
+		return 0, pubErr
+	}
+	return len(events), nil
+}
@@ -0,0 +1,71 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// WithTx returns a repository bound to the given transaction; events must
+// be added through it to commit or roll back with the change.
+func (r *Repository) WithTx(tx *gorm.DB) *Repository {
+	return &Repository{db: tx}
+}
+
+func (r *Repository) Add(ctx context.Context, ev *Event) error {
+	return r.db.WithContext(ctx).Create(ev).Error
+}
+
+// Pending returns unpublished events in the order they were written.
+func (r *Repository) Pending(ctx context.Context, limit int) ([]Event, error) {
+	var events []Event
+	if err := r.db.WithContext(ctx).
+		Where("published_at IS NULL").
+		Order("id ASC").
+		Limit(limit).
+		Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r *Repository) MarkPublished(ctx context.Context, ids []uint, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Model(&Event{}).
+		Where("id IN ?", ids).
+		Update("published_at", at).Error
+}
+
+func (r *Repository) MarkFailed(ctx context.Context, ids []uint, cause string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if len(cause) > 255 {
+		cause = cause[:255]
+	}
+	return r.db.WithContext(ctx).Model(&Event{}).
+		Where("id IN ?", ids).
+		Updates(map[string]any{
+			"attempts":   gorm.Expr("attempts + 1"),
+			"last_error": cause,
+		}).Error
+}
+
+// Purge deletes events published before cutoff.
+func (r *Repository) Purge(ctx context.Context, cutoff time.Time) (int64, error) {
+	res := r.db.WithContext(ctx).
+		Where("published_at IS NOT NULL AND published_at < ?", cutoff).
+		Delete(&Event{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,201 @@
+package policy
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// Any matches every role or genre in a Rule.
+const Any = "*"
+
+// RoleStaff matches admins and librarians.
+const RoleStaff = "staff"
+
+// Rule is one row of the circulation policy. Role and Genre select who and
+// what it applies to; Any matches everything. Zero limits are taken from the
+// next less specific rule, so a rule only needs the fields it changes.
+type Rule struct {
+	ID              uint   `gorm:"primaryKey" json:"id,omitempty" mapstructure:"-"`
+	Role            string `gorm:"size:20;not null;default:'*';uniqueIndex:uq_policy_scope" json:"role" mapstructure:"role"`
+	Genre           string `gorm:"size:100;not null;default:'*';uniqueIndex:uq_policy_scope" json:"genre" mapstructure:"genre"`
+	LoanDays        int    `json:"loan_days,omitempty" mapstructure:"loan_days"`
+	MaxLoans        int    `json:"max_loans,omitempty" mapstructure:"max_loans"`
+	MaxReservations int    `json:"max_reservations,omitempty" mapstructure:"max_reservations"`
+	RenewDays       int    `json:"renew_days,omitempty" mapstructure:"renew_days"`
+	// MaxRenewals < 0 disables renewals; 0 means "inherit"
+	MaxRenewals int     `json:"max_renewals,omitempty" mapstructure:"max_renewals"`
+	FinePerDay  float64 `gorm:"type:decimal(12,2)" json:"fine_per_day,omitempty" mapstructure:"fine_per_day"`
+	FineCap     float64 `gorm:"type:decimal(12,2)" json:"fine_cap,omitempty" mapstructure:"fine_cap"`
+}
+
+func (Rule) TableName() string { return "circulation_policies" }
+
+// Default applies when no configured rule sets a value.
+var Default = Rule{
+	Role:            Any,
+	Genre:           Any,
+	LoanDays:        14,
+	MaxLoans:        5,
+	MaxReservations: 3,
+	RenewDays:       14,
+	MaxRenewals:     2,
+}
+
+// Policy is the resolved rule for one borrower and item.
+type Policy struct {
+	LoanDays        int     `json:"loan_days"`
+	MaxLoans        int     `json:"max_loans"`
+	MaxReservations int     `json:"max_reservations"`
+	RenewDays       int     `json:"renew_days"`
+	MaxRenewals     int     `json:"max_renewals"`
+	FinePerDay      float64 `json:"fine_per_day"`
+	FineCap         float64 `json:"fine_cap"` // 0 = no cap
+}
+
+// Engine resolves policies from a set of rules. It is safe for concurrent
+// use and can be reloaded at runtime.
+type Engine struct {
+	mu    sync.RWMutex
+	base  Rule
+	rules []Rule
+}
+
+func NewEngine(base Rule, rules []Rule) *Engine {
+	e := &Engine{base: base}
+	e.Set(rules)
+	return e
+}
+
+// Set replaces the rules.
+func (e *Engine) Set(rules []Rule) {
+	normalized := make([]Rule, len(rules))
+	for i, r := range rules {
+		r.Role = scope(r.Role)
+		r.Genre = scope(r.Genre)
+		normalized[i] = r
+	}
+	e.mu.Lock()
+	e.rules = normalized
+	e.mu.Unlock()
+}
+
+func (e *Engine) Rules() []Rule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return append([]Rule(nil), e.rules...)
+}
+
+func scope(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return Any
+	}
+	return s
+}
+
+func isStaff(role string) bool {
+	return role == "admin" || role == "librarian"
+}
+
+// specificity ranks how closely r matches role and genre; -1 means no match.
+// A genre match beats a role match, and an exact role beats "staff".
+func specificity(r Rule, role, genre string) int {
+	score := 0
+	switch {
+	case r.Role == role:
+		score += 2
+	case r.Role == RoleStaff && isStaff(role):
+		score++
+	case r.Role != Any:
+		return -1
+	}
+	switch {
+	case r.Genre == genre:
+		score += 4
+	case r.Genre != Any:
+		return -1
+	}
+	return score
+}
+
+// Resolve returns the policy for a borrower role and an item genre. Matching
+// rules are applied from least to most specific, each overriding the
+// fields it sets.
+func (e *Engine) Resolve(role, genre string) Policy {
+	role, genre = scope(role), scope(genre)
+
+	e.mu.RLock()
+	var matches [7][]Rule
+	for _, r := range e.rules {
+		if s := specificity(r, role, genre); s >= 0 {
+			matches[s] = append(matches[s], r)
+		}
+	}
+	e.mu.RUnlock()
+
+	p := apply(Policy{}, e.base)
+	for _, rules := range matches {
+		for _, r := range rules {
+			p = apply(p, r)
+		}
+	}
+	if p.MaxRenewals < 0 {
+		p.MaxRenewals = 0
+	}
+	return p
+}
+
+func apply(p Policy, r Rule) Policy {
+	if r.LoanDays > 0 {
+		p.LoanDays = r.LoanDays
+	}
+	if r.MaxLoans > 0 {
+		p.MaxLoans = r.MaxLoans
+	}
+	if r.MaxReservations > 0 {
+		p.MaxReservations = r.MaxReservations
+	}
+	if r.RenewDays > 0 {
+		p.RenewDays = r.RenewDays
+	}
+	if r.MaxRenewals != 0 {
+		p.MaxRenewals = r.MaxRenewals
+	}
+	if r.FinePerDay > 0 {
+		p.FinePerDay = r.FinePerDay
+	}
+	if r.FineCap > 0 {
+		p.FineCap = r.FineCap
+	}
+	return p
+}
+
+// Store keeps rules in the circulation_policies table.
+type Store struct {
+	db *gorm.DB
+}
+
+func NewStore(db *gorm.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) List(ctx context.Context) ([]Rule, error) {
+	var rules []Rule
+	if err := s.db.WithContext(ctx).Order("id ASC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Reload replaces the rules of e with the ones stored in the database.
+func (s *Store) Reload(ctx context.Context, e *Engine) error {
+	rules, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+	e.Set(rules)
+	return nil
+}
@@ -0,0 +1,59 @@
+package policy
+
+import "testing"
+
+func TestResolve(t *testing.T) {
+	base := Default
+	base.FinePerDay = 500
+	e := NewEngine(base, []Rule{
+		{Role: "Student", LoanDays: 21, MaxLoans: 3},
+		{Genre: "reference", LoanDays: 3, MaxRenewals: -1},
+		{Role: "student", Genre: "Reference", LoanDays: 7},
+		{Role: RoleStaff, MaxLoans: 20},
+		{Role: "admin", MaxLoans: 50},
+		{Role: Any, Genre: "novel", FinePerDay: 1000, FineCap: 20000},
+	})
+
+	defaults := Policy{LoanDays: 14, MaxLoans: 5, MaxReservations: 3, RenewDays: 14, MaxRenewals: 2, FinePerDay: 500}
+	with := func(f func(p *Policy)) Policy {
+		p := defaults
+		f(&p)
+		return p
+	}
+	for _, tt := range []struct {
+		name, role, genre string
+		want              Policy
+	}{
+		{"no matching rule", "member", "poetry", defaults},
+		{"no role or genre", "", "", defaults},
+		{"role", "student", "poetry", with(func(p *Policy) { p.LoanDays, p.MaxLoans = 21, 3 })},
+		{"role without genre", "student", "", with(func(p *Policy) { p.LoanDays, p.MaxLoans = 21, 3 })},
+		{"genre", "member", "novel", with(func(p *Policy) { p.FinePerDay, p.FineCap = 1000, 20000 })},
+		// negative max renewals disables renewals
+		{"genre beats role", "member", "reference", with(func(p *Policy) { p.LoanDays, p.MaxRenewals = 3, 0 })},
+		{"role and genre", "student", "reference", with(func(p *Policy) { p.LoanDays, p.MaxLoans, p.MaxRenewals = 7, 3, 0 })},
+		{"scope is case and space insensitive", " STUDENT ", "Reference", with(func(p *Policy) { p.LoanDays, p.MaxLoans, p.MaxRenewals = 7, 3, 0 })},
+		{"staff", "librarian", "poetry", with(func(p *Policy) { p.MaxLoans = 20 })},
+		{"exact role beats staff", "admin", "poetry", with(func(p *Policy) { p.MaxLoans = 50 })},
+		{"staff and genre", "librarian", "novel", with(func(p *Policy) { p.MaxLoans, p.FinePerDay, p.FineCap = 20, 1000, 20000 })},
+		{"member is not staff", "member", "", defaults},
+	} {
+		if got := e.Resolve(tt.role, tt.genre); got != tt.want {
+			t.Errorf("%s: Resolve(%q, %q) = %+v, want %+v", tt.name, tt.role, tt.genre, got, tt.want)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	e := NewEngine(Default, nil)
+	if got := e.Resolve("student", ""); got.LoanDays != 14 {
+		t.Errorf("without rules: loan days %d, want 14", got.LoanDays)
+	}
+	e.Set([]Rule{{Role: "student", LoanDays: 30}})
+	if got := e.Resolve("student", ""); got.LoanDays != 30 {
+		t.Errorf("after Set: loan days %d, want 30", got.LoanDays)
+	}
+	if rules := e.Rules(); len(rules) != 1 || rules[0].Genre != Any {
+		t.Errorf("Rules() = %+v, want one rule for any genre", rules)
+	}
+}
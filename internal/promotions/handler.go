@@ -0,0 +1,124 @@
+package promotions
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/erfnzmn/Library_Management_System/pkg/middleware"
+	"github.com/labstack/echo/v4"
+)
+
+type Handler struct {
+	service   *Service
+	jwtSecret string
+}
+
+func NewHandler(service *Service, jwtSecret string) *Handler {
+	return &Handler{service: service, jwtSecret: jwtSecret}
+}
+
+// RegisterRoutes — managing promotions is for sales staff; customers use
+// codes through the cart (/sales/cart/coupon)
+func (h *Handler) RegisterRoutes(e *echo.Echo) {
+	g := e.Group("/sales/promotions")
+	g.Use(middleware.JWT(h.jwtSecret))
+	g.Use(middleware.RequirePermission(middleware.PermSalesManage))
+
+	g.GET("", h.List)
+	g.POST("", h.Create, middleware.Idempotent)
+	g.GET("/:id", h.Get)
+	g.PUT("/:id", h.Update)
+	g.DELETE("/:id", h.Delete)
+	g.GET("/:id/redemptions", h.Redemptions)
+}
+
+// List
+func (h *Handler) List(c echo.Context) error {
+	list, err := h.service.List(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// Create
+func (h *Handler) Create(c echo.Context) error {
+	var req PromotionRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid input"})
+	}
+	p, err := h.service.Create(c.Request().Context(), req)
+	if err != nil {
+		return c.JSON(promotionErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, p)
+}
+
+// Get
+func (h *Handler) Get(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid promotion id"})
+	}
+	p, err := h.service.Get(c.Request().Context(), uint(id))
+	if err != nil {
+		return c.JSON(promotionErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, p)
+}
+
+// Update
+func (h *Handler) Update(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid promotion id"})
+	}
+	var req PromotionRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid input"})
+	}
+	p, err := h.service.Update(c.Request().Context(), uint(id), req)
+	if err != nil {
+		return c.JSON(promotionErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, p)
+}
+
+// Delete
+func (h *Handler) Delete(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid promotion id"})
+	}
+	if err := h.service.Delete(c.Request().Context(), uint(id)); err != nil {
+		return c.JSON(promotionErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Redemptions lists the orders a promotion was used on
+func (h *Handler) Redemptions(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid promotion id"})
+	}
+	list, err := h.service.Redemptions(c.Request().Context(), uint(id))
+	if err != nil {
+		return c.JSON(promotionErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+func promotionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrPromotionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrInvalidPromotion):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrPromotionInUse):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
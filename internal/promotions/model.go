@@ -0,0 +1,130 @@
+package promotions
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	KindPercent = "percent" // Value is a percentage of the price, 10 = 10%
+	KindFixed   = "fixed"   // Value is an amount off the eligible lines of the order
+)
+
+// Promotion is a discount applied when a cart is priced. Promotions without
+// a code apply automatically to every eligible cart (e.g. a student price);
+// those with a code only when the customer enters it.
+//
+// Genre, Tag and Roles narrow who and what the promotion is for; empty
+// means any. Roles is a comma separated list of user roles.
+type Promotion struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	Name        string     `gorm:"size:100;not null" json:"name"`
+	Code        *string    `gorm:"size:40;uniqueIndex" json:"code,omitempty"`
+	Kind        string     `gorm:"type:enum('percent','fixed');not null" json:"kind"`
+	Value       float64    `gorm:"type:decimal(12,2);not null" json:"value"`
+	Genre       string     `gorm:"size:100" json:"genre,omitempty"`
+	Tag         string     `gorm:"size:100" json:"tag,omitempty"`
+	Roles       string     `gorm:"size:100" json:"roles,omitempty"`
+	MinSubtotal float64    `gorm:"type:decimal(12,2);not null;default:0" json:"min_subtotal"`
+	StartsAt    *time.Time `json:"starts_at,omitempty"`
+	EndsAt      *time.Time `json:"ends_at,omitempty"`
+	// UsageLimit caps redemptions over all users, PerUserLimit per user; 0
+	// means unlimited
+	UsageLimit   int `gorm:"not null;default:0" json:"usage_limit"`
+	PerUserLimit int `gorm:"not null;default:0" json:"per_user_limit"`
+	Used         int `gorm:"not null;default:0" json:"used"`
+	// Stackable promotions combine with each other and with the best
+	// exclusive one; two exclusive promotions never combine
+	Stackable bool      `gorm:"not null;default:false" json:"stackable"`
+	Priority  int       `gorm:"not null;default:0" json:"priority"`
+	Active    bool      `gorm:"not null;default:true" json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (Promotion) TableName() string { return "promotions" }
+
+// LiveAt reports whether the promotion is active and within its dates.
+func (p *Promotion) LiveAt(now time.Time) bool {
+	if !p.Active {
+		return false
+	}
+	if p.StartsAt != nil && now.Before(*p.StartsAt) {
+		return false
+	}
+	return p.EndsAt == nil || now.Before(*p.EndsAt)
+}
+
+func (p *Promotion) forRole(role string) bool {
+	if strings.TrimSpace(p.Roles) == "" {
+		return true
+	}
+	for _, r := range strings.Split(p.Roles, ",") {
+		if strings.EqualFold(strings.TrimSpace(r), role) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Promotion) covers(l Line) bool {
+	if p.Genre != "" && !strings.EqualFold(p.Genre, l.Genre) {
+		return false
+	}
+	if p.Tag == "" {
+		return true
+	}
+	for _, t := range l.Tags {
+		if strings.EqualFold(strings.TrimSpace(t), p.Tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redemption records a promotion used by an order; usage limits count the
+// redemptions that were not released by cancelling the order.
+type Redemption struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	PromotionID uint       `gorm:"not null;index" json:"promotion_id"`
+	UserID      uint       `gorm:"not null;index" json:"user_id"`
+	OrderID     uint       `gorm:"not null;index" json:"order_id"`
+	Code        string     `gorm:"size:40" json:"code,omitempty"`
+	Amount      float64    `gorm:"type:decimal(12,2);not null" json:"amount"`
+	ReleasedAt  *time.Time `json:"released_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func (Redemption) TableName() string { return "promotion_redemptions" }
+
+// Line is one cart or order line to be priced.
+type Line struct {
+	BookID    uint
+	Genre     string
+	Tags      []string
+	UnitPrice float64
+	Quantity  int
+}
+
+// Customer is who the cart is priced for.
+type Customer struct {
+	UserID uint
+	Role   string
+}
+
+// Applied is a promotion that lowered the price, with the total it took off.
+type Applied struct {
+	PromotionID uint    `json:"promotion_id"`
+	Name        string  `json:"name"`
+	Code        string  `json:"code,omitempty"`
+	Amount      float64 `json:"amount"`
+}
+
+// Quote is the result of pricing: Discounts[i] is taken off line i.
+type Quote struct {
+	Subtotal  float64   `json:"subtotal"`
+	Discount  float64   `json:"discount"`
+	Total     float64   `json:"total"`
+	Discounts []float64 `json:"-"`
+	Applied   []Applied `json:"applied"`
+}
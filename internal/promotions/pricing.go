@@ -0,0 +1,149 @@
+package promotions
+
+import (
+	"math"
+	"sort"
+)
+
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// Apply prices lines with the given promotions. The rules are:
+//
+//   - a promotion applies to the lines it covers (genre, tag) when the
+//     customer's role matches and the covered lines add up to MinSubtotal
+//   - of the exclusive (non-stackable) promotions only the one taking off
+//     the most is used
+//   - stackable promotions are then applied one after another, by priority
+//     (highest first), percentages before fixed amounts, each on what is
+//     left of the price
+//   - a fixed amount is spread over the covered lines in proportion to
+//     their price; no line goes below zero
+func Apply(promos []Promotion, customer Customer, lines []Line) *Quote {
+	q := &Quote{Discounts: make([]float64, len(lines))}
+	gross := make([]float64, len(lines))
+	for i, l := range lines {
+		gross[i] = round(l.UnitPrice * float64(l.Quantity))
+		q.Subtotal += gross[i]
+	}
+	q.Subtotal = round(q.Subtotal)
+
+	var exclusive, stackable []Promotion
+	for _, p := range promos {
+		if !p.forRole(customer.Role) || !p.eligible(lines, gross) {
+			continue
+		}
+		if p.Stackable {
+			stackable = append(stackable, p)
+		} else {
+			exclusive = append(exclusive, p)
+		}
+	}
+
+	remaining := append([]float64(nil), gross...)
+	if len(exclusive) > 0 {
+		sort.SliceStable(exclusive, func(i, j int) bool { return exclusive[i].Priority > exclusive[j].Priority })
+		best, bestAmount := -1, 0.0
+		for i := range exclusive {
+			amount := sum(exclusive[i].discounts(lines, remaining))
+			if amount > bestAmount {
+				best, bestAmount = i, amount
+			}
+		}
+		if best >= 0 {
+			q.apply(&exclusive[best], lines, remaining)
+		}
+	}
+
+	sort.SliceStable(stackable, func(i, j int) bool {
+		if stackable[i].Priority != stackable[j].Priority {
+			return stackable[i].Priority > stackable[j].Priority
+		}
+		return stackable[i].Kind == KindPercent && stackable[j].Kind != KindPercent
+	})
+	for i := range stackable {
+		q.apply(&stackable[i], lines, remaining)
+	}
+
+	q.Discount = round(q.Subtotal - sum(remaining))
+	q.Total = round(sum(remaining))
+	return q
+}
+
+func (q *Quote) apply(p *Promotion, lines []Line, remaining []float64) {
+	d := p.discounts(lines, remaining)
+	amount := sum(d)
+	if amount <= 0 {
+		return
+	}
+	for i := range d {
+		remaining[i] = round(remaining[i] - d[i])
+		q.Discounts[i] = round(q.Discounts[i] + d[i])
+	}
+	applied := Applied{PromotionID: p.ID, Name: p.Name, Amount: amount}
+	if p.Code != nil {
+		applied.Code = *p.Code
+	}
+	q.Applied = append(q.Applied, applied)
+}
+
+func (p *Promotion) eligible(lines []Line, gross []float64) bool {
+	covered, any := 0.0, false
+	for i, l := range lines {
+		if p.covers(l) {
+			covered += gross[i]
+			any = true
+		}
+	}
+	return any && covered >= p.MinSubtotal
+}
+
+// discounts computes what p would take off each line given the prices
+// still remaining.
+func (p *Promotion) discounts(lines []Line, remaining []float64) []float64 {
+	d := make([]float64, len(lines))
+	switch p.Kind {
+	case KindPercent:
+		rate := math.Min(p.Value, 100) / 100
+		for i, l := range lines {
+			if p.covers(l) {
+				d[i] = round(remaining[i] * rate)
+			}
+		}
+	case KindFixed:
+		base := 0.0
+		last := -1
+		for i, l := range lines {
+			if p.covers(l) && remaining[i] > 0 {
+				base += remaining[i]
+				last = i
+			}
+		}
+		if last < 0 {
+			return d
+		}
+		amount := round(math.Min(p.Value, base))
+		left := amount
+		for i, l := range lines {
+			if !p.covers(l) || remaining[i] <= 0 {
+				continue
+			}
+			if i == last {
+				d[i] = round(math.Min(left, remaining[i]))
+				break
+			}
+			d[i] = round(amount * remaining[i] / base)
+			left -= d[i]
+		}
+	}
+	return d
+}
+
+func sum(v []float64) float64 {
+	t := 0.0
+	for _, x := range v {
+		t += x
+	}
+	return round(t)
+}
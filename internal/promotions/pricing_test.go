@@ -0,0 +1,135 @@
+package promotions
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	lines := []Line{
+		{BookID: 1, Genre: "novel", Tags: []string{"classic"}, UnitPrice: 100, Quantity: 2},
+		{BookID: 2, Genre: "science", Tags: []string{"textbook"}, UnitPrice: 300, Quantity: 1},
+	}
+	percent := func(id uint, value float64) Promotion {
+		return Promotion{ID: id, Name: "p", Kind: KindPercent, Value: value, Active: true}
+	}
+	fixed := func(id uint, value float64) Promotion {
+		return Promotion{ID: id, Name: "f", Kind: KindFixed, Value: value, Active: true}
+	}
+	with := func(p Promotion, f func(p *Promotion)) Promotion {
+		f(&p)
+		return p
+	}
+	stackable := func(p *Promotion) { p.Stackable = true }
+
+	type applied struct {
+		id     uint
+		amount float64
+	}
+	for _, tt := range []struct {
+		name      string
+		promos    []Promotion
+		role      string
+		discounts []float64
+		applied   []applied
+	}{
+		{
+			name:      "no promotions",
+			discounts: []float64{0, 0},
+		},
+		{
+			name:      "best exclusive wins",
+			promos:    []Promotion{percent(1, 10), fixed(2, 80), with(percent(3, 50), func(p *Promotion) { p.Genre = "novel" })},
+			discounts: []float64{100, 0},
+			applied:   []applied{{3, 100}},
+		},
+		{
+			name: "tie goes to the higher priority",
+			promos: []Promotion{
+				percent(1, 16),
+				with(fixed(2, 80), func(p *Promotion) { p.Priority = 1 }),
+			},
+			discounts: []float64{32, 48},
+			applied:   []applied{{2, 80}},
+		},
+		{
+			name:      "stackable after the exclusive one",
+			promos:    []Promotion{with(percent(4, 10), stackable), percent(1, 10)},
+			discounts: []float64{38, 57},
+			applied:   []applied{{1, 50}, {4, 45}},
+		},
+		{
+			name:      "percent before fixed at the same priority",
+			promos:    []Promotion{with(fixed(5, 50), stackable), with(percent(4, 10), stackable)},
+			discounts: []float64{40, 60},
+			applied:   []applied{{4, 50}, {5, 50}},
+		},
+		{
+			name: "higher priority first",
+			promos: []Promotion{
+				with(percent(4, 10), stackable),
+				with(fixed(6, 100), func(p *Promotion) { p.Stackable, p.Priority = true, 5 }),
+			},
+			discounts: []float64{56, 84},
+			applied:   []applied{{6, 100}, {4, 40}},
+		},
+		{
+			name:      "role does not match",
+			promos:    []Promotion{with(percent(7, 20), func(p *Promotion) { p.Roles = "student, staff" })},
+			role:      "member",
+			discounts: []float64{0, 0},
+		},
+		{
+			name:      "role matches",
+			promos:    []Promotion{with(percent(7, 20), func(p *Promotion) { p.Roles = "student, staff" })},
+			role:      "Student",
+			discounts: []float64{40, 60},
+			applied:   []applied{{7, 100}},
+		},
+		{
+			name:      "below the minimum subtotal",
+			promos:    []Promotion{with(percent(8, 50), func(p *Promotion) { p.MinSubtotal = 1000 })},
+			discounts: []float64{0, 0},
+		},
+		{
+			name:      "minimum subtotal counts covered lines only",
+			promos:    []Promotion{with(percent(8, 50), func(p *Promotion) { p.Genre, p.MinSubtotal = "novel", 250 })},
+			discounts: []float64{0, 0},
+		},
+		{
+			name:      "tag",
+			promos:    []Promotion{with(percent(9, 25), func(p *Promotion) { p.Tag = "Classic" })},
+			discounts: []float64{50, 0},
+			applied:   []applied{{9, 50}},
+		},
+		{
+			name:      "fixed amount capped at the price",
+			promos:    []Promotion{fixed(10, 1000)},
+			discounts: []float64{200, 300},
+			applied:   []applied{{10, 500}},
+		},
+		{
+			name:      "percent capped at 100",
+			promos:    []Promotion{with(percent(11, 150), func(p *Promotion) { p.Genre = "science" })},
+			discounts: []float64{0, 300},
+			applied:   []applied{{11, 300}},
+		},
+	} {
+		q := Apply(tt.promos, Customer{UserID: 1, Role: tt.role}, lines)
+		if !reflect.DeepEqual(q.Discounts, tt.discounts) {
+			t.Errorf("%s: discounts %v, want %v", tt.name, q.Discounts, tt.discounts)
+		}
+		var got []applied
+		for _, a := range q.Applied {
+			got = append(got, applied{a.PromotionID, a.Amount})
+		}
+		if !reflect.DeepEqual(got, tt.applied) {
+			t.Errorf("%s: applied %v, want %v", tt.name, got, tt.applied)
+		}
+		discount := tt.discounts[0] + tt.discounts[1]
+		if q.Subtotal != 500 || q.Discount != discount || q.Total != 500-discount {
+			t.Errorf("%s: subtotal %v, discount %v, total %v, want 500, %v, %v",
+				tt.name, q.Subtotal, q.Discount, q.Total, discount, 500-discount)
+		}
+	}
+}
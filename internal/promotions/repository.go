@@ -0,0 +1,159 @@
+package promotions
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// WithTx returns a repository bound to the given transaction.
+func (r *Repository) WithTx(tx *gorm.DB) *Repository {
+	return &Repository{db: tx}
+}
+
+func (r *Repository) Create(ctx context.Context, p *Promotion) error {
+	return r.db.WithContext(ctx).Create(p).Error
+}
+
+func (r *Repository) Update(ctx context.Context, p *Promotion) error {
+	return r.db.WithContext(ctx).Omit("used").Save(p).Error
+}
+
+func (r *Repository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&Promotion{}, id).Error
+}
+
+func (r *Repository) GetByID(ctx context.Context, id uint) (*Promotion, error) {
+	var p Promotion
+	if err := r.db.WithContext(ctx).First(&p, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Lock reads a promotion holding a row lock on it until the end of the
+// transaction.
+func (r *Repository) Lock(ctx context.Context, id uint) (*Promotion, error) {
+	var p Promotion
+	if err := r.db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).First(&p, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *Repository) GetByCode(ctx context.Context, code string) (*Promotion, error) {
+	var p Promotion
+	if err := r.db.WithContext(ctx).Where("code = ?", code).First(&p).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *Repository) List(ctx context.Context) ([]Promotion, error) {
+	var list []Promotion
+	if err := r.db.WithContext(ctx).Order("id DESC").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// ListAutomatic returns the promotions without a code that are live at now
+// and not used up.
+func (r *Repository) ListAutomatic(ctx context.Context, now time.Time) ([]Promotion, error) {
+	var list []Promotion
+	if err := r.db.WithContext(ctx).
+		Where("code IS NULL AND active = ?", true).
+		Where("starts_at IS NULL OR starts_at <= ?", now).
+		Where("ends_at IS NULL OR ends_at > ?", now).
+		Where("usage_limit = 0 OR used < usage_limit").
+		Order("id ASC").
+		Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// TakeUse counts one redemption, refusing atomically once the usage limit
+// is reached.
+func (r *Repository) TakeUse(ctx context.Context, id uint) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&Promotion{}).
+		Where("id = ? AND (usage_limit = 0 OR used < usage_limit)", id).
+		UpdateColumn("used", gorm.Expr("used + 1"))
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *Repository) ReturnUse(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Model(&Promotion{}).
+		Where("id = ? AND used > 0", id).
+		UpdateColumn("used", gorm.Expr("used - 1")).Error
+}
+
+func (r *Repository) CreateRedemption(ctx context.Context, red *Redemption) error {
+	return r.db.WithContext(ctx).Create(red).Error
+}
+
+// CountUserRedemptions counts the redemptions of a promotion by a user that
+// still hold.
+func (r *Repository) CountUserRedemptions(ctx context.Context, promotionID, userID uint) (int64, error) {
+	var n int64
+	err := r.db.WithContext(ctx).Model(&Redemption{}).
+		Where("promotion_id = ? AND user_id = ? AND released_at IS NULL", promotionID, userID).
+		Count(&n).Error
+	return n, err
+}
+
+func (r *Repository) CountRedemptions(ctx context.Context, promotionID uint) (int64, error) {
+	var n int64
+	err := r.db.WithContext(ctx).Model(&Redemption{}).
+		Where("promotion_id = ?", promotionID).
+		Count(&n).Error
+	return n, err
+}
+
+func (r *Repository) RedemptionsByPromotion(ctx context.Context, promotionID uint) ([]Redemption, error) {
+	var list []Redemption
+	if err := r.db.WithContext(ctx).
+		Where("promotion_id = ?", promotionID).
+		Order("id DESC").
+		Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *Repository) OpenRedemptionsByOrder(ctx context.Context, orderID uint) ([]Redemption, error) {
+	var list []Redemption
+	if err := r.db.WithContext(ctx).
+		Where("order_id = ? AND released_at IS NULL", orderID).
+		Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *Repository) ReleaseRedemption(ctx context.Context, id uint, at time.Time) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&Redemption{}).
+		Where("id = ? AND released_at IS NULL", id).
+		Update("released_at", at)
+	return res.RowsAffected > 0, res.Error
+}
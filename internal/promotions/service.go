@@ -0,0 +1,291 @@
+package promotions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPromotionNotFound = errors.New("promotion not found")
+	ErrInvalidPromotion  = errors.New("invalid promotion")
+	ErrPromotionInUse    = errors.New("promotion has been redeemed; deactivate it instead")
+
+	ErrCouponInvalid       = errors.New("COUPON_INVALID: unknown coupon code")
+	ErrCouponExpired       = errors.New("COUPON_EXPIRED: coupon is not valid at this time")
+	ErrCouponUsedUp        = errors.New("COUPON_USED_UP: coupon usage limit reached")
+	ErrCouponNotApplicable = errors.New("COUPON_NOT_APPLICABLE: coupon does not apply to this cart")
+)
+
+type Service struct {
+	repo *Repository
+}
+
+func NewService(repo *Repository) *Service {
+	return &Service{repo: repo}
+}
+
+// WithTx returns a service whose repository runs in tx, for redeeming and
+// releasing coupons in the transaction of the order they belong to.
+func (s *Service) WithTx(tx *gorm.DB) *Service {
+	return &Service{repo: s.repo.WithTx(tx)}
+}
+
+// NormalizeCode makes coupon codes case and space insensitive.
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// PromotionRequest is the body of the staff create and update endpoints.
+type PromotionRequest struct {
+	Name         string     `json:"name"`
+	Code         string     `json:"code"`
+	Kind         string     `json:"kind"`
+	Value        float64    `json:"value"`
+	Genre        string     `json:"genre"`
+	Tag          string     `json:"tag"`
+	Roles        string     `json:"roles"`
+	MinSubtotal  float64    `json:"min_subtotal"`
+	StartsAt     *time.Time `json:"starts_at"`
+	EndsAt       *time.Time `json:"ends_at"`
+	UsageLimit   int        `json:"usage_limit"`
+	PerUserLimit int        `json:"per_user_limit"`
+	Stackable    bool       `json:"stackable"`
+	Priority     int        `json:"priority"`
+	Active       *bool      `json:"active"`
+}
+
+func (req PromotionRequest) apply(p *Promotion) error {
+	switch {
+	case strings.TrimSpace(req.Name) == "":
+		return fmt.Errorf("%w: name is required", ErrInvalidPromotion)
+	case req.Kind != KindPercent && req.Kind != KindFixed:
+		return fmt.Errorf("%w: kind must be percent or fixed", ErrInvalidPromotion)
+	case req.Value <= 0, req.Kind == KindPercent && req.Value > 100:
+		return fmt.Errorf("%w: value out of range", ErrInvalidPromotion)
+	case req.UsageLimit < 0, req.PerUserLimit < 0, req.MinSubtotal < 0:
+		return fmt.Errorf("%w: limits cannot be negative", ErrInvalidPromotion)
+	case req.StartsAt != nil && req.EndsAt != nil && !req.EndsAt.After(*req.StartsAt):
+		return fmt.Errorf("%w: ends_at must be after starts_at", ErrInvalidPromotion)
+	}
+	p.Name = strings.TrimSpace(req.Name)
+	p.Code = nil
+	if code := NormalizeCode(req.Code); code != "" {
+		p.Code = &code
+	}
+	p.Kind = req.Kind
+	p.Value = round(req.Value)
+	p.Genre = strings.TrimSpace(req.Genre)
+	p.Tag = strings.TrimSpace(req.Tag)
+	p.Roles = strings.TrimSpace(req.Roles)
+	p.MinSubtotal = round(req.MinSubtotal)
+	p.StartsAt = req.StartsAt
+	p.EndsAt = req.EndsAt
+	p.UsageLimit = req.UsageLimit
+	p.PerUserLimit = req.PerUserLimit
+	p.Stackable = req.Stackable
+	p.Priority = req.Priority
+	p.Active = req.Active == nil || *req.Active
+	return nil
+}
+
+func (s *Service) Create(ctx context.Context, req PromotionRequest) (*Promotion, error) {
+	p := &Promotion{}
+	if err := req.apply(p); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *Service) Update(ctx context.Context, id uint, req PromotionRequest) (*Promotion, error) {
+	p, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.apply(p); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *Service) Get(ctx context.Context, id uint) (*Promotion, error) {
+	p, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, ErrPromotionNotFound
+	}
+	return p, nil
+}
+
+func (s *Service) List(ctx context.Context) ([]Promotion, error) {
+	return s.repo.List(ctx)
+}
+
+// Delete removes a promotion that was never redeemed; redeemed ones stay
+// for the audit trail and can only be deactivated.
+func (s *Service) Delete(ctx context.Context, id uint) error {
+	if _, err := s.Get(ctx, id); err != nil {
+		return err
+	}
+	n, err := s.repo.CountRedemptions(ctx, id)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrPromotionInUse
+	}
+	return s.repo.Delete(ctx, id)
+}
+
+func (s *Service) Redemptions(ctx context.Context, id uint) ([]Redemption, error) {
+	if _, err := s.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.RedemptionsByPromotion(ctx, id)
+}
+
+// Price applies the live automatic promotions and the coupon code, if any,
+// to lines.
+func (s *Service) Price(ctx context.Context, customer Customer, lines []Line, code string) (*Quote, error) {
+	now := time.Now()
+	promos, err := s.repo.ListAutomatic(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	if code = NormalizeCode(code); code != "" {
+		coupon, err := s.coupon(ctx, customer, code, now)
+		if err != nil {
+			return nil, err
+		}
+		if !coupon.forRole(customer.Role) || !coupon.eligible(lines, grossOf(lines)) {
+			return nil, ErrCouponNotApplicable
+		}
+		promos = append(promos, *coupon)
+	}
+	return Apply(promos, customer, lines), nil
+}
+
+func (s *Service) coupon(ctx context.Context, customer Customer, code string, now time.Time) (*Promotion, error) {
+	p, err := s.repo.GetByCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil || !p.Active {
+		return nil, ErrCouponInvalid
+	}
+	if !p.LiveAt(now) {
+		return nil, ErrCouponExpired
+	}
+	if p.UsageLimit > 0 && p.Used >= p.UsageLimit {
+		return nil, ErrCouponUsedUp
+	}
+	if p.PerUserLimit > 0 {
+		n, err := s.repo.CountUserRedemptions(ctx, p.ID, customer.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if n >= int64(p.PerUserLimit) {
+			return nil, ErrCouponUsedUp
+		}
+	}
+	return p, nil
+}
+
+func grossOf(lines []Line) []float64 {
+	gross := make([]float64, len(lines))
+	for i, l := range lines {
+		gross[i] = round(l.UnitPrice * float64(l.Quantity))
+	}
+	return gross
+}
+
+// Redeem records the promotions of a quote against an order. Usage limits
+// are checked again here, atomically, since other orders may have used the
+// last redemption after the cart was priced. It must run in the order's
+// transaction: each promotion is locked, in ID order, so that concurrent
+// orders by one user cannot both pass the per-user limit.
+func (s *Service) Redeem(ctx context.Context, customer Customer, orderID uint, applied []Applied) error {
+	applied = append([]Applied(nil), applied...)
+	sort.Slice(applied, func(i, j int) bool { return applied[i].PromotionID < applied[j].PromotionID })
+	for _, a := range applied {
+		p, err := s.repo.Lock(ctx, a.PromotionID)
+		if err == nil && p == nil {
+			err = ErrPromotionNotFound
+		}
+		if err != nil {
+			return s.abort(ctx, orderID, err)
+		}
+		if p.PerUserLimit > 0 {
+			n, err := s.repo.CountUserRedemptions(ctx, p.ID, customer.UserID)
+			if err != nil {
+				return s.abort(ctx, orderID, err)
+			}
+			if n >= int64(p.PerUserLimit) {
+				return s.abort(ctx, orderID, ErrCouponUsedUp)
+			}
+		}
+		ok, err := s.repo.TakeUse(ctx, p.ID)
+		if err != nil {
+			return s.abort(ctx, orderID, err)
+		}
+		if !ok {
+			return s.abort(ctx, orderID, ErrCouponUsedUp)
+		}
+		red := &Redemption{PromotionID: p.ID, UserID: customer.UserID, OrderID: orderID, Code: a.Code, Amount: a.Amount}
+		if err := s.repo.CreateRedemption(ctx, red); err != nil {
+			_ = s.repo.ReturnUse(ctx, p.ID)
+			return s.abort(ctx, orderID, err)
+		}
+	}
+	return nil
+}
+
+// abort gives back what a failed Redeem already took.
+func (s *Service) abort(ctx context.Context, orderID uint, err error) error {
+	if rerr := s.Release(ctx, orderID); rerr != nil {
+		return errors.Join(err, rerr)
+	}
+	return err
+}
+
+// Release returns the redemptions of a cancelled order so the coupons can
+// be used again.
+func (s *Service) Release(ctx context.Context, orderID uint) error {
+	list, err := s.repo.OpenRedemptionsByOrder(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, red := range list {
+		released, err := s.repo.ReleaseRedemption(ctx, red.ID, now)
+		if err != nil {
+			return err
+		}
+		if released {
+			if err := s.repo.ReturnUse(ctx, red.PromotionID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// IsCouponError reports whether err is about the coupon code rather than a
+// failure to price.
+func IsCouponError(err error) bool {
+	return errors.Is(err, ErrCouponInvalid) || errors.Is(err, ErrCouponExpired) ||
+		errors.Is(err, ErrCouponUsedUp) || errors.Is(err, ErrCouponNotApplicable)
+}
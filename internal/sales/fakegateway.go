@@ -0,0 +1,236 @@
+package sales
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const fakeSignatureHeader = "X-Fake-Signature"
+
+// Outcomes a FakeGateway can simulate for an intent.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// WebhookSink delivers a webhook to the application, e.g. by calling the
+// service directly or by POSTing to the callback URL.
+type WebhookSink func(ctx context.Context, header http.Header, body []byte) error
+
+// FakeGateway is an in-process payment provider for development and tests.
+// Intents stay pending until Simulate is called; webhooks are signed with
+// HMAC-SHA256 like a real provider's, can be delayed, or dropped to exercise
+// reconciliation.
+type FakeGateway struct {
+	secret      []byte
+	redirectURL string
+
+	mu      sync.Mutex
+	intents map[string]*Intent
+	sink    WebhookSink
+}
+
+func NewFakeGateway(secret, redirectURL string) *FakeGateway {
+	return &FakeGateway{
+		secret:      []byte(secret),
+		redirectURL: redirectURL,
+		intents:     make(map[string]*Intent),
+	}
+}
+
+func (g *FakeGateway) Name() string { return "fake" }
+
+// SetWebhookSink sets where simulated webhooks are delivered.
+func (g *FakeGateway) SetWebhookSink(sink WebhookSink) {
+	g.mu.Lock()
+	g.sink = sink
+	g.mu.Unlock()
+}
+
+// HTTPSink posts webhooks to url.
+func HTTPSink(url string) WebhookSink {
+	return func(ctx context.Context, header http.Header, body []byte) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header = header.Clone()
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("webhook returned %s", resp.Status)
+		}
+		return nil
+	}
+}
+
+func randomRef(prefix string) string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+func (g *FakeGateway) CreateIntent(_ context.Context, req IntentRequest) (*Intent, error) {
+	in := &Intent{Ref: randomRef("fpi_"), Status: PaymentPending, Amount: req.Amount}
+	if g.redirectURL != "" {
+		in.RedirectURL = g.redirectURL + "?ref=" + in.Ref
+	}
+	g.mu.Lock()
+	g.intents[in.Ref] = in
+	g.mu.Unlock()
+	cp := *in
+	return &cp, nil
+}
+
+func (g *FakeGateway) update(ref string, from []string, to string) (*Intent, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	in, ok := g.intents[ref]
+	if !ok {
+		return nil, ErrUnknownIntent
+	}
+	allowed := false
+	for _, s := range from {
+		if in.Status == s {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return nil, fmt.Errorf("fake gateway: intent %s is %s", ref, in.Status)
+	}
+	in.Status = to
+	cp := *in
+	return &cp, nil
+}
+
+func (g *FakeGateway) Capture(_ context.Context, ref string) (*Intent, error) {
+	return g.update(ref, []string{PaymentAuthorized, PaymentSucceeded}, PaymentSucceeded)
+}
+
+func (g *FakeGateway) Refund(_ context.Context, ref string, _ float64) (*Intent, error) {
+	return g.update(ref, []string{PaymentSucceeded, PaymentRefunded}, PaymentRefunded)
+}
+
+func (g *FakeGateway) Lookup(_ context.Context, ref string) (*Intent, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	in, ok := g.intents[ref]
+	if !ok {
+		return nil, ErrUnknownIntent
+	}
+	cp := *in
+	return &cp, nil
+}
+
+type fakeWebhook struct {
+	ID        string    `json:"id"`
+	IntentRef string    `json:"intent"`
+	Status    string    `json:"status"`
+	Amount    float64   `json:"amount"`
+	Created   time.Time `json:"created"`
+}
+
+func (g *FakeGateway) sign(body []byte) string {
+	mac := hmac.New(sha256.New, g.secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (g *FakeGateway) VerifyWebhook(header http.Header, body []byte) (*WebhookEvent, error) {
+	sig, err := hex.DecodeString(header.Get(fakeSignatureHeader))
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	want, _ := hex.DecodeString(g.sign(body))
+	if !hmac.Equal(sig, want) {
+		return nil, ErrInvalidSignature
+	}
+	var w fakeWebhook
+	if err := json.Unmarshal(body, &w); err != nil {
+		return nil, err
+	}
+	return &WebhookEvent{
+		EventID:    w.ID,
+		IntentRef:  w.IntentRef,
+		Status:     w.Status,
+		Amount:     w.Amount,
+		OccurredAt: w.Created,
+	}, nil
+}
+
+// Simulation describes what the customer does with an intent.
+type Simulation struct {
+	Outcome     string        `json:"outcome"` // success | failure
+	Delay       time.Duration `json:"-"`       // webhook delay
+	DropWebhook bool          `json:"drop_webhook"`
+	Duplicate   bool          `json:"duplicate"` // deliver the webhook twice
+}
+
+// Simulate moves an intent to authorized (success) or failed and, unless
+// dropped, notifies the application after the configured delay.
+func (g *FakeGateway) Simulate(ref string, sim Simulation) (*Intent, error) {
+	to := PaymentAuthorized
+	if sim.Outcome == OutcomeFailure {
+		to = PaymentFailed
+	}
+	in, err := g.update(ref, []string{PaymentPending}, to)
+	if err != nil {
+		return nil, err
+	}
+	if sim.DropWebhook {
+		return in, nil
+	}
+
+	body, err := json.Marshal(fakeWebhook{
+		ID:        randomRef("evt_"),
+		IntentRef: in.Ref,
+		Status:    in.Status,
+		Amount:    in.Amount,
+		Created:   time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	header.Set(fakeSignatureHeader, g.sign(body))
+
+	g.mu.Lock()
+	sink := g.sink
+	g.mu.Unlock()
+	if sink == nil {
+		return in, nil
+	}
+	deliver := func() {
+		times := 1
+		if sim.Duplicate {
+			times = 2
+		}
+		for i := 0; i < times; i++ {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := sink(ctx, header, body); err != nil {
+				log.Printf("fake gateway: webhook for %s: %v", in.Ref, err)
+			}
+			cancel()
+		}
+	}
+	if sim.Delay > 0 {
+		time.AfterFunc(sim.Delay, deliver)
+	} else {
+		go deliver()
+	}
+	return in, nil
+}
@@ -0,0 +1,59 @@
+package sales
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Payment statuses, shared by gateways and the payments table.
+const (
+	PaymentPending    = "pending"    // created, waiting for the customer
+	PaymentAuthorized = "authorized" // customer approved, to be captured
+	PaymentSucceeded  = "succeeded"  // captured
+	PaymentFailed     = "failed"
+	PaymentRefunded   = "refunded"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrUnknownIntent    = errors.New("unknown payment intent")
+)
+
+// IntentRequest asks a gateway to start collecting money for an order.
+type IntentRequest struct {
+	OrderID  uint
+	Amount   float64
+	Currency string
+}
+
+// Intent is the gateway's view of one payment.
+type Intent struct {
+	Ref         string  `json:"ref"`
+	Status      string  `json:"status"`
+	Amount      float64 `json:"amount"`
+	RedirectURL string  `json:"redirect_url,omitempty"`
+}
+
+// WebhookEvent is a verified notification from a gateway. EventID is unique
+// per gateway and is used to process each event once.
+type WebhookEvent struct {
+	EventID    string
+	IntentRef  string
+	Status     string
+	Amount     float64
+	OccurredAt time.Time
+}
+
+// Gateway is a payment provider.
+type Gateway interface {
+	Name() string
+	CreateIntent(ctx context.Context, req IntentRequest) (*Intent, error)
+	Capture(ctx context.Context, ref string) (*Intent, error)
+	Refund(ctx context.Context, ref string, amount float64) (*Intent, error)
+	// Lookup returns the current state at the provider, for reconciliation.
+	Lookup(ctx context.Context, ref string) (*Intent, error)
+	// VerifyWebhook authenticates a callback and decodes it.
+	VerifyWebhook(header http.Header, body []byte) (*WebhookEvent, error)
+}
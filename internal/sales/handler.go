@@ -1 +1,375 @@
-package sales
\ No newline at end of file
+package sales
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/erfnzmn/Library_Management_System/internal/promotions"
+	"github.com/erfnzmn/Library_Management_System/pkg/middleware"
+	"github.com/labstack/echo/v4"
+)
+
+type Handler struct {
+	service   *Service
+	jwtSecret string
+}
+
+func NewHandler(service *Service, jwtSecret string) *Handler {
+	return &Handler{service: service, jwtSecret: jwtSecret}
+}
+
+// RegisterRoutes
+func (h *Handler) RegisterRoutes(e *echo.Echo) {
+	g := e.Group("/sales")
+	g.Use(middleware.JWT(h.jwtSecret))
+
+	staff := middleware.RequirePermission(middleware.PermSalesManage)
+	once := middleware.Idempotent
+
+	// cart
+	g.GET("/cart", h.GetCart)
+	g.PUT("/cart/items", h.SetCartItem)
+	g.DELETE("/cart/items/:bookID", h.RemoveCartItem)
+	g.DELETE("/cart", h.ClearCart)
+	g.PUT("/cart/coupon", h.SetCoupon)
+	g.DELETE("/cart/coupon", h.RemoveCoupon)
+
+	// orders
+	g.POST("/orders", h.Checkout, once)
+	g.GET("/orders", h.ListMyOrders)
+	g.GET("/orders/all", h.ListOrders, staff)
+	g.GET("/orders/:id", h.GetOrder)
+	g.POST("/orders/:id/cancel", h.CancelOrder)
+	g.POST("/orders/:id/pay", h.MarkPaid, staff, once)
+	g.POST("/orders/:id/refund", h.RefundOrder, staff, once)
+
+	// payments
+	g.POST("/orders/:id/payments", h.StartPayment, once)
+	g.GET("/orders/:id/payments", h.ListPayments)
+	g.POST("/payments/reconcile", h.Reconcile, staff)
+	if _, ok := h.service.Gateway().(*FakeGateway); ok {
+		g.POST("/payments/fake/:ref/simulate", h.SimulatePayment)
+	}
+	// called by the provider, authenticated by signature instead of JWT
+	e.POST("/sales/payments/webhook/:provider", h.Webhook)
+}
+
+// GetCart
+func (h *Handler) GetCart(c echo.Context) error {
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid or missing token"})
+	}
+	cart, err := h.service.GetCart(c.Request().Context(), userID)
+	if err != nil {
+		return c.JSON(salesErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, cart)
+}
+
+// SetCartItem sets the quantity of a book in the cart
+func (h *Handler) SetCartItem(c echo.Context) error {
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid or missing token"})
+	}
+	var req CartItemRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid input"})
+	}
+	cart, err := h.service.SetCartItem(c.Request().Context(), userID, req)
+	if err != nil {
+		return c.JSON(salesErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, cart)
+}
+
+// RemoveCartItem
+func (h *Handler) RemoveCartItem(c echo.Context) error {
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid or missing token"})
+	}
+	bookID, err := strconv.ParseUint(c.Param("bookID"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid book id"})
+	}
+	cart, err := h.service.RemoveCartItem(c.Request().Context(), userID, uint(bookID))
+	if err != nil {
+		return c.JSON(salesErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, cart)
+}
+
+// ClearCart
+func (h *Handler) ClearCart(c echo.Context) error {
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid or missing token"})
+	}
+	if err := h.service.ClearCart(c.Request().Context(), userID); err != nil {
+		return c.JSON(salesErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// SetCoupon applies a coupon code to the cart
+func (h *Handler) SetCoupon(c echo.Context) error {
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid or missing token"})
+	}
+	var req CouponRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid input"})
+	}
+	cart, err := h.service.SetCoupon(c.Request().Context(), userID, req.Code)
+	if err != nil {
+		return c.JSON(salesErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, cart)
+}
+
+// RemoveCoupon
+func (h *Handler) RemoveCoupon(c echo.Context) error {
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid or missing token"})
+	}
+	cart, err := h.service.RemoveCoupon(c.Request().Context(), userID)
+	if err != nil {
+		return c.JSON(salesErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, cart)
+}
+
+// Checkout places an order for the cart
+func (h *Handler) Checkout(c echo.Context) error {
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid or missing token"})
+	}
+	order, err := h.service.Checkout(c.Request().Context(), userID)
+	if err != nil {
+		return c.JSON(salesErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, order)
+}
+
+// ListMyOrders
+func (h *Handler) ListMyOrders(c echo.Context) error {
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid or missing token"})
+	}
+	orders, err := h.service.ListOrders(c.Request().Context(), OrderQuery{UserID: userID, Status: c.QueryParam("status")})
+	if err != nil {
+		return c.JSON(salesErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, orders)
+}
+
+// ListOrders lists every order for staff (?status=&user_id=)
+func (h *Handler) ListOrders(c echo.Context) error {
+	q := OrderQuery{Status: c.QueryParam("status")}
+	if v := c.QueryParam("user_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid user id"})
+		}
+		q.UserID = uint(id)
+	}
+	orders, err := h.service.ListOrders(c.Request().Context(), q)
+	if err != nil {
+		return c.JSON(salesErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, orders)
+}
+
+// authorizeOrder loads an order the caller owns, or any order for staff.
+// When it returns nil the response has already been written.
+func (h *Handler) authorizeOrder(c echo.Context) (*Order, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid order id"})
+	}
+	order, err := h.service.GetOrder(c.Request().Context(), uint(id))
+	if err != nil {
+		return nil, c.JSON(salesErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	if middleware.Can(c, middleware.PermSalesManage) {
+		return order, nil
+	}
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return nil, c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid or missing token"})
+	}
+	if order.UserID != userID {
+		return nil, c.JSON(http.StatusForbidden, echo.Map{"error": "FORBIDDEN"})
+	}
+	return order, nil
+}
+
+// GetOrder
+func (h *Handler) GetOrder(c echo.Context) error {
+	order, err := h.authorizeOrder(c)
+	if order == nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, order)
+}
+
+// CancelOrder — owners may cancel their pending orders
+func (h *Handler) CancelOrder(c echo.Context) error {
+	order, err := h.authorizeOrder(c)
+	if order == nil {
+		return err
+	}
+	order, err = h.service.CancelOrder(c.Request().Context(), order.ID)
+	if err != nil {
+		return c.JSON(salesErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, order)
+}
+
+// MarkPaid records a payment taken at the desk
+func (h *Handler) MarkPaid(c echo.Context) error {
+	return h.staffTransition(c, h.service.MarkPaid)
+}
+
+// RefundOrder
+func (h *Handler) RefundOrder(c echo.Context) error {
+	return h.staffTransition(c, h.service.RefundOrder)
+}
+
+func (h *Handler) staffTransition(c echo.Context, fn func(ctx context.Context, id uint) (*Order, error)) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid order id"})
+	}
+	order, err := fn(c.Request().Context(), uint(id))
+	if err != nil {
+		return c.JSON(salesErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, order)
+}
+
+// StartPayment opens a gateway payment for a pending order
+func (h *Handler) StartPayment(c echo.Context) error {
+	order, err := h.authorizeOrder(c)
+	if order == nil {
+		return err
+	}
+	payment, err := h.service.StartPayment(c.Request().Context(), order.ID)
+	if err != nil {
+		return c.JSON(salesErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, payment)
+}
+
+// ListPayments
+func (h *Handler) ListPayments(c echo.Context) error {
+	order, err := h.authorizeOrder(c)
+	if order == nil {
+		return err
+	}
+	payments, err := h.service.GetPayments(c.Request().Context(), order.ID)
+	if err != nil {
+		return c.JSON(salesErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, payments)
+}
+
+// Webhook receives payment notifications; duplicates are acknowledged
+func (h *Handler) Webhook(c echo.Context) error {
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, 1<<20))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid body"})
+	}
+	if err := h.service.HandleWebhook(c.Request().Context(), c.Param("provider"), c.Request().Header, body); err != nil {
+		return c.JSON(salesErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"received": true})
+}
+
+// Reconcile checks unsettled payments with the provider now (?older_than=)
+func (h *Handler) Reconcile(c echo.Context) error {
+	olderThan := time.Duration(0)
+	if v := c.QueryParam("older_than"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid older_than"})
+		}
+		olderThan = d
+	}
+	report, err := h.service.Reconcile(c.Request().Context(), olderThan)
+	if err != nil {
+		return c.JSON(salesErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// SimulatePayment plays the customer's part with the fake gateway
+// body: {"outcome": "success"|"failure", "delay": "5s", "drop_webhook": false, "duplicate": false}
+func (h *Handler) SimulatePayment(c echo.Context) error {
+	fake, ok := h.service.Gateway().(*FakeGateway)
+	if !ok {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": ErrNoGateway.Error()})
+	}
+	var req struct {
+		Simulation
+		Delay string `json:"delay"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid input"})
+	}
+	if req.Delay != "" {
+		d, err := time.ParseDuration(req.Delay)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid delay"})
+		}
+		req.Simulation.Delay = d
+	}
+
+	payment, err := h.service.GetPaymentByRef(c.Request().Context(), c.Param("ref"))
+	if err != nil {
+		return c.JSON(salesErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	if !middleware.Can(c, middleware.PermSalesManage) {
+		order, err := h.service.GetOrder(c.Request().Context(), payment.OrderID)
+		if err != nil {
+			return c.JSON(salesErrorStatus(err), echo.Map{"error": err.Error()})
+		}
+		userID, err := middleware.CurrentUserID(c)
+		if err != nil || order.UserID != userID {
+			return c.JSON(http.StatusForbidden, echo.Map{"error": "FORBIDDEN"})
+		}
+	}
+	intent, err := fake.Simulate(payment.Ref, req.Simulation)
+	if err != nil {
+		return c.JSON(http.StatusConflict, echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, intent)
+}
+
+func salesErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrBookNotFound), errors.Is(err, ErrOrderNotFound), errors.Is(err, ErrCartItemNotFound),
+		errors.Is(err, ErrPaymentNotFound), errors.Is(err, ErrNoGateway):
+		return http.StatusNotFound
+	case errors.Is(err, ErrInvalidSignature):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrInvalidQuantity), errors.Is(err, ErrInvalidStatus), errors.Is(err, ErrCartEmpty):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrNotForSale), errors.Is(err, ErrInsufficientStock), errors.Is(err, ErrInvalidTransition):
+		return http.StatusConflict
+	case promotions.IsCouponError(err):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
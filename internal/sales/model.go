@@ -1 +1,184 @@
-package sales
\ No newline at end of file
+package sales
+
+import (
+	"time"
+
+	"github.com/erfnzmn/Library_Management_System/internal/promotions"
+)
+
+const (
+	OrderPending   = "pending"
+	OrderPaid      = "paid"
+	OrderCancelled = "cancelled"
+	OrderRefunded  = "refunded"
+)
+
+// transitions lists the statuses an order may move to from each status.
+var transitions = map[string][]string{
+	OrderPending: {OrderPaid, OrderCancelled},
+	OrderPaid:    {OrderRefunded},
+}
+
+func CanTransition(from, to string) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Cart is the basket of a user; one per user, prices are looked up when it
+// is shown and fixed only when an order is placed.
+type Cart struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;uniqueIndex" json:"user_id"`
+	Coupon    string     `gorm:"size:40" json:"coupon,omitempty"`
+	Items     []CartItem `gorm:"foreignKey:CartID;constraint:OnDelete:CASCADE" json:"items"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+func (Cart) TableName() string { return "carts" }
+
+type CartItem struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CartID    uint      `gorm:"not null;uniqueIndex:uq_cart_book" json:"cart_id"`
+	BookID    uint      `gorm:"not null;uniqueIndex:uq_cart_book" json:"book_id"`
+	Quantity  int       `gorm:"not null" json:"quantity"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (CartItem) TableName() string { return "cart_items" }
+
+type Order struct {
+	ID     uint   `gorm:"primaryKey" json:"id"`
+	UserID uint   `gorm:"not null;index" json:"user_id"`
+	Status string `gorm:"type:enum('pending','paid','cancelled','refunded');not null;default:'pending';index" json:"status"`
+	// Subtotal is at list prices; Total = Subtotal - Discount is what is charged
+	Subtotal    float64         `gorm:"type:decimal(12,2);not null;default:0" json:"subtotal"`
+	Discount    float64         `gorm:"type:decimal(12,2);not null;default:0" json:"discount"`
+	Total       float64         `gorm:"type:decimal(12,2);not null" json:"total"`
+	Items       []OrderItem     `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"items"`
+	Discounts   []OrderDiscount `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"discounts,omitempty"`
+	PaidAt      *time.Time      `json:"paid_at,omitempty"`
+	CancelledAt *time.Time      `json:"cancelled_at,omitempty"`
+	RefundedAt  *time.Time      `json:"refunded_at,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+func (Order) TableName() string { return "orders" }
+
+// OrderItem is a line of an order, priced when the order was placed.
+type OrderItem struct {
+	ID        uint        `gorm:"primaryKey" json:"id"`
+	OrderID   uint        `gorm:"not null;index" json:"order_id"`
+	BookID    uint        `gorm:"not null;index" json:"book_id"`
+	Title     string      `gorm:"type:varchar(200);not null" json:"title"`
+	UnitPrice float64     `gorm:"type:decimal(12,2);not null" json:"unit_price"`
+	Quantity  int         `gorm:"not null" json:"quantity"`
+	Discount  float64     `gorm:"type:decimal(12,2);not null;default:0" json:"discount"`
+	LineTotal float64     `gorm:"type:decimal(12,2);not null" json:"line_total"` // after discount
+	Copies    []OrderCopy `gorm:"foreignKey:OrderItemID;constraint:OnDelete:CASCADE" json:"copies,omitempty"`
+}
+
+func (OrderItem) TableName() string { return "order_items" }
+
+// OrderCopy records which physical copy was sold on an order line, so it
+// can be put back on sale when the order is cancelled or refunded.
+type OrderCopy struct {
+	ID          uint `gorm:"primaryKey" json:"-"`
+	OrderItemID uint `gorm:"not null;index" json:"-"`
+	CopyID      uint `gorm:"not null;index" json:"copy_id"`
+}
+
+func (OrderCopy) TableName() string { return "order_copies" }
+
+// OrderDiscount records a promotion applied to an order and how much it
+// took off, for auditing.
+type OrderDiscount struct {
+	ID          uint    `gorm:"primaryKey" json:"-"`
+	OrderID     uint    `gorm:"not null;index" json:"-"`
+	PromotionID uint    `gorm:"not null;index" json:"promotion_id"`
+	Name        string  `gorm:"size:100;not null" json:"name"`
+	Code        string  `gorm:"size:40" json:"code,omitempty"`
+	Amount      float64 `gorm:"type:decimal(12,2);not null" json:"amount"`
+}
+
+func (OrderDiscount) TableName() string { return "order_discounts" }
+
+// CartView is a cart priced with current book prices and promotions.
+type CartView struct {
+	Items    []CartLine `json:"items"`
+	Subtotal float64    `json:"subtotal"`
+	Discount float64    `json:"discount"`
+	Total    float64    `json:"total"`
+	Coupon   string     `json:"coupon,omitempty"`
+	// CouponError tells why the coupon on the cart no longer applies; the
+	// cart is then priced without it
+	CouponError string               `json:"coupon_error,omitempty"`
+	Discounts   []promotions.Applied `json:"discounts,omitempty"`
+}
+
+type CartLine struct {
+	BookID    uint    `json:"book_id"`
+	Title     string  `json:"title"`
+	UnitPrice float64 `json:"unit_price"`
+	Quantity  int     `json:"quantity"`
+	Discount  float64 `json:"discount"`
+	LineTotal float64 `json:"line_total"`
+	InStock   int     `json:"in_stock"`
+}
+
+type CouponRequest struct {
+	Code string `json:"code"`
+}
+
+type CartItemRequest struct {
+	BookID   uint `json:"book_id"`
+	Quantity int  `json:"quantity"`
+}
+
+type OrderQuery struct {
+	UserID uint
+	Status string
+}
+
+// Payment is one attempt to pay an order through a gateway.
+type Payment struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	OrderID   uint       `gorm:"not null;index" json:"order_id"`
+	Provider  string     `gorm:"type:varchar(32);not null" json:"provider"`
+	Ref       string     `gorm:"type:varchar(128);not null;uniqueIndex" json:"ref"`
+	Amount    float64    `gorm:"type:decimal(12,2);not null" json:"amount"`
+	Status    string     `gorm:"type:enum('pending','authorized','succeeded','failed','refunded');not null;default:'pending';index" json:"status"`
+	SettledAt *time.Time `json:"settled_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+
+	RedirectURL string `gorm:"-" json:"redirect_url,omitempty"`
+}
+
+func (Payment) TableName() string { return "payments" }
+
+// PaymentEvent records processed webhooks so a redelivered event is
+// acknowledged without being applied twice.
+type PaymentEvent struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Provider   string    `gorm:"type:varchar(32);not null;uniqueIndex:uq_payment_event" json:"provider"`
+	EventID    string    `gorm:"type:varchar(128);not null;uniqueIndex:uq_payment_event" json:"event_id"`
+	PaymentRef string    `gorm:"type:varchar(128);not null;index" json:"payment_ref"`
+	Status     string    `gorm:"type:varchar(32);not null" json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (PaymentEvent) TableName() string { return "payment_events" }
+
+// ReconcileReport summarises one reconciliation run.
+type ReconcileReport struct {
+	Checked int `json:"checked"`
+	Updated int `json:"updated"`
+	Failed  int `json:"failed"`
+}
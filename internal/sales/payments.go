@@ -0,0 +1,289 @@
+package sales
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/erfnzmn/Library_Management_System/pkg/lock"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNoGateway       = errors.New("no payment gateway configured for this provider")
+	ErrPaymentNotFound = errors.New("payment not found")
+)
+
+// Currency of order totals and payments.
+const Currency = "IRR"
+
+const reconcileBatchSize = 100
+
+// SetGateway enables online payments.
+func (s *Service) SetGateway(g Gateway) {
+	s.gateway = g
+}
+
+func (s *Service) Gateway() Gateway {
+	return s.gateway
+}
+
+// StartPayment opens a payment intent for a pending order. The customer
+// completes it at the provider; the result arrives by webhook.
+func (s *Service) StartPayment(ctx context.Context, orderID uint) (*Payment, error) {
+	if s.gateway == nil {
+		return nil, ErrNoGateway
+	}
+	order, err := s.GetOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != OrderPending {
+		return nil, ErrInvalidTransition
+	}
+	intent, err := s.gateway.CreateIntent(ctx, IntentRequest{OrderID: order.ID, Amount: order.Total, Currency: Currency})
+	if err != nil {
+		return nil, err
+	}
+	p := &Payment{
+		OrderID:  order.ID,
+		Provider: s.gateway.Name(),
+		Ref:      intent.Ref,
+		Amount:   order.Total,
+		Status:   intent.Status,
+	}
+	if err := s.repo.CreatePayment(ctx, p); err != nil {
+		return nil, err
+	}
+	p.RedirectURL = intent.RedirectURL
+	return p, nil
+}
+
+func (s *Service) GetPayments(ctx context.Context, orderID uint) ([]Payment, error) {
+	return s.repo.GetPaymentsByOrder(ctx, orderID)
+}
+
+func (s *Service) GetPaymentByRef(ctx context.Context, ref string) (*Payment, error) {
+	p, err := s.repo.GetPaymentByRef(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, ErrPaymentNotFound
+	}
+	return p, nil
+}
+
+// HandleWebhook verifies and applies a provider callback. Events already
+// processed are acknowledged and ignored, so providers may retry freely.
+func (s *Service) HandleWebhook(ctx context.Context, provider string, header http.Header, body []byte) error {
+	if s.gateway == nil || s.gateway.Name() != provider {
+		return ErrNoGateway
+	}
+	ev, err := s.gateway.VerifyWebhook(header, body)
+	if err != nil {
+		return err
+	}
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		s := s.withTx(tx)
+		fresh, err := s.repo.RecordEvent(ctx, &PaymentEvent{
+			Provider:   provider,
+			EventID:    ev.EventID,
+			PaymentRef: ev.IntentRef,
+			Status:     ev.Status,
+		})
+		if err != nil || !fresh {
+			return err
+		}
+		_, err = s.applyStatus(ctx, ev.IntentRef, ev.Status)
+		return err
+	})
+}
+
+// applyStatus moves a payment, and its order, to the state reported by the
+// provider. Authorized payments are captured right away. Money that arrives
+// for an order that is no longer pending is refunded.
+//
+// It runs in a transaction. The order and then the payment are locked, and
+// the status is checked again under the lock before the gateway is called,
+// so a webhook and the reconciler reporting the same payment act on it once.
+func (s *Service) applyStatus(ctx context.Context, ref, status string) (bool, error) {
+	p, err := s.GetPaymentByRef(ctx, ref)
+	if err != nil {
+		return false, err
+	}
+	order, err := s.repo.LockOrder(ctx, p.OrderID)
+	if err != nil {
+		return false, err
+	}
+	if order == nil {
+		return false, ErrOrderNotFound
+	}
+	if p, err = s.repo.LockPayment(ctx, ref); err != nil {
+		return false, err
+	}
+	if p == nil {
+		return false, ErrPaymentNotFound
+	}
+	if p.Status == status {
+		return false, nil
+	}
+
+	if status == PaymentAuthorized {
+		if p.Status != PaymentPending {
+			return false, nil
+		}
+		intent, err := s.gateway.Capture(ctx, ref)
+		if err != nil {
+			return false, err
+		}
+		status = intent.Status
+	}
+
+	now := time.Now()
+	switch status {
+	case PaymentSucceeded:
+		if p.Status == PaymentSucceeded || p.Status == PaymentRefunded {
+			return false, nil
+		}
+		p.Status, p.SettledAt = PaymentSucceeded, &now
+		if err := s.repo.UpdatePayment(ctx, p); err != nil {
+			return false, err
+		}
+		if order.Status == OrderPending {
+			return true, s.setStatus(ctx, order, OrderPaid)
+		}
+		// paid twice, or paid after cancelling
+		log.Printf("payment %s settled for order %d in status %s, refunding", ref, order.ID, order.Status)
+		return true, s.refundPayment(ctx, p)
+
+	case PaymentFailed:
+		if p.Status != PaymentPending && p.Status != PaymentAuthorized {
+			return false, nil
+		}
+		p.Status, p.SettledAt = PaymentFailed, &now
+		return true, s.repo.UpdatePayment(ctx, p)
+
+	case PaymentRefunded:
+		p.Status = PaymentRefunded
+		if err := s.repo.UpdatePayment(ctx, p); err != nil {
+			return false, err
+		}
+		if CanTransition(order.Status, OrderRefunded) {
+			err = s.setStatus(ctx, order, OrderRefunded)
+		}
+		return true, err
+	}
+	return false, nil
+}
+
+func (s *Service) refundPayment(ctx context.Context, p *Payment) error {
+	if s.gateway == nil || s.gateway.Name() != p.Provider {
+		return ErrNoGateway
+	}
+	if _, err := s.gateway.Refund(ctx, p.Ref, p.Amount); err != nil {
+		return err
+	}
+	p.Status = PaymentRefunded
+	return s.repo.UpdatePayment(ctx, p)
+}
+
+// settledPayment returns the captured payment of an order, if any. The
+// payments of the order stay locked until the transaction ends.
+func (s *Service) settledPayment(ctx context.Context, orderID uint) (*Payment, error) {
+	payments, err := s.repo.LockPaymentsByOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range payments {
+		if payments[i].Status == PaymentSucceeded {
+			return &payments[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// Reconcile asks the provider about payments left pending or authorized
+// for longer than olderThan, e.g. because a webhook was lost, and applies
+// what it reports.
+func (s *Service) Reconcile(ctx context.Context, olderThan time.Duration) (*ReconcileReport, error) {
+	report := &ReconcileReport{}
+	if s.gateway == nil {
+		return report, nil
+	}
+	payments, err := s.repo.GetUnsettledPayments(ctx, time.Now().Add(-olderThan), reconcileBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range payments {
+		if p.Provider != s.gateway.Name() {
+			continue
+		}
+		report.Checked++
+		intent, err := s.gateway.Lookup(ctx, p.Ref)
+		if err != nil {
+			report.Failed++
+			log.Printf("reconcile: payment %s: %v", p.Ref, err)
+			continue
+		}
+		var changed bool
+		err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var err error
+			changed, err = s.withTx(tx).applyStatus(ctx, p.Ref, intent.Status)
+			return err
+		})
+		if err != nil {
+			report.Failed++
+			log.Printf("reconcile: payment %s: %v", p.Ref, err)
+			continue
+		}
+		if changed {
+			report.Updated++
+		}
+	}
+	return report, nil
+}
+
+// Reconciler runs Reconcile periodically on one instance at a time.
+type Reconciler struct {
+	service   *Service
+	locker    lock.Locker
+	interval  time.Duration
+	olderThan time.Duration
+}
+
+const reconcileLockKey = "sales:reconcile-payments"
+
+func NewReconciler(service *Service, locker lock.Locker, interval, olderThan time.Duration) *Reconciler {
+	return &Reconciler{service: service, locker: locker, interval: interval, olderThan: olderThan}
+}
+
+// Run blocks until ctx is cancelled.
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		release, ok, err := r.locker.TryAcquire(ctx, reconcileLockKey, r.interval)
+		if err != nil {
+			log.Printf("reconciler: lock: %v", err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		report, err := r.service.Reconcile(ctx, r.olderThan)
+		release()
+		if err != nil {
+			log.Printf("reconciler: %v", err)
+		} else if report.Updated > 0 || report.Failed > 0 {
+			log.Printf("reconciler: %+v", *report)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package sales
+
+import (
+	"context"
+	"strings"
+
+	books "github.com/erfnzmn/Library_Management_System/internal/books"
+	"github.com/erfnzmn/Library_Management_System/internal/promotions"
+)
+
+// UserDirectory gives the role of a user for role-based pricing.
+type UserDirectory interface {
+	UserRole(ctx context.Context, userID uint) (string, error)
+}
+
+// SetPromotions enables discounts and coupon codes; without it carts are
+// priced at list prices.
+func (s *Service) SetPromotions(p *promotions.Service) {
+	s.promotions = p
+}
+
+func (s *Service) SetUserDirectory(users UserDirectory) {
+	s.users = users
+}
+
+func lineFor(b *books.Book, quantity int) promotions.Line {
+	var tags []string
+	if b.Tags != "" {
+		tags = strings.Split(b.Tags, ",")
+	}
+	return promotions.Line{
+		BookID:    b.ID,
+		Genre:     b.Genre,
+		Tags:      tags,
+		UnitPrice: b.Price,
+		Quantity:  quantity,
+	}
+}
+
+// quote prices lines for a user with the live promotions and the coupon.
+func (s *Service) quote(ctx context.Context, userID uint, lines []promotions.Line, coupon string) (*promotions.Quote, error) {
+	customer := promotions.Customer{UserID: userID}
+	if s.users != nil {
+		role, err := s.users.UserRole(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		customer.Role = role
+	}
+	if s.promotions == nil {
+		return promotions.Apply(nil, customer, lines), nil
+	}
+	return s.promotions.Price(ctx, customer, lines, coupon)
+}
+
+// SetCoupon puts a coupon code on the cart once it checks out against the
+// current contents.
+func (s *Service) SetCoupon(ctx context.Context, userID uint, code string) (*CartView, error) {
+	if s.promotions == nil {
+		return nil, promotions.ErrCouponInvalid
+	}
+	code = promotions.NormalizeCode(code)
+	if code == "" {
+		return nil, promotions.ErrCouponInvalid
+	}
+	cart, err := s.repo.GetOrCreateCart(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	cart.Coupon = code
+	view, err := s.priceCart(ctx, cart, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetCoupon(ctx, cart.ID, code); err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
+func (s *Service) RemoveCoupon(ctx context.Context, userID uint) (*CartView, error) {
+	cart, err := s.repo.GetOrCreateCart(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetCoupon(ctx, cart.ID, ""); err != nil {
+		return nil, err
+	}
+	return s.GetCart(ctx, userID)
+}
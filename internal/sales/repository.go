@@ -1 +1,207 @@
-package sales
\ No newline at end of file
+package sales
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// WithTx returns a repository bound to the given transaction.
+func (r *Repository) WithTx(tx *gorm.DB) *Repository {
+	return &Repository{db: tx}
+}
+
+// GetOrCreateCart returns the cart of a user with its items.
+func (r *Repository) GetOrCreateCart(ctx context.Context, userID uint) (*Cart, error) {
+	return r.getOrCreateCart(ctx, r.db.WithContext(ctx), userID)
+}
+
+// LockCart is GetOrCreateCart holding a row lock on the cart until the end
+// of the transaction, so its items cannot be read twice by concurrent
+// checkouts.
+func (r *Repository) LockCart(ctx context.Context, userID uint) (*Cart, error) {
+	return r.getOrCreateCart(ctx, r.db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}), userID)
+}
+
+// getOrCreateCart creates the cart if needed, then reads it through db.
+func (r *Repository) getOrCreateCart(ctx context.Context, db *gorm.DB, userID uint) (*Cart, error) {
+	cart := Cart{UserID: userID}
+	if err := r.db.WithContext(ctx).
+		Where(Cart{UserID: userID}).
+		FirstOrCreate(&cart).Error; err != nil {
+		return nil, err
+	}
+	if err := db.First(&cart, cart.ID).Error; err != nil {
+		return nil, err
+	}
+	if err := r.db.WithContext(ctx).
+		Where("cart_id = ?", cart.ID).
+		Order("id ASC").
+		Find(&cart.Items).Error; err != nil {
+		return nil, err
+	}
+	return &cart, nil
+}
+
+// SetCartItem sets the quantity of a book in a cart.
+func (r *Repository) SetCartItem(ctx context.Context, cartID, bookID uint, quantity int) error {
+	item := CartItem{CartID: cartID, BookID: bookID, Quantity: quantity}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "cart_id"}, {Name: "book_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"quantity", "updated_at"}),
+	}).Create(&item).Error
+}
+
+func (r *Repository) DeleteCartItem(ctx context.Context, cartID, bookID uint) (bool, error) {
+	res := r.db.WithContext(ctx).
+		Where("cart_id = ? AND book_id = ?", cartID, bookID).
+		Delete(&CartItem{})
+	return res.RowsAffected > 0, res.Error
+}
+
+// ClearCart empties a cart and drops its coupon.
+func (r *Repository) ClearCart(ctx context.Context, cartID uint) error {
+	if err := r.db.WithContext(ctx).Where("cart_id = ?", cartID).Delete(&CartItem{}).Error; err != nil {
+		return err
+	}
+	return r.SetCoupon(ctx, cartID, "")
+}
+
+func (r *Repository) SetCoupon(ctx context.Context, cartID uint, code string) error {
+	return r.db.WithContext(ctx).Model(&Cart{}).Where("id = ?", cartID).Update("coupon", code).Error
+}
+
+func (r *Repository) CreateOrder(ctx context.Context, order *Order) error {
+	return r.db.WithContext(ctx).Create(order).Error
+}
+
+func (r *Repository) UpdateOrder(ctx context.Context, order *Order) error {
+	return r.db.WithContext(ctx).Omit(clause.Associations).Save(order).Error
+}
+
+// GetOrderByID loads an order with its lines and sold copies.
+func (r *Repository) GetOrderByID(ctx context.Context, id uint) (*Order, error) {
+	return r.getOrder(r.db.WithContext(ctx), id)
+}
+
+// LockOrder is GetOrderByID locking the order row until the transaction
+// ends, so that two status changes of one order run one after the other.
+func (r *Repository) LockOrder(ctx context.Context, id uint) (*Order, error) {
+	return r.getOrder(r.db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}), id)
+}
+
+func (r *Repository) getOrder(db *gorm.DB, id uint) (*Order, error) {
+	var order Order
+	err := db.
+		Preload("Items.Copies").
+		Preload("Discounts").
+		First(&order, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (r *Repository) ListOrders(ctx context.Context, q OrderQuery) ([]Order, error) {
+	var orders []Order
+	db := r.db.WithContext(ctx).Preload("Items").Preload("Discounts")
+	if q.UserID != 0 {
+		db = db.Where("user_id = ?", q.UserID)
+	}
+	if q.Status != "" {
+		db = db.Where("status = ?", q.Status)
+	}
+	if err := db.Order("created_at DESC, id DESC").Find(&orders).Error; err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+func (r *Repository) CreatePayment(ctx context.Context, p *Payment) error {
+	return r.db.WithContext(ctx).Create(p).Error
+}
+
+func (r *Repository) UpdatePayment(ctx context.Context, p *Payment) error {
+	return r.db.WithContext(ctx).Save(p).Error
+}
+
+func (r *Repository) GetPaymentByRef(ctx context.Context, ref string) (*Payment, error) {
+	return r.getPayment(r.db.WithContext(ctx), ref)
+}
+
+// LockPayment is GetPaymentByRef locking the payment row until the
+// transaction ends, so that a webhook and the reconciler cannot both act on
+// the same status.
+func (r *Repository) LockPayment(ctx context.Context, ref string) (*Payment, error) {
+	return r.getPayment(r.db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}), ref)
+}
+
+func (r *Repository) getPayment(db *gorm.DB, ref string) (*Payment, error) {
+	var p Payment
+	err := db.Where("ref = ?", ref).First(&p).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *Repository) GetPaymentsByOrder(ctx context.Context, orderID uint) ([]Payment, error) {
+	return r.paymentsByOrder(r.db.WithContext(ctx), orderID)
+}
+
+// LockPaymentsByOrder is GetPaymentsByOrder locking the payment rows until
+// the transaction ends.
+func (r *Repository) LockPaymentsByOrder(ctx context.Context, orderID uint) ([]Payment, error) {
+	return r.paymentsByOrder(r.db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}), orderID)
+}
+
+func (r *Repository) paymentsByOrder(db *gorm.DB, orderID uint) ([]Payment, error) {
+	var payments []Payment
+	if err := db.
+		Where("order_id = ?", orderID).
+		Order("id ASC").
+		Find(&payments).Error; err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+// GetUnsettledPayments returns payments still pending or authorized that
+// were created before cutoff.
+func (r *Repository) GetUnsettledPayments(ctx context.Context, cutoff time.Time, limit int) ([]Payment, error) {
+	var payments []Payment
+	if err := r.db.WithContext(ctx).
+		Where("status IN ? AND created_at < ?", []string{PaymentPending, PaymentAuthorized}, cutoff).
+		Order("created_at ASC").
+		Limit(limit).
+		Find(&payments).Error; err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+// RecordEvent stores a webhook event; it reports false when the event was
+// already recorded.
+func (r *Repository) RecordEvent(ctx context.Context, ev *PaymentEvent) (bool, error) {
+	res := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(ev)
+	return res.RowsAffected > 0, res.Error
+}
@@ -1 +1,424 @@
-package sales
\ No newline at end of file
+package sales
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	books "github.com/erfnzmn/Library_Management_System/internal/books"
+	"github.com/erfnzmn/Library_Management_System/internal/promotions"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrBookNotFound      = errors.New("book not found")
+	ErrNotForSale        = errors.New("book is not for sale")
+	ErrInsufficientStock = errors.New("not enough copies for sale")
+	ErrInvalidQuantity   = errors.New("quantity must be at least 1")
+	ErrCartEmpty         = errors.New("cart is empty")
+	ErrCartItemNotFound  = errors.New("book is not in the cart")
+	ErrOrderNotFound     = errors.New("order not found")
+	ErrInvalidTransition = errors.New("order status does not allow this operation")
+	ErrInvalidStatus     = errors.New("invalid order status")
+)
+
+type Service struct {
+	repo     *Repository
+	bookRepo *books.Repository
+	db       *gorm.DB
+	gateway  Gateway
+
+	promotions *promotions.Service
+	users      UserDirectory
+}
+
+func NewService(db *gorm.DB, repo *Repository, bookRepo *books.Repository) *Service {
+	return &Service{db: db, repo: repo, bookRepo: bookRepo}
+}
+
+// withTx returns a copy of the service whose repositories run in tx.
+func (s *Service) withTx(tx *gorm.DB) *Service {
+	txs := *s
+	txs.db = tx
+	txs.repo = s.repo.WithTx(tx)
+	txs.bookRepo = s.bookRepo.WithTx(tx)
+	if s.promotions != nil {
+		txs.promotions = s.promotions.WithTx(tx)
+	}
+	return &txs
+}
+
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// GetCart prices the cart of a user with current book prices and
+// promotions.
+func (s *Service) GetCart(ctx context.Context, userID uint) (*CartView, error) {
+	cart, err := s.repo.GetOrCreateCart(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.priceCart(ctx, cart, true)
+}
+
+// priceCart builds the view of a cart. A coupon that no longer applies is
+// reported in the view when lenient, returned as the error otherwise.
+func (s *Service) priceCart(ctx context.Context, cart *Cart, lenient bool) (*CartView, error) {
+	ids := make([]uint, len(cart.Items))
+	for i, item := range cart.Items {
+		ids[i] = item.BookID
+	}
+	list, err := s.bookRepo.GetBooksByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]books.Book, len(list))
+	for _, b := range list {
+		byID[b.ID] = b
+	}
+
+	view := &CartView{Items: make([]CartLine, 0, len(cart.Items)), Coupon: cart.Coupon}
+	var lines []promotions.Line
+	for _, item := range cart.Items {
+		b, ok := byID[item.BookID]
+		if !ok {
+			continue // removed from the catalogue
+		}
+		view.Items = append(view.Items, CartLine{
+			BookID:    b.ID,
+			Title:     b.Title,
+			UnitPrice: b.Price,
+			Quantity:  item.Quantity,
+			InStock:   b.SaleStock,
+		})
+		lines = append(lines, lineFor(&b, item.Quantity))
+	}
+
+	q, err := s.quote(ctx, cart.UserID, lines, cart.Coupon)
+	if err != nil && lenient && promotions.IsCouponError(err) {
+		view.CouponError = err.Error()
+		q, err = s.quote(ctx, cart.UserID, lines, "")
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := range view.Items {
+		line := &view.Items[i]
+		line.Discount = q.Discounts[i]
+		line.LineTotal = round(line.UnitPrice*float64(line.Quantity) - line.Discount)
+	}
+	view.Subtotal, view.Discount, view.Total = q.Subtotal, q.Discount, q.Total
+	view.Discounts = q.Applied
+	return view, nil
+}
+
+// SetCartItem puts quantity copies of a book in the cart, replacing any
+// previous quantity.
+func (s *Service) SetCartItem(ctx context.Context, userID uint, req CartItemRequest) (*CartView, error) {
+	if req.Quantity < 1 {
+		return nil, ErrInvalidQuantity
+	}
+	book, err := s.bookRepo.GetBookByID(ctx, req.BookID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBookNotFound
+		}
+		return nil, err
+	}
+	if book.SaleStock == 0 {
+		return nil, ErrNotForSale
+	}
+	if req.Quantity > book.SaleStock {
+		return nil, ErrInsufficientStock
+	}
+	cart, err := s.repo.GetOrCreateCart(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetCartItem(ctx, cart.ID, book.ID, req.Quantity); err != nil {
+		return nil, err
+	}
+	return s.GetCart(ctx, userID)
+}
+
+func (s *Service) RemoveCartItem(ctx context.Context, userID, bookID uint) (*CartView, error) {
+	cart, err := s.repo.GetOrCreateCart(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	found, err := s.repo.DeleteCartItem(ctx, cart.ID, bookID)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrCartItemNotFound
+	}
+	return s.GetCart(ctx, userID)
+}
+
+func (s *Service) ClearCart(ctx context.Context, userID uint) error {
+	cart, err := s.repo.GetOrCreateCart(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return s.repo.ClearCart(ctx, cart.ID)
+}
+
+// Checkout turns the cart into a pending order: prices are fixed, the
+// copies are taken off sale and the cart is emptied.
+func (s *Service) Checkout(ctx context.Context, userID uint) (*Order, error) {
+	var order *Order
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		s := s.withTx(tx)
+		// a second checkout of the same cart waits here and then finds
+		// it empty
+		cart, err := s.repo.LockCart(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if len(cart.Items) == 0 {
+			return ErrCartEmpty
+		}
+		// lock every book of the cart up front, in ID order, so that
+		// checkouts of overlapping carts queue instead of deadlocking
+		ids := make([]uint, len(cart.Items))
+		for i, item := range cart.Items {
+			ids[i] = item.BookID
+		}
+		if _, err := s.bookRepo.LockBooks(ctx, ids); err != nil {
+			return err
+		}
+
+		order = &Order{UserID: userID, Status: OrderPending}
+		var lines []promotions.Line
+		for _, item := range cart.Items {
+			line, book, err := s.takeCopies(ctx, item)
+			if err != nil {
+				return err
+			}
+			order.Items = append(order.Items, *line)
+			lines = append(lines, lineFor(book, item.Quantity))
+		}
+
+		q, err := s.quote(ctx, userID, lines, cart.Coupon)
+		if err != nil {
+			return err
+		}
+		for i := range order.Items {
+			item := &order.Items[i]
+			item.Discount = q.Discounts[i]
+			item.LineTotal = round(item.LineTotal - item.Discount)
+		}
+		order.Subtotal, order.Discount, order.Total = q.Subtotal, q.Discount, q.Total
+		for _, a := range q.Applied {
+			order.Discounts = append(order.Discounts, OrderDiscount{
+				PromotionID: a.PromotionID,
+				Name:        a.Name,
+				Code:        a.Code,
+				Amount:      a.Amount,
+			})
+		}
+
+		if err := s.repo.CreateOrder(ctx, order); err != nil {
+			return err
+		}
+		if s.promotions != nil && len(q.Applied) > 0 {
+			customer := promotions.Customer{UserID: userID}
+			if err := s.promotions.Redeem(ctx, customer, order.ID, q.Applied); err != nil {
+				return err
+			}
+		}
+		return s.repo.ClearCart(ctx, cart.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// takeCopies marks the copies of a cart line sold and prices the line at
+// list price. It runs in the checkout transaction.
+func (s *Service) takeCopies(ctx context.Context, item CartItem) (*OrderItem, *books.Book, error) {
+	book, err := s.bookRepo.LockBook(ctx, item.BookID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrBookNotFound
+		}
+		return nil, nil, err
+	}
+	copies, err := s.bookRepo.FindCopiesForSale(ctx, book.ID, item.Quantity)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(copies) < item.Quantity {
+		return nil, nil, ErrInsufficientStock
+	}
+	line := &OrderItem{
+		BookID:    book.ID,
+		Title:     book.Title,
+		UnitPrice: book.Price,
+		Quantity:  item.Quantity,
+		LineTotal: round(book.Price * float64(item.Quantity)),
+	}
+	ids := make([]uint, len(copies))
+	for i, c := range copies {
+		ids[i] = c.ID
+		line.Copies = append(line.Copies, OrderCopy{CopyID: c.ID})
+	}
+	n, err := s.bookRepo.TransitionCopies(ctx, ids, books.CopyStatusForSale, books.CopyStatusSold)
+	if err != nil {
+		return nil, nil, err
+	}
+	if n != int64(len(ids)) {
+		return nil, nil, ErrInsufficientStock
+	}
+	return line, book, s.bookRepo.SyncAvailability(ctx, book.ID)
+}
+
+func (s *Service) GetOrder(ctx context.Context, id uint) (*Order, error) {
+	order, err := s.repo.GetOrderByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+	return order, nil
+}
+
+func (s *Service) ListOrders(ctx context.Context, q OrderQuery) ([]Order, error) {
+	if q.Status != "" && !isValidStatus(q.Status) {
+		return nil, ErrInvalidStatus
+	}
+	return s.repo.ListOrders(ctx, q)
+}
+
+func isValidStatus(status string) bool {
+	switch status {
+	case OrderPending, OrderPaid, OrderCancelled, OrderRefunded:
+		return true
+	}
+	return false
+}
+
+func (s *Service) MarkPaid(ctx context.Context, id uint) (*Order, error) {
+	return s.transition(ctx, id, OrderPaid)
+}
+
+// CancelOrder cancels a pending order and puts its copies back on sale.
+func (s *Service) CancelOrder(ctx context.Context, id uint) (*Order, error) {
+	return s.transition(ctx, id, OrderCancelled)
+}
+
+// RefundOrder refunds a paid order; returned copies go back on sale. The
+// order and its payments are locked and the order is marked refunded before
+// money taken through a gateway is refunded there, all in one transaction:
+// a concurrent refund waits and then finds the order refunded, and a failed
+// gateway call rolls the order back to paid.
+func (s *Service) RefundOrder(ctx context.Context, id uint) (*Order, error) {
+	var order *Order
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		s := s.withTx(tx)
+		var err error
+		if order, err = s.lockOrder(ctx, id); err != nil {
+			return err
+		}
+		p, err := s.settledPayment(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := s.setStatus(ctx, order, OrderRefunded); err != nil {
+			return err
+		}
+		if p == nil {
+			return nil
+		}
+		return s.refundPayment(ctx, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+func (s *Service) transition(ctx context.Context, id uint, to string) (*Order, error) {
+	var order *Order
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		s := s.withTx(tx)
+		var err error
+		if order, err = s.lockOrder(ctx, id); err != nil {
+			return err
+		}
+		return s.setStatus(ctx, order, to)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+func (s *Service) lockOrder(ctx context.Context, id uint) (*Order, error) {
+	order, err := s.repo.LockOrder(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+	return order, nil
+}
+
+// setStatus moves an order locked by the current transaction to status to.
+func (s *Service) setStatus(ctx context.Context, order *Order, to string) error {
+	if !CanTransition(order.Status, to) {
+		return ErrInvalidTransition
+	}
+
+	now := time.Now()
+	switch to {
+	case OrderPaid:
+		order.PaidAt = &now
+	case OrderCancelled:
+		order.CancelledAt = &now
+	case OrderRefunded:
+		order.RefundedAt = &now
+	}
+	if to == OrderCancelled || to == OrderRefunded {
+		if err := s.restock(ctx, order); err != nil {
+			return err
+		}
+	}
+	// a cancelled order gives its coupons back; a refunded one has used them
+	if to == OrderCancelled && s.promotions != nil {
+		if err := s.promotions.Release(ctx, order.ID); err != nil {
+			return err
+		}
+	}
+	order.Status = to
+	return s.repo.UpdateOrder(ctx, order)
+}
+
+// restock puts the copies of an order back on sale.
+func (s *Service) restock(ctx context.Context, order *Order) error {
+	for _, item := range order.Items {
+		if _, err := s.bookRepo.LockBook(ctx, item.BookID); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue // removed from the catalogue
+			}
+			return err
+		}
+		ids := make([]uint, len(item.Copies))
+		for i, c := range item.Copies {
+			ids[i] = c.CopyID
+		}
+		if err := s.bookRepo.SetCopiesStatus(ctx, ids, books.CopyStatusForSale); err != nil {
+			return err
+		}
+		if err := s.bookRepo.SyncAvailability(ctx, item.BookID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package search
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryIndex is an in-process inverted index. It needs no database, so it is
+// also what tests and single-instance deployments use.
+type MemoryIndex struct {
+	mu sync.RWMutex
+	// postings: token -> document -> field -> term frequency
+	postings map[string]map[uint]map[string]int
+	// docTokens remembers what was indexed for a document so it can be removed
+	docTokens map[uint][]string
+}
+
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{
+		postings:  make(map[string]map[uint]map[string]int),
+		docTokens: make(map[uint][]string),
+	}
+}
+
+func (m *MemoryIndex) Index(ctx context.Context, doc Document) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.remove(doc.ID)
+	seen := make(map[string]bool)
+	add := func(field, tok string) {
+		docs, ok := m.postings[tok]
+		if !ok {
+			docs = make(map[uint]map[string]int)
+			m.postings[tok] = docs
+		}
+		fields, ok := docs[doc.ID]
+		if !ok {
+			fields = make(map[string]int)
+			docs[doc.ID] = fields
+		}
+		fields[field]++
+		if !seen[tok] {
+			seen[tok] = true
+			m.docTokens[doc.ID] = append(m.docTokens[doc.ID], tok)
+		}
+	}
+
+	for _, field := range []string{FieldTitle, FieldAuthor, FieldTags, FieldDescription} {
+		for _, tok := range Tokenize(doc.field(field)) {
+			add(field, tok)
+		}
+	}
+	if isbn := NormalizeISBN(doc.ISBN); isbn != "" {
+		add(FieldISBN, isbn)
+	}
+	return nil
+}
+
+func (m *MemoryIndex) Remove(ctx context.Context, id uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(id)
+	return nil
+}
+
+func (m *MemoryIndex) remove(id uint) {
+	for _, tok := range m.docTokens[id] {
+		delete(m.postings[tok], id)
+		if len(m.postings[tok]) == 0 {
+			delete(m.postings, tok)
+		}
+	}
+	delete(m.docTokens, id)
+}
+
+func (m *MemoryIndex) Search(ctx context.Context, q Query, limit int) ([]Hit, error) {
+	if q.Empty() {
+		return nil, nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	total := float64(len(m.docTokens))
+	var scores map[uint]float64
+	for _, term := range q.Terms {
+		termScores := make(map[uint]float64)
+		for _, tok := range m.expand(term) {
+			docs := m.postings[tok]
+			idf := math.Log(1 + total/float64(len(docs)))
+			for id, fields := range docs {
+				for field, tf := range fields {
+					if term.Field != "" && term.Field != field {
+						continue
+					}
+					score := idf * fieldWeights[field] * (1 + math.Log(float64(tf)))
+					if tok != term.Text {
+						// prefix expansions rank below exact matches
+						score *= 0.8
+					}
+					if score > termScores[id] {
+						termScores[id] = score
+					}
+				}
+			}
+		}
+
+		if scores == nil {
+			scores = termScores
+			continue
+		}
+		for id := range scores {
+			if s, ok := termScores[id]; ok {
+				scores[id] += s
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{ID: id, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+// expand returns the indexed tokens matched by a term.
+func (m *MemoryIndex) expand(term Term) []string {
+	if !term.Prefix {
+		if _, ok := m.postings[term.Text]; ok {
+			return []string{term.Text}
+		}
+		return nil
+	}
+	var toks []string
+	for tok := range m.postings {
+		if strings.HasPrefix(tok, term.Text) {
+			toks = append(toks, tok)
+		}
+	}
+	return toks
+}
@@ -0,0 +1,157 @@
+package search
+
+import (
+	"context"
+	"testing"
+)
+
+func newTestIndex(t *testing.T, docs ...Document) *MemoryIndex {
+	t.Helper()
+	idx := NewMemoryIndex()
+	for _, d := range docs {
+		if err := idx.Index(context.Background(), d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return idx
+}
+
+func search(t *testing.T, idx Index, raw string) []uint {
+	t.Helper()
+	hits, err := idx.Search(context.Background(), ParseQuery(raw), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]uint, len(hits))
+	for i, h := range hits {
+		ids[i] = h.ID
+	}
+	return ids
+}
+
+func equalIDs(a, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+var catalogue = []Document{
+	{ID: 1, Title: "The Blind Owl", Author: "Sadegh Hedayat", ISBN: "978-0-8021-3180-0", Tags: "novel, surrealism"},
+	{ID: 2, Title: "Shahnameh", Author: "Ferdowsi", Tags: "epic, poetry", Description: "The book of kings"},
+	{ID: 3, Title: "Hedayat: a biography", Author: "Homa Katouzian", Description: "The life of the author of The Blind Owl"},
+	{ID: 4, Title: "بوف کور", Author: "صادق هدایت", Tags: "رمان"},
+}
+
+func TestMemoryIndexRanking(t *testing.T) {
+	idx := newTestIndex(t, catalogue...)
+
+	// a title match outranks a description match
+	if got := search(t, idx, "owl"); !equalIDs(got, []uint{1, 3}) {
+		t.Errorf("owl: got %v, want [1 3]", got)
+	}
+	// and a title match outranks an author match
+	if got := search(t, idx, "hedayat"); !equalIDs(got, []uint{3, 1}) {
+		t.Errorf("hedayat: got %v, want [3 1]", got)
+	}
+}
+
+func TestMemoryIndexAllTermsMustMatch(t *testing.T) {
+	idx := newTestIndex(t, catalogue...)
+	if got := search(t, idx, "blind owl hedayat"); !equalIDs(got, []uint{1, 3}) {
+		t.Errorf("got %v, want [1 3]", got)
+	}
+	if got := search(t, idx, "owl ferdowsi"); len(got) != 0 {
+		t.Errorf("got %v, want none", got)
+	}
+}
+
+func TestMemoryIndexPrefix(t *testing.T) {
+	idx := newTestIndex(t, catalogue...)
+	if got := search(t, idx, "shah*"); !equalIDs(got, []uint{2}) {
+		t.Errorf("shah*: got %v, want [2]", got)
+	}
+	if got := search(t, idx, "shah"); len(got) != 0 {
+		t.Errorf("shah: got %v, want none without the star", got)
+	}
+
+	// an exact match ranks above a prefix expansion
+	idx = newTestIndex(t,
+		Document{ID: 10, Title: "Poetry"},
+		Document{ID: 11, Title: "Poet"},
+	)
+	if got := search(t, idx, "poet*"); !equalIDs(got, []uint{11, 10}) {
+		t.Errorf("poet*: got %v, want [11 10]", got)
+	}
+}
+
+func TestMemoryIndexFieldScope(t *testing.T) {
+	idx := newTestIndex(t, catalogue...)
+	if got := search(t, idx, "author:hedayat"); !equalIDs(got, []uint{1}) {
+		t.Errorf("author:hedayat: got %v, want [1]", got)
+	}
+	if got := search(t, idx, "title:hedayat"); !equalIDs(got, []uint{3}) {
+		t.Errorf("title:hedayat: got %v, want [3]", got)
+	}
+	if got := search(t, idx, "tags:poetry"); !equalIDs(got, []uint{2}) {
+		t.Errorf("tags:poetry: got %v, want [2]", got)
+	}
+	if got := search(t, idx, "isbn:9780802131800"); !equalIDs(got, []uint{1}) {
+		t.Errorf("isbn: got %v, want [1]", got)
+	}
+	if got := search(t, idx, "isbn:978-0-8021*"); !equalIDs(got, []uint{1}) {
+		t.Errorf("isbn prefix: got %v, want [1]", got)
+	}
+}
+
+func TestMemoryIndexPersian(t *testing.T) {
+	idx := newTestIndex(t, catalogue...)
+	// an Arabic kaf finds the Persian spelling
+	if got := search(t, idx, "بوف كور"); !equalIDs(got, []uint{4}) {
+		t.Errorf("got %v, want [4]", got)
+	}
+	if got := search(t, idx, "author:هدای*"); !equalIDs(got, []uint{4}) {
+		t.Errorf("got %v, want [4]", got)
+	}
+}
+
+func TestMemoryIndexReindexAndRemove(t *testing.T) {
+	idx := newTestIndex(t, catalogue...)
+	ctx := context.Background()
+
+	if err := idx.Index(ctx, Document{ID: 2, Title: "Divan", Author: "Hafez"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := search(t, idx, "shahnameh"); len(got) != 0 {
+		t.Errorf("old tokens still indexed: %v", got)
+	}
+	if got := search(t, idx, "hafez"); !equalIDs(got, []uint{2}) {
+		t.Errorf("hafez: got %v, want [2]", got)
+	}
+
+	if err := idx.Remove(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := search(t, idx, "owl"); !equalIDs(got, []uint{3}) {
+		t.Errorf("after remove: got %v, want [3]", got)
+	}
+}
+
+func TestMemoryIndexLimit(t *testing.T) {
+	idx := newTestIndex(t, catalogue...)
+	hits, err := idx.Search(context.Background(), ParseQuery("the"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 {
+		t.Errorf("got %d hits, want 1", len(hits))
+	}
+	if hits, _ := idx.Search(context.Background(), Query{}, 0); hits != nil {
+		t.Errorf("empty query returned %v", hits)
+	}
+}
@@ -0,0 +1,141 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SearchDocument stores the normalized text of a book so that MySQL FULLTEXT
+// matching sees the same Persian/Arabic normalization as queries do.
+type SearchDocument struct {
+	BookID      uint   `gorm:"primaryKey;autoIncrement:false"`
+	Title       string `gorm:"type:varchar(200);index:ft_search_all,class:FULLTEXT;index:ft_search_title,class:FULLTEXT"`
+	Author      string `gorm:"type:varchar(150);index:ft_search_all,class:FULLTEXT;index:ft_search_author,class:FULLTEXT"`
+	ISBN        string `gorm:"type:varchar(20);index"`
+	Tags        string `gorm:"type:varchar(255);index:ft_search_all,class:FULLTEXT;index:ft_search_tags,class:FULLTEXT"`
+	Description string `gorm:"type:text;index:ft_search_all,class:FULLTEXT;index:ft_search_description,class:FULLTEXT"`
+}
+
+func (SearchDocument) TableName() string { return "book_search_documents" }
+
+// ftColumns maps a field to the FULLTEXT index columns used to match it;
+// MATCH() must name exactly the columns of one FULLTEXT index.
+var ftColumns = map[string]string{
+	"":               "title, author, tags, description",
+	FieldTitle:       "title",
+	FieldAuthor:      "author",
+	FieldTags:        "tags",
+	FieldDescription: "description",
+}
+
+// MySQLIndex searches with MySQL FULLTEXT indexes in BOOLEAN MODE.
+type MySQLIndex struct {
+	db *gorm.DB
+}
+
+func NewMySQLIndex(db *gorm.DB) *MySQLIndex {
+	return &MySQLIndex{db: db}
+}
+
+func (m *MySQLIndex) Index(ctx context.Context, doc Document) error {
+	row := SearchDocument{
+		BookID:      doc.ID,
+		Title:       strings.Join(Tokenize(doc.Title), " "),
+		Author:      strings.Join(Tokenize(doc.Author), " "),
+		ISBN:        NormalizeISBN(doc.ISBN),
+		Tags:        strings.Join(Tokenize(doc.Tags), " "),
+		Description: strings.Join(Tokenize(doc.Description), " "),
+	}
+	return m.db.WithContext(ctx).
+		Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(&row).Error
+}
+
+func (m *MySQLIndex) Remove(ctx context.Context, id uint) error {
+	return m.db.WithContext(ctx).Delete(&SearchDocument{}, id).Error
+}
+
+func (m *MySQLIndex) Search(ctx context.Context, q Query, limit int) ([]Hit, error) {
+	if q.Empty() {
+		return nil, nil
+	}
+
+	// one boolean expression per FULLTEXT index, ISBN terms as plain predicates
+	exprs := make(map[string][]string)
+	var where []string
+	var whereArgs []any
+	for _, t := range q.Terms {
+		if t.Field == FieldISBN {
+			if t.Prefix {
+				where = append(where, "isbn LIKE ?")
+				whereArgs = append(whereArgs, t.Text+"%")
+			} else {
+				where = append(where, "isbn = ?")
+				whereArgs = append(whereArgs, t.Text)
+			}
+			continue
+		}
+		word := "+" + booleanEscape(t.Text)
+		if t.Prefix {
+			word += "*"
+		}
+		exprs[t.Field] = append(exprs[t.Field], word)
+	}
+
+	var scoreParts []string
+	var scoreArgs []any
+	for field, words := range exprs {
+		match := fmt.Sprintf("MATCH(%s) AGAINST (? IN BOOLEAN MODE)", ftColumns[field])
+		expr := strings.Join(words, " ")
+		weight := 1.0
+		if field != "" {
+			weight = fieldWeights[field]
+		}
+		scoreParts = append(scoreParts, fmt.Sprintf("%g * %s", weight, match))
+		scoreArgs = append(scoreArgs, expr)
+		where = append(where, match)
+		whereArgs = append(whereArgs, expr)
+	}
+	score := "1"
+	if len(scoreParts) > 0 {
+		score = strings.Join(scoreParts, " + ")
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+
+	var rows []struct {
+		BookID uint
+		Score  float64
+	}
+	err := m.db.WithContext(ctx).
+		Model(&SearchDocument{}).
+		Select("book_id, "+score+" AS score", scoreArgs...).
+		Where(strings.Join(where, " AND "), whereArgs...).
+		Order("score DESC, book_id ASC").
+		Limit(limit).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make([]Hit, len(rows))
+	for i, r := range rows {
+		hits[i] = Hit{ID: r.BookID, Score: r.Score}
+	}
+	return hits, nil
+}
+
+// booleanEscape drops characters that are operators in BOOLEAN MODE.
+func booleanEscape(s string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`+-<>()~*"@`, r) {
+			return -1
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,57 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// persianReplacer unifies Arabic and Persian variants of the same letter and
+// maps Persian/Arabic-Indic digits to ASCII so that "كتاب", "کتاب" and
+// "۱۹۸۴"/"1984" index to the same tokens.
+var persianReplacer = strings.NewReplacer(
+	"ي", "ی", "ى", "ی", "ئ", "ی",
+	"ك", "ک",
+	"ة", "ه", "ۀ", "ه",
+	"أ", "ا", "إ", "ا", "آ", "ا", "ٱ", "ا",
+	"ؤ", "و",
+	"‌", " ", // ZWNJ (نیم‌فاصله)
+	"ـ", "", // tatweel
+	"۰", "0", "۱", "1", "۲", "2", "۳", "3", "۴", "4",
+	"۵", "5", "۶", "6", "۷", "7", "۸", "8", "۹", "9",
+	"٠", "0", "١", "1", "٢", "2", "٣", "3", "٤", "4",
+	"٥", "5", "٦", "6", "٧", "7", "٨", "8", "٩", "9",
+)
+
+// Normalize lower-cases text, unifies Persian/Arabic characters and strips
+// diacritics (harakat).
+func Normalize(s string) string {
+	s = persianReplacer.Replace(s)
+	s = strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Mn, r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, s)
+	return s
+}
+
+// Tokenize normalizes text and splits it into words.
+func Tokenize(s string) []string {
+	return strings.FieldsFunc(Normalize(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// NormalizeISBN keeps only digits and the X check character.
+func NormalizeISBN(s string) string {
+	var b strings.Builder
+	for _, r := range Normalize(s) {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == 'x':
+			b.WriteRune('x')
+		}
+	}
+	return b.String()
+}
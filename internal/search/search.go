@@ -0,0 +1,114 @@
+// Package search provides full-text search over the book catalogue behind a
+// pluggable Index: MySQLIndex for production and MemoryIndex for tests and
+// deployments without MySQL FULLTEXT support.
+package search
+
+import (
+	"context"
+	"strings"
+)
+
+const (
+	FieldTitle       = "title"
+	FieldAuthor      = "author"
+	FieldISBN        = "isbn"
+	FieldTags        = "tags"
+	FieldDescription = "description"
+)
+
+// fieldWeights controls how much a match in each field contributes to the
+// relevance score.
+var fieldWeights = map[string]float64{
+	FieldTitle:       3,
+	FieldAuthor:      2,
+	FieldISBN:        5,
+	FieldTags:        1.5,
+	FieldDescription: 1,
+}
+
+// Document is the searchable view of a book.
+type Document struct {
+	ID          uint
+	Title       string
+	Author      string
+	ISBN        string
+	Tags        string
+	Description string
+}
+
+func (d Document) field(name string) string {
+	switch name {
+	case FieldTitle:
+		return d.Title
+	case FieldAuthor:
+		return d.Author
+	case FieldISBN:
+		return d.ISBN
+	case FieldTags:
+		return d.Tags
+	case FieldDescription:
+		return d.Description
+	}
+	return ""
+}
+
+// Term is a single normalized query word. An empty Field matches any field.
+type Term struct {
+	Field  string
+	Text   string
+	Prefix bool
+}
+
+type Query struct {
+	Terms []Term
+}
+
+func (q Query) Empty() bool { return len(q.Terms) == 0 }
+
+type Hit struct {
+	ID    uint
+	Score float64
+}
+
+// Index is implemented by every search backend. Search returns hits ordered
+// by descending score; every term of the query must match.
+type Index interface {
+	Index(ctx context.Context, doc Document) error
+	Remove(ctx context.Context, id uint) error
+	Search(ctx context.Context, q Query, limit int) ([]Hit, error)
+}
+
+// ParseQuery understands free words, field-scoped words (author:hedayat,
+// isbn:978-600-...) and trailing-star prefixes (shah*).
+//
+//	ParseQuery(`author:hedayat بوف*`)
+func ParseQuery(raw string) Query {
+	var q Query
+	for _, part := range strings.Fields(raw) {
+		field := ""
+		if i := strings.IndexByte(part, ':'); i > 0 {
+			if _, ok := fieldWeights[strings.ToLower(part[:i])]; ok {
+				field = strings.ToLower(part[:i])
+				part = part[i+1:]
+			}
+		}
+		prefix := strings.HasSuffix(part, "*")
+		part = strings.TrimRight(part, "*")
+
+		if field == FieldISBN {
+			if isbn := NormalizeISBN(part); isbn != "" {
+				q.Terms = append(q.Terms, Term{Field: field, Text: isbn, Prefix: prefix})
+			}
+			continue
+		}
+		tokens := Tokenize(part)
+		for i, tok := range tokens {
+			q.Terms = append(q.Terms, Term{
+				Field:  field,
+				Text:   tok,
+				Prefix: prefix && i == len(tokens)-1,
+			})
+		}
+	}
+	return q
+}
@@ -0,0 +1,79 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Hello World", "hello world"},
+		{"كتاب", "کتاب"},     // Arabic kaf
+		{"علي", "علی"},       // Arabic yeh
+		{"۱۹۸۴", "1984"},     // Persian digits
+		{"١٩٨٤", "1984"},     // Arabic-Indic digits
+		{"آسمان", "اسمان"},   // alef with madda
+		{"كِتابٌ", "کتاب"},   // harakat are dropped
+		{"می‌روم", "می روم"}, // ZWNJ splits words
+		{"کتـــاب", "کتاب"},  // tatweel
+		{"مدرسة", "مدرسه"},   // teh marbuta
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.in); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize("Bouf-e Koor, (Hedayat) ۱۳۱۵!")
+	want := []string{"bouf", "e", "koor", "hedayat", "1315"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Tokenize = %q, want %q", got, want)
+	}
+}
+
+func TestNormalizeISBN(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"978-600-119-123-4", "9786001191234"},
+		{"0-306-40615-X", "030640615x"},
+		{"۹۷۸ ۶۰۰", "978600"},
+		{"n/a", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeISBN(tt.in); got != tt.want {
+			t.Errorf("NormalizeISBN(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want []Term
+	}{
+		{"", nil},
+		{"blind owl", []Term{{Text: "blind"}, {Text: "owl"}}},
+		{"author:Hedayat", []Term{{Field: FieldAuthor, Text: "hedayat"}}},
+		{"TITLE:owl", []Term{{Field: FieldTitle, Text: "owl"}}},
+		{"shah*", []Term{{Text: "shah", Prefix: true}}},
+		{"author:hed*", []Term{{Field: FieldAuthor, Text: "hed", Prefix: true}}},
+		{"isbn:978-600-119", []Term{{Field: FieldISBN, Text: "978600119"}}},
+		{"isbn:---", nil},
+		// an unknown field name is searched as a plain word
+		{"foo:bar", []Term{{Text: "foo"}, {Text: "bar"}}},
+		// only the last token of a split word is a prefix
+		{"bouf-e*", []Term{{Text: "bouf"}, {Text: "e", Prefix: true}}},
+		{"كتاب", []Term{{Text: "کتاب"}}},
+	}
+	for _, tt := range tests {
+		got := ParseQuery(tt.raw)
+		if !reflect.DeepEqual(got.Terms, tt.want) {
+			t.Errorf("ParseQuery(%q) = %+v, want %+v", tt.raw, got.Terms, tt.want)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package users
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -11,13 +12,30 @@ import (
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
 
+	"github.com/erfnzmn/Library_Management_System/pkg/mail"
+	"github.com/erfnzmn/Library_Management_System/pkg/middleware"
 	"github.com/erfnzmn/Library_Management_System/pkg/rate"
 )
 
 type Handler struct {
-	svc       *Service
-	jwtSecret string
-	jwtTTL    time.Duration
+	svc        *Service
+	jwtSecret  string
+	jwtTTL     time.Duration
+	refreshTTL time.Duration
+	resetTTL   time.Duration
+	resetURL   string
+	mailer     mail.Sender
+}
+
+// RouteConfig تنظیمات ماژول کاربران
+type RouteConfig struct {
+	JWTSecret  string
+	JWTTTL     time.Duration
+	RefreshTTL time.Duration
+	ResetTTL   time.Duration
+	// ResetURL صفحهٔ فرانت‌اند؛ توکن به صورت ?token= به آن اضافه می‌شود
+	ResetURL string
+	Mailer   mail.Sender
 }
 
 // normalize email (for consistent limiter keys)
@@ -25,15 +43,41 @@ func normalizeEmail(s string) string {
 	return strings.TrimSpace(strings.ToLower(s))
 }
 
-func RegisterUserRoutes(e *echo.Echo, db *gorm.DB, jwtSecret string, jwtTTL time.Duration) {
-	_ = db.AutoMigrate(&User{})
+func RegisterUserRoutes(e *echo.Echo, db *gorm.DB, cfg RouteConfig) {
+	_ = db.AutoMigrate(&User{}, &RefreshToken{}, &PasswordReset{})
 
 	repo := NewRepository(db)
 	svc := NewService(repo)
-	h := &Handler{svc: svc, jwtSecret: jwtSecret, jwtTTL: jwtTTL}
+	h := &Handler{
+		svc:        svc,
+		jwtSecret:  cfg.JWTSecret,
+		jwtTTL:     cfg.JWTTTL,
+		refreshTTL: cfg.RefreshTTL,
+		resetTTL:   cfg.ResetTTL,
+		resetURL:   cfg.ResetURL,
+		mailer:     cfg.Mailer,
+	}
+	jwtSecret := cfg.JWTSecret
 
 	e.POST("/users/signup", h.Signup)
 	e.POST("/users/login", h.Login)
+	e.POST("/users/refresh", h.Refresh)
+	e.POST("/users/password/forgot", h.ForgotPassword)
+	e.POST("/users/password/reset", h.ResetPassword)
+
+	auth := middleware.JWT(jwtSecret)
+	e.POST("/users/logout", h.Logout, auth)
+	e.POST("/users/logout/all", h.LogoutAll, auth)
+
+	// مدیریت کاربران — فقط ادمین
+	admin := []echo.MiddlewareFunc{
+		middleware.JWT(jwtSecret),
+		middleware.RequirePermission(middleware.PermUsersManage),
+	}
+	e.POST("/users", h.CreateUser, admin...)
+	e.PUT("/users/:id/role", h.SetRole, admin...)
+	e.PUT("/users/:id/block", h.Block, admin...)
+	e.DELETE("/users/:id/block", h.Unblock, admin...)
 }
 
 // helper to fetch loginLimiter from Echo context
@@ -46,6 +90,16 @@ func getLoginLimiter(c echo.Context) *rate.Limiter {
 	return nil
 }
 
+// helper to fetch passwordResetLimiter from Echo context
+func getResetLimiter(c echo.Context) *rate.Limiter {
+	if v := c.Get("passwordResetLimiter"); v != nil {
+		if lim, ok := v.(*rate.Limiter); ok {
+			return lim
+		}
+	}
+	return nil
+}
+
 // -------------------- Signup (no limiter) --------------------
 func (h *Handler) Signup(c echo.Context) error {
 	var req SignupRequest
@@ -61,7 +115,7 @@ func (h *Handler) Signup(c echo.Context) error {
 			"detail": "name/email/password/role required",
 		})
 	}
-	if !IsValidRole(req.Role) {
+	if !IsSelfServiceRole(req.Role) {
 		return c.JSON(http.StatusBadRequest, echo.Map{
 			"error":  "invalid role",
 			"detail": "role must be 'member' or 'student'",
@@ -80,19 +134,196 @@ func (h *Handler) Signup(c echo.Context) error {
 		return c.JSON(status, echo.Map{"error": err.Error()})
 	}
 
-	token, expSec, err := h.createJWT(u.ID, u.Role)
+	return h.issueTokens(c, http.StatusCreated, u)
+}
+
+// -------------------- Forgot password (with limiter) --------------------
+// پاسخ همیشه یکسان است تا وجود یا عدم وجود ایمیل لو نرود
+func (h *Handler) ForgotPassword(c echo.Context) error {
+	var req ForgotPasswordRequest
+	if err := c.Bind(&req); err != nil || req.Email == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "invalid request",
+			"detail": "email required",
+		})
+	}
+
+	if h.mailer == nil {
+		return c.JSON(http.StatusServiceUnavailable, echo.Map{"error": "password recovery is not configured"})
+	}
+	accepted := echo.Map{"message": "if the account exists, a reset link has been sent"}
+
+	email := normalizeEmail(req.Email)
+	ctx := c.Request().Context()
+	if lim := getResetLimiter(c); lim != nil {
+		for _, key := range []string{"pwreset:email:" + email, "pwreset:ip:" + c.RealIP()} {
+			if blocked, retry, err := lim.TooMany(ctx, key); err == nil && blocked {
+				c.Response().Header().Set("Retry-After", fmt.Sprintf("%d", retry))
+				return c.JSON(http.StatusTooManyRequests, echo.Map{
+					"error":           "TOO_MANY_RESET_REQUESTS",
+					"retry_after_sec": retry,
+				})
+			}
+		}
+	}
+
+	u, token, err := h.svc.RequestPasswordReset(email, h.resetTTL)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{
-			"error": "token generation failed",
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	if u == nil {
+		return c.JSON(http.StatusAccepted, accepted)
+	}
+
+	link := h.resetURL + "?token=" + url.QueryEscape(token)
+	msg := mail.Message{
+		To:      u.Email,
+		Subject: "بازیابی رمز عبور / Password reset",
+		Text: fmt.Sprintf("سلام %s،\n\nبرای تعیین رمز جدید روی لینک زیر بزنید (اعتبار: %s):\n%s\n\n"+
+			"To choose a new password open the link above. If you did not ask for this, ignore this email.\n",
+			u.Name, h.resetTTL, link),
+	}
+	if err := h.mailer.Send(ctx, msg); err != nil {
+		c.Logger().Errorf("password reset mail to user %d: %v", u.ID, err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "failed to send reset email"})
+	}
+	return c.JSON(http.StatusAccepted, accepted)
+}
+
+// -------------------- Reset password --------------------
+func (h *Handler) ResetPassword(c echo.Context) error {
+	var req ResetPasswordRequest
+	if err := c.Bind(&req); err != nil || req.Token == "" || req.Password == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "invalid request",
+			"detail": "token/password required",
 		})
 	}
 
-	return c.JSON(http.StatusCreated, echo.Map{
-		"access_token": token,
-		"token_type":   "Bearer",
-		"expires_in":   expSec,
-		"user":         u,
-	})
+	u, err := h.svc.ResetPassword(req.Token, req.Password)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch err {
+		case ErrInvalidResetToken:
+			status = http.StatusBadRequest
+		case ErrWeakPassword:
+			status = http.StatusBadRequest
+		}
+		return c.JSON(status, echo.Map{"error": err.Error()})
+	}
+
+	// access tokenهای قبلی هم دیگر معتبر نیستند
+	if d := middleware.GetDenylist(c); d != nil && u != nil {
+		if err := d.RevokeUser(c.Request().Context(), u.ID, time.Now(), h.jwtTTL); err != nil {
+			c.Logger().Warnf("denylist: %v", err)
+		}
+	}
+	return c.JSON(http.StatusOK, echo.Map{"message": "password updated, please log in again"})
+}
+
+// -------------------- Admin: create user with any role --------------------
+func (h *Handler) CreateUser(c echo.Context) error {
+	var req CreateUserRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "invalid request",
+			"detail": err.Error(),
+		})
+	}
+	if req.Name == "" || req.Email == "" || req.Password == "" || req.Role == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "invalid request",
+			"detail": "name/email/password/role required",
+		})
+	}
+
+	u, err := h.svc.CreateUser(req.Name, normalizeEmail(req.Email), req.Password, req.Role)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch err {
+		case ErrEmailInUse:
+			status = http.StatusConflict
+		case ErrWeakPassword, ErrInvalidRole:
+			status = http.StatusBadRequest
+		}
+		return c.JSON(status, echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, u)
+}
+
+// -------------------- Admin: change role --------------------
+func (h *Handler) SetRole(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid user id"})
+	}
+	var req SetRoleRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "invalid request",
+			"detail": err.Error(),
+		})
+	}
+
+	u, err := h.svc.SetRole(uint(id), req.Role)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch err {
+		case ErrUserNotFound:
+			status = http.StatusNotFound
+		case ErrInvalidRole:
+			status = http.StatusBadRequest
+		}
+		return c.JSON(status, echo.Map{"error": err.Error()})
+	}
+	h.revokeAccessTokens(c, u.ID)
+	return c.JSON(http.StatusOK, u)
+}
+
+// -------------------- Admin: block / unblock --------------------
+func (h *Handler) Block(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid user id"})
+	}
+	var req BlockRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid request"})
+	}
+	return h.setBlocked(c, uint(id), true, req.Reason)
+}
+
+func (h *Handler) Unblock(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid user id"})
+	}
+	return h.setBlocked(c, uint(id), false, "")
+}
+
+func (h *Handler) setBlocked(c echo.Context, id uint, blocked bool, reason string) error {
+	u, err := h.svc.SetBlocked(id, blocked, reason)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == ErrUserNotFound {
+			status = http.StatusNotFound
+		}
+		return c.JSON(status, echo.Map{"error": err.Error()})
+	}
+	if blocked {
+		h.revokeAccessTokens(c, u.ID)
+	}
+	return c.JSON(http.StatusOK, u)
+}
+
+// revokeAccessTokens: access tokenهای صادرشده تا این لحظه برای کاربر باطل می‌شوند
+// (بعد از تغییر نقش یا مسدود شدن، نقش و وضعیت قدیمی در توکن مانده است)
+func (h *Handler) revokeAccessTokens(c echo.Context, userID uint) {
+	if d := middleware.GetDenylist(c); d != nil {
+		if err := d.RevokeUser(c.Request().Context(), userID, time.Now(), h.jwtTTL); err != nil {
+			c.Logger().Warnf("denylist: %v", err)
+		}
+	}
 }
 
 // -------------------- Login (with limiter) --------------------
@@ -139,28 +370,124 @@ func (h *Handler) Login(c echo.Context) error {
 
 	// successful login -> reset limiter
 
+	return h.issueTokens(c, http.StatusOK, u)
+}
+
+// -------------------- Refresh (rotation) --------------------
+func (h *Handler) Refresh(c echo.Context) error {
+	var req RefreshRequest
+	if err := c.Bind(&req); err != nil || req.RefreshToken == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{
+			"error":  "invalid request",
+			"detail": "refresh_token required",
+		})
+	}
+
+	u, refresh, err := h.svc.Refresh(req.RefreshToken, h.refreshTTL)
+	if err != nil {
+		switch err {
+		case ErrInvalidRefreshToken:
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": err.Error()})
+		case ErrRefreshTokenReused:
+			// کل خانواده باطل شد؛ کاربر باید دوباره لاگین کند
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "REFRESH_TOKEN_REUSED"})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+
 	token, expSec, err := h.createJWT(u.ID, u.Role)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{
 			"error": "token generation failed",
 		})
 	}
-
 	return c.JSON(http.StatusOK, echo.Map{
-		"access_token": token,
-		"token_type":   "Bearer",
-		"expires_in":   expSec,
-		"user":         u,
+		"access_token":  token,
+		"refresh_token": refresh,
+		"token_type":    "Bearer",
+		"expires_in":    expSec,
+		"user":          u,
 	})
 }
 
+// -------------------- Logout --------------------
+// access token فعلی در denylist می‌رود و refresh token (اگر داده شود) باطل می‌شود
+func (h *Handler) Logout(c echo.Context) error {
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid or missing token"})
+	}
+	var req RefreshRequest
+	_ = c.Bind(&req)
+	if req.RefreshToken != "" {
+		if err := h.svc.RevokeRefreshToken(userID, req.RefreshToken); err != nil && err != ErrInvalidRefreshToken {
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+	}
+
+	if d := middleware.GetDenylist(c); d != nil {
+		jti, exp, err := middleware.TokenID(c)
+		if err == nil {
+			if err := d.RevokeToken(c.Request().Context(), jti, exp); err != nil {
+				c.Logger().Warnf("denylist: %v", err)
+			}
+		}
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// LogoutAll: همهٔ refresh tokenها و همهٔ access tokenهای صادرشده تا این لحظه باطل می‌شوند
+func (h *Handler) LogoutAll(c echo.Context) error {
+	userID, err := middleware.CurrentUserID(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid or missing token"})
+	}
+	if err := h.svc.RevokeAllSessions(userID); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	if d := middleware.GetDenylist(c); d != nil {
+		if err := d.RevokeUser(c.Request().Context(), userID, time.Now(), h.jwtTTL); err != nil {
+			c.Logger().Warnf("denylist: %v", err)
+		}
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
 // -------------------- JWT helper --------------------
+func (h *Handler) issueTokens(c echo.Context, status int, u *User) error {
+	token, expSec, err := h.createJWT(u.ID, u.Role)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"error": "token generation failed",
+		})
+	}
+	refresh, err := h.svc.IssueRefreshToken(u.ID, h.refreshTTL)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{
+			"error": "token generation failed",
+		})
+	}
+
+	return c.JSON(status, echo.Map{
+		"access_token":  token,
+		"refresh_token": refresh,
+		"token_type":    "Bearer",
+		"expires_in":    expSec,
+		"user":          u,
+	})
+}
+
 func (h *Handler) createJWT(userID uint, role string) (string, int64, error) {
 	now := time.Now()
 	exp := now.Add(h.jwtTTL)
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", 0, err
+	}
 	claims := jwt.MapClaims{
 		"sub":  strconv.Itoa(int(userID)),
 		"role": role,
+		"jti":  jti,
 		"iat":  now.Unix(),
 		"exp":  exp.Unix(),
 	}
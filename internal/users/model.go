@@ -7,11 +7,22 @@ import (
 )
 
 const (
-	RoleMember  = "member"
-	RoleStudent = "student"
+	RoleAdmin     = "admin"
+	RoleLibrarian = "librarian"
+	RoleMember    = "member"
+	RoleStudent   = "student"
 )
 
 func IsValidRole(role string) bool {
+	switch role {
+	case RoleAdmin, RoleLibrarian, RoleMember, RoleStudent:
+		return true
+	}
+	return false
+}
+
+// IsSelfServiceRole: نقش‌هایی که کاربر خودش در ثبت‌نام می‌تواند انتخاب کند
+func IsSelfServiceRole(role string) bool {
 	return role == RoleMember || role == RoleStudent
 }
 
@@ -22,6 +33,8 @@ type User struct {
 	Email        string         `gorm:"size:190;not null;uniqueIndex" json:"email"`
 	PasswordHash string         `gorm:"size:255;not null" json:"-"`
 	Role         string         `gorm:"size:20;not null;default:member" json:"role"`
+	BlockedAt    *time.Time     `json:"blocked_at,omitempty"` // کاربر مسدود نمی‌تواند امانت بگیرد یا تمدید کند
+	BlockReason  string         `gorm:"size:255" json:"block_reason,omitempty"`
 	CreatedAt    time.Time      `json:"created_at"`
 	UpdatedAt    time.Time      `json:"updated_at"`
 	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
@@ -29,6 +42,47 @@ type User struct {
 
 func (User) TableName() string { return "users" }
 
+// RefreshToken فقط هش توکن را نگه می‌دارد. توکن‌هایی که از یک لاگین
+// چرخش پیدا کرده‌اند FamilyID مشترک دارند تا در صورت استفادهٔ مجدد
+// از توکن باطل‌شده، کل زنجیره باطل شود.
+type RefreshToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	TokenHash  string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	FamilyID   string     `gorm:"size:36;not null;index" json:"family_id"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	ReplacedBy *uint      `json:"replaced_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (RefreshToken) TableName() string { return "refresh_tokens" }
+
+// PasswordReset توکن یک‌بارمصرف بازیابی رمز (فقط هش ذخیره می‌شود)
+type PasswordReset struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	TokenHash string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (PasswordReset) TableName() string { return "password_resets" }
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 // ورودیِ ثبت‌نام
 type SignupRequest struct {
 	Name     string `json:"name" binding:"required"`
@@ -38,6 +92,22 @@ type SignupRequest struct {
 
 }
 
+// ورودیِ ساخت کاربر توسط ادمین (هر نقشی مجاز است)
+type CreateUserRequest struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Role     string `json:"role"` // admin | librarian | member | student
+}
+
+type SetRoleRequest struct {
+	Role string `json:"role"`
+}
+
+type BlockRequest struct {
+	Reason string `json:"reason"`
+}
+
 // ورودیِ لاگین
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
@@ -2,13 +2,27 @@ package users
 
 import (
 	"errors"
+	"time"
 
 	"gorm.io/gorm"
 )
 
 type Repository interface {
 	Create(u *User) error
+	Update(u *User) error
 	FindByEmail(email string) (*User, error)
+	FindByID(id uint) (*User, error)
+	CountByRole(role string) (int64, error)
+
+	CreateRefreshToken(t *RefreshToken) error
+	FindRefreshToken(hash string) (*RefreshToken, error)
+	RotateRefreshToken(old *RefreshToken, next *RefreshToken) error
+	RevokeRefreshFamily(familyID string) error
+	RevokeUserRefreshTokens(userID uint) error
+
+	CreatePasswordReset(pr *PasswordReset) error
+	FindPasswordReset(hash string) (*PasswordReset, error)
+	ConsumePasswordReset(pr *PasswordReset, newHash string) error
 }
 
 type gormRepository struct{ db *gorm.DB }
@@ -27,3 +41,104 @@ func (r *gormRepository) FindByEmail(email string) (*User, error) {
 	}
 	return &u, err
 }
+
+func (r *gormRepository) Update(u *User) error {
+	return r.db.Save(u).Error
+}
+
+func (r *gormRepository) FindByID(id uint) (*User, error) {
+	var u User
+	err := r.db.First(&u, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &u, err
+}
+
+func (r *gormRepository) CountByRole(role string) (int64, error) {
+	var n int64
+	err := r.db.Model(&User{}).Where("role = ?", role).Count(&n).Error
+	return n, err
+}
+
+func (r *gormRepository) CreateRefreshToken(t *RefreshToken) error {
+	return r.db.Create(t).Error
+}
+
+func (r *gormRepository) FindRefreshToken(hash string) (*RefreshToken, error) {
+	var t RefreshToken
+	err := r.db.Where("token_hash = ?", hash).First(&t).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &t, err
+}
+
+// RotateRefreshToken revokes old and stores next in one transaction. The
+// conditional update makes a concurrent second rotation of old fail.
+func (r *gormRepository) RotateRefreshToken(old *RefreshToken, next *RefreshToken) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(next).Error; err != nil {
+			return err
+		}
+		res := tx.Model(&RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", old.ID).
+			Updates(map[string]any{"revoked_at": time.Now(), "replaced_by": next.ID})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+		return nil
+	})
+}
+
+func (r *gormRepository) RevokeRefreshFamily(familyID string) error {
+	return r.db.Model(&RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *gormRepository) RevokeUserRefreshTokens(userID uint) error {
+	return r.db.Model(&RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *gormRepository) CreatePasswordReset(pr *PasswordReset) error {
+	return r.db.Create(pr).Error
+}
+
+func (r *gormRepository) FindPasswordReset(hash string) (*PasswordReset, error) {
+	var pr PasswordReset
+	err := r.db.Where("token_hash = ?", hash).First(&pr).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &pr, err
+}
+
+// ConsumePasswordReset marks the token used, sets the new password and voids
+// every other outstanding reset token of the user, atomically.
+func (r *gormRepository) ConsumePasswordReset(pr *PasswordReset, newHash string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		res := tx.Model(&PasswordReset{}).
+			Where("id = ? AND used_at IS NULL", pr.ID).
+			Update("used_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrInvalidResetToken
+		}
+		if err := tx.Model(&User{}).Where("id = ?", pr.UserID).
+			Update("password_hash", newHash).Error; err != nil {
+			return err
+		}
+		return tx.Model(&PasswordReset{}).
+			Where("user_id = ? AND used_at IS NULL", pr.UserID).
+			Update("used_at", now).Error
+	})
+}
@@ -1,8 +1,14 @@
 package users
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"strings"
+	"time"
 	"unicode"
 
 	"golang.org/x/crypto/bcrypt"
@@ -13,6 +19,11 @@ var (
 	ErrWeakPassword = errors.New("password does not meet policy requirements")
 	ErrInvalidLogin = errors.New("invalid email or password")
 	ErrInvalidRole  = errors.New("invalid role")
+	ErrUserNotFound = errors.New("user not found")
+
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+	ErrInvalidResetToken   = errors.New("invalid, expired or already used reset token")
 
 
 )
@@ -25,8 +36,17 @@ func NewService(repo Repository) *Service {
 	return &Service{repo: repo}
 }
 
-// Signup: قوانین ثبت‌نام
+// Signup: قوانین ثبت‌نام — فقط نقش‌های member و student
 func (s *Service) Signup(name, email, password, role string) (*User, error) {
+	role = strings.ToLower(strings.TrimSpace(role))
+	if !IsSelfServiceRole(role) {
+		return nil, ErrInvalidRole
+	}
+	return s.CreateUser(name, email, password, role)
+}
+
+// CreateUser: ساخت کاربر با هر نقش معتبر (برای ادمین و bootstrap)
+func (s *Service) CreateUser(name, email, password, role string) (*User, error) {
 	email = strings.ToLower(strings.TrimSpace(email))
 	role = strings.ToLower(strings.TrimSpace(role))
 
@@ -85,6 +105,282 @@ func (s *Service) Login(email, password string) (*User, error) {
     return u, nil
 }
 
+func (s *Service) SetRole(userID uint, role string) (*User, error) {
+	role = strings.ToLower(strings.TrimSpace(role))
+	if !IsValidRole(role) {
+		return nil, ErrInvalidRole
+	}
+	u, err := s.repo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, ErrUserNotFound
+	}
+	changed := u.Role != role
+	u.Role = role
+	if err := s.repo.Update(u); err != nil {
+		return nil, err
+	}
+	// نشست‌های قبلی نقش قدیمی را در توکن دارند
+	if changed {
+		if err := s.repo.RevokeUserRefreshTokens(u.ID); err != nil {
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+// UserRole نقش کاربر را برمی‌گرداند (برای اولویت صف رزرو در ماژول امانت)
+func (s *Service) UserRole(ctx context.Context, userID uint) (string, error) {
+	u, err := s.repo.FindByID(userID)
+	if err != nil {
+		return "", err
+	}
+	if u == nil {
+		return "", ErrUserNotFound
+	}
+	return u.Role, nil
+}
+
+// DisplayName نام کاربر برای چاپ روی فاکتور و رسید
+func (s *Service) DisplayName(ctx context.Context, userID uint) (string, error) {
+	u, err := s.repo.FindByID(userID)
+	if err != nil {
+		return "", err
+	}
+	if u == nil {
+		return "", ErrUserNotFound
+	}
+	return u.Name, nil
+}
+
+// IsBlocked برای ماژول امانت: آیا کاربر مسدود شده است؟
+func (s *Service) IsBlocked(ctx context.Context, userID uint) (bool, error) {
+	u, err := s.repo.FindByID(userID)
+	if err != nil {
+		return false, err
+	}
+	if u == nil {
+		return false, ErrUserNotFound
+	}
+	return u.BlockedAt != nil, nil
+}
+
+// SetBlocked مسدود کردن یا رفع مسدودیت کاربر توسط ادمین
+func (s *Service) SetBlocked(userID uint, blocked bool, reason string) (*User, error) {
+	u, err := s.repo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, ErrUserNotFound
+	}
+	if blocked {
+		now := time.Now()
+		u.BlockedAt = &now
+		u.BlockReason = strings.TrimSpace(reason)
+	} else {
+		u.BlockedAt = nil
+		u.BlockReason = ""
+	}
+	if err := s.repo.Update(u); err != nil {
+		return nil, err
+	}
+	if blocked {
+		if err := s.repo.RevokeUserRefreshTokens(u.ID); err != nil {
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+// EnsureAdmin: اگر هیچ ادمینی وجود نداشته باشد، اولین ادمین را می‌سازد
+// (یا کاربر موجود با همین ایمیل را ارتقا می‌دهد)
+func (s *Service) EnsureAdmin(name, email, password string) (*User, bool, error) {
+	n, err := s.repo.CountByRole(RoleAdmin)
+	if err != nil {
+		return nil, false, err
+	}
+	if n > 0 {
+		return nil, false, nil
+	}
+	existing, err := s.repo.FindByEmail(strings.ToLower(strings.TrimSpace(email)))
+	if err != nil {
+		return nil, false, err
+	}
+	if existing != nil {
+		u, err := s.SetRole(existing.ID, RoleAdmin)
+		return u, err == nil, err
+	}
+	if name == "" {
+		name = "Administrator"
+	}
+	u, err := s.CreateUser(name, email, password, RoleAdmin)
+	return u, err == nil, err
+}
+
+// -------------------- Refresh tokens --------------------
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+func newFamilyID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:4]) + "-" + hex.EncodeToString(b[4:6]) + "-" +
+		hex.EncodeToString(b[6:8]) + "-" + hex.EncodeToString(b[8:10]) + "-" + hex.EncodeToString(b[10:]), nil
+}
+
+func (s *Service) newRefreshToken(userID uint, familyID string, ttl time.Duration) (string, *RefreshToken, error) {
+	raw, err := randomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	return raw, &RefreshToken{
+		UserID:    userID,
+		TokenHash: hashToken(raw),
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(ttl),
+	}, nil
+}
+
+// IssueRefreshToken: شروع یک خانوادهٔ جدید از توکن‌ها (بعد از لاگین)
+func (s *Service) IssueRefreshToken(userID uint, ttl time.Duration) (string, error) {
+	family, err := newFamilyID()
+	if err != nil {
+		return "", err
+	}
+	raw, t, err := s.newRefreshToken(userID, family, ttl)
+	if err != nil {
+		return "", err
+	}
+	if err := s.repo.CreateRefreshToken(t); err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// Refresh: توکن فعلی باطل و توکن جدید در همان خانواده صادر می‌شود.
+// استفادهٔ مجدد از توکن باطل‌شده یعنی نشت توکن، پس کل خانواده باطل می‌شود.
+func (s *Service) Refresh(raw string, ttl time.Duration) (*User, string, error) {
+	t, err := s.repo.FindRefreshToken(hashToken(raw))
+	if err != nil {
+		return nil, "", err
+	}
+	if t == nil {
+		return nil, "", ErrInvalidRefreshToken
+	}
+	if t.RevokedAt != nil {
+		if err := s.repo.RevokeRefreshFamily(t.FamilyID); err != nil {
+			return nil, "", err
+		}
+		return nil, "", ErrRefreshTokenReused
+	}
+	if time.Now().After(t.ExpiresAt) {
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	u, err := s.repo.FindByID(t.UserID)
+	if err != nil {
+		return nil, "", err
+	}
+	if u == nil {
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	nextRaw, next, err := s.newRefreshToken(t.UserID, t.FamilyID, ttl)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := s.repo.RotateRefreshToken(t, next); err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			_ = s.repo.RevokeRefreshFamily(t.FamilyID)
+		}
+		return nil, "", err
+	}
+	return u, nextRaw, nil
+}
+
+// RevokeRefreshToken: خروج از همین نشست
+func (s *Service) RevokeRefreshToken(userID uint, raw string) error {
+	t, err := s.repo.FindRefreshToken(hashToken(raw))
+	if err != nil {
+		return err
+	}
+	if t == nil || t.UserID != userID {
+		return ErrInvalidRefreshToken
+	}
+	return s.repo.RevokeRefreshFamily(t.FamilyID)
+}
+
+// RevokeAllSessions: خروج از همهٔ دستگاه‌ها
+func (s *Service) RevokeAllSessions(userID uint) error {
+	return s.repo.RevokeUserRefreshTokens(userID)
+}
+
+// -------------------- Password recovery --------------------
+
+// RequestPasswordReset returns a raw single-use token for the account, or
+// a nil user when no account has this email (callers must not reveal that).
+func (s *Service) RequestPasswordReset(email string, ttl time.Duration) (*User, string, error) {
+	u, err := s.repo.FindByEmail(strings.ToLower(strings.TrimSpace(email)))
+	if err != nil || u == nil {
+		return nil, "", err
+	}
+	raw, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	pr := &PasswordReset{
+		UserID:    u.ID,
+		TokenHash: hashToken(raw),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := s.repo.CreatePasswordReset(pr); err != nil {
+		return nil, "", err
+	}
+	return u, raw, nil
+}
+
+// ResetPassword consumes the token, applies the password policy and ends
+// every session (refresh tokens) of the user.
+func (s *Service) ResetPassword(raw, password string) (*User, error) {
+	pr, err := s.repo.FindPasswordReset(hashToken(raw))
+	if err != nil {
+		return nil, err
+	}
+	if pr == nil || pr.UsedAt != nil || time.Now().After(pr.ExpiresAt) {
+		return nil, ErrInvalidResetToken
+	}
+	if !passwordStrong(password) {
+		return nil, ErrWeakPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.ConsumePasswordReset(pr, string(hash)); err != nil {
+		return nil, err
+	}
+	if err := s.repo.RevokeUserRefreshTokens(pr.UserID); err != nil {
+		return nil, err
+	}
+	return s.repo.FindByID(pr.UserID)
+}
+
 func passwordStrong(p string) bool {
 	if len(p) < 8 {
 		return false
@@ -0,0 +1,45 @@
+CREATE TABLE IF NOT EXISTS book_copies (
+  id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  book_id INT UNSIGNED NOT NULL,
+  barcode VARCHAR(64) NOT NULL,
+  shelf_location VARCHAR(100) NULL,
+  `condition` ENUM('new','good','worn','damaged') DEFAULT 'good',
+  acquired_at DATETIME NULL,
+  status ENUM('available','on_loan','reserved','lost','withdrawn') NOT NULL DEFAULT 'available',
+
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  UNIQUE KEY uq_book_copies_barcode (barcode),
+  CONSTRAINT fk_book_copies_book FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_book_copies_book   ON book_copies (book_id);
+CREATE INDEX idx_book_copies_status ON book_copies (status);
+
+ALTER TABLE loans
+  ADD COLUMN copy_id INT UNSIGNED NULL AFTER book_id,
+  ADD INDEX idx_loans_copy (copy_id);
+
+-- one available copy per unit of the old stock counter
+INSERT INTO book_copies (book_id, barcode, status)
+WITH RECURSIVE seq (n) AS (
+  SELECT 1 UNION ALL SELECT n + 1 FROM seq WHERE n < 1000
+)
+SELECT b.id, CONCAT('BK', LPAD(b.id, 6, '0'), '-', LPAD(seq.n, 3, '0')), 'available'
+FROM books b
+JOIN seq ON seq.n <= b.stock;
+
+-- the old counter did not include copies out on open loans: give each one
+-- its own copy and attach it to the loan, so returning it puts it back
+INSERT INTO book_copies (book_id, barcode, status)
+SELECT l.book_id,
+       CONCAT('BK', LPAD(l.book_id, 6, '0'), '-L', l.id),
+       IF(l.status = 'borrowed', 'on_loan', 'reserved')
+FROM loans l
+WHERE l.is_active AND l.status IN ('reserved', 'borrowed');
+
+UPDATE loans l
+JOIN book_copies bc ON bc.barcode = CONCAT('BK', LPAD(l.book_id, 6, '0'), '-L', l.id)
+SET l.copy_id = bc.id
+WHERE l.is_active AND l.status IN ('reserved', 'borrowed');
@@ -0,0 +1,6 @@
+CREATE INDEX idx_books_genre              ON books (genre);
+CREATE INDEX idx_books_language           ON books (language);
+CREATE INDEX idx_books_year               ON books (year_of_publication);
+CREATE INDEX idx_books_price              ON books (price);
+CREATE INDEX idx_books_reservation_status ON books (reservation_status);
+CREATE INDEX idx_books_selling_status     ON books (selling_status);
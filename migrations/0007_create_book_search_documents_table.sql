@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS book_search_documents (
+  book_id INT UNSIGNED PRIMARY KEY,
+  title VARCHAR(200) NULL,
+  author VARCHAR(150) NULL,
+  isbn VARCHAR(20) NULL,
+  tags VARCHAR(255) NULL,
+  description TEXT NULL,
+
+  INDEX idx_book_search_documents_isbn (isbn),
+  FULLTEXT INDEX ft_search_all (title, author, tags, description),
+  FULLTEXT INDEX ft_search_title (title),
+  FULLTEXT INDEX ft_search_author (author),
+  FULLTEXT INDEX ft_search_tags (tags),
+  FULLTEXT INDEX ft_search_description (description),
+
+  CONSTRAINT fk_book_search_documents_book FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
+);
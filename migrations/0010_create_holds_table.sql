@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS holds (
+  id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  user_id INT UNSIGNED NOT NULL,
+  book_id INT UNSIGNED NOT NULL,
+  status ENUM('queued','fulfilled','cancelled') NOT NULL DEFAULT 'queued',
+  priority INT NOT NULL DEFAULT 0,
+  loan_id INT UNSIGNED NULL,
+  queued_at DATETIME NOT NULL,
+  fulfilled_at DATETIME NULL,
+  cancelled_at DATETIME NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  CONSTRAINT fk_holds_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  CONSTRAINT fk_holds_book FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+  CONSTRAINT fk_holds_loan FOREIGN KEY (loan_id) REFERENCES loans(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_holds_queue ON holds (book_id, status);
+CREATE INDEX idx_holds_user ON holds (user_id);
@@ -0,0 +1,5 @@
+ALTER TABLE loans
+  MODIFY COLUMN status ENUM('reserved','borrowed','returned','cancelled','expired') NOT NULL DEFAULT 'reserved',
+  ADD COLUMN expired_at DATETIME NULL AFTER cancelled_at;
+
+CREATE INDEX idx_loans_status_reserved_at ON loans (status, reserved_at);
@@ -0,0 +1,19 @@
+ALTER TABLE loans
+  ADD COLUMN renewal_count INT NOT NULL DEFAULT 0 AFTER expired_at;
+
+ALTER TABLE users
+  ADD COLUMN blocked_at DATETIME NULL,
+  ADD COLUMN block_reason VARCHAR(255) NULL;
+
+CREATE TABLE IF NOT EXISTS loan_renewals (
+  id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  loan_id INT UNSIGNED NOT NULL,
+  renewed_by INT UNSIGNED NOT NULL,
+  previous_due_date DATETIME NOT NULL,
+  new_due_date DATETIME NOT NULL,
+  renewed_at DATETIME NOT NULL,
+
+  CONSTRAINT fk_loan_renewals_loan FOREIGN KEY (loan_id) REFERENCES loans(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_loan_renewals_loan ON loan_renewals (loan_id);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS circulation_policies (
+  id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  role VARCHAR(20) NOT NULL DEFAULT '*',
+  genre VARCHAR(100) NOT NULL DEFAULT '*',
+  loan_days INT NOT NULL DEFAULT 0,
+  max_loans INT NOT NULL DEFAULT 0,
+  max_reservations INT NOT NULL DEFAULT 0,
+  renew_days INT NOT NULL DEFAULT 0,
+  max_renewals INT NOT NULL DEFAULT 0,
+  fine_per_day DECIMAL(12,2) NOT NULL DEFAULT 0,
+  fine_cap DECIMAL(12,2) NOT NULL DEFAULT 0,
+
+  UNIQUE KEY uq_policy_scope (role, genre)
+);
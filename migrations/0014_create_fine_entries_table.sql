@@ -0,0 +1,24 @@
+ALTER TABLE loans
+  MODIFY COLUMN status ENUM('reserved','borrowed','overdue','returned','cancelled','expired') NOT NULL DEFAULT 'reserved',
+  ADD COLUMN overdue_at DATETIME NULL AFTER renewal_count;
+
+CREATE INDEX idx_loans_status_due_date ON loans (status, due_date);
+
+CREATE TABLE IF NOT EXISTS fine_entries (
+  id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  user_id INT UNSIGNED NOT NULL,
+  loan_id INT UNSIGNED NULL,
+  kind ENUM('accrual','adjustment','waiver','payment') NOT NULL,
+  amount DECIMAL(12,2) NOT NULL,
+  accrual_date DATE NULL,
+  note VARCHAR(255) NULL,
+  created_by INT UNSIGNED NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  -- one accrual per loan and day; payments etc. leave accrual_date NULL
+  UNIQUE KEY uq_fine_accrual_day (loan_id, accrual_date),
+  CONSTRAINT fk_fine_entries_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  CONSTRAINT fk_fine_entries_loan FOREIGN KEY (loan_id) REFERENCES loans(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_fine_entries_user ON fine_entries (user_id);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS holidays (
+  id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  date DATE NOT NULL,
+  name VARCHAR(255) NULL,
+  uid VARCHAR(255) NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  UNIQUE KEY uq_holidays_date (date)
+);
+
+CREATE INDEX idx_holidays_uid ON holidays (uid);
@@ -0,0 +1,71 @@
+ALTER TABLE books
+  ADD COLUMN sale_stock INT NOT NULL DEFAULT 0 AFTER selling_status;
+
+ALTER TABLE book_copies
+  MODIFY COLUMN status ENUM('available','on_loan','reserved','lost','withdrawn','for_sale','sold') NOT NULL DEFAULT 'available';
+
+CREATE TABLE IF NOT EXISTS carts (
+  id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  user_id INT UNSIGNED NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  UNIQUE KEY uq_carts_user (user_id),
+  CONSTRAINT fk_carts_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS cart_items (
+  id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  cart_id INT UNSIGNED NOT NULL,
+  book_id INT UNSIGNED NOT NULL,
+  quantity INT NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  UNIQUE KEY uq_cart_book (cart_id, book_id),
+  CONSTRAINT fk_cart_items_cart FOREIGN KEY (cart_id) REFERENCES carts(id) ON DELETE CASCADE,
+  CONSTRAINT fk_cart_items_book FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS orders (
+  id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  user_id INT UNSIGNED NOT NULL,
+  status ENUM('pending','paid','cancelled','refunded') NOT NULL DEFAULT 'pending',
+  total DECIMAL(12,2) NOT NULL,
+  paid_at DATETIME NULL,
+  cancelled_at DATETIME NULL,
+  refunded_at DATETIME NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  CONSTRAINT fk_orders_user FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_orders_user ON orders (user_id);
+CREATE INDEX idx_orders_status ON orders (status);
+
+CREATE TABLE IF NOT EXISTS order_items (
+  id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  order_id INT UNSIGNED NOT NULL,
+  book_id INT UNSIGNED NOT NULL,
+  title VARCHAR(200) NOT NULL,
+  unit_price DECIMAL(12,2) NOT NULL,
+  quantity INT NOT NULL,
+  line_total DECIMAL(12,2) NOT NULL,
+
+  CONSTRAINT fk_order_items_order FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE,
+  CONSTRAINT fk_order_items_book FOREIGN KEY (book_id) REFERENCES books(id)
+);
+
+CREATE INDEX idx_order_items_order ON order_items (order_id);
+
+CREATE TABLE IF NOT EXISTS order_copies (
+  id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  order_item_id INT UNSIGNED NOT NULL,
+  copy_id INT UNSIGNED NOT NULL,
+
+  CONSTRAINT fk_order_copies_item FOREIGN KEY (order_item_id) REFERENCES order_items(id) ON DELETE CASCADE,
+  CONSTRAINT fk_order_copies_copy FOREIGN KEY (copy_id) REFERENCES book_copies(id)
+);
+
+CREATE INDEX idx_order_copies_item ON order_copies (order_item_id);
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS payments (
+  id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  order_id INT UNSIGNED NOT NULL,
+  provider VARCHAR(32) NOT NULL,
+  ref VARCHAR(128) NOT NULL,
+  amount DECIMAL(12,2) NOT NULL,
+  status ENUM('pending','authorized','succeeded','failed','refunded') NOT NULL DEFAULT 'pending',
+  settled_at DATETIME NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  UNIQUE KEY uq_payments_ref (ref),
+  CONSTRAINT fk_payments_order FOREIGN KEY (order_id) REFERENCES orders(id)
+);
+
+CREATE INDEX idx_payments_order ON payments (order_id);
+CREATE INDEX idx_payments_status ON payments (status);
+
+CREATE TABLE IF NOT EXISTS payment_events (
+  id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  provider VARCHAR(32) NOT NULL,
+  event_id VARCHAR(128) NOT NULL,
+  payment_ref VARCHAR(128) NOT NULL,
+  status VARCHAR(32) NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  UNIQUE KEY uq_payment_event (provider, event_id)
+);
+
+CREATE INDEX idx_payment_events_ref ON payment_events (payment_ref);
@@ -0,0 +1,54 @@
+CREATE TABLE IF NOT EXISTS invoices (
+  id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  number VARCHAR(32) NOT NULL,
+  kind ENUM('order','fine_payment') NOT NULL,
+  order_id INT UNSIGNED NULL,
+  fine_entry_id INT UNSIGNED NULL,
+  user_id INT UNSIGNED NOT NULL,
+  customer VARCHAR(100) NULL,
+  currency CHAR(3) NOT NULL,
+  subtotal DECIMAL(12,2) NOT NULL,
+  tax DECIMAL(12,2) NOT NULL,
+  total DECIMAL(12,2) NOT NULL,
+  issued_at DATETIME NOT NULL,
+
+  UNIQUE KEY uq_invoices_number (number),
+  UNIQUE KEY uq_invoices_order (order_id),
+  UNIQUE KEY uq_invoices_fine_entry (fine_entry_id),
+  CONSTRAINT fk_invoices_order FOREIGN KEY (order_id) REFERENCES orders(id),
+  CONSTRAINT fk_invoices_fine_entry FOREIGN KEY (fine_entry_id) REFERENCES fine_entries(id),
+  CONSTRAINT fk_invoices_user FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_invoices_user ON invoices (user_id);
+
+CREATE TABLE IF NOT EXISTS invoice_lines (
+  id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  invoice_id INT UNSIGNED NOT NULL,
+  description VARCHAR(255) NOT NULL,
+  quantity INT NOT NULL,
+  unit_price DECIMAL(12,2) NOT NULL,
+  amount DECIMAL(12,2) NOT NULL,
+
+  CONSTRAINT fk_invoice_lines_invoice FOREIGN KEY (invoice_id) REFERENCES invoices(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS invoice_taxes (
+  id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  invoice_id INT UNSIGNED NOT NULL,
+  name VARCHAR(50) NOT NULL,
+  rate DECIMAL(6,4) NOT NULL,
+  base DECIMAL(12,2) NOT NULL,
+  amount DECIMAL(12,2) NOT NULL,
+
+  CONSTRAINT fk_invoice_taxes_invoice FOREIGN KEY (invoice_id) REFERENCES invoices(id) ON DELETE CASCADE
+);
+
+-- one gap-free counter per series (INV, RCT) and year
+CREATE TABLE IF NOT EXISTS invoice_sequences (
+  series VARCHAR(20) NOT NULL,
+  year INT NOT NULL,
+  last INT UNSIGNED NOT NULL DEFAULT 0,
+
+  PRIMARY KEY (series, year)
+);
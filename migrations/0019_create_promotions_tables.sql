@@ -0,0 +1,65 @@
+CREATE TABLE IF NOT EXISTS promotions (
+  id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  name VARCHAR(100) NOT NULL,
+  code VARCHAR(40) NULL,                -- NULL: applied automatically
+  kind ENUM('percent','fixed') NOT NULL,
+  value DECIMAL(12,2) NOT NULL,
+  genre VARCHAR(100) NULL,
+  tag VARCHAR(100) NULL,
+  roles VARCHAR(100) NULL,              -- comma separated, empty = everyone
+  min_subtotal DECIMAL(12,2) NOT NULL DEFAULT 0,
+  starts_at DATETIME NULL,
+  ends_at DATETIME NULL,
+  usage_limit INT NOT NULL DEFAULT 0,   -- 0 = unlimited
+  per_user_limit INT NOT NULL DEFAULT 0,
+  used INT NOT NULL DEFAULT 0,
+  stackable TINYINT(1) NOT NULL DEFAULT 0,
+  priority INT NOT NULL DEFAULT 0,
+  active TINYINT(1) NOT NULL DEFAULT 1,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  UNIQUE KEY uq_promotions_code (code)
+);
+
+CREATE TABLE IF NOT EXISTS promotion_redemptions (
+  id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  promotion_id INT UNSIGNED NOT NULL,
+  user_id INT UNSIGNED NOT NULL,
+  order_id INT UNSIGNED NOT NULL,
+  code VARCHAR(40) NULL,
+  amount DECIMAL(12,2) NOT NULL,
+  released_at DATETIME NULL,            -- set when the order is cancelled
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  CONSTRAINT fk_redemptions_promotion FOREIGN KEY (promotion_id) REFERENCES promotions(id),
+  CONSTRAINT fk_redemptions_order FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_redemptions_promotion_user ON promotion_redemptions (promotion_id, user_id);
+CREATE INDEX idx_redemptions_order ON promotion_redemptions (order_id);
+
+CREATE TABLE IF NOT EXISTS order_discounts (
+  id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+  order_id INT UNSIGNED NOT NULL,
+  promotion_id INT UNSIGNED NOT NULL,
+  name VARCHAR(100) NOT NULL,
+  code VARCHAR(40) NULL,
+  amount DECIMAL(12,2) NOT NULL,
+
+  CONSTRAINT fk_order_discounts_order FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_order_discounts_order ON order_discounts (order_id);
+
+ALTER TABLE carts ADD COLUMN coupon VARCHAR(40) NULL AFTER user_id;
+
+ALTER TABLE orders
+  ADD COLUMN subtotal DECIMAL(12,2) NOT NULL DEFAULT 0 AFTER status,
+  ADD COLUMN discount DECIMAL(12,2) NOT NULL DEFAULT 0 AFTER subtotal;
+
+UPDATE orders SET subtotal = total WHERE subtotal = 0;
+
+ALTER TABLE order_items ADD COLUMN discount DECIMAL(12,2) NOT NULL DEFAULT 0 AFTER quantity;
+
+ALTER TABLE invoice_lines ADD COLUMN discount DECIMAL(12,2) NOT NULL DEFAULT 0 AFTER unit_price;
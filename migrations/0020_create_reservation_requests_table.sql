@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS reservation_requests (
+  id CHAR(32) NOT NULL PRIMARY KEY,     -- correlation id of the queued message
+  user_id INT UNSIGNED NOT NULL,
+  book_id INT UNSIGNED NOT NULL,
+  status ENUM('pending','retrying','succeeded','failed') NOT NULL DEFAULT 'pending',
+  outcome VARCHAR(20) NULL,             -- reserved or queued
+  loan_id INT UNSIGNED NULL,
+  hold_id INT UNSIGNED NULL,
+  error VARCHAR(255) NULL,
+  error_class VARCHAR(20) NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  completed_at DATETIME NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+  CONSTRAINT fk_reservation_requests_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_reservation_requests_user ON reservation_requests (user_id, created_at);
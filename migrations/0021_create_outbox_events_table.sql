@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS outbox_events (
+  id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,  -- relay order
+  event_id CHAR(32) NOT NULL,                     -- message id of the published event
+  type VARCHAR(50) NOT NULL,                      -- e.g. loan.returned, also the routing key
+  aggregate_type VARCHAR(50) NOT NULL,
+  aggregate_id INT UNSIGNED NOT NULL,
+  payload JSON NOT NULL,
+  occurred_at DATETIME(3) NOT NULL,
+  published_at DATETIME(3) NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  last_error VARCHAR(255) NULL,
+
+  UNIQUE KEY uq_outbox_events_event (event_id)
+);
+
+CREATE INDEX idx_outbox_events_published ON outbox_events (published_at);
@@ -0,0 +1,17 @@
+-- used when Redis is not configured
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  id CHAR(64) NOT NULL PRIMARY KEY,     -- sha256 of user id and Idempotency-Key
+  fingerprint CHAR(64) NOT NULL,        -- sha256 of method, path, query and body
+  status INT NOT NULL DEFAULT 0,        -- 0 while the first request is in flight
+  content_type VARCHAR(100) NULL,
+  body MEDIUMBLOB NULL,
+  expires_at DATETIME(3) NOT NULL,
+  created_at DATETIME(3) NULL
+);
+
+CREATE INDEX idx_idempotency_keys_expires ON idempotency_keys (expires_at);
+
+CREATE TABLE IF NOT EXISTS processed_messages (
+  message_id VARCHAR(64) NOT NULL PRIMARY KEY,
+  processed_at DATETIME(3) NOT NULL
+);
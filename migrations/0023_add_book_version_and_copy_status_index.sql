@@ -0,0 +1,5 @@
+-- optimistic locking of catalogue edits (PUT /books/:id)
+ALTER TABLE books ADD COLUMN version INT UNSIGNED NOT NULL DEFAULT 1;
+
+-- reservations and checkouts lock the copies of one book in one status
+CREATE INDEX idx_book_copies_book_status ON book_copies (book_id, status);
@@ -0,0 +1,119 @@
+// Package events is a small publish/subscribe bus for pushing state changes
+// to connected clients (server-sent events). With Redis every instance sees
+// every message; without it messages stay in the process.
+package events
+
+import (
+	"context"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Bus delivers payloads published on a topic to its current subscribers.
+// Delivery is best effort: subscribers that fall behind miss messages, so
+// a message should carry the full state rather than a change.
+type Bus interface {
+	Publish(ctx context.Context, topic string, payload []byte) error
+	// Subscribe returns the messages of topic until cancel is called or
+	// ctx ends.
+	Subscribe(ctx context.Context, topic string) (msgs <-chan []byte, cancel func(), err error)
+}
+
+// New returns a Redis bus, or a process-local one when rdb is nil.
+func New(rdb *redis.Client) Bus {
+	if rdb == nil {
+		return NewLocal()
+	}
+	return &Redis{rdb: rdb}
+}
+
+const buffer = 16
+
+type Redis struct {
+	rdb *redis.Client
+}
+
+func (r *Redis) Publish(ctx context.Context, topic string, payload []byte) error {
+	return r.rdb.Publish(ctx, topic, payload).Err()
+}
+
+func (r *Redis) Subscribe(ctx context.Context, topic string) (<-chan []byte, func(), error) {
+	ps := r.rdb.Subscribe(ctx, topic)
+	// wait for the subscription so nothing published afterwards is missed
+	if _, err := ps.Receive(ctx); err != nil {
+		_ = ps.Close()
+		return nil, nil, err
+	}
+	out := make(chan []byte, buffer)
+	ctx, stop := context.WithCancel(ctx)
+	go func() {
+		defer close(out)
+		defer ps.Close()
+		in := ps.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case m, ok := <-in:
+				if !ok {
+					return
+				}
+				select {
+				case out <- []byte(m.Payload):
+				default: // slow subscriber
+				}
+			}
+		}
+	}()
+	return out, stop, nil
+}
+
+type Local struct {
+	mu   sync.Mutex
+	subs map[string]map[chan []byte]struct{}
+}
+
+func NewLocal() *Local {
+	return &Local{subs: make(map[string]map[chan []byte]struct{})}
+}
+
+func (l *Local) Publish(_ context.Context, topic string, payload []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for ch := range l.subs[topic] {
+		select {
+		case ch <- payload:
+		default: // slow subscriber
+		}
+	}
+	return nil
+}
+
+func (l *Local) Subscribe(ctx context.Context, topic string) (<-chan []byte, func(), error) {
+	ch := make(chan []byte, buffer)
+	l.mu.Lock()
+	if l.subs[topic] == nil {
+		l.subs[topic] = make(map[chan []byte]struct{})
+	}
+	l.subs[topic][ch] = struct{}{}
+	l.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			l.mu.Lock()
+			delete(l.subs[topic], ch)
+			if len(l.subs[topic]) == 0 {
+				delete(l.subs, topic)
+			}
+			l.mu.Unlock()
+			close(ch)
+		})
+	}
+	go func() {
+		<-ctx.Done()
+		cancel()
+	}()
+	return ch, cancel, nil
+}
@@ -0,0 +1,276 @@
+// Package idempotency remembers the responses of requests made with an
+// idempotency key so that retries get the first response instead of
+// repeating the operation. Records live in Redis when available and in
+// the idempotency_keys table otherwise, or while Redis fails.
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInFlight = errors.New("IDEMPOTENCY_IN_FLIGHT: a request with this idempotency key is still being processed")
+	ErrMismatch = errors.New("IDEMPOTENCY_KEY_REUSED: this idempotency key was used for a different request")
+)
+
+// Response is what gets replayed.
+type Response struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+}
+
+// Store claims keys and keeps responses. Keys are opaque and already
+// scoped to the caller; fingerprint identifies the request made with them.
+type Store interface {
+	// Begin claims key for lease. It returns the stored response of a
+	// completed request, ErrInFlight while the first request is running or
+	// ErrMismatch when the fingerprints differ. A nil response and error
+	// mean the caller holds the key and must Complete or Release it.
+	Begin(ctx context.Context, key, fingerprint string, lease time.Duration) (*Response, error)
+	// Complete stores the response for ttl.
+	Complete(ctx context.Context, key, fingerprint string, res *Response, ttl time.Duration) error
+	// Release gives up a claimed key so that the request can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+// New returns a Redis store backed by the SQL one, or the SQL store alone
+// when rdb is nil.
+func New(rdb *redis.Client, db *gorm.DB) Store {
+	if rdb == nil {
+		return NewSQL(db)
+	}
+	return NewFallback(NewRedis(rdb), NewSQL(db))
+}
+
+// replay checks a record found under a claimed key.
+func replay(fingerprint, want string, res *Response) (*Response, error) {
+	if fingerprint != want {
+		return nil, ErrMismatch
+	}
+	if res == nil {
+		return nil, ErrInFlight
+	}
+	return res, nil
+}
+
+type Redis struct {
+	rdb *redis.Client
+}
+
+func NewRedis(rdb *redis.Client) *Redis {
+	return &Redis{rdb: rdb}
+}
+
+type redisRecord struct {
+	Fingerprint string    `json:"fingerprint"`
+	Response    *Response `json:"response,omitempty"`
+}
+
+func redisKey(key string) string { return "idempotency:" + key }
+
+func (r *Redis) Begin(ctx context.Context, key, fingerprint string, lease time.Duration) (*Response, error) {
+	claim, err := json.Marshal(redisRecord{Fingerprint: fingerprint})
+	if err != nil {
+		return nil, err
+	}
+	// a second round covers a record expiring between SETNX and GET
+	for i := 0; i < 2; i++ {
+		ok, err := r.rdb.SetNX(ctx, redisKey(key), claim, lease).Result()
+		if err != nil || ok {
+			return nil, err
+		}
+		raw, err := r.rdb.Get(ctx, redisKey(key)).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var rec redisRecord
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			return nil, err
+		}
+		return replay(rec.Fingerprint, fingerprint, rec.Response)
+	}
+	return nil, ErrInFlight
+}
+
+func (r *Redis) Complete(ctx context.Context, key, fingerprint string, res *Response, ttl time.Duration) error {
+	raw, err := json.Marshal(redisRecord{Fingerprint: fingerprint, Response: res})
+	if err != nil {
+		return err
+	}
+	return r.rdb.Set(ctx, redisKey(key), raw, ttl).Err()
+}
+
+func (r *Redis) Release(ctx context.Context, key string) error {
+	return r.rdb.Del(ctx, redisKey(key)).Err()
+}
+
+// Record is a key in the SQL store; Status 0 marks a request in flight.
+type Record struct {
+	ID          string    `gorm:"primaryKey;type:char(64)"`
+	Fingerprint string    `gorm:"type:char(64);not null"`
+	Status      int       `gorm:"not null;default:0"`
+	ContentType string    `gorm:"type:varchar(100)"`
+	Body        []byte    `gorm:"type:mediumblob"`
+	ExpiresAt   time.Time `gorm:"not null;index"`
+	CreatedAt   time.Time
+}
+
+func (Record) TableName() string { return "idempotency_keys" }
+
+func (rec *Record) response() *Response {
+	if rec.Status == 0 {
+		return nil
+	}
+	return &Response{Status: rec.Status, ContentType: rec.ContentType, Body: rec.Body}
+}
+
+type SQL struct {
+	db *gorm.DB
+}
+
+func NewSQL(db *gorm.DB) *SQL {
+	return &SQL{db: db}
+}
+
+func (s *SQL) Begin(ctx context.Context, key, fingerprint string, lease time.Duration) (*Response, error) {
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		res := s.db.WithContext(ctx).
+			Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&Record{ID: key, Fingerprint: fingerprint, ExpiresAt: now.Add(lease)})
+		if res.Error != nil || res.RowsAffected == 1 {
+			return nil, res.Error
+		}
+		var rec Record
+		err := s.db.WithContext(ctx).Where("id = ?", key).First(&rec).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		// expired records, and leases of requests that died, are taken over
+		if rec.ExpiresAt.Before(now) {
+			if err := s.db.WithContext(ctx).
+				Where("id = ? AND expires_at < ?", key, now).
+				Delete(&Record{}).Error; err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return replay(rec.Fingerprint, fingerprint, rec.response())
+	}
+	return nil, ErrInFlight
+}
+
+// lookup checks the live record of key, if any, without claiming it.
+func (s *SQL) lookup(ctx context.Context, key, fingerprint string) (*Response, bool, error) {
+	var rec Record
+	err := s.db.WithContext(ctx).Where("id = ? AND expires_at >= ?", key, time.Now()).First(&rec).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	res, err := replay(rec.Fingerprint, fingerprint, rec.response())
+	return res, true, err
+}
+
+// Complete also stores responses of keys claimed in Redis, when Redis
+// fails to take them.
+func (s *SQL) Complete(ctx context.Context, key, fingerprint string, res *Response, ttl time.Duration) error {
+	now := time.Now()
+	if err := s.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoUpdates: clause.AssignmentColumns(
+			[]string{"fingerprint", "status", "content_type", "body", "expires_at"})}).
+		Create(&Record{
+			ID:          key,
+			Fingerprint: fingerprint,
+			Status:      res.Status,
+			ContentType: res.ContentType,
+			Body:        res.Body,
+			ExpiresAt:   now.Add(ttl),
+		}).Error; err != nil {
+		return err
+	}
+	// nothing else removes expired records
+	return s.db.WithContext(ctx).Where("expires_at < ?", now).Delete(&Record{}).Error
+}
+
+func (s *SQL) Release(ctx context.Context, key string) error {
+	return s.db.WithContext(ctx).Where("id = ? AND status = 0", key).Delete(&Record{}).Error
+}
+
+// Fallback keeps records in Redis and switches to the SQL store for
+// requests that meet a Redis error, so an outage of Redis does not turn
+// idempotent requests away. Keys claimed in Redis are checked against the
+// SQL store as well, since a retry may come after Redis is back.
+type Fallback struct {
+	redis *Redis
+	sql   *SQL
+	// claimed holds the keys whose requests run on the SQL store
+	claimed sync.Map
+}
+
+func NewFallback(redis *Redis, sql *SQL) *Fallback {
+	return &Fallback{redis: redis, sql: sql}
+}
+
+func (f *Fallback) Begin(ctx context.Context, key, fingerprint string, lease time.Duration) (*Response, error) {
+	res, err := f.redis.Begin(ctx, key, fingerprint, lease)
+	switch {
+	case errors.Is(err, ErrInFlight), errors.Is(err, ErrMismatch):
+		return nil, err
+	case err == nil && res != nil:
+		return res, nil
+	case err == nil:
+		stored, found, err := f.sql.lookup(ctx, key, fingerprint)
+		if err == nil && !found {
+			return nil, nil
+		}
+		if rerr := f.redis.Release(ctx, key); rerr != nil {
+			log.Printf("idempotency: redis: release: %v", rerr)
+		}
+		return stored, err
+	}
+
+	log.Printf("idempotency: redis: %v; using the SQL store", err)
+	res, err = f.sql.Begin(ctx, key, fingerprint, lease)
+	if err == nil && res == nil {
+		f.claimed.Store(key, struct{}{})
+	}
+	return res, err
+}
+
+func (f *Fallback) Complete(ctx context.Context, key, fingerprint string, res *Response, ttl time.Duration) error {
+	if _, ok := f.claimed.LoadAndDelete(key); ok {
+		return f.sql.Complete(ctx, key, fingerprint, res, ttl)
+	}
+	err := f.redis.Complete(ctx, key, fingerprint, res, ttl)
+	if err == nil {
+		return nil
+	}
+	log.Printf("idempotency: redis: %v; using the SQL store", err)
+	return f.sql.Complete(ctx, key, fingerprint, res, ttl)
+}
+
+func (f *Fallback) Release(ctx context.Context, key string) error {
+	if _, ok := f.claimed.LoadAndDelete(key); ok {
+		return f.sql.Release(ctx, key)
+	}
+	return f.redis.Release(ctx, key)
+}
@@ -0,0 +1,93 @@
+package isbn
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrInvalid = errors.New("invalid ISBN")
+
+// Clean removes separators and maps Persian/Arabic digits to ASCII.
+// "۹۷۸-۶۰۰-..." and "978 600 ..." both become "978600...".
+func Clean(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r >= '۰' && r <= '۹':
+			b.WriteRune('0' + (r - '۰'))
+		case r >= '٠' && r <= '٩':
+			b.WriteRune('0' + (r - '٠'))
+		case r == 'x' || r == 'X':
+			b.WriteRune('X')
+		}
+	}
+	return b.String()
+}
+
+func Valid10(s string) bool {
+	if len(s) != 10 {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 10; i++ {
+		var d int
+		switch {
+		case s[i] >= '0' && s[i] <= '9':
+			d = int(s[i] - '0')
+		case s[i] == 'X' && i == 9:
+			d = 10
+		default:
+			return false
+		}
+		sum += d * (10 - i)
+	}
+	return sum%11 == 0
+}
+
+func Valid13(s string) bool {
+	if len(s) != 13 {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 13; i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+		d := int(s[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// To13 converts a valid ISBN-10 to its ISBN-13 (978 prefix) form.
+func To13(isbn10 string) string {
+	core := "978" + isbn10[:9]
+	sum := 0
+	for i := 0; i < 12; i++ {
+		d := int(core[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	check := (10 - sum%10) % 10
+	return core + string(rune('0'+check))
+}
+
+// Normalize validates an ISBN-10 or ISBN-13 in any common notation and
+// returns it as a bare ISBN-13.
+func Normalize(s string) (string, error) {
+	c := Clean(s)
+	switch {
+	case Valid13(c):
+		return c, nil
+	case Valid10(c):
+		return To13(c), nil
+	}
+	return "", ErrInvalid
+}
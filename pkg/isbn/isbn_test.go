@@ -0,0 +1,94 @@
+package isbn
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestClean(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{"978-0-306-40615-7", "9780306406157"},
+		{"978 0 306 40615 7", "9780306406157"},
+		{"۹۷۸-۰-۳۰۶-۴۰۶۱۵-۷", "9780306406157"},
+		{"٩٧٨٠٣٠٦٤٠٦١٥٧", "9780306406157"},
+		{"0-8044-2957-x", "080442957X"},
+		{"ISBN: 0306406152", "0306406152"},
+	} {
+		if got := Clean(tt.in); got != tt.want {
+			t.Errorf("Clean(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestValid10(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want bool
+	}{
+		{"0306406152", true},
+		{"080442957X", true},
+		{"0306406153", false}, // wrong check digit
+		{"08044295X7", false}, // X only as the check digit
+		{"030640615", false},
+		{"03064061520", false},
+		{"", false},
+	} {
+		if got := Valid10(tt.in); got != tt.want {
+			t.Errorf("Valid10(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestValid13(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want bool
+	}{
+		{"9780306406157", true},
+		{"9786001190599", true},
+		{"9780306406158", false}, // wrong check digit
+		{"978030640615X", false},
+		{"978030640615", false},
+		{"", false},
+	} {
+		if got := Valid13(tt.in); got != tt.want {
+			t.Errorf("Valid13(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTo13(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{"0306406152", "9780306406157"},
+		{"080442957X", "9780804429573"},
+		{"0000000000", "9780000000002"},
+	} {
+		if got := To13(tt.in); got != tt.want {
+			t.Errorf("To13(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if !Valid13(To13(tt.in)) {
+			t.Errorf("To13(%q) is not a valid ISBN-13", tt.in)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	for _, tt := range []struct {
+		in, want string
+		err      error
+	}{
+		{"978-0-306-40615-7", "9780306406157", nil},
+		{"0-306-40615-2", "9780306406157", nil},
+		{"۰-۳۰۶-۴۰۶۱۵-۲", "9780306406157", nil},
+		{"0-8044-2957-X", "9780804429573", nil},
+		{"978-0-306-40615-8", "", ErrInvalid},
+		{"0-306-40615-3", "", ErrInvalid},
+		{"not an isbn", "", ErrInvalid},
+		{"", "", ErrInvalid},
+	} {
+		got, err := Normalize(tt.in)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("Normalize(%q) = %q, %v, want %q, %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Locker hands out named, expiring locks. TryAcquire never blocks: ok is
+// false when somebody else holds the lock. The returned release func is
+// safe to call more than once.
+type Locker interface {
+	TryAcquire(ctx context.Context, key string, ttl time.Duration) (release func(), ok bool, err error)
+}
+
+// New returns a Redis-backed locker, or a process-local one when rdb is nil
+// (enough for a single instance).
+func New(rdb *redis.Client) Locker {
+	if rdb == nil {
+		return NewLocal()
+	}
+	return NewRedis(rdb)
+}
+
+// releaseLua deletes the key only while it still holds our token, so an
+// expired lock that was taken over by another instance is left alone.
+const releaseLua = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`
+
+type Redis struct {
+	rdb     *redis.Client
+	release *redis.Script
+}
+
+func NewRedis(rdb *redis.Client) *Redis {
+	return &Redis{rdb: rdb, release: redis.NewScript(releaseLua)}
+}
+
+func lockKey(key string) string { return "lock:" + key }
+
+func (l *Redis) TryAcquire(ctx context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, false, err
+	}
+	ok, err := l.rdb.SetNX(ctx, lockKey(key), token, ttl).Result()
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			// the caller's ctx may be done already
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			_ = l.release.Run(ctx, l.rdb, []string{lockKey(key)}, token).Err()
+		})
+	}, true, nil
+}
+
+// Local is an in-process Locker.
+type Local struct {
+	mu   sync.Mutex
+	held map[string]localLock
+}
+
+type localLock struct {
+	token   string
+	expires time.Time
+}
+
+func NewLocal() *Local {
+	return &Local{held: make(map[string]localLock)}
+}
+
+func (l *Local) TryAcquire(_ context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, false, err
+	}
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if cur, ok := l.held[key]; ok && now.Before(cur.expires) {
+		return nil, false, nil
+	}
+	l.held[key] = localLock{token: token, expires: now.Add(ttl)}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if cur, ok := l.held[key]; ok && cur.token == token {
+				delete(l.held, key)
+			}
+		})
+	}, true, nil
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
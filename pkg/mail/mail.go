@@ -0,0 +1,57 @@
+// Package mail sends transactional e-mail such as password reset links.
+package mail
+
+import (
+	"context"
+	"sync"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// MemorySender keeps messages in memory instead of sending them; use it in
+// tests and local development.
+type MemorySender struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemorySender() *MemorySender {
+	return &MemorySender{}
+}
+
+func (m *MemorySender) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns a copy of everything sent so far.
+func (m *MemorySender) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]Message, len(m.messages))
+	copy(out, m.messages)
+	return out
+}
+
+// Last returns the most recent message sent to addr.
+func (m *MemorySender) Last(addr string) (Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To == addr {
+			return m.messages[i], true
+		}
+	}
+	return Message{}, false
+}
@@ -0,0 +1,169 @@
+package marc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+var ErrInvalidRecord = errors.New("invalid MARC record")
+
+// Reader decodes ISO 2709 records one at a time.
+type Reader struct {
+	r *bufio.Reader
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Read returns the next record, or io.EOF when the input is exhausted.
+func (rd *Reader) Read() (*Record, error) {
+	// tolerate line breaks between records, which some exports add
+	for {
+		b, err := rd.r.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+		if b[0] != '\n' && b[0] != '\r' {
+			break
+		}
+		_, _ = rd.r.ReadByte()
+	}
+
+	lenBytes, err := rd.r.Peek(5)
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	length, err := strconv.Atoi(string(lenBytes))
+	if err != nil || length < leaderLen+1 {
+		return nil, fmt.Errorf("%w: bad record length %q", ErrInvalidRecord, lenBytes)
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(rd.r, buf); err != nil {
+		return nil, err
+	}
+	return Decode(buf)
+}
+
+// Decode parses a single ISO 2709 record.
+func Decode(data []byte) (*Record, error) {
+	if len(data) < leaderLen+1 || data[len(data)-1] != recordTerminator {
+		return nil, fmt.Errorf("%w: missing record terminator", ErrInvalidRecord)
+	}
+	rec := &Record{Leader: string(data[:leaderLen])}
+	base, err := strconv.Atoi(string(data[12:17]))
+	if err != nil || base <= leaderLen || base > len(data) {
+		return nil, fmt.Errorf("%w: bad base address", ErrInvalidRecord)
+	}
+
+	dir := data[leaderLen : base-1]
+	if len(dir)%dirEntryLen != 0 {
+		return nil, fmt.Errorf("%w: bad directory length", ErrInvalidRecord)
+	}
+	for i := 0; i < len(dir); i += dirEntryLen {
+		entry := dir[i : i+dirEntryLen]
+		tag := string(entry[0:3])
+		flen, err1 := strconv.Atoi(string(entry[3:7]))
+		start, err2 := strconv.Atoi(string(entry[7:12]))
+		if err1 != nil || err2 != nil || base+start+flen > len(data) || flen < 1 {
+			return nil, fmt.Errorf("%w: bad directory entry for %s", ErrInvalidRecord, tag)
+		}
+		raw := data[base+start : base+start+flen-1] // drop field terminator
+		rec.Fields = append(rec.Fields, decodeField(tag, raw))
+	}
+	return rec, nil
+}
+
+func decodeField(tag string, raw []byte) Field {
+	f := Field{Tag: tag}
+	if f.IsControl() {
+		f.Value = string(raw)
+		return f
+	}
+	if len(raw) >= 2 {
+		f.Ind1, f.Ind2 = raw[0], raw[1]
+		raw = raw[2:]
+	}
+	for _, part := range bytes.Split(raw, []byte{subfieldDelim}) {
+		if len(part) == 0 {
+			continue
+		}
+		f.Subfields = append(f.Subfields, Subfield{Code: part[0], Value: string(part[1:])})
+	}
+	return f
+}
+
+// Writer encodes records as ISO 2709.
+type Writer struct {
+	w io.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+func (wr *Writer) Write(rec *Record) error {
+	data, err := Encode(rec)
+	if err != nil {
+		return err
+	}
+	_, err = wr.w.Write(data)
+	return err
+}
+
+// Encode serializes a record, recomputing the record length and base address
+// in the leader.
+func Encode(rec *Record) ([]byte, error) {
+	var dir, body bytes.Buffer
+	for _, f := range rec.Fields {
+		if len(f.Tag) != 3 {
+			return nil, fmt.Errorf("%w: tag %q", ErrInvalidRecord, f.Tag)
+		}
+		start := body.Len()
+		if f.IsControl() {
+			body.WriteString(f.Value)
+		} else {
+			body.WriteByte(indicator(f.Ind1))
+			body.WriteByte(indicator(f.Ind2))
+			for _, sf := range f.Subfields {
+				body.WriteByte(subfieldDelim)
+				body.WriteByte(sf.Code)
+				body.WriteString(sf.Value)
+			}
+		}
+		body.WriteByte(fieldTerminator)
+		flen := body.Len() - start
+		if flen > 9999 || start > 99999 {
+			return nil, fmt.Errorf("%w: field %s too large", ErrInvalidRecord, f.Tag)
+		}
+		fmt.Fprintf(&dir, "%s%04d%05d", f.Tag, flen, start)
+	}
+	dir.WriteByte(fieldTerminator)
+
+	base := leaderLen + dir.Len()
+	total := base + body.Len() + 1
+	if total > 99999 {
+		return nil, fmt.Errorf("%w: record too large", ErrInvalidRecord)
+	}
+
+	leader := []byte(rec.Leader)
+	if len(leader) != leaderLen {
+		leader = []byte(DefaultLeader)
+	}
+	copy(leader[0:5], fmt.Sprintf("%05d", total))
+	copy(leader[12:17], fmt.Sprintf("%05d", base))
+
+	out := make([]byte, 0, total)
+	out = append(out, leader...)
+	out = append(out, dir.Bytes()...)
+	out = append(out, body.Bytes()...)
+	out = append(out, recordTerminator)
+	return out, nil
+}
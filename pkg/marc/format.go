@@ -0,0 +1,43 @@
+package marc
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	FormatMARC21  = "marc21"
+	FormatMARCXML = "marcxml"
+)
+
+type RecordReader interface {
+	Read() (*Record, error)
+}
+
+type RecordWriter interface {
+	Write(rec *Record) error
+	Close() error
+}
+
+func NewFormatReader(format string, r io.Reader) (RecordReader, error) {
+	switch format {
+	case FormatMARC21:
+		return NewReader(r), nil
+	case FormatMARCXML:
+		return NewXMLReader(r), nil
+	}
+	return nil, fmt.Errorf("unknown MARC format %q", format)
+}
+
+func NewFormatWriter(format string, w io.Writer) (RecordWriter, error) {
+	switch format {
+	case FormatMARC21:
+		return NewWriter(w), nil
+	case FormatMARCXML:
+		return NewXMLWriter(w), nil
+	}
+	return nil, fmt.Errorf("unknown MARC format %q", format)
+}
+
+// Close is a no-op; ISO 2709 has no trailer.
+func (wr *Writer) Close() error { return nil }
@@ -0,0 +1,236 @@
+package marc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// sampleRecords are typical catalogue records: a Persian novel and an
+// English one with several subjects and repeated fields.
+func sampleRecords() []*Record {
+	fa := NewRecord()
+	fa.AddControlField("001", "1001")
+	fa.AddControlField("008", "240101s1937    ir            000 1 per d")
+	fa.AddDataField("020", ' ', ' ', "a", "9789643510172")
+	fa.AddDataField("100", '1', ' ', "a", "هدایت، صادق")
+	fa.AddDataField("245", '1', '0', "a", "بوف کور /", "c", "صادق هدایت")
+	fa.AddDataField("264", ' ', '1', "a", "تهران :", "b", "امیرکبیر,", "c", "1316")
+	fa.AddDataField("650", ' ', '4', "a", "داستان‌های فارسی")
+
+	en := NewRecord()
+	en.Leader = "00000cam a2200000 i 4500"
+	en.AddControlField("001", "1002")
+	en.AddControlField("005", "20240101120000.0")
+	en.AddDataField("020", ' ', ' ', "a", "0-306-40615-2", "q", "paperback")
+	en.AddDataField("100", '1', ' ', "a", "Orwell, George,", "d", "1903-1950")
+	en.AddDataField("245", '1', '0', "a", "Nineteen eighty-four :", "b", "a novel")
+	en.AddDataField("250", ' ', ' ', "a", "Centennial edition")
+	en.AddDataField("520", ' ', ' ', "a", "A dystopian novel about surveillance.")
+	en.AddDataField("650", ' ', '0', "a", "Totalitarianism")
+	en.AddDataField("650", ' ', '0', "a", "Dystopias")
+	return []*Record{fa, en}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	for _, rec := range sampleRecords() {
+		data, err := Encode(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, _ := strconv.Atoi(string(data[0:5])); n != len(data) {
+			t.Errorf("leader record length %d, encoded %d bytes", n, len(data))
+		}
+		if data[len(data)-1] != recordTerminator {
+			t.Error("missing record terminator")
+		}
+
+		got, err := Decode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Leader[5:12] != rec.Leader[5:12] || got.Leader[17:] != rec.Leader[17:] {
+			t.Errorf("leader %q, want %q apart from length and base address", got.Leader, rec.Leader)
+		}
+		if !reflect.DeepEqual(got.Fields, rec.Fields) {
+			t.Errorf("fields differ after round trip:\n got %v\nwant %v", got, rec)
+		}
+	}
+}
+
+func TestReaderWriterStream(t *testing.T) {
+	recs := sampleRecords()
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for i, rec := range recs {
+		if err := w.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			buf.WriteString("\r\n") // some exports put line breaks between records
+		}
+	}
+
+	r := NewReader(&buf)
+	for _, want := range recs {
+		got, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got.Fields, want.Fields) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("after the last record: %v, want io.EOF", err)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	data, err := Encode(sampleRecords()[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	badBase := append([]byte{}, data...)
+	copy(badBase[12:17], "99999")
+
+	for name, in := range map[string][]byte{
+		"empty":          nil,
+		"no terminator":  data[:len(data)-1],
+		"bad base":       badBase,
+		"truncated body": append(append([]byte{}, data[:len(data)-20]...), recordTerminator),
+	} {
+		if _, err := Decode(in); !errors.Is(err, ErrInvalidRecord) {
+			t.Errorf("%s: got %v, want ErrInvalidRecord", name, err)
+		}
+	}
+
+	if _, err := NewReader(strings.NewReader("abcde")).Read(); !errors.Is(err, ErrInvalidRecord) {
+		t.Errorf("bad length: got %v, want ErrInvalidRecord", err)
+	}
+}
+
+func TestXMLRoundTrip(t *testing.T) {
+	recs := sampleRecords()
+	var buf bytes.Buffer
+	w := NewXMLWriter(&buf)
+	for _, rec := range recs {
+		if err := w.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `<collection xmlns="`+xmlNamespace+`">`) {
+		t.Errorf("missing collection element:\n%s", buf.String())
+	}
+
+	r := NewXMLReader(&buf)
+	for _, want := range recs {
+		got, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Leader != want.Leader {
+			t.Errorf("leader %q, want %q", got.Leader, want.Leader)
+		}
+		if !reflect.DeepEqual(got.Fields, want.Fields) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("after the last record: %v, want io.EOF", err)
+	}
+}
+
+// sampleXML is a single record as published by catalogues, without a
+// collection wrapper.
+const sampleXML = `<?xml version="1.0" encoding="UTF-8"?>
+<record xmlns="http://www.loc.gov/MARC21/slim">
+  <leader>01142cam  2200301 a 4500</leader>
+  <controlfield tag="001">92005291</controlfield>
+  <datafield tag="020" ind1=" " ind2=" ">
+    <subfield code="a">0394800834</subfield>
+  </datafield>
+  <datafield tag="100" ind1="1" ind2=" ">
+    <subfield code="a">Sendak, Maurice.</subfield>
+  </datafield>
+  <datafield tag="245" ind1="1" ind2="0">
+    <subfield code="a">Where the wild things are /</subfield>
+    <subfield code="c">story and pictures by Maurice Sendak.</subfield>
+  </datafield>
+</record>`
+
+func TestXMLReaderSample(t *testing.T) {
+	rec, err := NewXMLReader(strings.NewReader(sampleXML)).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Leader != "01142cam  2200301 a 4500" {
+		t.Errorf("leader %q", rec.Leader)
+	}
+	if got := rec.ControlField("001"); got != "92005291" {
+		t.Errorf("001 = %q", got)
+	}
+	if got := rec.Value("245", 'a'); got != "Where the wild things are /" {
+		t.Errorf("245$a = %q", got)
+	}
+	if f := rec.DataFields("100"); len(f) != 1 || f[0].Ind1 != '1' || f[0].Ind2 != ' ' {
+		t.Errorf("100 = %v", f)
+	}
+
+	// MARCXML -> MARC21 -> MARCXML keeps every field
+	data, err := Encode(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back.Fields, rec.Fields) {
+		t.Errorf("got %v, want %v", back, rec)
+	}
+}
+
+func TestFormatReaderWriter(t *testing.T) {
+	for _, format := range []string{FormatMARC21, FormatMARCXML} {
+		var buf bytes.Buffer
+		w, err := NewFormatWriter(format, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, rec := range sampleRecords() {
+			if err := w.Write(rec); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		r, err := NewFormatReader(format, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for {
+			if _, err := r.Read(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: %v", format, err)
+			}
+			n++
+		}
+		if n != 2 {
+			t.Errorf("%s: read %d records, want 2", format, n)
+		}
+	}
+	if _, err := NewFormatReader("unimarc", nil); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
@@ -0,0 +1,137 @@
+// Package marc reads and writes bibliographic records in MARC21 (ISO 2709)
+// and MARCXML.
+package marc
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	recordTerminator = 0x1D
+	fieldTerminator  = 0x1E
+	subfieldDelim    = 0x1F
+
+	leaderLen   = 24
+	dirEntryLen = 12
+)
+
+// DefaultLeader describes a new, unicode-encoded monograph record.
+const DefaultLeader = "00000nam a2200000 a 4500"
+
+type Subfield struct {
+	Code  byte
+	Value string
+}
+
+// Field is either a control field (tag 001-009, Value set) or a data field
+// with two indicators and subfields.
+type Field struct {
+	Tag       string
+	Ind1      byte
+	Ind2      byte
+	Value     string
+	Subfields []Subfield
+}
+
+func (f Field) IsControl() bool {
+	return strings.HasPrefix(f.Tag, "00")
+}
+
+// Subfield returns the first value of the given subfield code.
+func (f Field) Subfield(code byte) string {
+	for _, sf := range f.Subfields {
+		if sf.Code == code {
+			return sf.Value
+		}
+	}
+	return ""
+}
+
+func (f Field) String() string {
+	if f.IsControl() {
+		return fmt.Sprintf("%s    %s", f.Tag, f.Value)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %c%c", f.Tag, indicator(f.Ind1), indicator(f.Ind2))
+	for _, sf := range f.Subfields {
+		fmt.Fprintf(&b, " $%c %s", sf.Code, sf.Value)
+	}
+	return b.String()
+}
+
+type Record struct {
+	Leader string
+	Fields []Field
+}
+
+func NewRecord() *Record {
+	return &Record{Leader: DefaultLeader}
+}
+
+// ControlField returns the value of the first control field with the tag.
+func (r *Record) ControlField(tag string) string {
+	for _, f := range r.Fields {
+		if f.Tag == tag && f.IsControl() {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// DataFields returns all data fields with the tag, in record order.
+func (r *Record) DataFields(tag string) []Field {
+	var out []Field
+	for _, f := range r.Fields {
+		if f.Tag == tag && !f.IsControl() {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// Value returns the first value of tag$code, or "".
+func (r *Record) Value(tag string, code byte) string {
+	for _, f := range r.DataFields(tag) {
+		if v := f.Subfield(code); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (r *Record) AddControlField(tag, value string) {
+	r.Fields = append(r.Fields, Field{Tag: tag, Value: value})
+}
+
+// AddDataField appends a data field built from code/value pairs, skipping
+// empty values. Nothing is added when every value is empty.
+func (r *Record) AddDataField(tag string, ind1, ind2 byte, pairs ...string) {
+	f := Field{Tag: tag, Ind1: ind1, Ind2: ind2}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] == "" || pairs[i] == "" {
+			continue
+		}
+		f.Subfields = append(f.Subfields, Subfield{Code: pairs[i][0], Value: pairs[i+1]})
+	}
+	if len(f.Subfields) > 0 {
+		r.Fields = append(r.Fields, f)
+	}
+}
+
+func (r *Record) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "LDR    %s\n", r.Leader)
+	for _, f := range r.Fields {
+		b.WriteString(f.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func indicator(c byte) byte {
+	if c == 0 {
+		return ' '
+	}
+	return c
+}
@@ -0,0 +1,160 @@
+package marc
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+const xmlNamespace = "http://www.loc.gov/MARC21/slim"
+
+type xmlSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlDataField struct {
+	Tag       string        `xml:"tag,attr"`
+	Ind1      string        `xml:"ind1,attr"`
+	Ind2      string        `xml:"ind2,attr"`
+	Subfields []xmlSubfield `xml:"subfield"`
+}
+
+type xmlRecord struct {
+	XMLName       xml.Name          `xml:"record"`
+	Leader        string            `xml:"leader"`
+	ControlFields []xmlControlField `xml:"controlfield"`
+	DataFields    []xmlDataField    `xml:"datafield"`
+}
+
+// XMLReader streams <record> elements from a MARCXML document, whether or
+// not they are wrapped in a <collection>.
+type XMLReader struct {
+	dec *xml.Decoder
+}
+
+func NewXMLReader(r io.Reader) *XMLReader {
+	return &XMLReader{dec: xml.NewDecoder(r)}
+}
+
+// Read returns the next record, or io.EOF.
+func (xr *XMLReader) Read() (*Record, error) {
+	for {
+		tok, err := xr.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+		var xrec xmlRecord
+		if err := xr.dec.DecodeElement(&xrec, &start); err != nil {
+			return nil, err
+		}
+		return fromXML(&xrec)
+	}
+}
+
+func fromXML(x *xmlRecord) (*Record, error) {
+	rec := &Record{Leader: x.Leader}
+	if len(rec.Leader) != leaderLen {
+		rec.Leader = DefaultLeader
+	}
+	// MARCXML keeps control and data fields apart; control fields come first
+	// in MARC21 as well, so order is preserved for well-formed records.
+	for _, cf := range x.ControlFields {
+		rec.Fields = append(rec.Fields, Field{Tag: cf.Tag, Value: cf.Value})
+	}
+	for _, df := range x.DataFields {
+		if len(df.Tag) != 3 {
+			return nil, fmt.Errorf("%w: tag %q", ErrInvalidRecord, df.Tag)
+		}
+		f := Field{Tag: df.Tag, Ind1: firstByte(df.Ind1), Ind2: firstByte(df.Ind2)}
+		for _, sf := range df.Subfields {
+			f.Subfields = append(f.Subfields, Subfield{Code: firstByte(sf.Code), Value: sf.Value})
+		}
+		rec.Fields = append(rec.Fields, f)
+	}
+	return rec, nil
+}
+
+func toXML(rec *Record) *xmlRecord {
+	x := &xmlRecord{Leader: rec.Leader}
+	for _, f := range rec.Fields {
+		if f.IsControl() {
+			x.ControlFields = append(x.ControlFields, xmlControlField{Tag: f.Tag, Value: f.Value})
+			continue
+		}
+		df := xmlDataField{Tag: f.Tag, Ind1: string(indicator(f.Ind1)), Ind2: string(indicator(f.Ind2))}
+		for _, sf := range f.Subfields {
+			df.Subfields = append(df.Subfields, xmlSubfield{Code: string(sf.Code), Value: sf.Value})
+		}
+		x.DataFields = append(x.DataFields, df)
+	}
+	return x
+}
+
+// XMLWriter writes a <collection> of records. Close must be called to end
+// the document.
+type XMLWriter struct {
+	w       io.Writer
+	enc     *xml.Encoder
+	started bool
+}
+
+func NewXMLWriter(w io.Writer) *XMLWriter {
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return &XMLWriter{w: w, enc: enc}
+}
+
+func (xw *XMLWriter) start() error {
+	if xw.started {
+		return nil
+	}
+	xw.started = true
+	if _, err := io.WriteString(xw.w, xml.Header); err != nil {
+		return err
+	}
+	return xw.enc.EncodeToken(xml.StartElement{
+		Name: xml.Name{Local: "collection"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: xmlNamespace}},
+	})
+}
+
+func (xw *XMLWriter) Write(rec *Record) error {
+	if err := xw.start(); err != nil {
+		return err
+	}
+	if err := xw.enc.Encode(toXML(rec)); err != nil {
+		return err
+	}
+	return xw.enc.Flush()
+}
+
+func (xw *XMLWriter) Close() error {
+	if err := xw.start(); err != nil {
+		return err
+	}
+	if err := xw.enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: "collection"}}); err != nil {
+		return err
+	}
+	if err := xw.enc.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(xw.w, "\n")
+	return err
+}
+
+func firstByte(s string) byte {
+	if s == "" {
+		return ' '
+	}
+	return s[0]
+}
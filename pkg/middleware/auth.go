@@ -42,4 +42,7 @@ func CurrentUserID(c echo.Context) (uint, error){
 	default:
 		return 0, errors.New("unsupported sub claim type")
 	}
-}
\ No newline at end of file
+}
+func uitoa(n uint) string {
+	return strconv.FormatUint(uint64(n), 10)
+}
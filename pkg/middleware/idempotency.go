@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/erfnzmn/Library_Management_System/pkg/idempotency"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderIdempotentReplayed marks a response replayed from the store.
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+
+	maxIdempotencyKey = 255
+	// idempotencyLease bounds how long a key stays locked by a request
+	// that never finished (e.g. the server died)
+	idempotencyLease = 2 * time.Minute
+)
+
+type idempotencySettings struct {
+	store  idempotency.Store
+	window time.Duration
+}
+
+// WithIdempotency makes the store available to Idempotent; responses are
+// kept for window.
+func WithIdempotency(store idempotency.Store, window time.Duration) echo.MiddlewareFunc {
+	s := &idempotencySettings{store: store, window: window}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("idempotency", s)
+			return next(c)
+		}
+	}
+}
+
+// Idempotent must run after JWT. A request carrying an Idempotency-Key
+// runs once per key and user: retries get the first response replayed,
+// a retry arriving while the first is still running gets 409, and reusing
+// the key for a different request gets 422. 5xx responses are not kept,
+// so the request may be retried with the same key.
+func Idempotent(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		s, _ := c.Get("idempotency").(*idempotencySettings)
+		key := c.Request().Header.Get(HeaderIdempotencyKey)
+		if s == nil || key == "" {
+			return next(c)
+		}
+		if len(key) > maxIdempotencyKey {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "Idempotency-Key is too long"})
+		}
+		userID, err := CurrentUserID(c)
+		if err != nil {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid or missing token"})
+		}
+
+		req := c.Request()
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid input"})
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+
+		id := digest(uitoa(userID), key)
+		fingerprint := digest(req.Method, req.URL.Path, req.URL.RawQuery, string(body))
+		ctx := req.Context()
+		stored, err := s.store.Begin(ctx, id, fingerprint, idempotencyLease)
+		switch {
+		case errors.Is(err, idempotency.ErrInFlight):
+			return c.JSON(http.StatusConflict, echo.Map{"error": err.Error()})
+		case errors.Is(err, idempotency.ErrMismatch):
+			return c.JSON(http.StatusUnprocessableEntity, echo.Map{"error": err.Error()})
+		case err != nil:
+			log.Printf("idempotency: begin: %v", err)
+			return c.JSON(http.StatusServiceUnavailable, echo.Map{"error": "idempotency store unavailable, try again shortly"})
+		case stored != nil:
+			c.Response().Header().Set(HeaderIdempotentReplayed, "true")
+			return c.Blob(stored.Status, stored.ContentType, stored.Body)
+		}
+
+		res := c.Response()
+		rec := &recorder{ResponseWriter: res.Writer}
+		res.Writer = rec
+		if err := next(c); err != nil {
+			c.Error(err) // render it now so that it is recorded
+		}
+		res.Writer = rec.ResponseWriter
+
+		// a client that gave up must still find the response when it retries
+		ctx = context.WithoutCancel(ctx)
+		if !res.Committed || res.Status >= http.StatusInternalServerError {
+			if err := s.store.Release(ctx, id); err != nil {
+				log.Printf("idempotency: release: %v", err)
+			}
+			return nil
+		}
+		if err := s.store.Complete(ctx, id, fingerprint, &idempotency.Response{
+			Status:      res.Status,
+			ContentType: res.Header().Get(echo.HeaderContentType),
+			Body:        rec.body.Bytes(),
+		}, s.window); err != nil {
+			log.Printf("idempotency: complete: %v", err)
+		}
+		return nil
+	}
+}
+
+func digest(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recorder keeps a copy of the response body.
+type recorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+	echojwt "github.com/labstack/echo-jwt/v4"
+	"github.com/labstack/echo/v4"
+)
+
+type Permission string
+
+const (
+	PermBooksWrite     Permission = "books:write"     // catalogue and copies
+	PermLoansReserve   Permission = "loans:reserve"   // place and cancel own reservations
+	PermLoansManage    Permission = "loans:manage"    // confirm, return, cancel anyone's loans
+	PermUsersManage    Permission = "users:manage"    // roles and staff accounts
+	PermFinesManage    Permission = "fines:manage"    // payments, adjustments, waivers
+	PermCalendarManage Permission = "calendar:manage" // holidays
+	PermSalesManage    Permission = "sales:manage"    // all orders, payments at the desk, refunds
+)
+
+// rolePermissions uses the role names of internal/users.
+var rolePermissions = map[string][]Permission{
+	"admin":     {PermBooksWrite, PermLoansReserve, PermLoansManage, PermUsersManage, PermFinesManage, PermCalendarManage, PermSalesManage},
+	"librarian": {PermBooksWrite, PermLoansReserve, PermLoansManage, PermFinesManage, PermCalendarManage, PermSalesManage},
+	"member":    {PermLoansReserve},
+	"student":   {PermLoansReserve},
+}
+
+func HasPermission(role string, perm Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// JWT validates the bearer token, stores it in the context as "user" and
+// rejects tokens on the denylist (see WithDenylist).
+func JWT(secret string) echo.MiddlewareFunc {
+	validate := echojwt.JWT([]byte(secret))
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return validate(rejectRevoked(next))
+	}
+}
+
+// StreamJWT is JWT for event streams: browsers' EventSource cannot set
+// headers, so the token may also come as the access_token query parameter.
+func StreamJWT(secret string) echo.MiddlewareFunc {
+	validate := echojwt.WithConfig(echojwt.Config{
+		SigningKey:  []byte(secret),
+		TokenLookup: "header:Authorization:Bearer ,query:access_token",
+	})
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return validate(rejectRevoked(next))
+	}
+}
+
+func claims(c echo.Context) (jwt.MapClaims, error) {
+	u := c.Get("user")
+	if u == nil {
+		return nil, errors.New("no jwt user in context (missing JWT middleware)")
+	}
+	token, ok := u.(*jwt.Token)
+	if !ok {
+		return nil, errors.New("invalid token type in context")
+	}
+	mc, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid JWT claims type")
+	}
+	return mc, nil
+}
+
+func CurrentUserRole(c echo.Context) (string, error) {
+	mc, err := claims(c)
+	if err != nil {
+		return "", err
+	}
+	role, ok := mc["role"].(string)
+	if !ok || role == "" {
+		return "", errors.New("role claim not found")
+	}
+	return role, nil
+}
+
+// Can reports whether the authenticated user holds perm.
+func Can(c echo.Context, perm Permission) bool {
+	role, err := CurrentUserRole(c)
+	return err == nil && HasPermission(role, perm)
+}
+
+// RequirePermission must run after JWT; it rejects requests whose role
+// lacks any of perms.
+func RequirePermission(perms ...Permission) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			role, err := CurrentUserRole(c)
+			if err != nil {
+				return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid or missing token"})
+			}
+			for _, p := range perms {
+				if !HasPermission(role, p) {
+					return c.JSON(http.StatusForbidden, echo.Map{"error": "FORBIDDEN", "missing_permission": p})
+				}
+			}
+			return next(c)
+		}
+	}
+}
+
+// SelfOr allows the request when the :param path value is the caller's own
+// user ID, or when the caller holds perm.
+func SelfOr(param string, perm Permission) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			uid, err := CurrentUserID(c)
+			if err != nil {
+				return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid or missing token"})
+			}
+			if c.Param(param) != "" && c.Param(param) == uitoa(uid) {
+				return next(c)
+			}
+			if Can(c, perm) {
+				return next(c)
+			}
+			return c.JSON(http.StatusForbidden, echo.Map{"error": "FORBIDDEN"})
+		}
+	}
+}
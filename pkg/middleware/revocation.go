@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+)
+
+// Denylist records revoked access tokens (by jti) and per-user cut-off times
+// for "log out everywhere". Entries live in Redis when available and are
+// always mirrored in memory, which is also consulted when Redis fails.
+type Denylist struct {
+	rdb *redis.Client
+
+	mu    sync.Mutex
+	jtis  map[string]time.Time // jti -> expiry of the entry
+	users map[uint]cutoff
+}
+
+type cutoff struct {
+	at      time.Time
+	expires time.Time
+}
+
+func NewDenylist(rdb *redis.Client) *Denylist {
+	return &Denylist{
+		rdb:   rdb,
+		jtis:  make(map[string]time.Time),
+		users: make(map[uint]cutoff),
+	}
+}
+
+func jtiKey(jti string) string   { return "jwt:denied:" + jti }
+func userKey(userID uint) string { return "jwt:user-cutoff:" + uitoa(userID) }
+
+// RevokeToken denies a single access token until its own expiry.
+func (d *Denylist) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if jti == "" || ttl <= 0 {
+		return nil
+	}
+	d.mu.Lock()
+	d.jtis[jti] = expiresAt
+	d.mu.Unlock()
+	if d.rdb != nil {
+		return d.rdb.Set(ctx, jtiKey(jti), 1, ttl).Err()
+	}
+	return nil
+}
+
+// RevokeUser denies every access token of the user issued before at, or in
+// the same second: iat has whole seconds, so a token from that second may
+// predate the cut-off. ttl should be the access token lifetime, after which
+// the cut-off is moot.
+func (d *Denylist) RevokeUser(ctx context.Context, userID uint, at time.Time, ttl time.Duration) error {
+	d.mu.Lock()
+	d.users[userID] = cutoff{at: at, expires: at.Add(ttl)}
+	d.mu.Unlock()
+	if d.rdb != nil {
+		return d.rdb.Set(ctx, userKey(userID), at.Unix(), ttl).Err()
+	}
+	return nil
+}
+
+func (d *Denylist) IsTokenRevoked(ctx context.Context, jti string) bool {
+	if d.rdb != nil && jti != "" {
+		n, err := d.rdb.Exists(ctx, jtiKey(jti)).Result()
+		if err == nil {
+			return n > 0
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	exp, ok := d.jtis[jti]
+	if ok && time.Now().After(exp) {
+		delete(d.jtis, jti)
+		return false
+	}
+	return ok
+}
+
+// IssuedBeforeCutoff reports whether a token issued at iat predates the
+// user's last "log out everywhere".
+func (d *Denylist) IssuedBeforeCutoff(ctx context.Context, userID uint, iat time.Time) bool {
+	if d.rdb != nil {
+		v, err := d.rdb.Get(ctx, userKey(userID)).Result()
+		if err == redis.Nil {
+			return false
+		}
+		if err == nil {
+			sec, _ := strconv.ParseInt(v, 10, 64)
+			return iat.Unix() <= sec
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c, ok := d.users[userID]
+	if !ok {
+		return false
+	}
+	if time.Now().After(c.expires) {
+		delete(d.users, userID)
+		return false
+	}
+	return iat.Unix() <= c.at.Unix()
+}
+
+// WithDenylist makes the denylist available to JWT and the users handlers.
+func WithDenylist(d *Denylist) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("tokenDenylist", d)
+			return next(c)
+		}
+	}
+}
+
+func GetDenylist(c echo.Context) *Denylist {
+	if d, ok := c.Get("tokenDenylist").(*Denylist); ok {
+		return d
+	}
+	return nil
+}
+
+// rejectRevoked runs after echo-jwt has validated the token.
+func rejectRevoked(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		d := GetDenylist(c)
+		if d == nil {
+			return next(c)
+		}
+		mc, err := claims(c)
+		if err != nil {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid or missing token"})
+		}
+		ctx := c.Request().Context()
+		if jti, _ := mc["jti"].(string); jti != "" && d.IsTokenRevoked(ctx, jti) {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "TOKEN_REVOKED"})
+		}
+		if iat, err := mc.GetIssuedAt(); err == nil && iat != nil {
+			if uid, err := CurrentUserID(c); err == nil && d.IssuedBeforeCutoff(ctx, uid, iat.Time) {
+				return c.JSON(http.StatusUnauthorized, echo.Map{"error": "TOKEN_REVOKED"})
+			}
+		}
+		return next(c)
+	}
+}
+
+// TokenID returns the jti and expiry of the current access token.
+func TokenID(c echo.Context) (string, time.Time, error) {
+	mc, err := claims(c)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	jti, _ := mc["jti"].(string)
+	var exp time.Time
+	if e, err := mc.GetExpirationTime(); err == nil && e != nil {
+		exp = e.Time
+	}
+	return jti, exp, nil
+}
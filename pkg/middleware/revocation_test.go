@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestIssuedBeforeCutoff(t *testing.T) {
+	ctx := context.Background()
+	at := time.Now().Truncate(time.Second).Add(500 * time.Millisecond)
+	d := NewDenylist(nil)
+	if err := d.RevokeUser(ctx, 1, at, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		user uint
+		iat  time.Time
+		want bool
+	}{
+		{"earlier second", 1, at.Add(-time.Second), true},
+		// iat is truncated to the second, like the claim in a token
+		{"same second", 1, at.Truncate(time.Second), true},
+		{"next second", 1, at.Add(time.Second).Truncate(time.Second), false},
+		{"other user", 2, at.Add(-time.Second), false},
+	} {
+		if got := d.IssuedBeforeCutoff(ctx, tt.user, tt.iat); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
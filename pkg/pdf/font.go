@@ -0,0 +1,372 @@
+package pdf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// font is a TrueType font read far enough to map runes to glyphs, measure
+// text and embed the glyphs a document uses.
+type font struct {
+	name       string
+	tables     map[string][]byte
+	unitsPerEm int
+	ascent     int
+	descent    int
+	bbox       [4]int
+	longLoca   bool
+	numGlyphs  int
+	advances   []uint16
+	cmap       map[rune]uint16
+}
+
+var errBadFont = errors.New("pdf: invalid TrueType font")
+
+func parseFont(name string, data []byte) (*font, error) {
+	tables, err := readTables(data)
+	if err != nil {
+		return nil, err
+	}
+	f := &font{name: name, tables: tables}
+	for _, tag := range []string{"head", "hhea", "maxp", "hmtx", "loca", "glyf", "cmap"} {
+		if f.tables[tag] == nil {
+			return nil, fmt.Errorf("%w: no %s table", errBadFont, tag)
+		}
+	}
+
+	head := f.tables["head"]
+	f.unitsPerEm = int(binary.BigEndian.Uint16(head[18:]))
+	for i := range f.bbox {
+		f.bbox[i] = int(int16(binary.BigEndian.Uint16(head[36+2*i:])))
+	}
+	f.longLoca = binary.BigEndian.Uint16(head[50:]) == 1
+
+	hhea := f.tables["hhea"]
+	f.ascent = int(int16(binary.BigEndian.Uint16(hhea[4:])))
+	f.descent = int(int16(binary.BigEndian.Uint16(hhea[6:])))
+	metrics := int(binary.BigEndian.Uint16(hhea[34:]))
+	f.numGlyphs = int(binary.BigEndian.Uint16(f.tables["maxp"][4:]))
+
+	hmtx := f.tables["hmtx"]
+	if metrics == 0 || len(hmtx) < 4*metrics {
+		return nil, errBadFont
+	}
+	f.advances = make([]uint16, f.numGlyphs)
+	for g := range f.advances {
+		// glyphs past the last metric share its advance
+		f.advances[g] = binary.BigEndian.Uint16(hmtx[4*min(g, metrics-1):])
+	}
+
+	if f.cmap, err = parseCmap(f.tables["cmap"]); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// readTables returns the tables of a font file by tag.
+func readTables(data []byte) (map[string][]byte, error) {
+	if len(data) < 12 {
+		return nil, errBadFont
+	}
+	tables := make(map[string][]byte)
+	n := int(binary.BigEndian.Uint16(data[4:]))
+	for i := 0; i < n; i++ {
+		rec := 12 + 16*i
+		if rec+16 > len(data) {
+			return nil, errBadFont
+		}
+		off := int(binary.BigEndian.Uint32(data[rec+8:]))
+		length := int(binary.BigEndian.Uint32(data[rec+12:]))
+		if off+length > len(data) {
+			return nil, errBadFont
+		}
+		tables[string(data[rec:rec+4])] = data[off : off+length]
+	}
+	return tables, nil
+}
+
+// parseCmap reads the Unicode mapping, preferring the full-range format 12
+// subtable over the BMP-only format 4 one.
+func parseCmap(data []byte) (map[rune]uint16, error) {
+	if len(data) < 4 {
+		return nil, errBadFont
+	}
+	var bmp, full []byte
+	n := int(binary.BigEndian.Uint16(data[2:]))
+	for i := 0; i < n; i++ {
+		rec := 4 + 8*i
+		if rec+8 > len(data) {
+			return nil, errBadFont
+		}
+		platform := binary.BigEndian.Uint16(data[rec:])
+		encoding := binary.BigEndian.Uint16(data[rec+2:])
+		off := int(binary.BigEndian.Uint32(data[rec+4:]))
+		if off+4 > len(data) {
+			return nil, errBadFont
+		}
+		sub := data[off:]
+		switch format := binary.BigEndian.Uint16(sub); {
+		case format == 12 && (platform == 3 && encoding == 10 || platform == 0):
+			full = sub
+		case format == 4 && (platform == 3 && encoding == 1 || platform == 0):
+			bmp = sub
+		}
+	}
+	switch {
+	case full != nil:
+		return parseCmap12(full)
+	case bmp != nil:
+		return parseCmap4(bmp)
+	}
+	return nil, fmt.Errorf("%w: no Unicode cmap", errBadFont)
+}
+
+func parseCmap4(sub []byte) (map[rune]uint16, error) {
+	if len(sub) < 14 {
+		return nil, errBadFont
+	}
+	segs := int(binary.BigEndian.Uint16(sub[6:])) / 2
+	ends := 14
+	starts := ends + 2*segs + 2
+	deltas := starts + 2*segs
+	ranges := deltas + 2*segs
+	if ranges+2*segs > len(sub) {
+		return nil, errBadFont
+	}
+	m := make(map[rune]uint16)
+	for i := 0; i < segs; i++ {
+		end := int(binary.BigEndian.Uint16(sub[ends+2*i:]))
+		start := int(binary.BigEndian.Uint16(sub[starts+2*i:]))
+		delta := int(binary.BigEndian.Uint16(sub[deltas+2*i:]))
+		rangeOff := int(binary.BigEndian.Uint16(sub[ranges+2*i:]))
+		for c := start; c <= end && c != 0xFFFF; c++ {
+			g := (c + delta) & 0xFFFF
+			if rangeOff != 0 {
+				at := ranges + 2*i + rangeOff + 2*(c-start)
+				if at+2 > len(sub) {
+					return nil, errBadFont
+				}
+				g = int(binary.BigEndian.Uint16(sub[at:]))
+				if g != 0 {
+					g = (g + delta) & 0xFFFF
+				}
+			}
+			if g != 0 {
+				m[rune(c)] = uint16(g)
+			}
+		}
+	}
+	return m, nil
+}
+
+func parseCmap12(sub []byte) (map[rune]uint16, error) {
+	if len(sub) < 16 {
+		return nil, errBadFont
+	}
+	groups := int(binary.BigEndian.Uint32(sub[12:]))
+	if 16+12*groups > len(sub) {
+		return nil, errBadFont
+	}
+	m := make(map[rune]uint16)
+	for i := 0; i < groups; i++ {
+		g := sub[16+12*i:]
+		start := binary.BigEndian.Uint32(g)
+		end := binary.BigEndian.Uint32(g[4:])
+		glyph := binary.BigEndian.Uint32(g[8:])
+		for c := start; c <= end && c <= 0x10FFFF; c++ {
+			if id := glyph + (c - start); id != 0 && id < 0xFFFF {
+				m[rune(c)] = uint16(id)
+			}
+		}
+	}
+	return m, nil
+}
+
+// glyph returns the glyph of r, or 0 (.notdef) when the font lacks it.
+func (f *font) glyph(r rune) uint16 {
+	return f.cmap[r]
+}
+
+func (f *font) has(r rune) bool {
+	_, ok := f.cmap[r]
+	return ok
+}
+
+// advance returns the width of glyph g in thousandths of the font size.
+func (f *font) advance(g uint16) float64 {
+	if int(g) >= len(f.advances) {
+		return 0
+	}
+	return float64(f.advances[g]) * 1000 / float64(f.unitsPerEm)
+}
+
+// scale converts font units to thousandths of the font size.
+func (f *font) scale(v int) int {
+	return v * 1000 / f.unitsPerEm
+}
+
+func (f *font) glyphData(g uint16) []byte {
+	loca, glyf := f.tables["loca"], f.tables["glyf"]
+	var start, end int
+	if f.longLoca {
+		if 4*int(g)+8 > len(loca) {
+			return nil
+		}
+		start = int(binary.BigEndian.Uint32(loca[4*int(g):]))
+		end = int(binary.BigEndian.Uint32(loca[4*int(g)+4:]))
+	} else {
+		if 2*int(g)+4 > len(loca) {
+			return nil
+		}
+		start = 2 * int(binary.BigEndian.Uint16(loca[2*int(g):]))
+		end = 2 * int(binary.BigEndian.Uint16(loca[2*int(g)+2:]))
+	}
+	if start >= end || end > len(glyf) {
+		return nil
+	}
+	return glyf[start:end]
+}
+
+// components returns the glyphs a composite glyph is built from.
+func components(data []byte) []uint16 {
+	if len(data) < 10 || int16(binary.BigEndian.Uint16(data)) >= 0 {
+		return nil
+	}
+	const (
+		argsAreWords  = 0x0001
+		haveScale     = 0x0008
+		moreComponent = 0x0020
+		haveXYScale   = 0x0040
+		haveTwoByTwo  = 0x0080
+	)
+	var out []uint16
+	for p := 10; p+4 <= len(data); {
+		flags := binary.BigEndian.Uint16(data[p:])
+		out = append(out, binary.BigEndian.Uint16(data[p+2:]))
+		p += 4
+		if flags&argsAreWords != 0 {
+			p += 4
+		} else {
+			p += 2
+		}
+		switch {
+		case flags&haveScale != 0:
+			p += 2
+		case flags&haveXYScale != 0:
+			p += 4
+		case flags&haveTwoByTwo != 0:
+			p += 8
+		}
+		if flags&moreComponent == 0 {
+			break
+		}
+	}
+	return out
+}
+
+// subset returns a font file in which only the used glyphs, and the glyphs
+// they are composed of, keep their outlines. Glyph ids are unchanged, so
+// text is written with the ids of the full font.
+func (f *font) subset(used map[uint16]bool) []byte {
+	keep := map[uint16]bool{}
+	var visit func(g uint16)
+	visit = func(g uint16) {
+		if keep[g] || int(g) >= f.numGlyphs {
+			return
+		}
+		keep[g] = true
+		for _, c := range components(f.glyphData(g)) {
+			visit(c)
+		}
+	}
+	visit(0)
+	for g := range used {
+		visit(g)
+	}
+
+	var glyf []byte
+	loca := make([]byte, 4*(f.numGlyphs+1))
+	for g := 0; g < f.numGlyphs; g++ {
+		binary.BigEndian.PutUint32(loca[4*g:], uint32(len(glyf)))
+		if keep[uint16(g)] {
+			glyf = append(glyf, f.glyphData(uint16(g))...)
+			for len(glyf)%4 != 0 {
+				glyf = append(glyf, 0)
+			}
+		}
+	}
+	binary.BigEndian.PutUint32(loca[4*f.numGlyphs:], uint32(len(glyf)))
+
+	head := append([]byte(nil), f.tables["head"]...)
+	binary.BigEndian.PutUint32(head[8:], 0) // checkSumAdjustment, set below
+	binary.BigEndian.PutUint16(head[50:], 1)
+
+	tables := map[string][]byte{
+		"head": head,
+		"hhea": f.tables["hhea"],
+		"maxp": f.tables["maxp"],
+		"hmtx": f.tables["hmtx"],
+		"loca": loca,
+		"glyf": glyf,
+	}
+	// hinting programs are needed by the glyphs that use them
+	for _, tag := range []string{"cvt ", "fpgm", "prep"} {
+		if t := f.tables[tag]; t != nil {
+			tables[tag] = t
+		}
+	}
+	return writeFont(tables)
+}
+
+func writeFont(tables map[string][]byte) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	n := len(tags)
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= n {
+		entrySelector++
+	}
+	searchRange := 16 << entrySelector
+
+	out := make([]byte, 12+16*n)
+	binary.BigEndian.PutUint32(out, 0x00010000)
+	binary.BigEndian.PutUint16(out[4:], uint16(n))
+	binary.BigEndian.PutUint16(out[6:], uint16(searchRange))
+	binary.BigEndian.PutUint16(out[8:], uint16(entrySelector))
+	binary.BigEndian.PutUint16(out[10:], uint16(16*n-searchRange))
+
+	headAt := 0
+	for i, tag := range tags {
+		t := tables[tag]
+		rec := out[12+16*i:]
+		copy(rec, tag)
+		binary.BigEndian.PutUint32(rec[4:], checksum(t))
+		binary.BigEndian.PutUint32(rec[8:], uint32(len(out)))
+		binary.BigEndian.PutUint32(rec[12:], uint32(len(t)))
+		if tag == "head" {
+			headAt = len(out)
+		}
+		out = append(out, t...)
+		for len(out)%4 != 0 {
+			out = append(out, 0)
+		}
+	}
+	binary.BigEndian.PutUint32(out[headAt+8:], 0xB1B0AFBA-checksum(out))
+	return out
+}
+
+func checksum(b []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(b); i += 4 {
+		var word [4]byte
+		copy(word[:], b[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
@@ -0,0 +1,272 @@
+// Package pdf writes simple text documents (invoices, receipts) as PDF 1.4.
+// Text is set in DejaVu Sans, embedded in the binary and subset into each
+// document, so Persian and other non-Latin text prints as written: Arabic
+// script is shaped and right-to-left runs are reordered before drawing.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	_ "embed"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A4 page size in points.
+const (
+	A4Width  = 595.28
+	A4Height = 841.89
+)
+
+var (
+	//go:embed fonts/DejaVuSans.ttf
+	regularTTF []byte
+	//go:embed fonts/DejaVuSans-Bold.ttf
+	boldTTF []byte
+)
+
+// fonts are the regular and the bold face, parsed on first use.
+var fonts = sync.OnceValue(func() [2]*font {
+	regular, err := parseFont("DejaVuSans", regularTTF)
+	if err != nil {
+		panic(err)
+	}
+	bold, err := parseFont("DejaVuSans-Bold", boldTTF)
+	if err != nil {
+		panic(err)
+	}
+	return [2]*font{regular, bold}
+})
+
+func face(bold bool) int {
+	if bold {
+		return 1
+	}
+	return 0
+}
+
+type Document struct {
+	pages []*Page
+	// used maps the glyphs drawn with each face to the text they stand for
+	used [2]map[uint16][]rune
+}
+
+type Page struct {
+	doc     *Document
+	content bytes.Buffer
+}
+
+func New() *Document {
+	return &Document{used: [2]map[uint16][]rune{{}, {}}}
+}
+
+func (d *Document) AddPage() *Page {
+	p := &Page{doc: d}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+// glyphs shapes s and returns its glyphs in drawing order.
+func glyphs(f *font, s string) ([]uint16, []cluster) {
+	cs := visual(shape(s, f.has))
+	gs := make([]uint16, len(cs))
+	for i, c := range cs {
+		gs[i] = f.glyph(c.r)
+	}
+	return gs, cs
+}
+
+// Text draws s with its baseline starting at (x, y); y grows upwards from
+// the bottom of the page.
+func (p *Page) Text(x, y, size float64, bold bool, s string) {
+	if s == "" {
+		return
+	}
+	i := face(bold)
+	gs, cs := glyphs(fonts()[i], s)
+	var hex strings.Builder
+	for k, g := range gs {
+		fmt.Fprintf(&hex, "%04X", g)
+		if _, ok := p.doc.used[i][g]; !ok {
+			p.doc.used[i][g] = cs[k].text
+		}
+	}
+	fmt.Fprintf(&p.content, "BT /F%d %.2f Tf %.2f %.2f Td <%s> Tj ET\n", i+1, size, x, y, hex.String())
+}
+
+// TextRight draws s so that it ends at x.
+func (p *Page) TextRight(x, y, size float64, bold bool, s string) {
+	p.Text(x-textWidth(fonts()[face(bold)], s, size), y, size, bold, s)
+}
+
+// Line draws a thin line.
+func (p *Page) Line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(&p.content, "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, y1, x2, y2)
+}
+
+// Width returns the width of s in the regular face.
+func Width(s string, size float64) float64 {
+	return textWidth(fonts()[0], s, size)
+}
+
+func textWidth(f *font, s string, size float64) float64 {
+	gs, _ := glyphs(f, s)
+	w := 0.0
+	for _, g := range gs {
+		w += f.advance(g)
+	}
+	return w * size / 1000
+}
+
+// WriteTo serialises the document.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+	// objects are numbered before they are written: 1 catalog, 2 pages,
+	// 3-4 the two faces, then a page and its content per page, then the
+	// rest of each face
+	var objs []string
+	reserve := func() int {
+		objs = append(objs, "")
+		return len(objs)
+	}
+	catalog, pages := reserve(), reserve()
+	faces := [2]int{reserve(), reserve()}
+	kids := make([]string, len(d.pages))
+	pageObjs := make([]int, len(d.pages))
+	for i := range d.pages {
+		pageObjs[i] = reserve()
+		reserve()
+		kids[i] = fmt.Sprintf("%d 0 R", pageObjs[i])
+	}
+
+	objs[catalog-1] = fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pages)
+	objs[pages-1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages))
+	var resources strings.Builder
+	for i, f := range fonts() {
+		if len(d.used[i]) == 0 {
+			objs[faces[i]-1] = "null"
+			continue
+		}
+		objs[faces[i]-1] = fontObjects(f, d.used[i], reserve, func(n int, body string) { objs[n-1] = body })
+		fmt.Fprintf(&resources, "/F%d %d 0 R ", i+1, faces[i])
+	}
+	for i, p := range d.pages {
+		objs[pageObjs[i]-1] = fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] "+
+			"/Resources << /Font << %s>> >> /Contents %d 0 R >>",
+			pages, A4Width, A4Height, resources.String(), pageObjs[i]+1)
+		objs[pageObjs[i]] = stream("", p.content.Bytes())
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objs))
+	for i, body := range objs {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, body)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, catalog, xref)
+
+	written, err := w.Write(buf.Bytes())
+	return int64(written), err
+}
+
+// fontObjects writes the descendant objects of a face as a Type0 font with
+// identity encoding (text is written as glyph ids) and returns the body of
+// the font dictionary itself.
+func fontObjects(f *font, used map[uint16][]rune, reserve func() int, set func(int, string)) string {
+	ids := make([]uint16, 0, len(used))
+	for g := range used {
+		ids = append(ids, g)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	// a subset font is named with a tag derived from its glyphs
+	h := fnv.New32a()
+	for _, g := range ids {
+		fmt.Fprint(h, g, ",")
+	}
+	sum := h.Sum32()
+	tag := make([]byte, 6)
+	for i := range tag {
+		tag[i] = 'A' + byte(sum%26)
+		sum /= 26
+	}
+	name := string(tag) + "+" + f.name
+
+	var widths strings.Builder
+	for _, g := range ids {
+		fmt.Fprintf(&widths, "%d [%d] ", g, int(f.advance(g)+0.5))
+	}
+	var cmap strings.Builder
+	cmap.WriteString("/CIDInit /ProcSet findresource begin 12 dict begin begincmap\n" +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n" +
+		"/CMapName /Adobe-Identity-UCS def /CMapType 2 def\n" +
+		"1 begincodespacerange <0000> <FFFF> endcodespacerange\n")
+	for start := 0; start < len(ids); start += 100 {
+		chunk := ids[start:min(start+100, len(ids))]
+		fmt.Fprintf(&cmap, "%d beginbfchar\n", len(chunk))
+		for _, g := range chunk {
+			fmt.Fprintf(&cmap, "<%04X> <", g)
+			for _, r := range used[g] {
+				for _, u := range utf16(r) {
+					fmt.Fprintf(&cmap, "%04X", u)
+				}
+			}
+			cmap.WriteString(">\n")
+		}
+		cmap.WriteString("endbfchar\n")
+	}
+	cmap.WriteString("endcmap CMapName currentdict /CMap defineresource pop end end\n")
+
+	file, descriptor, cidFont, toUnicode := reserve(), reserve(), reserve(), reserve()
+	keep := make(map[uint16]bool, len(ids))
+	for _, g := range ids {
+		keep[g] = true
+	}
+	raw := f.subset(keep)
+	set(file, stream(fmt.Sprintf("/Filter /FlateDecode /Length1 %d ", len(raw)), deflate(raw)))
+	set(descriptor, fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags 32 /FontBBox [%d %d %d %d] "+
+		"/ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+		name, f.scale(f.bbox[0]), f.scale(f.bbox[1]), f.scale(f.bbox[2]), f.scale(f.bbox[3]),
+		f.scale(f.ascent), f.scale(f.descent), f.scale(f.ascent), file))
+	set(cidFont, fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s "+
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> "+
+		"/FontDescriptor %d 0 R /CIDToGIDMap /Identity /W [%s] >>", name, descriptor, widths.String()))
+	set(toUnicode, stream("", []byte(cmap.String())))
+	return fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H "+
+		"/DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>", name, cidFont, toUnicode)
+}
+
+// stream returns a stream object; extra holds further dictionary entries
+// such as /Filter.
+func stream(extra string, data []byte) string {
+	return fmt.Sprintf("<< %s/Length %d >>\nstream\n%s\nendstream", extra, len(data), data)
+}
+
+func deflate(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func utf16(r rune) []uint16 {
+	if r < 0x10000 {
+		return []uint16{uint16(r)}
+	}
+	r -= 0x10000
+	return []uint16{uint16(0xD800 + r>>10), uint16(0xDC00 + r&0x3FF)}
+}
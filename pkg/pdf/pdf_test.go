@@ -0,0 +1,223 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func runes(cs []cluster) string {
+	var b strings.Builder
+	for _, c := range cs {
+		b.WriteRune(c.r)
+	}
+	return b.String()
+}
+
+func TestShape(t *testing.T) {
+	all := func(rune) bool { return true }
+	for _, tt := range []struct {
+		in   string
+		want []rune
+	}{
+		// beh initial, waw final, feh isolated; keheh initial, waw final, reh isolated
+		{"بوف کور", []rune{0xFE91, 0xFEEE, 0xFED1, ' ', 0xFB90, 0xFEEE, 0xFEAD}},
+		// lam-alef ligature, then lam initial and heh final
+		{"لاله", []rune{0xFEFB, 0xFEDF, 0xFEEA}},
+		// the zero-width non-joiner keeps noon isolated and is dropped
+		{"نی‌ها", []rune{0xFEE7, 0xFBFD, 0xFEEB, 0xFE8E}},
+		{"Total", []rune("Total")},
+	} {
+		if got := runes(shape(tt.in, all)); got != string(tt.want) {
+			t.Errorf("shape(%q) = %U, want %U", tt.in, []rune(got), tt.want)
+		}
+	}
+
+	// forms missing from the font fall back to the letter
+	if got := runes(shape("بب", func(r rune) bool { return r < 0xFB50 })); got != "بب" {
+		t.Errorf("without presentation forms: %q", got)
+	}
+}
+
+func TestVisual(t *testing.T) {
+	plain := func(s string) []cluster {
+		var cs []cluster
+		for _, r := range s {
+			cs = append(cs, cluster{r: r, text: []rune{r}})
+		}
+		return cs
+	}
+	for _, tt := range []struct{ in, want string }{
+		{"INV-2024-000001", "INV-2024-000001"},
+		{"بوف کور", "روک فوب"},
+		// numbers keep their order inside right-to-left text
+		{"مبلغ ۱۲۰٬۰۰۰ ریال", "لایر ۱۲۰٬۰۰۰ غلبم"},
+		{"تاریخ: ۱۴۰۳/۰۱/۲۵", "۱۴۰۳/۰۱/۲۵ :خیرات"},
+		// brackets are mirrored
+		{"جریمه (۳)", "(۳) همیرج"},
+		// a Persian note inside English text
+		{"Fine payment - جریمه دیرکرد (loan #3)", "Fine payment - درکرید همیرج (loan #3)"},
+	} {
+		if got := runes(visual(plain(tt.in))); got != tt.want {
+			t.Errorf("visual(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFontsCoverPersian(t *testing.T) {
+	const persian = "ابپتثجچحخدذرزژسشصضطظعغفقکگلمنوهیآئء۰۱۲۳۴۵۶۷۸۹٬٫٪"
+	for _, f := range fonts() {
+		for _, r := range persian {
+			for _, form := range append([]rune{r}, arabicForms[r]...) {
+				if !f.has(form) {
+					t.Errorf("%s has no glyph for %U", f.name, form)
+				}
+			}
+		}
+	}
+}
+
+func TestSubset(t *testing.T) {
+	f := fonts()[0]
+	gs, _ := glyphs(f, "بوف کور")
+	used := map[uint16]bool{}
+	for _, g := range gs {
+		used[g] = true
+	}
+	data := f.subset(used)
+	if checksum(data) != 0xB1B0AFBA {
+		t.Errorf("font checksum %#x", checksum(data))
+	}
+
+	tables, err := readTables(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tables["cmap"]; ok {
+		t.Error("subset kept the cmap; text is written with glyph ids")
+	}
+	sub := &font{tables: tables, longLoca: true}
+	for g := range used {
+		if !bytes.Equal(sub.glyphData(g), f.glyphData(g)) {
+			t.Errorf("glyph %d changed", g)
+		}
+	}
+	if unused := f.glyph('Z'); sub.glyphData(unused) != nil {
+		t.Errorf("unused glyph %d kept", unused)
+	}
+}
+
+var (
+	tjPattern     = regexp.MustCompile(`<([0-9A-F]*)> Tj`)
+	streamPattern = regexp.MustCompile(`/Filter /FlateDecode /Length1 (\d+) /Length (\d+) >>\nstream\n`)
+)
+
+// drawnGlyphs returns the glyph ids of every text operator in a PDF.
+func drawnGlyphs(t *testing.T, out []byte) []uint16 {
+	t.Helper()
+	var gs []uint16
+	for _, m := range tjPattern.FindAllSubmatch(out, -1) {
+		b, err := hex.DecodeString(string(m[1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i+1 < len(b); i += 2 {
+			gs = append(gs, uint16(b[i])<<8|uint16(b[i+1]))
+		}
+	}
+	return gs
+}
+
+func TestDocumentPersian(t *testing.T) {
+	doc := New()
+	page := doc.AddPage()
+	page.Text(50, 700, 20, true, "صورتحساب فروش")
+	page.TextRight(545, 650, 10, false, "بوف کور - ۱۲۰٬۰۰۰ ریال")
+	page.Text(50, 600, 10, false, "Invoice INV-2024-000001")
+	var buf bytes.Buffer
+	if _, err := doc.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.Bytes()
+
+	gs := drawnGlyphs(t, out)
+	if len(gs) == 0 {
+		t.Fatal("no text drawn")
+	}
+	for _, g := range gs {
+		if g == 0 {
+			t.Fatal("text drawn with .notdef")
+		}
+	}
+	question := fonts()[0].glyph('?')
+	for _, g := range gs {
+		if g == question {
+			t.Fatal("text drawn as '?'")
+		}
+	}
+
+	// copy and paste gets the letters back
+	for _, r := range []string{"<0628>", "<06A9>", "<06F1>", "<0049>"} {
+		if !bytes.Contains(out, []byte(r)) {
+			t.Errorf("ToUnicode has no %s", r)
+		}
+	}
+
+	// both faces are embedded as valid subsets
+	fontsFound := 0
+	for _, m := range streamPattern.FindAllSubmatchIndex(out, -1) {
+		n1, _ := strconv.Atoi(string(out[m[2]:m[3]]))
+		n, _ := strconv.Atoi(string(out[m[4]:m[5]]))
+		zr, err := zlib.NewReader(bytes.NewReader(out[m[1] : m[1]+n]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(raw) != n1 || checksum(raw) != 0xB1B0AFBA {
+			t.Errorf("embedded font: %d bytes, /Length1 %d, checksum %#x", len(raw), n1, checksum(raw))
+		}
+		fontsFound++
+	}
+	if fontsFound != 2 {
+		t.Errorf("%d fonts embedded, want 2", fontsFound)
+	}
+}
+
+func TestWriteToOffsets(t *testing.T) {
+	doc := New()
+	doc.AddPage().Text(50, 700, 12, false, "one")
+	doc.AddPage().Text(50, 700, 12, true, "two")
+	var buf bytes.Buffer
+	if _, err := doc.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.Bytes()
+
+	m := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(out)
+	if m == nil {
+		t.Fatal("no startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	lines := strings.Split(string(out[xref:]), "\n")
+	if lines[0] != "xref" {
+		t.Fatalf("startxref points at %q", lines[0])
+	}
+	count, err := strconv.Atoi(strings.Fields(lines[1])[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < count; i++ {
+		off, _ := strconv.Atoi(lines[2+i][:10])
+		if want := strconv.Itoa(i) + " 0 obj"; !bytes.HasPrefix(out[off:], []byte(want)) {
+			t.Errorf("xref entry %d points at %q", i, out[off:off+12])
+		}
+	}
+}
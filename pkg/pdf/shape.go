@@ -0,0 +1,312 @@
+package pdf
+
+import "unicode"
+
+// PDF draws glyphs left to right exactly as given, so right-to-left text
+// has to be shaped and reordered before it is written: Arabic-script
+// letters are replaced by the presentation form for their position in the
+// word, and runs are put in visual order with a reduced form of the Unicode
+// bidirectional algorithm (one paragraph, no explicit embeddings).
+
+// cluster is one rune to draw and the text it stands for, which differs
+// for presentation forms and ligatures and is kept for copy and paste.
+type cluster struct {
+	r    rune
+	text []rune
+}
+
+// arabicForms lists isolated, final, initial and medial forms; letters
+// with only two forms join on their right side only.
+var arabicForms = map[rune][]rune{
+	0x0621: {0xFE80},
+	0x0622: {0xFE81, 0xFE82},
+	0x0623: {0xFE83, 0xFE84},
+	0x0624: {0xFE85, 0xFE86},
+	0x0625: {0xFE87, 0xFE88},
+	0x0626: {0xFE89, 0xFE8A, 0xFE8B, 0xFE8C},
+	0x0627: {0xFE8D, 0xFE8E},
+	0x0628: {0xFE8F, 0xFE90, 0xFE91, 0xFE92},
+	0x0629: {0xFE93, 0xFE94},
+	0x062A: {0xFE95, 0xFE96, 0xFE97, 0xFE98},
+	0x062B: {0xFE99, 0xFE9A, 0xFE9B, 0xFE9C},
+	0x062C: {0xFE9D, 0xFE9E, 0xFE9F, 0xFEA0},
+	0x062D: {0xFEA1, 0xFEA2, 0xFEA3, 0xFEA4},
+	0x062E: {0xFEA5, 0xFEA6, 0xFEA7, 0xFEA8},
+	0x062F: {0xFEA9, 0xFEAA},
+	0x0630: {0xFEAB, 0xFEAC},
+	0x0631: {0xFEAD, 0xFEAE},
+	0x0632: {0xFEAF, 0xFEB0},
+	0x0633: {0xFEB1, 0xFEB2, 0xFEB3, 0xFEB4},
+	0x0634: {0xFEB5, 0xFEB6, 0xFEB7, 0xFEB8},
+	0x0635: {0xFEB9, 0xFEBA, 0xFEBB, 0xFEBC},
+	0x0636: {0xFEBD, 0xFEBE, 0xFEBF, 0xFEC0},
+	0x0637: {0xFEC1, 0xFEC2, 0xFEC3, 0xFEC4},
+	0x0638: {0xFEC5, 0xFEC6, 0xFEC7, 0xFEC8},
+	0x0639: {0xFEC9, 0xFECA, 0xFECB, 0xFECC},
+	0x063A: {0xFECD, 0xFECE, 0xFECF, 0xFED0},
+	0x0641: {0xFED1, 0xFED2, 0xFED3, 0xFED4},
+	0x0642: {0xFED5, 0xFED6, 0xFED7, 0xFED8},
+	0x0643: {0xFED9, 0xFEDA, 0xFEDB, 0xFEDC},
+	0x0644: {0xFEDD, 0xFEDE, 0xFEDF, 0xFEE0},
+	0x0645: {0xFEE1, 0xFEE2, 0xFEE3, 0xFEE4},
+	0x0646: {0xFEE5, 0xFEE6, 0xFEE7, 0xFEE8},
+	0x0647: {0xFEE9, 0xFEEA, 0xFEEB, 0xFEEC},
+	0x0648: {0xFEED, 0xFEEE},
+	0x0649: {0xFEEF, 0xFEF0},
+	0x064A: {0xFEF1, 0xFEF2, 0xFEF3, 0xFEF4},
+	0x067E: {0xFB56, 0xFB57, 0xFB58, 0xFB59}, // peh
+	0x0686: {0xFB7A, 0xFB7B, 0xFB7C, 0xFB7D}, // tcheh
+	0x0698: {0xFB8A, 0xFB8B},                 // jeh
+	0x06A9: {0xFB8E, 0xFB8F, 0xFB90, 0xFB91}, // keheh
+	0x06AF: {0xFB92, 0xFB93, 0xFB94, 0xFB95}, // gaf
+	0x06CC: {0xFBFC, 0xFBFD, 0xFBFE, 0xFBFF}, // farsi yeh
+}
+
+// lamAlef maps the alef that follows a lam to the isolated and final forms
+// of their ligature.
+var lamAlef = map[rune][2]rune{
+	0x0622: {0xFEF5, 0xFEF6},
+	0x0623: {0xFEF7, 0xFEF8},
+	0x0625: {0xFEF9, 0xFEFA},
+	0x0627: {0xFEFB, 0xFEFC},
+}
+
+const (
+	lam        = 0x0644
+	tatweel    = 0x0640
+	zwnj, zwj  = 0x200C, 0x200D
+	formIsol   = 0
+	formFinal  = 1
+	formInit   = 2
+	formMedial = 3
+)
+
+// transparent marks (harakat) sit on a letter without breaking its joins.
+func transparent(r rune) bool {
+	return r >= 0x064B && r <= 0x065F || r == 0x0670
+}
+
+// joinsBefore reports whether r connects to the letter after it.
+func joinsBefore(r rune) bool {
+	return len(arabicForms[r]) == 4 || r == tatweel || r == zwj
+}
+
+// joinsAfter reports whether r connects to the letter before it.
+func joinsAfter(r rune) bool {
+	return len(arabicForms[r]) >= 2 || r == tatweel || r == zwj
+}
+
+// shape replaces Arabic-script letters by their contextual forms, in
+// logical order. has reports whether the font has a glyph; forms it lacks
+// fall back to the plain letter.
+func shape(s string, has func(rune) bool) []cluster {
+	rs := []rune(s)
+	// neighbour returns the closest rune before (step -1) or after (+1) i
+	// that is not a transparent mark
+	neighbour := func(i, step int) rune {
+		for j := i + step; j >= 0 && j < len(rs); j += step {
+			if !transparent(rs[j]) {
+				return rs[j]
+			}
+		}
+		return 0
+	}
+
+	out := make([]cluster, 0, len(rs))
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		if r == zwnj || r == zwj {
+			continue // only affect joining
+		}
+		forms, ok := arabicForms[r]
+		if !ok {
+			out = append(out, cluster{r: r, text: []rune{r}})
+			continue
+		}
+		prev := joinsBefore(neighbour(i, -1))
+		if r == lam && i+1 < len(rs) {
+			if lig, ok := lamAlef[rs[i+1]]; ok {
+				form := lig[0]
+				if prev {
+					form = lig[1]
+				}
+				if has(form) {
+					out = append(out, cluster{r: form, text: rs[i : i+2]})
+					i++
+					continue
+				}
+			}
+		}
+		next := len(forms) == 4 && joinsAfter(neighbour(i, +1))
+		form := formIsol
+		switch {
+		case prev && next:
+			form = formMedial
+		case prev:
+			form = formFinal
+		case next:
+			form = formInit
+		}
+		if form >= len(forms) {
+			form = formIsol
+		}
+		shaped := forms[form]
+		if !has(shaped) {
+			shaped = r
+		}
+		out = append(out, cluster{r: shaped, text: []rune{r}})
+	}
+	return out
+}
+
+// bidi classes, as far as they are told apart here.
+const (
+	classL = iota
+	classR
+	classNumber
+	classSeparator // between digits it joins the number
+	classNeutral
+)
+
+func bidiClass(r rune) int {
+	switch {
+	case r >= '0' && r <= '9', r >= 0x0660 && r <= 0x0669, r >= 0x06F0 && r <= 0x06F9,
+		r == 0x066B, r == 0x066C:
+		return classNumber
+	case r == '.' || r == ',' || r == ':' || r == '/' || r == '-' || r == '+':
+		return classSeparator
+	case r >= 0x0590 && r <= 0x08FF, r >= 0xFB1D && r <= 0xFDFF, r >= 0xFE70 && r <= 0xFEFF:
+		if transparent(r) {
+			return classNeutral
+		}
+		return classR
+	case unicode.IsLetter(r):
+		return classL
+	}
+	return classNeutral
+}
+
+// mirrored lists the characters drawn mirrored in right-to-left runs.
+var mirrored = map[rune]rune{
+	'(': ')', ')': '(', '[': ']', ']': '[', '{': '}', '}': '{',
+	'<': '>', '>': '<', '«': '»', '»': '«',
+}
+
+// visual returns the clusters of one line in the order they are drawn,
+// left to right. The base direction is that of the first strong letter.
+func visual(cs []cluster) []cluster {
+	classes := make([]int, len(cs))
+	base := -1
+	for i, c := range cs {
+		classes[i] = bidiClass(c.r)
+		if base < 0 && (classes[i] == classL || classes[i] == classR) {
+			base = classes[i]
+		}
+	}
+	if base != classR && base != classL {
+		base = classL
+	}
+
+	// a separator between two digits belongs to the number
+	for i, c := range classes {
+		if c == classSeparator {
+			if i > 0 && i+1 < len(classes) && classes[i-1] == classNumber && classes[i+1] == classNumber {
+				classes[i] = classNumber
+			} else {
+				classes[i] = classNeutral
+			}
+		}
+	}
+
+	// numbers after Latin text read as Latin; the others count as right to
+	// left when resolving the neutrals around them
+	strong := base
+	for i, c := range classes {
+		switch c {
+		case classL, classR:
+			strong = c
+		case classNumber:
+			if strong == classL {
+				classes[i] = classL
+			}
+		}
+	}
+
+	// neutrals between two runs of the same direction take it, others take
+	// the base direction
+	dir := func(c int) int {
+		if c == classNumber {
+			return classR
+		}
+		return c
+	}
+	for i := 0; i < len(classes); {
+		if classes[i] != classNeutral {
+			i++
+			continue
+		}
+		j := i
+		for j < len(classes) && classes[j] == classNeutral {
+			j++
+		}
+		before, after := base, base
+		if i > 0 {
+			before = dir(classes[i-1])
+		}
+		if j < len(classes) {
+			after = dir(classes[j])
+		}
+		resolved := base
+		if before == after {
+			resolved = before
+		}
+		for k := i; k < j; k++ {
+			classes[k] = resolved
+		}
+		i = j
+	}
+
+	// embedding levels: right-to-left runs are odd, numbers inside them
+	// are a left-to-right run one level up
+	levels := make([]int, len(classes))
+	for i, c := range classes {
+		switch {
+		case c == classNumber:
+			levels[i] = 2
+		case c == classR:
+			levels[i] = 1
+		case base == classR:
+			levels[i] = 2
+		}
+	}
+	out := append([]cluster(nil), cs...)
+	for i := range out {
+		if levels[i] == 1 {
+			if m, ok := mirrored[out[i].r]; ok {
+				out[i] = cluster{r: m, text: []rune{m}}
+			}
+		}
+	}
+	for level := 2; level >= 1; level-- {
+		for i := 0; i < len(out); {
+			if levels[i] < level {
+				i++
+				continue
+			}
+			j := i
+			for j < len(out) && levels[j] >= level {
+				j++
+			}
+			reverse(out[i:j])
+			reverse(levels[i:j])
+			i = j
+		}
+	}
+	return out
+}
+
+func reverse[T any](s []T) {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+}
@@ -0,0 +1,79 @@
+package rabbitmq
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/erfnzmn/Library_Management_System/pkg/middleware"
+	"github.com/labstack/echo/v4"
+)
+
+// AdminHandler lets circulation staff look into and replay reservation
+// requests that ended up in DeadQueue.
+type AdminHandler struct {
+	client    *Client
+	jwtSecret string
+}
+
+func NewAdminHandler(client *Client, jwtSecret string) *AdminHandler {
+	return &AdminHandler{client: client, jwtSecret: jwtSecret}
+}
+
+// DeadLetterRequest selects dead letters by message id.
+type DeadLetterRequest struct {
+	MessageIDs []string `json:"message_ids"`
+}
+
+func (h *AdminHandler) RegisterRoutes(e *echo.Echo) {
+	g := e.Group("/api/loans/dead-letters")
+	g.Use(middleware.JWT(h.jwtSecret))
+	g.Use(middleware.RequirePermission(middleware.PermLoansManage))
+
+	g.GET("", h.List)
+	g.POST("/replay", h.Replay)
+	g.POST("/discard", h.Discard)
+}
+
+// List ?limit= (default and max 1000)
+func (h *AdminHandler) List(c echo.Context) error {
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	list, err := h.client.DeadLetters(limit)
+	if err != nil {
+		return c.JSON(adminErrorStatus(err), echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// Replay — an empty message_ids list replays everything
+func (h *AdminHandler) Replay(c echo.Context) error {
+	var req DeadLetterRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid input"})
+	}
+	n, err := h.client.ReplayDeadLetters(req.MessageIDs)
+	if err != nil {
+		return c.JSON(adminErrorStatus(err), echo.Map{"error": err.Error(), "replayed": n})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"replayed": n})
+}
+
+// Discard — message_ids is required so that nothing is dropped by accident
+func (h *AdminHandler) Discard(c echo.Context) error {
+	var req DeadLetterRequest
+	if err := c.Bind(&req); err != nil || len(req.MessageIDs) == 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "message_ids is required"})
+	}
+	n, err := h.client.DiscardDeadLetters(req.MessageIDs)
+	if err != nil {
+		return c.JSON(adminErrorStatus(err), echo.Map{"error": err.Error(), "discarded": n})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"discarded": n})
+}
+
+func adminErrorStatus(err error) int {
+	if errors.Is(err, ErrNotConnected) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
@@ -3,16 +3,39 @@ package rabbitmq
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
+	"os"
 
 	"github.com/streadway/amqp"
 	"github.com/erfnzmn/Library_Management_System/internal/loans"
 )
 
-func ConsumeReservations(ch *amqp.Channel, loanService *loans.Service) error {
+// ConsumeReservations declares the retry topology and registers the
+// reservation worker; the client starts it again after every reconnect.
+func ConsumeReservations(client *Client, loanService *loans.Service, policy RetryPolicy) error {
+	if err := client.DeclareTopology(policy.declare); err != nil {
+		return err
+	}
+	return client.Consume("reservations", func(ch *amqp.Channel) error {
+		return consumeReservations(ch, loanService, policy)
+	})
+}
+
+// consumerTag names the consumer after the process, so the consumers of
+// several instances can be told apart in the broker.
+func consumerTag(name string) string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%s-%d", name, host, os.Getpid())
+}
+
+func consumeReservations(ch *amqp.Channel, loanService *loans.Service, policy RetryPolicy) error {
 	msgs, err := ch.Consume(
-		"reserve_requests", // queue name
-		"loans-worker-1", // consumer tag
+		ReserveQueue, // queue name
+		consumerTag("loans-worker"), // consumer tag
 		false, // auto-ack
 		false, // exclusive
 		false, // no-local
@@ -25,19 +48,51 @@ func ConsumeReservations(ch *amqp.Channel, loanService *loans.Service) error {
 		for d := range msgs {
 			var req ReserveMessage
 			if err := json.Unmarshal(d.Body, &req); err != nil {
-				log.Printf("invalid message: %v", err)
-				_ = d.Nack(false, false) 
+				log.Printf("invalid message %s: %v", d.MessageId, err)
+				if _, perr := policy.fail(ch, d, ClassPermanent, err); perr != nil {
+					log.Printf("dead-letter message %s: %v", d.MessageId, perr)
+					continue
+				}
+				if err := loanService.RequestFailed(context.Background(), requestID(d), err, ClassPermanent, true, attempts(d.Headers)+1); err != nil {
+					log.Printf("record request %s: %v", requestID(d), err)
+				}
 				continue
 			}
 
-			if err := loanService.ReserveBook(context.Background(), req.UserID, req.BookID); err != nil {
-				log.Printf("reserve failed (user=%d book=%d): %v", req.UserID, req.BookID, err)
-				_ = d.Nack(false, false)
-			} else {
-				_ = d.Ack(false)
+			id := requestID(d)
+			res, err := loanService.ProcessRequest(context.Background(), d.MessageId, id, req.UserID, req.BookID)
+			if err != nil {
+				class := Classify(err)
+				n := attempts(d.Headers) + 1
+				queue, perr := policy.fail(ch, d, class, err)
+				log.Printf("reserve failed (user=%d book=%d attempt=%d class=%s): %v; moved to %s",
+					req.UserID, req.BookID, n, class, err, queue)
+				if perr != nil {
+					log.Printf("republish message %s: %v", d.MessageId, perr)
+					continue // requeued, tried again as is
+				}
+				if err := loanService.RequestFailed(context.Background(), id, err, class, queue == DeadQueue, n); err != nil {
+					log.Printf("record request %s: %v", id, err)
+				}
+				continue
+			}
+			if res == nil {
+				log.Printf("message %s already processed, skipped", d.MessageId)
+			} else if res.Hold != nil {
+				log.Printf("no copy free, user=%d queued for book=%d at position %d", req.UserID, req.BookID, res.Hold.Position)
 			}
+			_ = d.Ack(false)
 		}
 	}()
 
 	return nil
 }
+
+// requestID is the reservation request a message belongs to; messages
+// queued before requests were tracked carry none.
+func requestID(d amqp.Delivery) string {
+	if d.CorrelationId != "" {
+		return d.CorrelationId
+	}
+	return d.MessageId
+}
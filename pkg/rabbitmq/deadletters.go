@@ -0,0 +1,147 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// MaxInspect bounds how many dead letters one call reads.
+const MaxInspect = 1000
+
+// DeadLetter is a reservation request in DeadQueue.
+type DeadLetter struct {
+	MessageID string    `json:"message_id"`
+	UserID    uint      `json:"user_id"`
+	BookID    uint      `json:"book_id"`
+	Attempts  int       `json:"attempts"`
+	Class     string    `json:"class"`
+	Error     string    `json:"error"`
+	FailedAt  string    `json:"failed_at,omitempty"`
+	QueuedAt  time.Time `json:"queued_at,omitempty"`
+	Body      string    `json:"body,omitempty"` // only when it is not a valid request
+}
+
+func deadLetterOf(d amqp.Delivery) DeadLetter {
+	dl := DeadLetter{
+		MessageID: d.MessageId,
+		Attempts:  attempts(d.Headers),
+		QueuedAt:  d.Timestamp,
+	}
+	dl.Class, _ = d.Headers[HeaderErrorClass].(string)
+	dl.Error, _ = d.Headers[HeaderError].(string)
+	dl.FailedAt, _ = d.Headers[HeaderFailedAt].(string)
+	var req ReserveMessage
+	if err := json.Unmarshal(d.Body, &req); err != nil {
+		dl.Body = string(d.Body)
+	} else {
+		dl.UserID, dl.BookID = req.UserID, req.BookID
+	}
+	return dl
+}
+
+// withChannel runs fn on a short-lived channel of the current connection.
+// Deliveries fn gets but does not acknowledge go back to their queue when
+// the channel closes.
+func (c *Client) withChannel(fn func(ch *amqp.Channel) error) error {
+	c.mu.RLock()
+	conn := c.conn
+	c.mu.RUnlock()
+	if conn == nil {
+		return ErrNotConnected
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+	return fn(ch)
+}
+
+// scanDeadLetters gets up to limit dead letters and passes each to fn,
+// which acknowledges it or leaves it in the queue.
+func (c *Client) scanDeadLetters(limit int, fn func(ch *amqp.Channel, d amqp.Delivery) error) error {
+	if limit <= 0 || limit > MaxInspect {
+		limit = MaxInspect
+	}
+	return c.withChannel(func(ch *amqp.Channel) error {
+		for i := 0; i < limit; i++ {
+			d, ok, err := ch.Get(DeadQueue, false)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return nil
+			}
+			if err := fn(ch, d); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeadLetters lists dead letters without removing them.
+func (c *Client) DeadLetters(limit int) ([]DeadLetter, error) {
+	list := []DeadLetter{}
+	err := c.scanDeadLetters(limit, func(_ *amqp.Channel, d amqp.Delivery) error {
+		list = append(list, deadLetterOf(d))
+		return nil
+	})
+	return list, err
+}
+
+func selected(ids []string) func(id string) bool {
+	if len(ids) == 0 {
+		return func(string) bool { return true }
+	}
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return func(id string) bool { return set[id] }
+}
+
+// ReplayDeadLetters sends the given dead letters (all when ids is empty)
+// back to ReserveQueue with a fresh attempt count.
+func (c *Client) ReplayDeadLetters(ids []string) (int, error) {
+	want := selected(ids)
+	n := 0
+	err := c.scanDeadLetters(MaxInspect, func(ch *amqp.Channel, d amqp.Delivery) error {
+		if !want(d.MessageId) {
+			return nil
+		}
+		headers := copyHeaders(d.Headers)
+		delete(headers, HeaderAttempts)
+		headers["x-replayed-at"] = time.Now().UTC().Format(time.RFC3339)
+		if err := ch.Publish("", ReserveQueue, false, false, amqp.Publishing{
+			Headers:       headers,
+			ContentType:   d.ContentType,
+			DeliveryMode:  amqp.Persistent,
+			MessageId:     d.MessageId,
+			CorrelationId: d.CorrelationId,
+			Timestamp:     d.Timestamp,
+			Body:          d.Body,
+		}); err != nil {
+			return err
+		}
+		n++
+		return d.Ack(false)
+	})
+	return n, err
+}
+
+// DiscardDeadLetters removes the given dead letters for good.
+func (c *Client) DiscardDeadLetters(ids []string) (int, error) {
+	want := selected(ids)
+	n := 0
+	err := c.scanDeadLetters(MaxInspect, func(_ *amqp.Channel, d amqp.Delivery) error {
+		if !want(d.MessageId) {
+			return nil
+		}
+		n++
+		return d.Ack(false)
+	})
+	return n, err
+}
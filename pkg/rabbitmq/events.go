@@ -0,0 +1,120 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/erfnzmn/Library_Management_System/internal/outbox"
+	"github.com/streadway/amqp"
+)
+
+// EventsExchange is the topic exchange domain events are published to,
+// routed by event type (e.g. "loan.returned").
+const EventsExchange = "library.events"
+
+const confirmTimeout = 10 * time.Second
+
+var errConfirmTimeout = errors.New("rabbitmq: timed out waiting for publisher confirms")
+
+func declareEventsExchange(ch *amqp.Channel) error {
+	return ch.ExchangeDeclare(
+		EventsExchange,
+		"topic",
+		true,  // durable
+		false, // auto-delete
+		false, // internal
+		false, // no-wait
+		nil,
+	)
+}
+
+// PublishConfirmed publishes msgs on a channel of its own in confirm mode
+// and waits for the broker; confirmed[i] reports whether msgs[i] was acked.
+// Messages not confirmed may still have been delivered.
+func (c *Client) PublishConfirmed(ctx context.Context, exchange string, keys []string, msgs []amqp.Publishing) ([]bool, error) {
+	c.mu.RLock()
+	conn := c.conn
+	c.mu.RUnlock()
+	if conn == nil {
+		return nil, ErrNotConnected
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	defer ch.Close()
+	if err := ch.Confirm(false); err != nil {
+		return nil, err
+	}
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation, len(msgs)))
+
+	published := len(msgs)
+	var pubErr error
+	for i, msg := range msgs {
+		if pubErr = ch.Publish(exchange, keys[i], false, false, msg); pubErr != nil {
+			published = i
+			break
+		}
+	}
+
+	confirmed := make([]bool, len(msgs))
+	timeout := time.NewTimer(confirmTimeout)
+	defer timeout.Stop()
+	for i := 0; i < published; i++ {
+		select {
+		case conf, ok := <-confirms:
+			if !ok {
+				return confirmed, ErrNotConnected
+			}
+			// delivery tags count from 1 on a fresh channel
+			if tag := int(conf.DeliveryTag); tag >= 1 && tag <= published {
+				confirmed[tag-1] = conf.Ack
+			}
+		case <-timeout.C:
+			return confirmed, errConfirmTimeout
+		case <-ctx.Done():
+			return confirmed, ctx.Err()
+		}
+	}
+	return confirmed, pubErr
+}
+
+// EventPublisher relays the outbox to EventsExchange.
+type EventPublisher struct {
+	client *Client
+}
+
+// NewEventPublisher declares the events exchange, also on every reconnect.
+func NewEventPublisher(client *Client) (*EventPublisher, error) {
+	if err := client.DeclareTopology(declareEventsExchange); err != nil {
+		return nil, err
+	}
+	return &EventPublisher{client: client}, nil
+}
+
+func (p *EventPublisher) PublishEvents(ctx context.Context, events []outbox.Event) ([]bool, error) {
+	keys := make([]string, len(events))
+	msgs := make([]amqp.Publishing, len(events))
+	for i, ev := range events {
+		body, err := json.Marshal(ev)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = ev.Type
+		msgs[i] = amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			MessageId:    ev.EventID,
+			Type:         ev.Type,
+			Timestamp:    ev.OccurredAt,
+			Headers: amqp.Table{
+				"aggregate_type": ev.AggregateType,
+				"aggregate_id":   int64(ev.AggregateID),
+			},
+			Body: body,
+		}
+	}
+	return p.client.PublishConfirmed(ctx, EventsExchange, keys, msgs)
+}
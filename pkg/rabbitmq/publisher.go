@@ -1,29 +1,40 @@
 package rabbitmq
 
 import (
-	"github.com/streadway/amqp"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"time"
+
+	"github.com/streadway/amqp"
 )
+
 type ReserveMessage struct {
 	UserID uint `json:"user_id"`
 	BookID uint `json:"book_id"`
 }
 
-func PublishReservation(ch *amqp.Channel, msg ReserveMessage) error {
+func PublishReservation(c *Client, msg ReserveMessage) error {
 	body, err := json.Marshal(msg)
 	if err != nil {
 		return err
 	}
 
-	return ch.Publish(
+	return c.Publish(
 		"",
-		"reserve_requests",
-		false, // mandatory
-		false, // immediate
+		ReserveQueue,
 		amqp.Publishing{
-			ContentType: "application/json",
+			ContentType:  "application/json",
 			DeliveryMode: amqp.Persistent,
-			Body:        body,
+			MessageId:    newMessageID(),
+			Timestamp:    time.Now().UTC(),
+			Body:         body,
 		},
 	)
-}
\ No newline at end of file
+}
+
+func newMessageID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
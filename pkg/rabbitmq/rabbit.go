@@ -1,48 +1,291 @@
 package rabbitmq
 
 import (
-	"github.com/streadway/amqp"
+	"errors"
 	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
 )
 
-type Client struct{
-	Conn *amqp.Connection
-	Channel *amqp.Channel
+// ErrNotConnected is returned by Publish while the broker is unreachable.
+var ErrNotConnected = errors.New("rabbitmq: not connected")
+
+// Connection states reported by Status.
+const (
+	StateConnected    = "connected"
+	StateReconnecting = "reconnecting"
+	StateClosed       = "closed"
+)
+
+// ReserveQueue receives the reservation requests of the loans module.
+const ReserveQueue = "reserve_requests"
+
+// Client owns the broker connection. When the connection or one of its
+// channels closes unexpectedly it reconnects with exponential backoff,
+// declares the topology again and restarts the registered consumers, so
+// publishers and consumers survive a broker restart.
+type Client struct {
+	url string
+
+	mu         sync.RWMutex
+	conn       *amqp.Connection
+	ch         *amqp.Channel // publishing channel
+	pubMu      sync.Mutex    // amqp.Channel must not publish concurrently
+	state      string
+	since      time.Time
+	lastErr    error
+	reconnects int
+	topology   []func(ch *amqp.Channel) error
+	consumers  []consumer
+
+	minBackoff, maxBackoff time.Duration
+	done                   chan struct{}
 }
 
+// consumer is started on a channel of its own after every (re)connect; it
+// must return once its deliveries channel is closed.
+type consumer struct {
+	name  string
+	start func(ch *amqp.Channel) error
+}
+
+// Status is exposed on the health endpoint.
+type Status struct {
+	State      string    `json:"state"`
+	Since      time.Time `json:"since"`
+	LastError  string    `json:"last_error,omitempty"`
+	Reconnects int       `json:"reconnects"`
+}
+
+// NewRabbitMQ dials the broker and declares the reservation queue. The
+// first dial must succeed; later connection losses are recovered from.
 func NewRabbitMQ(url string) (*Client, error) {
-	conn, err := amqp.Dial(url)
-	if err != nil {
-		return nil, err
+	c := &Client{
+		url:        url,
+		minBackoff: 500 * time.Millisecond,
+		maxBackoff: 30 * time.Second,
+		done:       make(chan struct{}),
 	}
-
-	ch, err := conn.Channel()
-	if err != nil{
-		conn.Close()
+	c.DeclareTopology(declareReserveQueue)
+	if err := c.connect(); err != nil {
 		return nil, err
 	}
-	_, err = ch.QueueDeclare(
-		"reserve_requests",
-		true, // durable
+	log.Println("🐇 RabbitMQ connected and queue ready")
+	return c, nil
+}
+
+// declareReserveQueue declares the shared work queue: durable and not
+// exclusive, so it survives reconnects and every instance can consume it.
+func declareReserveQueue(ch *amqp.Channel) error {
+	_, err := ch.QueueDeclare(
+		ReserveQueue,
+		true,  // durable
 		false, // auto-delete
-		true, // exclusive
+		false, // exclusive
 		false, // no-wait
-		nil, //args
+		nil,   //args
 	)
+	return err
+}
+
+// DeclareTopology adds queues, exchanges or bindings to declare on every
+// connect; it runs at once when already connected.
+func (c *Client) DeclareTopology(fn func(ch *amqp.Channel) error) error {
+	c.mu.Lock()
+	c.topology = append(c.topology, fn)
+	ch := c.ch
+	c.mu.Unlock()
+	if ch != nil {
+		return fn(ch)
+	}
+	return nil
+}
+
+// Consume registers a consumer and starts it; it is started again on a new
+// channel after each reconnect.
+func (c *Client) Consume(name string, start func(ch *amqp.Channel) error) error {
+	c.mu.Lock()
+	cons := consumer{name: name, start: start}
+	c.consumers = append(c.consumers, cons)
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		return nil // started once connected
+	}
+	return startConsumer(conn, cons)
+}
+
+// startConsumer opens a channel for the consumer. A channel failing on its
+// own (e.g. the queue was deleted) closes the connection so that
+// everything is recovered together.
+func startConsumer(conn *amqp.Connection, cons consumer) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	if err := cons.start(ch); err != nil {
+		_ = ch.Close()
+		return err
+	}
+	closed := ch.NotifyClose(make(chan *amqp.Error, 1))
+	go func() {
+		if reason := <-closed; reason != nil {
+			log.Printf("rabbitmq: consumer %s channel closed: %v", cons.name, reason)
+			_ = conn.Close()
+		}
+	}()
+	return nil
+}
+
+// connect dials, declares the topology and starts the consumers, then
+// watches the connection in the background.
+func (c *Client) connect() error {
+	conn, err := amqp.Dial(c.url)
+	if err != nil {
+		return err
+	}
+	ch, err := conn.Channel()
 	if err != nil {
 		conn.Close()
-		return nil, err
+		return err
 	}
 
-	log.Println("🐇 RabbitMQ connected and queue ready")
-	return &Client{Conn: conn, Channel: ch}, nil
+	c.mu.Lock()
+	topology := append([]func(*amqp.Channel) error(nil), c.topology...)
+	consumers := append([]consumer(nil), c.consumers...)
+	c.mu.Unlock()
+
+	for _, fn := range topology {
+		if err := fn(ch); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	for _, cons := range consumers {
+		if err := startConsumer(conn, cons); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	chClosed := ch.NotifyClose(make(chan *amqp.Error, 1))
+
+	c.mu.Lock()
+	if c.state == StateClosed {
+		c.mu.Unlock()
+		conn.Close()
+		return ErrNotConnected
+	}
+	c.conn, c.ch = conn, ch
+	c.state, c.since, c.lastErr = StateConnected, time.Now(), nil
+	c.mu.Unlock()
+
+	go c.watch(conn, connClosed, chClosed)
+	return nil
+}
+
+func (c *Client) watch(conn *amqp.Connection, connClosed, chClosed chan *amqp.Error) {
+	var reason *amqp.Error
+	select {
+	case <-c.done:
+		return
+	case reason = <-connClosed:
+	case reason = <-chClosed:
+	}
+	// a nil reason is a clean close: ours from Close(), or one made to
+	// recover from a failed channel
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+
+	_ = conn.Close() // a failed publishing channel takes the connection down too
+	c.mu.Lock()
+	c.conn, c.ch = nil, nil
+	c.state, c.since = StateReconnecting, time.Now()
+	if reason != nil {
+		c.lastErr = reason
+	}
+	c.mu.Unlock()
+	log.Printf("rabbitmq: connection lost (%v), reconnecting", reason)
+	c.reconnect()
+}
+
+// reconnect retries with exponential backoff and jitter until it succeeds
+// or the client is closed.
+func (c *Client) reconnect() {
+	delay := c.minBackoff
+	for attempt := 1; ; attempt++ {
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay)))
+		select {
+		case <-c.done:
+			return
+		case <-time.After(wait):
+		}
+		err := c.connect()
+		if err == nil {
+			c.mu.Lock()
+			c.reconnects++
+			c.mu.Unlock()
+			log.Printf("rabbitmq: reconnected after %d attempt(s)", attempt)
+			return
+		}
+		c.mu.Lock()
+		c.lastErr = err
+		c.mu.Unlock()
+		log.Printf("rabbitmq: reconnect attempt %d failed: %v", attempt, err)
+		if delay *= 2; delay > c.maxBackoff {
+			delay = c.maxBackoff
+		}
+	}
+}
+
+// Publish sends a message on the current connection.
+func (c *Client) Publish(exchange, key string, msg amqp.Publishing) error {
+	c.mu.RLock()
+	ch := c.ch
+	c.mu.RUnlock()
+	if ch == nil {
+		return ErrNotConnected
+	}
+	c.pubMu.Lock()
+	defer c.pubMu.Unlock()
+	return ch.Publish(exchange, key, false, false, msg)
+}
+
+func (c *Client) Connected() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.state == StateConnected
+}
+
+func (c *Client) Status() Status {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	s := Status{State: c.state, Since: c.since, Reconnects: c.reconnects}
+	if c.lastErr != nil {
+		s.LastError = c.lastErr.Error()
+	}
+	return s
 }
 
-func (r *Client) Close() {
-	if r.Channel != nil {
-		_ = r.Channel.Close()
+func (c *Client) Close() {
+	c.mu.Lock()
+	if c.state == StateClosed {
+		c.mu.Unlock()
+		return
 	}
-	if r.Conn != nil {
-		_ = r.Conn.Close()
+	close(c.done)
+	conn := c.conn
+	c.conn, c.ch = nil, nil
+	c.state, c.since = StateClosed, time.Now()
+	c.mu.Unlock()
+	if conn != nil {
+		_ = conn.Close()
 	}
 }
@@ -0,0 +1,141 @@
+package rabbitmq
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/erfnzmn/Library_Management_System/internal/loans"
+	"github.com/erfnzmn/Library_Management_System/internal/users"
+	"github.com/streadway/amqp"
+)
+
+// DeadQueue keeps reservation requests that failed for good, for staff to
+// inspect and replay.
+const DeadQueue = ReserveQueue + ".dead"
+
+// Headers carried by retried and dead-lettered messages.
+const (
+	HeaderAttempts   = "x-attempts" // failed attempts so far
+	HeaderError      = "x-error"
+	HeaderErrorClass = "x-error-class"
+	HeaderFailedAt   = "x-failed-at"
+)
+
+// Error classes of a failed reservation request.
+const (
+	// ClassTransient failures (database down, timeouts) are retried
+	ClassTransient = "transient"
+	// ClassRejected requests broke a lending rule (no stock, over limit,
+	// blocked, already reserved); replaying may work once that changes
+	ClassRejected = "rejected"
+	// ClassPermanent requests can never succeed (malformed, unknown book
+	// or user)
+	ClassPermanent = "permanent"
+)
+
+// Classify sorts a ReserveBook error; unknown errors count as transient.
+func Classify(err error) string {
+	switch {
+	case errors.Is(err, loans.ErrBookNotFound), errors.Is(err, loans.ErrUserNotFound), errors.Is(err, users.ErrUserNotFound):
+		return ClassPermanent
+	case errors.Is(err, loans.ErrNoStockAvailable), errors.Is(err, loans.ErrAlreadyReserved),
+		errors.Is(err, loans.ErrOverLimit), errors.Is(err, loans.ErrUserBlocked):
+		return ClassRejected
+	}
+	return ClassTransient
+}
+
+// RetryPolicy says how often and how late transient failures are retried.
+// Attempt n waits Delays[n-1] (the last delay once past the end), in a
+// queue of its own whose TTL hands the message back to ReserveQueue.
+type RetryPolicy struct {
+	Delays      []time.Duration
+	MaxAttempts int
+}
+
+// DefaultRetryPolicy backs off exponentially: 5s, 20s, 80s, 320s.
+var DefaultRetryPolicy = RetryPolicy{
+	Delays:      []time.Duration{5 * time.Second, 20 * time.Second, 80 * time.Second, 320 * time.Second},
+	MaxAttempts: 5,
+}
+
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	if attempt > len(p.Delays) {
+		attempt = len(p.Delays)
+	}
+	return p.Delays[attempt-1]
+}
+
+func retryQueue(delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%s", ReserveQueue, delay)
+}
+
+// declare creates the retry queues and the dead-letter queue.
+func (p RetryPolicy) declare(ch *amqp.Channel) error {
+	for _, d := range p.Delays {
+		_, err := ch.QueueDeclare(retryQueue(d), true, false, false, false, amqp.Table{
+			"x-message-ttl":             d.Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": ReserveQueue,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	_, err := ch.QueueDeclare(DeadQueue, true, false, false, false, nil)
+	return err
+}
+
+// attempts reads the failed attempt count of a delivery.
+func attempts(h amqp.Table) int {
+	switch v := h[HeaderAttempts].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
+
+// copyHeaders returns a copy of h to be changed for a republished message.
+func copyHeaders(h amqp.Table) amqp.Table {
+	out := amqp.Table{}
+	for k, v := range h {
+		out[k] = v
+	}
+	return out
+}
+
+// fail handles a failed delivery: transient errors go to the retry queue
+// for the attempt, the rest, and those out of attempts, to DeadQueue. The
+// delivery is acknowledged only once it has been republished.
+func (p RetryPolicy) fail(ch *amqp.Channel, d amqp.Delivery, class string, cause error) (string, error) {
+	n := attempts(d.Headers) + 1
+	headers := copyHeaders(d.Headers)
+	headers[HeaderAttempts] = int32(n)
+	headers[HeaderError] = cause.Error()
+	headers[HeaderErrorClass] = class
+	headers[HeaderFailedAt] = time.Now().UTC().Format(time.RFC3339)
+
+	queue := DeadQueue
+	if class == ClassTransient && n < p.MaxAttempts && len(p.Delays) > 0 {
+		queue = retryQueue(p.delay(n))
+	}
+	msg := amqp.Publishing{
+		Headers:       headers,
+		ContentType:   d.ContentType,
+		DeliveryMode:  amqp.Persistent,
+		MessageId:     d.MessageId,
+		CorrelationId: d.CorrelationId,
+		Timestamp:     d.Timestamp,
+		Body:          d.Body,
+	}
+	if err := ch.Publish("", queue, false, false, msg); err != nil {
+		_ = d.Nack(false, true) // keep it rather than lose it
+		return queue, err
+	}
+	return queue, d.Ack(false)
+}
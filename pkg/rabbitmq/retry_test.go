@@ -0,0 +1,71 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/erfnzmn/Library_Management_System/internal/loans"
+	"github.com/erfnzmn/Library_Management_System/internal/users"
+	"github.com/streadway/amqp"
+)
+
+func TestClassify(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want string
+	}{
+		{loans.ErrBookNotFound, ClassPermanent},
+		{loans.ErrUserNotFound, ClassPermanent},
+		{users.ErrUserNotFound, ClassPermanent},
+		{fmt.Errorf("reserve: %w", loans.ErrBookNotFound), ClassPermanent},
+		{loans.ErrNoStockAvailable, ClassRejected},
+		{loans.ErrAlreadyReserved, ClassRejected},
+		{loans.ErrOverLimit, ClassRejected},
+		{loans.ErrUserBlocked, ClassRejected},
+		{fmt.Errorf("reserve book 7: %w", loans.ErrOverLimit), ClassRejected},
+		{errors.Join(errors.New("db"), loans.ErrNoStockAvailable), ClassRejected},
+		{context.DeadlineExceeded, ClassTransient},
+		{errors.New("dial tcp: connection refused"), ClassTransient},
+	} {
+		if got := Classify(tt.err); got != tt.want {
+			t.Errorf("Classify(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	p := DefaultRetryPolicy
+	for _, tt := range []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 5 * time.Second},
+		{2, 20 * time.Second},
+		{4, 320 * time.Second},
+		{9, 320 * time.Second}, // the last delay once past the end
+	} {
+		if got := p.delay(tt.attempt); got != tt.want {
+			t.Errorf("delay(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestAttempts(t *testing.T) {
+	for _, tt := range []struct {
+		headers amqp.Table
+		want    int
+	}{
+		{nil, 0},
+		{amqp.Table{HeaderAttempts: int32(2)}, 2},
+		{amqp.Table{HeaderAttempts: int64(3)}, 3},
+		{amqp.Table{HeaderAttempts: 4}, 4},
+		{amqp.Table{HeaderAttempts: "5"}, 0},
+	} {
+		if got := attempts(tt.headers); got != tt.want {
+			t.Errorf("attempts(%v) = %d, want %d", tt.headers, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,468 @@
+// Package tests holds integration tests that need a real MySQL database.
+// They are skipped unless TEST_DB_DSN points at a scratch database, e.g.
+//
+//	TEST_DB_DSN='root:pass@tcp(localhost:3306)/library_test?parseTime=true' go test ./tests/
+//
+// The schema is created with AutoMigrate; every test creates its own book,
+// copies and users and deletes them afterwards. Never point it at
+// production data.
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	books "github.com/erfnzmn/Library_Management_System/internal/books"
+	"github.com/erfnzmn/Library_Management_System/internal/loans"
+	"github.com/erfnzmn/Library_Management_System/internal/promotions"
+	"github.com/erfnzmn/Library_Management_System/internal/sales"
+	"github.com/erfnzmn/Library_Management_System/internal/users"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const workers = 40
+
+var (
+	dbOnce sync.Once
+	testDB *gorm.DB
+	dbErr  error
+)
+
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DB_DSN is not set")
+	}
+	dbOnce.Do(func() {
+		testDB, dbErr = gorm.Open(mysql.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+		if dbErr != nil {
+			return
+		}
+		if sqlDB, err := testDB.DB(); err == nil {
+			sqlDB.SetMaxOpenConns(workers + 10)
+		}
+		dbErr = testDB.AutoMigrate(
+			&users.User{},
+			&books.Book{}, &books.BookCopy{},
+			&loans.Loan{}, &loans.Hold{},
+			&sales.Cart{}, &sales.CartItem{}, &sales.Order{}, &sales.OrderItem{}, &sales.OrderCopy{}, &sales.OrderDiscount{},
+			&promotions.Promotion{}, &promotions.Redemption{},
+		)
+	})
+	if dbErr != nil {
+		t.Fatal(dbErr)
+	}
+	return testDB
+}
+
+type fixture struct {
+	db    *gorm.DB
+	books *books.Repository
+	book  *books.Book
+	users []uint
+}
+
+// newFixture creates a book with lendable available copies and forSale
+// copies for sale, and workers users.
+func newFixture(t *testing.T, lendable, forSale int) *fixture {
+	t.Helper()
+	db := openDB(t)
+	ctx := context.Background()
+	fx := &fixture{db: db, books: books.NewRepository(db)}
+	t.Cleanup(fx.cleanup)
+
+	tag := strconv.FormatInt(time.Now().UnixMicro(), 10)
+	fx.book = &books.Book{Title: "stock test " + tag, Author: "test", ISBN: "T" + tag, Price: 10, Version: 1}
+	if err := fx.books.CreateBook(ctx, fx.book); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < lendable+forSale; i++ {
+		status := books.CopyStatusAvailable
+		if i >= lendable {
+			status = books.CopyStatusForSale
+		}
+		bc := &books.BookCopy{BookID: fx.book.ID, Barcode: fmt.Sprintf("T%s-%d", tag, i), Status: status}
+		if err := fx.books.CreateCopy(ctx, bc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fx.books.SyncAvailability(ctx, fx.book.ID); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < workers; i++ {
+		u := users.User{
+			Name:         fmt.Sprintf("stock test %d", i),
+			Email:        fmt.Sprintf("stock-%s-%d@example.invalid", tag, i),
+			PasswordHash: "!",
+			Role:         "member",
+		}
+		if err := db.Create(&u).Error; err != nil {
+			t.Fatal(err)
+		}
+		fx.users = append(fx.users, u.ID)
+	}
+	return fx
+}
+
+func (fx *fixture) cleanup() {
+	if fx.book == nil {
+		return
+	}
+	id := fx.book.ID
+	for _, q := range []struct {
+		sql  string
+		args []any
+	}{
+		{"DELETE oc FROM order_copies oc JOIN order_items oi ON oi.id = oc.order_item_id WHERE oi.book_id = ?", []any{id}},
+		{"DELETE FROM order_items WHERE book_id = ?", []any{id}},
+		{"DELETE FROM order_discounts WHERE order_id IN (SELECT id FROM orders WHERE user_id IN ?)", []any{fx.users}},
+		{"DELETE FROM orders WHERE user_id IN ?", []any{fx.users}},
+		{"DELETE FROM cart_items WHERE book_id = ?", []any{id}},
+		{"DELETE FROM carts WHERE user_id IN ?", []any{fx.users}},
+		{"DELETE FROM holds WHERE book_id = ?", []any{id}},
+		{"DELETE FROM loans WHERE book_id = ?", []any{id}},
+		{"DELETE FROM book_copies WHERE book_id = ?", []any{id}},
+		{"DELETE FROM books WHERE id = ?", []any{id}},
+		{"DELETE FROM users WHERE id IN ?", []any{fx.users}},
+	} {
+		if len(fx.users) == 0 && len(q.args) == 1 {
+			if _, ok := q.args[0].([]uint); ok {
+				continue
+			}
+		}
+		if err := fx.db.Exec(q.sql, q.args...).Error; err != nil {
+			fmt.Fprintf(os.Stderr, "cleanup: %s: %v\n", q.sql, err)
+		}
+	}
+}
+
+// race runs fn once per user, all starting together.
+func (fx *fixture) race(fn func(userID uint)) {
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for _, id := range fx.users {
+		wg.Add(1)
+		go func(id uint) {
+			defer wg.Done()
+			<-start
+			fn(id)
+		}(id)
+	}
+	close(start)
+	wg.Wait()
+}
+
+func (fx *fixture) copies(t *testing.T) map[string]int {
+	t.Helper()
+	var rows []struct {
+		Status string
+		N      int
+	}
+	if err := fx.db.Model(&books.BookCopy{}).
+		Select("status, COUNT(*) AS n").
+		Where("book_id = ?", fx.book.ID).
+		Group("status").
+		Scan(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	out := map[string]int{}
+	for _, r := range rows {
+		out[r.Status] = r.N
+	}
+	return out
+}
+
+// checkStock asserts that the counters on the book match its copies and
+// are not negative.
+func (fx *fixture) checkStock(t *testing.T) map[string]int {
+	t.Helper()
+	book, err := fx.books.GetBookByID(context.Background(), fx.book.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copies := fx.copies(t)
+	if book.Stock < 0 || book.SaleStock < 0 {
+		t.Errorf("negative stock: stock %d, sale stock %d", book.Stock, book.SaleStock)
+	}
+	if book.Stock != copies[books.CopyStatusAvailable] {
+		t.Errorf("stock %d, %d copies available", book.Stock, copies[books.CopyStatusAvailable])
+	}
+	if book.SaleStock != copies[books.CopyStatusForSale] {
+		t.Errorf("sale stock %d, %d copies for sale", book.SaleStock, copies[books.CopyStatusForSale])
+	}
+	return copies
+}
+
+// checkLoans asserts that every open loan holds its own reserved copy.
+func (fx *fixture) checkLoans(t *testing.T) int {
+	t.Helper()
+	var open []loans.Loan
+	if err := fx.db.Where("book_id = ? AND is_active = ? AND status = ?", fx.book.ID, true, loans.StatusReserved).
+		Find(&open).Error; err != nil {
+		t.Fatal(err)
+	}
+	seen := map[uint]uint{}
+	for _, l := range open {
+		if l.CopyID == nil {
+			t.Errorf("loan %d has no copy", l.ID)
+			continue
+		}
+		if other, dup := seen[*l.CopyID]; dup {
+			t.Errorf("copy %d reserved by loans %d and %d", *l.CopyID, other, l.ID)
+		}
+		seen[*l.CopyID] = l.ID
+		bc, err := fx.books.GetCopyByID(context.Background(), *l.CopyID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bc.Status != books.CopyStatusReserved {
+			t.Errorf("copy %d of loan %d is %s", bc.ID, l.ID, bc.Status)
+		}
+	}
+	return len(open)
+}
+
+func TestConcurrentReservations(t *testing.T) {
+	const lendable = 5
+	fx := newFixture(t, lendable, 0)
+	svc := loans.NewService(fx.db, loans.NewRepository(fx.db), fx.books)
+
+	var mu sync.Mutex
+	loaned, held := 0, 0
+	fx.race(func(userID uint) {
+		res, err := svc.ReserveBook(context.Background(), userID, fx.book.ID)
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case err != nil:
+			t.Errorf("reserve by user %d: %v", userID, err)
+		case res.Loan != nil:
+			loaned++
+		default:
+			held++
+		}
+	})
+
+	if loaned != lendable || held != workers-lendable {
+		t.Errorf("%d loans and %d holds, want %d and %d", loaned, held, lendable, workers-lendable)
+	}
+	if n := fx.checkLoans(t); n != lendable {
+		t.Errorf("%d open loans, want %d", n, lendable)
+	}
+	copies := fx.checkStock(t)
+	if copies[books.CopyStatusReserved] != lendable || copies[books.CopyStatusAvailable] != 0 {
+		t.Errorf("copies %v, want all %d reserved", copies, lendable)
+	}
+}
+
+func TestConcurrentCheckouts(t *testing.T) {
+	const forSale = 5
+	fx := newFixture(t, 0, forSale)
+	repo := sales.NewRepository(fx.db)
+	svc := sales.NewService(fx.db, repo, fx.books)
+	ctx := context.Background()
+
+	for _, id := range fx.users {
+		cart, err := repo.GetOrCreateCart(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.SetCartItem(ctx, cart.ID, fx.book.ID, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var mu sync.Mutex
+	sold, short := 0, 0
+	fx.race(func(userID uint) {
+		_, err := svc.Checkout(ctx, userID)
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case errors.Is(err, sales.ErrInsufficientStock):
+			short++
+		case err != nil:
+			t.Errorf("checkout by user %d: %v", userID, err)
+		default:
+			sold++
+		}
+	})
+
+	if sold != forSale || short != workers-forSale {
+		t.Errorf("%d orders and %d out of stock, want %d and %d", sold, short, forSale, workers-forSale)
+	}
+	copies := fx.checkStock(t)
+	if copies[books.CopyStatusSold] != forSale || copies[books.CopyStatusForSale] != 0 {
+		t.Errorf("copies %v, want all %d sold", copies, forSale)
+	}
+
+	var dup []uint
+	if err := fx.db.Table("order_copies").
+		Joins("JOIN order_items ON order_items.id = order_copies.order_item_id").
+		Where("order_items.book_id = ?", fx.book.ID).
+		Group("order_copies.copy_id").Having("COUNT(*) > 1").
+		Pluck("order_copies.copy_id", &dup).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(dup) > 0 {
+		t.Errorf("copies sold twice: %v", dup)
+	}
+}
+
+// TestRepeatedCheckouts has one user check out the same cart many times at
+// once. Only one order may be placed; the others find the cart empty.
+func TestRepeatedCheckouts(t *testing.T) {
+	const forSale = 5
+	fx := newFixture(t, 0, forSale)
+	repo := sales.NewRepository(fx.db)
+	svc := sales.NewService(fx.db, repo, fx.books)
+	ctx := context.Background()
+
+	userID := fx.users[0]
+	cart, err := repo.GetOrCreateCart(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SetCartItem(ctx, cart.ID, fx.book.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	placed, empty := 0, 0
+	fx.race(func(uint) {
+		_, err := svc.Checkout(ctx, userID)
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case errors.Is(err, sales.ErrCartEmpty):
+			empty++
+		case err != nil:
+			t.Errorf("checkout: %v", err)
+		default:
+			placed++
+		}
+	})
+
+	if placed != 1 || empty != workers-1 {
+		t.Errorf("%d orders and %d empty carts, want 1 and %d", placed, empty, workers-1)
+	}
+	copies := fx.checkStock(t)
+	if copies[books.CopyStatusSold] != 1 || copies[books.CopyStatusForSale] != forSale-1 {
+		t.Errorf("copies %v, want 1 sold", copies)
+	}
+}
+
+// TestCopyEditsDuringReservations has staff withdraw and restore copies
+// while members reserve them. A reserved copy must never be put back on the
+// shelf or withdrawn by an edit based on an older read.
+func TestCopyEditsDuringReservations(t *testing.T) {
+	const lendable = 10
+	fx := newFixture(t, lendable, 0)
+	loansService := loans.NewService(fx.db, loans.NewRepository(fx.db), fx.books)
+	booksService := books.NewService(fx.books, nil)
+	ctx := context.Background()
+
+	list, err := fx.books.ListCopiesByBook(ctx, fx.book.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	var staff sync.WaitGroup
+	for s := 0; s < 4; s++ {
+		staff.Add(1)
+		go func(s int) {
+			defer staff.Done()
+			for round := 0; ; round++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				bc := list[(s+round)%len(list)]
+				status := books.CopyStatusWithdrawn
+				if round%2 == 1 {
+					status = books.CopyStatusAvailable
+				}
+				edit := books.BookCopy{ID: bc.ID, Barcode: bc.Barcode, Condition: bc.Condition, Status: status}
+				err := booksService.UpdateCopy(ctx, fx.book.ID, &edit)
+				if err != nil && !errors.Is(err, books.ErrCopyInUse) && !errors.Is(err, books.ErrCopyChanged) {
+					t.Errorf("edit of copy %d: %v", bc.ID, err)
+					return
+				}
+			}
+		}(s)
+	}
+
+	var mu sync.Mutex
+	loaned := 0
+	fx.race(func(userID uint) {
+		res, err := loansService.ReserveBook(ctx, userID, fx.book.ID)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			t.Errorf("reserve by user %d: %v", userID, err)
+		} else if res.Loan != nil {
+			loaned++
+		}
+	})
+	close(stop)
+	staff.Wait()
+
+	if n := fx.checkLoans(t); n != loaned {
+		t.Errorf("%d open loans, %d reservations succeeded", n, loaned)
+	}
+	copies := fx.checkStock(t)
+	if copies[books.CopyStatusReserved] != loaned {
+		t.Errorf("%d copies reserved, %d loans", copies[books.CopyStatusReserved], loaned)
+	}
+	total := copies[books.CopyStatusReserved] + copies[books.CopyStatusAvailable] + copies[books.CopyStatusWithdrawn]
+	if total != lendable {
+		t.Errorf("copies %v, want %d in total", copies, lendable)
+	}
+}
+
+func TestConcurrentBookUpdates(t *testing.T) {
+	fx := newFixture(t, 1, 0)
+	svc := books.NewService(fx.books, nil)
+
+	var mu sync.Mutex
+	won, conflicts := 0, 0
+	fx.race(func(userID uint) {
+		b := *fx.book
+		b.Version = 1
+		b.Description = fmt.Sprintf("edited by user %d", userID)
+		err := svc.UpdateBook(context.Background(), &b)
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case errors.Is(err, books.ErrVersionConflict):
+			conflicts++
+		case err != nil:
+			t.Errorf("update by user %d: %v", userID, err)
+		default:
+			won++
+		}
+	})
+
+	if won != 1 || conflicts != workers-1 {
+		t.Errorf("%d updates applied, %d conflicts; want 1 and %d", won, conflicts, workers-1)
+	}
+	book, err := fx.books.GetBookByID(context.Background(), fx.book.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if book.Version != 2 {
+		t.Errorf("version %d, want 2", book.Version)
+	}
+	fx.checkStock(t)
+}